@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/derickit/go-rest-api/internal/config"
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/server"
+	"github.com/derickit/go-rest-api/internal/util"
+)
+
+const (
+	exitCodeOK              = 0
+	exitCodeFailure         = 1
+	exitCodeShutdownTimeout = 2
+	exitCodeUsage           = 64
+
+	exportPageSize = 500
+	importBatch    = 500
+)
+
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+func commands() []command {
+	return []command{
+		{name: "serve", summary: "serve the orders API", run: serveCmd},
+		{name: "migrate", summary: "apply pending index and schema migrations", run: migrateCmd},
+		{name: "seed", summary: "populate the database with random orders", run: seedCmd},
+		{name: "export", summary: "write all orders as JSON lines", run: exportCmd},
+		{name: "import", summary: "read orders as JSON lines, orders with the same id are replaced", run: importCmd},
+		{name: "config", summary: "config check: validate the configuration without starting", run: configCmd},
+		{name: "version", summary: "print build information", run: versionCmd},
+	}
+}
+
+// runCLI runs the subcommand named by the first argument and returns the process exit code.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return exitCodeUsage
+		}
+		return exitCodeOK
+	}
+	for _, cmd := range commands() {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(args[1:], stdout)
+		switch {
+		case err == nil:
+			return exitCodeOK
+		case errors.Is(err, flag.ErrHelp):
+			return exitCodeOK
+		case errors.Is(err, errUsage):
+			fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+			return exitCodeUsage
+		case errors.Is(err, server.ErrShutdownTimeout):
+			fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+			return exitCodeShutdownTimeout
+		default:
+			fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+			return exitCodeFailure
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return exitCodeUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", serviceName)
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", serviceName)
+}
+
+// settingFlag is a flag overriding a config.Setting.
+type settingFlag struct {
+	isBool bool
+	value  string
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *settingFlag) Set(v string) error {
+	f.value = v
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// newFlagSet returns the flags of a command including the ones of every config.Setting,
+// the returned config func loads the configuration with the flags that were set.
+func newFlagSet(name string) (*flag.FlagSet, func() (models.ServiceEnv, error)) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", "", "YAML, TOML or JSON config file (env "+config.FileEnv+")")
+	flags := make(map[string]*settingFlag, len(config.Settings))
+	for _, s := range config.Settings {
+		f := &settingFlag{isBool: s.Bool}
+		fs.Var(f, s.Flag, s.Usage+" (env "+s.Env+")")
+		flags[s.Flag] = f
+	}
+	return fs, func() (models.ServiceEnv, error) {
+		set := map[string]string{}
+		fs.Visit(func(f *flag.Flag) {
+			if sf, ok := flags[f.Name]; ok {
+				set[f.Name] = sf.value
+			}
+		})
+		return config.Load(config.Sources{File: *file, Flags: set})
+	}
+}
+
+func parseArgs(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments %v", errUsage, fs.Args())
+	}
+	return nil
+}
+
+func serveCmd(args []string, _ io.Writer) error {
+	fs, loadConfig := newFlagSet("serve")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	svcEnv, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	return run(svcEnv)
+}
+
+// withDB runs f with a database connection that is closed afterwards.
+func withDB(svcEnv models.ServiceEnv, f func(ctx context.Context, database db.MongoDatabase, lgr *logger.AppLogger) error) error {
+	lgr := logger.Setup(svcEnv)
+	dbConnMgr, err := connectDB(svcEnv, lgr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if dErr := dbConnMgr.Disconnect(); dErr != nil {
+			lgr.Error().Err(dErr).Msg("unable to disconnect from db ,potential connection leak")
+		}
+	}()
+	return f(context.Background(), dbConnMgr.Database(), lgr)
+}
+
+func migrateCmd(args []string, stdout io.Writer) error {
+	fs, loadConfig := newFlagSet("migrate")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	svcEnv, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	return withDB(svcEnv, func(ctx context.Context, database db.MongoDatabase, lgr *logger.AppLogger) error {
+		applied, mErr := db.Migrate(ctx, database, db.Migrations, lgr)
+		for _, id := range applied {
+			fmt.Fprintf(stdout, "applied %s\n", id)
+		}
+		if mErr == nil && len(applied) == 0 {
+			fmt.Fprintln(stdout, "database is up to date")
+		}
+		return mErr
+	})
+}
+
+func seedCmd(args []string, stdout io.Writer) error {
+	fs, loadConfig := newFlagSet("seed")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	svcEnv, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	return withDB(svcEnv, func(ctx context.Context, database db.MongoDatabase, lgr *logger.AppLogger) error {
+		if sErr := handlers.SeedOrders(ctx, db.NewOrderRepo(database, lgr), svcEnv.SeedRecordCount); sErr != nil {
+			return sErr
+		}
+		fmt.Fprintf(stdout, "seeded %d orders\n", svcEnv.SeedRecordCount)
+		return nil
+	})
+}
+
+func exportCmd(args []string, stdout io.Writer) error {
+	fs, loadConfig := newFlagSet("export")
+	out := fs.String("out", "", "file to write to, defaults to stdout")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	svcEnv, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	w := stdout
+	if *out != "" {
+		f, fErr := os.Create(*out)
+		if fErr != nil {
+			return fErr
+		}
+		defer f.Close()
+		w = f
+	}
+	return withDB(svcEnv, func(ctx context.Context, database db.MongoDatabase, lgr *logger.AppLogger) error {
+		n, eErr := exportOrders(ctx, db.NewOrderRepo(database, lgr), w)
+		lgr.Info().Int("count", n).Msg("exported orders")
+		return eErr
+	})
+}
+
+// exportOrders writes every order as a JSON line, newest first.
+func exportOrders(ctx context.Context, svc db.OrdersDataService, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	query := &db.OrdersQuery{Limit: exportPageSize}
+	count := 0
+	for {
+		page, err := svc.GetAll(ctx, query)
+		if err != nil {
+			return count, err
+		}
+		for i := range page.Orders {
+			if err = enc.Encode(&page.Orders[i]); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if !page.HasNext || len(page.Orders) == 0 {
+			break
+		}
+		last := page.Orders[len(page.Orders)-1]
+		query = &db.OrdersQuery{Limit: exportPageSize, Cursor: &util.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}}
+	}
+	return count, bw.Flush()
+}
+
+func importCmd(args []string, stdout io.Writer) error {
+	fs, loadConfig := newFlagSet("import")
+	in := fs.String("in", "", "file to read from, defaults to stdin")
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	svcEnv, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, fErr := os.Open(*in)
+		if fErr != nil {
+			return fErr
+		}
+		defer f.Close()
+		r = f
+	}
+	return withDB(svcEnv, func(ctx context.Context, database db.MongoDatabase, lgr *logger.AppLogger) error {
+		n, iErr := importOrders(ctx, db.NewOrderRepo(database, lgr), r)
+		fmt.Fprintf(stdout, "imported %d orders\n", n)
+		return iErr
+	})
+}
+
+type ordersImporter interface {
+	Import(ctx context.Context, orders []data.Order) (int64, error)
+}
+
+// importOrders reads orders as JSON lines, as written by exportOrders, and imports them in batches.
+func importOrders(ctx context.Context, importer ordersImporter, r io.Reader) (int64, error) {
+	dec := json.NewDecoder(r)
+	var imported int64
+	batch := make([]data.Order, 0, importBatch)
+	flush := func() error {
+		n, err := importer.Import(ctx, batch)
+		imported += n
+		batch = batch[:0]
+		return err
+	}
+	for line := 1; ; line++ {
+		var po data.Order
+		err := dec.Decode(&po)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("order %d: %w", line, err)
+		}
+		batch = append(batch, po)
+		if len(batch) == importBatch {
+			if err = flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	return imported, flush()
+}
+
+func configCmd(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "check" {
+		return fmt.Errorf("%w: expected 'config check'", errUsage)
+	}
+	fs, loadConfig := newFlagSet("config check")
+	if err := parseArgs(fs, args[1:]); err != nil {
+		return err
+	}
+	svcEnv, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, err = db.MongoDBCredentialFromSideCar(svcEnv.MongoVaultSideCar); err != nil {
+		return fmt.Errorf("invalid mongo sidecar %s: %w", svcEnv.MongoVaultSideCar, err)
+	}
+	fmt.Fprintf(stdout, "configuration is valid for environment %s\n", svcEnv.Name)
+	return nil
+}
+
+func versionCmd(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	info := map[string]string{
+		"version":   buildVersion(),
+		"commit":    commit,
+		"buildDate": buildDate,
+		"go":        runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" && info["commit"] == "" {
+				info["commit"] = s.Value
+			}
+			if s.Key == "vcs.time" && info["buildDate"] == "" {
+				info["buildDate"] = s.Value
+			}
+		}
+	}
+	keys := make([]string, 0, len(info))
+	for k := range info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(stdout, serviceName)
+	for _, k := range keys {
+		fmt.Fprintf(stdout, "  %-10s %s\n", k, valueOr(info[k], "unknown"))
+	}
+	return nil
+}
+
+// buildVersion is the version set at build time, dev for local builds.
+func buildVersion() string {
+	return valueOr(version, "dev")
+}
+
+func valueOr(v, fallback string) string {
+	if strings.TrimSpace(v) == "" {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/db/mocks"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRunCLI_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitCodeUsage, runCLI(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Commands:")
+
+	stderr.Reset()
+	assert.Equal(t, exitCodeUsage, runCLI([]string{"unknown"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `unknown command "unknown"`)
+
+	stderr.Reset()
+	assert.Equal(t, exitCodeUsage, runCLI([]string{"seed", "--unknown-flag"}, &stdout, &stderr))
+	assert.Equal(t, exitCodeUsage, runCLI([]string{"config"}, &stdout, &stderr))
+}
+
+func TestRunCLI_Version(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitCodeOK, runCLI([]string{"version"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), serviceName)
+	assert.Contains(t, stdout.String(), "go")
+	assert.Empty(t, stderr.String())
+}
+
+func TestRunCLI_ConfigCheck(t *testing.T) {
+	resetEnv(t)
+	t.Setenv("ORDERS_DISABLE_AUTH", "true")
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitCodeFailure, runCLI([]string{"config", "check"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "invalid configuration")
+
+	sideCar := t.TempDir() + "/mongo.json"
+	require.NoError(t, os.WriteFile(sideCar, []byte(`{"host":"localhost","port":"27017"}`), 0o600))
+	stderr.Reset()
+	code := runCLI([]string{"config", "check", "--environment", "test", "--db-name", "orders",
+		"--mongo-sidecar", sideCar}, &stdout, &stderr)
+	assert.Equal(t, exitCodeOK, code, stderr.String())
+	assert.Contains(t, stdout.String(), "environment test")
+}
+
+type fakeImporter struct {
+	batches [][]data.Order
+}
+
+func (f *fakeImporter) Import(_ context.Context, orders []data.Order) (int64, error) {
+	f.batches = append(f.batches, append([]data.Order(nil), orders...))
+	return int64(len(orders)), nil
+}
+
+func TestExportImportOrders(t *testing.T) {
+	orders := []data.Order{
+		{ID: primitive.NewObjectID(), User: "a", Status: data.OrderPending},
+		{ID: primitive.NewObjectID(), User: "b", Status: data.OrderPending},
+	}
+	var queries []*db.OrdersQuery
+	svc := &mocks.MockOrdersDataService{
+		GetAllFunc: func(_ context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
+			queries = append(queries, query)
+			if query.Cursor == nil {
+				return &db.OrdersPage{Orders: orders[:1], HasNext: true}, nil
+			}
+			return &db.OrdersPage{Orders: orders[1:]}, nil
+		},
+	}
+	var buf bytes.Buffer
+	n, err := exportOrders(context.Background(), svc, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.Len(t, queries, 2)
+	assert.Equal(t, orders[0].ID, queries[1].Cursor.ID)
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+
+	importer := &fakeImporter{}
+	imported, err := importOrders(context.Background(), importer, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), imported)
+	require.Len(t, importer.batches, 1)
+	assert.Equal(t, orders[1].ID, importer.batches[0][1].ID)
+
+	_, err = importOrders(context.Background(), importer, strings.NewReader("{not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefJWKSRefreshInterval    = 15 * time.Minute
+	DefJWKSMinRefreshInterval = 30 * time.Second
+	DefJWKSFetchTimeout       = 10 * time.Second
+)
+
+var (
+	ErrNoJWKSSource   = errors.New("jwks source is not configured")
+	ErrFetchJWKS      = errors.New("failed to fetch jwks")
+	ErrInvalidJWKS    = errors.New("invalid jwks")
+	ErrUnknownSignKey = errors.New("token is signed with an unknown key")
+)
+
+// KeyProvider resolves the public key a token was signed with.
+type KeyProvider interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+type JWKSOpts struct {
+	// Source is a JWKS file path or an http(s) URL
+	Source string
+	// RefreshInterval is how long fetched keys are used before they are fetched again
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refetching when tokens carry an unknown key id
+	MinRefreshInterval time.Duration
+	HTTPClient         *http.Client
+}
+
+// JWKSProvider is a KeyProvider reading keys from a JWKS file or URL. Keys are cached and fetched again after
+// RefreshInterval, or earlier when a token refers to an unknown key id, which is how key rotation is picked up.
+// Keys are fetched without holding the lock: stale keys keep verifying tokens until the new set is swapped in and
+// concurrent refreshes share one fetch. When a refresh fails the previously fetched keys stay in use.
+type JWKSProvider struct {
+	opts   JWKSOpts
+	logger *logger.AppLogger
+	group  singleflight.Group
+
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	fetchedAt  time.Time
+	triedAt    time.Time
+	refreshing bool
+}
+
+func NewJWKSProvider(opts JWKSOpts, lgr *logger.AppLogger) *JWKSProvider {
+	if opts.RefreshInterval == 0 {
+		opts.RefreshInterval = DefJWKSRefreshInterval
+	}
+	if opts.MinRefreshInterval == 0 {
+		opts.MinRefreshInterval = DefJWKSMinRefreshInterval
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: DefJWKSFetchTimeout}
+	}
+	return &JWKSProvider{opts: opts, logger: lgr}
+}
+
+func (p *JWKSProvider) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, known := p.lookup(kid)
+	// a token with an unknown key id waits for a refresh that is already running, it may bring the key
+	refresh := p.startRefresh(!known) || (!known && p.refreshing)
+	p.mu.Unlock()
+
+	if refresh && known {
+		// the cached key stays in use while the stale set is fetched again
+		go func() { _ = p.refresh(ctx) }()
+		return key, nil
+	}
+	var err error
+	if refresh {
+		err = p.refresh(ctx)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrFetchJWKS
+	}
+	key, ok := p.lookup(kid)
+	if !ok {
+		return nil, ErrUnknownSignKey
+	}
+	return key, nil
+}
+
+// Check is a health check reporting whether signing keys are available, keys are fetched when none were fetched
+// yet or they are stale.
+func (p *JWKSProvider) Check(ctx context.Context) error {
+	p.mu.Lock()
+	refresh := p.startRefresh(false)
+	p.mu.Unlock()
+	if refresh {
+		if err := p.refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys == nil {
+		return ErrFetchJWKS
+	}
+	return nil
+}
+
+// startRefresh reports whether the keys should be fetched again because they are stale, or because force is set,
+// refetching is limited to once per MinRefreshInterval. p.mu must be held.
+func (p *JWKSProvider) startRefresh(force bool) bool {
+	now := time.Now()
+	stale := now.Sub(p.fetchedAt) > p.opts.RefreshInterval
+	if (stale || force) && now.Sub(p.triedAt) > p.opts.MinRefreshInterval {
+		p.triedAt = now
+		p.refreshing = true
+		return true
+	}
+	return false
+}
+
+// refresh fetches the keys and swaps them in when the fetch succeeds, concurrent callers share one fetch. The fetch
+// is not cancelled with the request that started it, the other callers still wait for it; the HTTP client timeout
+// bounds it.
+func (p *JWKSProvider) refresh(ctx context.Context) error {
+	_, err, _ := p.group.Do(p.opts.Source, func() (any, error) {
+		keys, err := p.fetch(context.WithoutCancel(ctx))
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.refreshing = false
+		if err != nil {
+			p.logger.Error().Err(err).Str("jwksSource", p.opts.Source).Msg("failed to refresh jwks, using cached keys")
+			return nil, err
+		}
+		p.keys, p.fetchedAt = keys, time.Now()
+		return nil, nil
+	})
+	return err
+}
+
+// lookup finds the key by id, a token without key id is accepted when the set holds a single key.
+func (p *JWKSProvider) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *JWKSProvider) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if p.opts.Source == "" {
+		return nil, ErrNoJWKSSource
+	}
+	var raw []byte
+	var err error
+	if strings.HasPrefix(p.opts.Source, "http://") || strings.HasPrefix(p.opts.Source, "https://") {
+		raw, err = p.download(ctx)
+	} else {
+		raw, err = os.ReadFile(strings.TrimPrefix(p.opts.Source, "file://"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetchJWKS, err)
+	}
+	return ParseJWKS(raw)
+}
+
+func (p *JWKSProvider) download(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.opts.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS reads the RSA, EC and Ed25519 signing keys of a JWKS document keyed by their key id,
+// encryption keys and key types that are not supported are skipped.
+func ParseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWKS, err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %w", ErrInvalidJWKS, k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no signing keys", ErrInvalidJWKS)
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
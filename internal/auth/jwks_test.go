@@ -0,0 +1,116 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJWKS(t *testing.T) {
+	keys, err := auth.ParseJWKS([]byte(`{"keys":[
+		{"kty":"OKP","kid":"ed","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"},
+		{"kty":"oct","kid":"secret","k":"c2VjcmV0"}
+	]}`))
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Contains(t, keys, "ed")
+
+	_, err = auth.ParseJWKS([]byte(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	assert.ErrorIs(t, err, auth.ErrInvalidJWKS)
+	_, err = auth.ParseJWKS([]byte(`{"keys":[]}`))
+	assert.ErrorIs(t, err, auth.ErrInvalidJWKS)
+	_, err = auth.ParseJWKS([]byte(`not json`))
+	assert.ErrorIs(t, err, auth.ErrInvalidJWKS)
+}
+
+func TestJWKSProvider_URLIsCached(t *testing.T) {
+	key := newEdKey(t, "ed")
+	path := t.TempDir() + "/jwks.json"
+	writeJWKS(t, path, key)
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write(raw)
+	}))
+	defer srv.Close()
+
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	provider := auth.NewJWKSProvider(auth.JWKSOpts{Source: srv.URL, MinRefreshInterval: time.Hour}, lgr)
+	for i := 0; i < 3; i++ {
+		_, err = provider.Key(context.TODO(), "ed")
+		require.NoError(t, err)
+	}
+	_, err = provider.Key(context.TODO(), "unknown")
+	assert.ErrorIs(t, err, auth.ErrUnknownSignKey)
+	assert.Equal(t, int32(1), fetches.Load(), "unknown key ids should not refetch more often than MinRefreshInterval")
+}
+
+func TestJWKSProvider_Unavailable(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	_, err := auth.NewJWKSProvider(auth.JWKSOpts{}, lgr).Key(context.TODO(), "kid")
+	assert.ErrorIs(t, err, auth.ErrNoJWKSSource)
+
+	_, err = auth.NewJWKSProvider(auth.JWKSOpts{Source: "/does/not/exist.json"}, lgr).Key(context.TODO(), "kid")
+	assert.ErrorIs(t, err, auth.ErrFetchJWKS)
+}
+
+func TestJWKSProvider_Check(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	path := t.TempDir() + "/jwks.json"
+	assert.ErrorIs(t, auth.NewJWKSProvider(auth.JWKSOpts{Source: path}, lgr).Check(context.TODO()), auth.ErrFetchJWKS)
+
+	writeJWKS(t, path, newEdKey(t, "ed"))
+	provider := auth.NewJWKSProvider(auth.JWKSOpts{Source: path}, lgr)
+	require.NoError(t, provider.Check(context.TODO()))
+	_, err := provider.Key(context.TODO(), "ed")
+	assert.NoError(t, err, "keys fetched by the check should be used")
+}
+
+func TestJWKSProvider_StaleKeysServedDuringRefresh(t *testing.T) {
+	path := t.TempDir() + "/jwks.json"
+	writeJWKS(t, path, newEdKey(t, "ed"))
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-unblock
+		}
+		_, _ = w.Write(raw)
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	provider := auth.NewJWKSProvider(auth.JWKSOpts{
+		Source:             srv.URL,
+		RefreshInterval:    time.Millisecond,
+		MinRefreshInterval: time.Millisecond,
+	}, lgr)
+	_, err = provider.Key(context.TODO(), "ed")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	// the refresh of the stale keys hangs, verifying tokens must not wait for it
+	for i := 0; i < 3; i++ {
+		_, err = provider.Key(context.TODO(), "ed")
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, time.Millisecond)
+}
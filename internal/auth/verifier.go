@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const DefLeeway = 30 * time.Second
+
+// SupportedAlgorithms are the token signing algorithms accepted by the Verifier.
+var SupportedAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// TokenVerifier turns a bearer token into the principal it was issued to.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*Principal, error)
+}
+
+type VerifierOpts struct {
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew allowed when checking expiry and not before
+	Leeway time.Duration
+}
+
+// Verifier checks the signature, issuer, audience and expiry of JWTs, expiry is required.
+type Verifier struct {
+	keys   KeyProvider
+	parser *jwt.Parser
+}
+
+func NewVerifier(keys KeyProvider, opts VerifierOpts) *Verifier {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(SupportedAlgorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(opts.Leeway),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	return &Verifier{keys: keys, parser: jwt.NewParser(parserOpts...)}
+}
+
+// tokenClaims are the registered claims plus the OAuth 2 scope claim, either as a space separated string
+// ("scope") or as a list ("scp").
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Scp   []string `json:"scp,omitempty"`
+}
+
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	var claims tokenClaims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidToken)
+	}
+	scopes := append(strings.Fields(claims.Scope), claims.Scp...)
+	principal := &Principal{
+		Subject: claims.Subject,
+		Issuer:  claims.Issuer,
+		Scopes:  scopes,
+	}
+	if claims.ExpiresAt != nil {
+		principal.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return principal, nil
+}
+
+// DisabledVerifier accepts every request as DevPrincipal, it is only meant for local development.
+type DisabledVerifier struct{}
+
+func (DisabledVerifier) Verify(_ context.Context, _ string) (*Principal, error) {
+	return DevPrincipal, nil
+}
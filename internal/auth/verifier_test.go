@@ -0,0 +1,161 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	jwk     map[string]string
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newRSAKey(t *testing.T, kid string) signingKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodRS256, private: k, jwk: map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig",
+		"n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes()),
+	}}
+}
+
+func newECKey(t *testing.T, kid string) signingKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodES256, private: k, jwk: map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32))),
+	}}
+}
+
+func newEdKey(t *testing.T, kid string) signingKey {
+	pub, k, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: k, jwk: map[string]string{
+		"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(pub),
+	}}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...signingKey) {
+	set := map[string][]map[string]string{"keys": {}}
+	for _, k := range keys {
+		set["keys"] = append(set["keys"], k.jwk)
+	}
+	raw, err := json.Marshal(set)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+}
+
+func sign(t *testing.T, key signingKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	signed, err := token.SignedString(key.private)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "user-1",
+		"iss":   "https://issuer.test",
+		"aud":   "orders-api",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "orders:read orders:write",
+	}
+}
+
+func newTestVerifier(t *testing.T, keys ...signingKey) (*auth.Verifier, string) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, keys...)
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	provider := auth.NewJWKSProvider(auth.JWKSOpts{Source: path, MinRefreshInterval: time.Nanosecond}, lgr)
+	return auth.NewVerifier(provider, auth.VerifierOpts{Issuer: "https://issuer.test", Audience: "orders-api"}), path
+}
+
+func TestVerifier_SupportedAlgorithms(t *testing.T) {
+	keys := []signingKey{newRSAKey(t, "rsa"), newECKey(t, "ec"), newEdKey(t, "ed")}
+	verifier, _ := newTestVerifier(t, keys...)
+	for _, key := range keys {
+		t.Run(key.method.Alg(), func(t *testing.T) {
+			principal, err := verifier.Verify(context.TODO(), sign(t, key, validClaims()))
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", principal.Subject)
+			assert.True(t, principal.HasScope("orders:write"))
+			assert.False(t, principal.HasScope("admin"))
+		})
+	}
+}
+
+func TestVerifier_RejectsInvalidTokens(t *testing.T) {
+	key := newRSAKey(t, "rsa")
+	verifier, _ := newTestVerifier(t, key)
+	other := newRSAKey(t, "rsa")
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	hs256 := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	hs256Signed, err := hs256.SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	testCases := map[string]string{
+		"expired":          sign(t, key, with("exp", time.Now().Add(-time.Hour).Unix())),
+		"no expiry":        sign(t, key, with("exp", nil)),
+		"wrong issuer":     sign(t, key, with("iss", "https://evil.test")),
+		"wrong audience":   sign(t, key, with("aud", "other-api")),
+		"no subject":       sign(t, key, with("sub", nil)),
+		"wrong signature":  sign(t, other, validClaims()),
+		"hmac algorithm":   hs256Signed,
+		"not a jwt at all": "abc.def.ghi",
+	}
+	for description, token := range testCases {
+		t.Run(description, func(t *testing.T) {
+			_, err := verifier.Verify(context.TODO(), token)
+			assert.ErrorIs(t, err, auth.ErrInvalidToken)
+		})
+	}
+}
+
+func TestVerifier_KeyRotation(t *testing.T) {
+	oldKey, newKey := newECKey(t, "old"), newECKey(t, "new")
+	verifier, path := newTestVerifier(t, oldKey)
+	_, err := verifier.Verify(context.TODO(), sign(t, oldKey, validClaims()))
+	require.NoError(t, err)
+
+	writeJWKS(t, path, newKey)
+	_, err = verifier.Verify(context.TODO(), sign(t, newKey, validClaims()))
+	assert.NoError(t, err, "an unknown key id should refresh the key set")
+	_, err = verifier.Verify(context.TODO(), sign(t, oldKey, validClaims()))
+	assert.ErrorIs(t, err, auth.ErrInvalidToken, "retired keys should no longer be accepted")
+}
@@ -0,0 +1,485 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/rates"
+	"github.com/derickit/go-rest-api/internal/server"
+	"github.com/derickit/go-rest-api/internal/tracing"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix is the prefix of every environment variable read by Load
+	EnvPrefix = "ORDERS_"
+	// FileEnv names the config file when Sources.File is empty
+	FileEnv = EnvPrefix + "CONFIG"
+
+	defaultEnvironment = "local"
+	defaultPort        = "8080"
+	defaultLogLevel    = "info"
+	maxPageSizeLimit   = 1000
+
+	defaultTraceSampleRatio = 1.0
+)
+
+var (
+	ErrInvalidConfig     = errors.New("invalid configuration")
+	ErrConfigFileRead    = errors.New("failed to read config file")
+	ErrConfigFileFormat  = errors.New("unsupported config file format, expected .yaml, .yml, .toml or .json")
+	ErrUnknownConfigKey  = errors.New("unknown configuration key")
+	ErrInvalidConfigType = errors.New("invalid value type")
+)
+
+// Setting is a configuration value, read from the Key of a config file, the Env variable and the Flag of the CLI.
+type Setting struct {
+	Key   string
+	Env   string
+	Flag  string
+	Usage string
+	Bool  bool // the flag can be set without a value
+	set   func(svcEnv *models.ServiceEnv, value string) error
+}
+
+// Settings are all values the service can be configured with.
+var Settings = []Setting{
+	{Key: "environment", Env: EnvPrefix + "ENVIRONMENT", Flag: "environment",
+		Usage: "name of the environment, e.g. local, dev, prod",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.Name })},
+	{Key: "port", Env: EnvPrefix + "PORT", Flag: "port",
+		Usage: "port to serve on",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.Port })},
+	{Key: "dbName", Env: EnvPrefix + "DB_NAME", Flag: "db-name",
+		Usage: "name of the database",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.DBName })},
+	{Key: "mongoSideCar", Env: EnvPrefix + "MONGO_SIDECAR", Flag: "mongo-sidecar",
+		Usage: "path of the mongo credentials sidecar file",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.MongoVaultSideCar })},
+	{Key: "printDBQueries", Env: EnvPrefix + "PRINT_DB_QUERIES", Flag: "print-db-queries", Bool: true,
+		Usage: "log the queries sent to the database",
+		set:   boolValue(func(e *models.ServiceEnv) *bool { return &e.PrintQueries })},
+	{Key: "dbConnectionTimeout", Env: EnvPrefix + "DB_CONNECTION_TIMEOUT", Flag: "db-connection-timeout",
+		Usage: "timeout to connect to and ping the database",
+		set:   durationValue(func(e *models.ServiceEnv) *time.Duration { return &e.DBConnectionTimeout })},
+	{Key: "sideCarPollInterval", Env: EnvPrefix + "MONGO_SIDECAR_POLL_INTERVAL", Flag: "mongo-sidecar-poll-interval",
+		Usage: "how often the mongo sidecar file is checked for rotated credentials, 0 disables reloading",
+		set:   durationValue(func(e *models.ServiceEnv) *time.Duration { return &e.SideCarPollInterval })},
+	{Key: "disableAuth", Env: EnvPrefix + "DISABLE_AUTH", Flag: "disable-auth", Bool: true,
+		Usage: "disable authentication, local development only",
+		set:   boolValue(func(e *models.ServiceEnv) *bool { return &e.DisableAuth })},
+	{Key: "jwksSource", Env: EnvPrefix + "JWKS_SOURCE", Flag: "jwks-source",
+		Usage: "JWKS file path or URL",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.JWKSSource })},
+	{Key: "jwtIssuer", Env: EnvPrefix + "JWT_ISSUER", Flag: "jwt-issuer",
+		Usage: "expected token issuer",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.JWTIssuer })},
+	{Key: "jwtAudience", Env: EnvPrefix + "JWT_AUDIENCE", Flag: "jwt-audience",
+		Usage: "expected token audience",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.JWTAudience })},
+	{Key: "logLevel", Env: EnvPrefix + "LOG_LEVEL", Flag: "log-level",
+		Usage: "log level",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.LogLevel })},
+	{Key: "cursorSigningKey", Env: EnvPrefix + "CURSOR_SIGNING_KEY", Flag: "cursor-signing-key",
+		Usage: "key signing pagination cursors",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.CursorSigningKey })},
+	{Key: "maxPageSize", Env: EnvPrefix + "MAX_PAGE_SIZE", Flag: "max-page-size",
+		Usage: "largest page of orders a client can request",
+		set:   intValue(func(e *models.ServiceEnv) *int { return &e.MaxPageSize })},
+	{Key: "maxLineItems", Env: EnvPrefix + "MAX_LINE_ITEMS", Flag: "max-line-items",
+		Usage: "largest number of products of an order",
+		set:   intValue(func(e *models.ServiceEnv) *int { return &e.MaxLineItems })},
+	{Key: "maxProductQuantity", Env: EnvPrefix + "MAX_PRODUCT_QUANTITY", Flag: "max-product-quantity",
+		Usage: "largest quantity of a single product of an order",
+		set:   intValue(func(e *models.ServiceEnv) *int { return &e.MaxProductQuantity })},
+	{Key: "baseCurrency", Env: EnvPrefix + "BASE_CURRENCY", Flag: "base-currency",
+		Usage: "ISO 4217 currency order totals are reported in",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.BaseCurrency })},
+	{Key: "exchangeRatesFile", Env: EnvPrefix + "EXCHANGE_RATES_FILE", Flag: "exchange-rates-file",
+		Usage: "JSON file of exchange rates, only orders in the base currency are accepted when empty",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.ExchangeRatesFile })},
+	{Key: "exchangeRatesPollInterval", Env: EnvPrefix + "EXCHANGE_RATES_POLL_INTERVAL", Flag: "exchange-rates-poll-interval",
+		Usage: "how often the exchange rates file is read again",
+		set:   durationValue(func(e *models.ServiceEnv) *time.Duration { return &e.RatesPollInterval })},
+	{Key: "pricingRulesFile", Env: EnvPrefix + "PRICING_RULES_FILE", Flag: "pricing-rules-file",
+		Usage: "JSON file of the discount, shipping and tax rules, orders cost the sum of their products when empty",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.PricingRulesFile })},
+	{Key: "idempotencyKeyTTL", Env: EnvPrefix + "IDEMPOTENCY_KEY_TTL", Flag: "idempotency-key-ttl",
+		Usage: "how long Idempotency-Key responses are kept",
+		set:   durationValue(func(e *models.ServiceEnv) *time.Duration { return &e.IdempotencyKeyTTL })},
+	{Key: "trustedProxies", Env: EnvPrefix + "TRUSTED_PROXIES", Flag: "trusted-proxies",
+		Usage: "comma separated IPs and CIDRs of the proxies whose X-Forwarded-For is trusted, none when empty",
+		set:   listValue(func(e *models.ServiceEnv) *[]string { return &e.TrustedProxies })},
+	{Key: "readRateLimit", Env: EnvPrefix + "READ_RATE_LIMIT", Flag: "read-rate-limit",
+		Usage: "read requests per caller and minute",
+		set:   intValue(func(e *models.ServiceEnv) *int { return &e.ReadRateLimit })},
+	{Key: "writeRateLimit", Env: EnvPrefix + "WRITE_RATE_LIMIT", Flag: "write-rate-limit",
+		Usage: "write requests per caller and minute",
+		set:   intValue(func(e *models.ServiceEnv) *int { return &e.WriteRateLimit })},
+	{Key: "shutdownTimeout", Env: EnvPrefix + "SHUTDOWN_TIMEOUT", Flag: "shutdown-timeout",
+		Usage: "how long in-flight requests may take to drain on shutdown",
+		set:   durationValue(func(e *models.ServiceEnv) *time.Duration { return &e.ShutdownTimeout })},
+	{Key: "readinessGracePeriod", Env: EnvPrefix + "READINESS_GRACE_PERIOD", Flag: "readiness-grace-period",
+		Usage: "how long requests are still served on shutdown once readiness fails, 0 stops accepting them at once",
+		set:   durationValue(func(e *models.ServiceEnv) *time.Duration { return &e.ReadinessGracePeriod })},
+	{Key: "seedRecordCount", Env: EnvPrefix + "SEED_RECORD_COUNT", Flag: "seed-record-count",
+		Usage: "number of orders created when seeding a database",
+		set:   intValue(func(e *models.ServiceEnv) *int { return &e.SeedRecordCount })},
+	{Key: "gzipLevel", Env: EnvPrefix + "GZIP_LEVEL", Flag: "gzip-level",
+		Usage: "compression level of responses from -2 (huffman only) to 9 (best), 0 disables compression",
+		set:   intValue(func(e *models.ServiceEnv) *int { return &e.GzipLevel })},
+	{Key: "traceExporter", Env: EnvPrefix + "TRACE_EXPORTER", Flag: "trace-exporter",
+		Usage: "where spans are exported to: none, otlp, stdout or file",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.TraceExporter })},
+	{Key: "traceEndpoint", Env: EnvPrefix + "TRACE_ENDPOINT", Flag: "trace-endpoint",
+		Usage: "OTLP/HTTP url of the otlp exporter, the OTEL_EXPORTER_OTLP_* env vars apply when empty; path of the file exporter",
+		set:   stringValue(func(e *models.ServiceEnv) *string { return &e.TraceEndpoint })},
+	{Key: "traceSampleRatio", Env: EnvPrefix + "TRACE_SAMPLE_RATIO", Flag: "trace-sample-ratio",
+		Usage: "share of the traces started by this service that are sampled, from 0 to 1",
+		set:   floatValue(func(e *models.ServiceEnv) *float64 { return &e.TraceSampleRatio })},
+	{Key: "openAPIValidation", Env: EnvPrefix + "OPENAPI_VALIDATION", Flag: "openapi-validation", Bool: true,
+		Usage: "validate requests against the OpenAPI document, responses are validated too in dev mode",
+		set:   boolValue(func(e *models.ServiceEnv) *bool { return &e.OpenAPIValidation })},
+	{Key: "securityHeaders", Env: EnvPrefix + "SECURITY_HEADERS", Flag: "security-headers",
+		Usage: `headers set on every response as JSON object, e.g. {"X-Frame-Options":"DENY"}, an empty value removes a default header`,
+		set:   headersValue},
+}
+
+// Sources are the layers of the configuration, later layers override earlier ones:
+// defaults, the config file, environment variables and finally flags.
+type Sources struct {
+	File   string                          // YAML, TOML or JSON file, the format follows the extension; FileEnv is used when empty
+	Lookup func(key string) (string, bool) // looks up environment variables, os.LookupEnv when nil
+	Flags  map[string]string               // values of the flags set on the command line by Setting.Flag
+}
+
+// Defaults returns the configuration used when nothing else is configured.
+func Defaults() models.ServiceEnv {
+	return models.ServiceEnv{
+		Name:                 defaultEnvironment,
+		Port:                 defaultPort,
+		LogLevel:             defaultLogLevel,
+		DBConnectionTimeout:  db.DefConnectionTimeOut,
+		SideCarPollInterval:  db.DefSideCarPollInterval,
+		MaxPageSize:          handlers.MaxPageSize,
+		MaxLineItems:         handlers.DefMaxLineItems,
+		MaxProductQuantity:   handlers.DefMaxQuantity,
+		BaseCurrency:         string(money.DefaultCurrency),
+		RatesPollInterval:    rates.DefPollInterval,
+		ReadinessGracePeriod: server.DefReadinessGracePeriod,
+		SeedRecordCount:      handlers.DefSeedRecordCount,
+		GzipLevel:            gzip.DefaultCompression,
+		SecurityHeaders:      maps.Clone(middleware.DefSecurityHeaders),
+		TraceExporter:        tracing.ExporterNone,
+		TraceSampleRatio:     defaultTraceSampleRatio,
+	}
+}
+
+// Load reads the configuration from all sources and validates it, every problem found is reported in the
+// returned error which wraps ErrInvalidConfig.
+func Load(src Sources) (models.ServiceEnv, error) {
+	lookup := src.Lookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	file := src.File
+	if file == "" {
+		file, _ = lookup(FileEnv)
+	}
+
+	svcEnv := Defaults()
+	var errs []error
+	if file != "" {
+		errs = append(errs, applyFile(&svcEnv, file)...)
+	}
+	for _, s := range Settings {
+		if v, ok := lookup(s.Env); ok {
+			if err := s.set(&svcEnv, v); err != nil {
+				errs = append(errs, fmt.Errorf("env %s: %w", s.Env, err))
+			}
+		}
+	}
+	for _, s := range Settings {
+		if v, ok := src.Flags[s.Flag]; ok {
+			if err := s.set(&svcEnv, v); err != nil {
+				errs = append(errs, fmt.Errorf("flag --%s: %w", s.Flag, err))
+			}
+		}
+	}
+	errs = append(errs, Validate(svcEnv)...)
+	if len(errs) > 0 {
+		return svcEnv, errors.Join(append([]error{ErrInvalidConfig}, errs...)...)
+	}
+	return svcEnv, nil
+}
+
+// Validate returns every problem of svcEnv.
+func Validate(svcEnv models.ServiceEnv) []error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+	if strings.TrimSpace(svcEnv.Name) == "" {
+		invalid("environment", "should not be empty")
+	}
+	if port, err := strconv.Atoi(svcEnv.Port); err != nil || port < 1 || port > 65535 {
+		invalid("port", "%q is not a port between 1 and 65535", svcEnv.Port)
+	}
+	if svcEnv.DBName == "" {
+		invalid("dbName", "should be defined")
+	}
+	if svcEnv.MongoVaultSideCar == "" {
+		invalid("mongoSideCar", "mongo sidecar file path should be defined")
+	}
+	if svcEnv.DBConnectionTimeout <= 0 {
+		invalid("dbConnectionTimeout", "should be positive")
+	}
+	if svcEnv.SideCarPollInterval < 0 {
+		invalid("sideCarPollInterval", "should not be negative")
+	}
+	if svcEnv.JWKSSource == "" && !svcEnv.DisableAuth {
+		invalid("jwksSource", "jwks file path or url should be defined when auth is enabled")
+	}
+	if _, err := zerolog.ParseLevel(svcEnv.LogLevel); err != nil || svcEnv.LogLevel == "" {
+		invalid("logLevel", "unknown level %q", svcEnv.LogLevel)
+	}
+	if svcEnv.MaxPageSize < 1 || svcEnv.MaxPageSize > maxPageSizeLimit {
+		invalid("maxPageSize", "should be between 1 and %d", maxPageSizeLimit)
+	}
+	if svcEnv.MaxLineItems < 1 {
+		invalid("maxLineItems", "should be positive")
+	}
+	if svcEnv.MaxProductQuantity < 1 {
+		invalid("maxProductQuantity", "should be positive")
+	}
+	if _, err := money.ParseCurrency(svcEnv.BaseCurrency); err != nil {
+		invalid("baseCurrency", "%q is not an ISO 4217 currency code", svcEnv.BaseCurrency)
+	}
+	if svcEnv.RatesPollInterval <= 0 {
+		invalid("exchangeRatesPollInterval", "should be positive")
+	}
+	if svcEnv.IdempotencyKeyTTL < 0 {
+		invalid("idempotencyKeyTTL", "should not be negative")
+	}
+	if svcEnv.ReadRateLimit < 0 {
+		invalid("readRateLimit", "should not be negative")
+	}
+	if svcEnv.WriteRateLimit < 0 {
+		invalid("writeRateLimit", "should not be negative")
+	}
+	if svcEnv.ShutdownTimeout < 0 {
+		invalid("shutdownTimeout", "should not be negative")
+	}
+	if svcEnv.ReadinessGracePeriod < 0 {
+		invalid("readinessGracePeriod", "should not be negative")
+	}
+	if svcEnv.SeedRecordCount < 1 {
+		invalid("seedRecordCount", "should be positive")
+	}
+	if svcEnv.GzipLevel < gzip.HuffmanOnly || svcEnv.GzipLevel > gzip.BestCompression {
+		invalid("gzipLevel", "should be between %d and %d", gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	switch svcEnv.TraceExporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		if svcEnv.TraceEndpoint == "" {
+			invalid("traceEndpoint", "file path should be defined for the file exporter")
+		}
+	default:
+		invalid("traceExporter", "unknown exporter %q, expected none, otlp, stdout or file", svcEnv.TraceExporter)
+	}
+	if svcEnv.TraceSampleRatio < 0 || svcEnv.TraceSampleRatio > 1 {
+		invalid("traceSampleRatio", "should be between 0 and 1")
+	}
+	for _, proxy := range svcEnv.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			invalid("trustedProxies", "%q is not an IP or a CIDR", proxy)
+		}
+	}
+	names := make([]string, 0, len(svcEnv.SecurityHeaders))
+	for name := range svcEnv.SecurityHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !validHeaderName(name) {
+			invalid("securityHeaders", "%q is not a valid header name", name)
+		}
+		if strings.ContainsAny(svcEnv.SecurityHeaders[name], "\r\n") {
+			invalid("securityHeaders", "value of %s should be a single line", name)
+		}
+	}
+	return errs
+}
+
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func applyFile(svcEnv *models.ServiceEnv, file string) []error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return []error{fmt.Errorf("%w %s: %w", ErrConfigFileRead, file, err)}
+	}
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	default:
+		return []error{fmt.Errorf("%s: %w", file, ErrConfigFileFormat)}
+	}
+	if err != nil {
+		return []error{fmt.Errorf("%w %s: %w", ErrConfigFileRead, file, err)}
+	}
+
+	settings := make(map[string]Setting, len(Settings))
+	for _, s := range Settings {
+		settings[s.Key] = s
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		s, ok := settings[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w %q", file, ErrUnknownConfigKey, key))
+			continue
+		}
+		value, vErr := fileValue(values[key])
+		if vErr == nil {
+			vErr = s.set(svcEnv, value)
+		}
+		if vErr != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", file, key, vErr))
+		}
+	}
+	return errs
+}
+
+// fileValue formats a decoded file value the way it would be written in an environment variable.
+func fileValue(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case bool, int, int64, uint64, float64, json.Number:
+		return fmt.Sprint(t), nil
+	case map[string]any:
+		b, err := json.Marshal(t)
+		return string(b), err
+	default:
+		return "", fmt.Errorf("%w %T", ErrInvalidConfigType, v)
+	}
+}
+
+func stringValue(field func(*models.ServiceEnv) *string) func(*models.ServiceEnv, string) error {
+	return func(svcEnv *models.ServiceEnv, value string) error {
+		*field(svcEnv) = value
+		return nil
+	}
+}
+
+func boolValue(field func(*models.ServiceEnv) *bool) func(*models.ServiceEnv, string) error {
+	return func(svcEnv *models.ServiceEnv, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*field(svcEnv) = b
+		return nil
+	}
+}
+
+func intValue(field func(*models.ServiceEnv) *int) func(*models.ServiceEnv, string) error {
+	return func(svcEnv *models.ServiceEnv, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*field(svcEnv) = i
+		return nil
+	}
+}
+
+func floatValue(field func(*models.ServiceEnv) *float64) func(*models.ServiceEnv, string) error {
+	return func(svcEnv *models.ServiceEnv, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field(svcEnv) = f
+		return nil
+	}
+}
+
+func durationValue(field func(*models.ServiceEnv) *time.Duration) func(*models.ServiceEnv, string) error {
+	return func(svcEnv *models.ServiceEnv, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, e.g. 30s", value)
+		}
+		*field(svcEnv) = d
+		return nil
+	}
+}
+
+// listValue reads a comma separated list, blank items are left out.
+func listValue(field func(*models.ServiceEnv) *[]string) func(*models.ServiceEnv, string) error {
+	return func(svcEnv *models.ServiceEnv, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(svcEnv) = items
+		return nil
+	}
+}
+
+// headersValue merges a JSON object into the configured headers, so a layer only lists the headers it changes.
+func headersValue(svcEnv *models.ServiceEnv, value string) error {
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		return fmt.Errorf("expected a JSON object of header names and values: %w", err)
+	}
+	if svcEnv.SecurityHeaders == nil {
+		svcEnv.SecurityHeaders = map[string]string{}
+	}
+	maps.Copy(svcEnv.SecurityHeaders, headers)
+	return nil
+}
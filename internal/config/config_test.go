@@ -0,0 +1,81 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func validEnv() map[string]string {
+	return map[string]string{
+		"ORDERS_DB_NAME":       "orders",
+		"ORDERS_MONGO_SIDECAR": "/sidecar.json",
+		"ORDERS_JWKS_SOURCE":   "https://issuer.example.com/jwks.json",
+	}
+}
+
+func TestLoad(t *testing.T) {
+	env := validEnv()
+	env["ORDERS_GZIP_LEVEL"] = "0"
+	env["ORDERS_PRINT_DB_QUERIES"] = "true"
+	env["ORDERS_BASE_CURRENCY"] = "EUR"
+	env["ORDERS_TRUSTED_PROXIES"] = "10.0.0.0/8, 192.0.2.1,"
+	svcEnv, err := config.Load(config.Sources{Lookup: lookup(env), Flags: map[string]string{"port": "9090"}})
+	require.NoError(t, err)
+	assert.Equal(t, "orders", svcEnv.DBName)
+	assert.Equal(t, "9090", svcEnv.Port)
+	assert.Equal(t, 0, svcEnv.GzipLevel)
+	assert.True(t, svcEnv.PrintQueries)
+	assert.Equal(t, "EUR", svcEnv.BaseCurrency)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.1"}, svcEnv.TrustedProxies)
+}
+
+func TestLoad_UnsupportedFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.ini")
+	require.NoError(t, os.WriteFile(file, []byte("port=1"), 0o600))
+	_, err := config.Load(config.Sources{File: file, Lookup: lookup(validEnv())})
+	assert.ErrorIs(t, err, config.ErrInvalidConfig)
+	assert.ErrorIs(t, err, config.ErrConfigFileFormat)
+
+	_, err = config.Load(config.Sources{File: file + ".missing.yaml", Lookup: lookup(validEnv())})
+	assert.ErrorIs(t, err, config.ErrConfigFileRead)
+}
+
+func TestLoad_InvalidFileValue(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("maxPageSize: [1, 2]\nother: 1\n"), 0o600))
+	_, err := config.Load(config.Sources{File: file, Lookup: lookup(validEnv())})
+	assert.ErrorIs(t, err, config.ErrInvalidConfigType)
+	assert.ErrorIs(t, err, config.ErrUnknownConfigKey)
+}
+
+func TestValidate(t *testing.T) {
+	svcEnv := config.Defaults()
+	svcEnv.DBName = "orders"
+	svcEnv.MongoVaultSideCar = "/sidecar.json"
+	svcEnv.DisableAuth = true
+	assert.Empty(t, config.Validate(svcEnv))
+
+	svcEnv.LogLevel = "verbose"
+	svcEnv.SeedRecordCount = 0
+	svcEnv.DBConnectionTimeout = 0
+	svcEnv.SecurityHeaders = map[string]string{"Bad Header": "x", "X-Ok": "a\r\nInjected: 1"}
+	svcEnv.BaseCurrency = "usd"
+	svcEnv.RatesPollInterval = 0
+	svcEnv.ReadinessGracePeriod = -time.Second
+	svcEnv.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"}
+	errs := config.Validate(svcEnv)
+	assert.Len(t, errs, 9)
+}
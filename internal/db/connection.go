@@ -3,10 +3,11 @@ package db
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/derickit/go-rest-api/internal/logger"
-	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -40,12 +41,20 @@ type ConnectionOpts struct {
 	Database          string
 }
 
+// ConnectionManager owns the client of the database, the client is replaced when the credentials are reloaded.
 type ConnectionManager struct {
+	conn     atomic.Pointer[connection]
+	opts     *ConnectionOpts
+	reloadMu sync.Mutex
+	closed   bool
+	draining sync.WaitGroup
+	logger   *logger.AppLogger
+}
+
+type connection struct {
 	connectionURL string
 	client        *mongo.Client
 	database      *mongo.Database
-	credentials   *MongoDBCredentials
-	logger        *logger.AppLogger
 }
 
 func FillConnectionOpts(opts *ConnectionOpts) *ConnectionOpts {
@@ -66,41 +75,47 @@ func FillConnectionOpts(opts *ConnectionOpts) *ConnectionOpts {
 }
 
 func NewMongoManager(mc *MongoDBCredentials, opts *ConnectionOpts, lgr *logger.AppLogger) (*ConnectionManager, error) {
+	connMgr := &ConnectionManager{
+		opts:   FillConnectionOpts(opts),
+		logger: lgr,
+	}
+	conn, err := connMgr.connect(mc)
+	if err != nil {
+		return nil, err
+	}
+	connMgr.conn.Store(conn)
+	return connMgr, nil
+}
+
+// connect returns a pinged connection using the credentials mc.
+func (c *ConnectionManager) connect(mc *MongoDBCredentials) (*connection, error) {
 	connURL := MongoConnectionURL(mc)
-	lgr.Info().Str("connURL", MaskedMongoConnectionURL(mc)).Msg("connecting to db")
+	c.logger.Info().Str("connURL", MaskedMongoConnectionURL(mc)).Msg("connecting to db")
 	if len(connURL) == 0 {
 		return nil, ErrInvalidConnURL
 	}
-	connMgr := &ConnectionManager{
-		credentials:   mc,
-		logger:        lgr,
+	client, err := c.NewClient(connURL, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	conn := &connection{
 		connectionURL: connURL,
+		client:        client,
+		database:      client.Database(c.opts.Database),
 	}
-	connOpts := FillConnectionOpts(opts)
-	var err error
-	var c *mongo.Client
-	if c, err = connMgr.NewClient(connOpts); err == nil {
-		db := c.Database(connOpts.Database)
-		connMgr.database = db
-		connMgr.client = c
-		if pErr := connMgr.Ping(); pErr != nil {
-			return nil, ErrConnectionEstablish
+	if pErr := c.ping(conn); pErr != nil {
+		if dErr := client.Disconnect(context.Background()); dErr != nil {
+			c.logger.Error().Err(dErr).Msg("failed to disconnect from db")
 		}
-		return connMgr, nil
+		return nil, ErrConnectionEstablish
 	}
-	return nil, err
+	return conn, nil
 }
 
-func (c *ConnectionManager) NewClient(connOpts *ConnectionOpts) (*mongo.Client, error) {
-	var cmdMonitor *event.CommandMonitor
-	if connOpts.PrintQueries {
-		cmdMonitor = &event.CommandMonitor{
-			Started: func(_ context.Context, evt *event.CommandStartedEvent) {
-				c.logger.Info().Str("dbQuery", evt.Command.String()).Send()
-			},
-		}
-	}
-	clientOptions := options.Client().ApplyURI(c.connectionURL).SetMonitor(cmdMonitor)
+func (c *ConnectionManager) NewClient(connURL string, connOpts *ConnectionOpts) (*mongo.Client, error) {
+	clientOptions := options.Client().ApplyURI(connURL).
+		SetMonitor(c.commandMonitor(connOpts.PrintQueries)).
+		SetPoolMonitor(poolMonitor())
 	ctx, cancel := context.WithTimeout(context.Background(), connOpts.ConnectionTimeout)
 	defer cancel()
 	client, err := mongo.Connect(ctx, clientOptions)
@@ -111,22 +126,54 @@ func (c *ConnectionManager) NewClient(connOpts *ConnectionOpts) (*mongo.Client,
 	return client, nil
 }
 
+// Database returns the database of the current client, collections taken from it follow the client
+// when the credentials are reloaded.
 func (c *ConnectionManager) Database() MongoDatabase {
-	return c.database
+	return c
+}
+
+// Collection returns the collection name of the current client.
+func (c *ConnectionManager) Collection(name string, opts ...*options.CollectionOptions) *mongo.Collection {
+	return c.conn.Load().database.Collection(name, opts...)
+}
+
+// PingCheck is a health check pinging the database of mgr, it gives up when ctx is done.
+func PingCheck(mgr MongoManager) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- mgr.Ping()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
 func (c *ConnectionManager) Ping() error {
-	ctx, cancel := context.WithTimeout(context.Background(), DefConnectionTimeOut)
+	return c.ping(c.conn.Load())
+}
+
+func (c *ConnectionManager) ping(conn *connection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.ConnectionTimeout)
 	defer cancel()
-	if err := c.client.Ping(ctx, nil); err != nil {
+	if err := conn.client.Ping(ctx, nil); err != nil {
 		c.logger.Error().Err(err).Msg("failed to ping db")
 		return ErrPingDB
 	}
 	return nil
 }
 
+// Disconnect waits for replaced clients to drain and disconnects the current client.
 func (c *ConnectionManager) Disconnect() error {
-	if err := c.client.Disconnect(context.Background()); err != nil {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	c.closed = true
+	c.draining.Wait()
+	if err := c.conn.Load().client.Disconnect(context.Background()); err != nil {
 		c.logger.Error().Err(err).Msg("failed to disconnect from db")
 		return ErrConnectionLeak
 	}
@@ -68,13 +68,14 @@ func MongoConnectionURL(mc *MongoDBCredentials) string {
 }
 
 func MaskedMongoConnectionURL(mc *MongoDBCredentials) string {
-	if len(mc.User) > 0 {
-		mc.User = "****"
+	masked := *mc
+	if len(masked.User) > 0 {
+		masked.User = "****"
 	}
-	if len(mc.Password) > 0 {
-		mc.Password = "****"
+	if len(masked.Password) > 0 {
+		masked.Password = "****"
 	}
-	return MongoConnectionURL(mc)
+	return MongoConnectionURL(&masked)
 }
 
 func MongoDBCredentialFromSideCar(sideCarFile string) (*MongoDBCredentials, error) {
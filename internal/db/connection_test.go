@@ -21,6 +21,7 @@ import (
 
 var (
 	testDBMgr db.MongoManager
+	testCreds *db.MongoDBCredentials
 	lgr       = logger.Setup(models.ServiceEnv{Name: "test"})
 )
 
@@ -49,6 +50,7 @@ func TestMain(m *testing.M) {
 	creds := &db.MongoDBCredentials{
 		HostName: strings.TrimPrefix(mongoServer.URI(), "mongodb://"),
 	}
+	testCreds = creds
 	opts := &db.ConnectionOpts{
 		Database:     "test",
 		PrintQueries: true,
@@ -0,0 +1,391 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	CouponsCollection           = "coupons"
+	CouponRedemptionsCollection = "couponRedemptions"
+	// CouponUserCountsCollection holds the number of redemptions of a coupon held by each user
+	CouponUserCountsCollection = "couponUserCounts"
+)
+
+var (
+	ErrInvalidCouponID        = errors.New("invalid coupon id")
+	ErrCouponNotFound         = errors.New("coupon doesn't exist")
+	ErrCouponCodeExists       = errors.New("a coupon with the same code already exists")
+	ErrCouponNotActive        = errors.New("coupon is not valid at this time")
+	ErrCouponUsageLimit       = errors.New("coupon reached its usage limit")
+	ErrCouponUserLimit        = errors.New("coupon reached its usage limit for the user")
+	ErrFailedToCreateCoupon   = errors.New("failed to create coupon")
+	ErrUnexpectedUpdateCoupon = errors.New("unexpected error occurred while updating coupon")
+	ErrUnexpectedDeleteCoupon = errors.New("unexpected error occurred while deleting coupon")
+	ErrUnexpectedRedeem       = errors.New("unexpected error occurred while redeeming coupon")
+)
+
+type CouponsDataService interface {
+	Create(ctx context.Context, coupon *data.Coupon) (string, error)
+	Update(ctx context.Context, coupon *data.Coupon) error
+	GetAll(ctx context.Context) ([]data.Coupon, error)
+	GetByID(ctx context.Context, id primitive.ObjectID) (*data.Coupon, error)
+	GetByCode(ctx context.Context, code string) (*data.Coupon, error)
+	DeleteByID(ctx context.Context, id primitive.ObjectID) error
+	Redeem(ctx context.Context, id primitive.ObjectID, redemption *data.CouponRedemption) error
+	Release(ctx context.Context, id, redemptionID primitive.ObjectID) error
+}
+
+type CouponsRepo struct {
+	database MongoDatabase
+	logger   *logger.AppLogger
+}
+
+func NewCouponsRepo(db MongoDatabase, lgr *logger.AppLogger) *CouponsRepo {
+	return &CouponsRepo{
+		database: db,
+		logger:   lgr,
+	}
+}
+
+// collection is resolved per operation, see OrdersRepo.collection.
+func (r *CouponsRepo) collection() *mongo.Collection {
+	if r.database == nil {
+		return nil
+	}
+	return r.database.Collection(CouponsCollection)
+}
+
+func (r *CouponsRepo) redemptions() *mongo.Collection {
+	if r.database == nil {
+		return nil
+	}
+	return r.database.Collection(CouponRedemptionsCollection)
+}
+
+func (r *CouponsRepo) userCounts() *mongo.Collection {
+	if r.database == nil {
+		return nil
+	}
+	return r.database.Collection(CouponUserCountsCollection)
+}
+
+// couponUserCount is the number of redemptions of a coupon held by a user.
+type couponUserCount struct {
+	CouponID primitive.ObjectID `bson:"couponId"`
+	User     string             `bson:"user"`
+	Count    int64              `bson:"count"`
+}
+
+// EnsureIndexes creates the unique index on the coupon codes, the index of the redemptions of a coupon and the
+// unique index of the user counts, it is safe to call on every start.
+func (r *CouponsRepo) EnsureIndexes(ctx context.Context) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	indexes := []struct {
+		collection *mongo.Collection
+		model      mongo.IndexModel
+	}{
+		{r.collection(), mongo.IndexModel{
+			Keys:    doc("code", 1),
+			Options: options.Index().SetName("code_unique").SetUnique(true),
+		}},
+		{r.redemptions(), mongo.IndexModel{
+			Keys:    doc("couponId", 1),
+			Options: options.Index().SetName("couponId"),
+		}},
+		{r.userCounts(), mongo.IndexModel{
+			Keys:    bson.D{primitive.E{Key: "couponId", Value: 1}, primitive.E{Key: "user", Value: 1}},
+			Options: options.Index().SetName("couponId_user_unique").SetUnique(true),
+		}},
+	}
+	for _, index := range indexes {
+		if _, err := index.collection.Indexes().CreateOne(ctx, index.model); err != nil {
+			r.logger.Error().Err(err).Msg("failed to create coupons indexes")
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *CouponsRepo) Create(ctx context.Context, coupon *data.Coupon) (string, error) {
+	if err := validate(r.collection()); err != nil {
+		return "", err
+	}
+	if !coupon.ID.IsZero() {
+		return "", ErrInvalidCouponID
+	}
+	coupon.UsageCount = 0
+	result, err := r.collection().InsertOne(ctx, coupon)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", ErrCouponCodeExists
+		}
+		r.logger.Error().Err(err).Msg("error occurred while creating coupon")
+		return "", ErrFailedToCreateCoupon
+	}
+	coupon.ID = result.InsertedID.(primitive.ObjectID)
+	r.logger.Info().Str("couponId", coupon.ID.Hex()).Msg("coupon created successfully")
+	return coupon.ID.Hex(), nil
+}
+
+// Update saves the editable fields of the coupon, its usage count is only changed by Redeem and Release.
+func (r *CouponsRepo) Update(ctx context.Context, coupon *data.Coupon) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	if coupon.ID.IsZero() {
+		return ErrInvalidCouponID
+	}
+	coupon.UpdatedAt = time.Now()
+	fields := bson.D{
+		primitive.E{Key: "code", Value: coupon.Code},
+		primitive.E{Key: "description", Value: coupon.Description},
+		primitive.E{Key: "type", Value: coupon.Type},
+		primitive.E{Key: "currency", Value: coupon.Currency},
+		primitive.E{Key: "usageLimit", Value: coupon.UsageLimit},
+		primitive.E{Key: "perUserLimit", Value: coupon.PerUserLimit},
+		primitive.E{Key: "updatedAt", Value: coupon.UpdatedAt},
+	}
+	var unset bson.D
+	optional := func(key string, value any, isSet bool) {
+		if isSet {
+			fields = append(fields, primitive.E{Key: key, Value: value})
+		} else {
+			unset = append(unset, primitive.E{Key: key, Value: ""})
+		}
+	}
+	optional("percent", coupon.Percent, coupon.Percent != nil)
+	optional("amount", coupon.Amount, coupon.Amount != nil)
+	optional("minSpend", coupon.MinSpend, coupon.MinSpend != nil)
+	optional("validFrom", coupon.ValidFrom, coupon.ValidFrom != nil)
+	optional("validUntil", coupon.ValidUntil, coupon.ValidUntil != nil)
+	update := bson.D{primitive.E{Key: "$set", Value: fields}}
+	if len(unset) > 0 {
+		update = append(update, primitive.E{Key: "$unset", Value: unset})
+	}
+	result, err := r.collection().UpdateByID(ctx, coupon.ID, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrCouponCodeExists
+		}
+		r.logger.Error().Err(err).Msg("error occurred while updating coupon")
+		return ErrUnexpectedUpdateCoupon
+	}
+	if result.MatchedCount == 0 {
+		return ErrCouponNotFound
+	}
+	return nil
+}
+
+// GetAll returns every coupon, sorted by code.
+func (r *CouponsRepo) GetAll(ctx context.Context) ([]data.Coupon, error) {
+	if err := validate(r.collection()); err != nil {
+		return nil, err
+	}
+	findOptions := options.Find().SetSort(doc("code", 1))
+	cursor, err := r.collection().Find(ctx, bson.D{}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	coupons := []data.Coupon{}
+	if err = cursor.All(ctx, &coupons); err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (r *CouponsRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*data.Coupon, error) {
+	return r.findOne(ctx, doc("_id", id))
+}
+
+// GetByCode returns the coupon with the code, codes are stored upper case.
+func (r *CouponsRepo) GetByCode(ctx context.Context, code string) (*data.Coupon, error) {
+	return r.findOne(ctx, doc("code", code))
+}
+
+func (r *CouponsRepo) findOne(ctx context.Context, filter bson.D) (*data.Coupon, error) {
+	if err := validate(r.collection()); err != nil {
+		return nil, err
+	}
+	var coupon data.Coupon
+	if err := r.collection().FindOne(ctx, filter).Decode(&coupon); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// DeleteByID removes the coupon along with its redemptions and user counts, the orders keep the coupon they
+// were created with.
+func (r *CouponsRepo) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	res, err := r.collection().DeleteOne(ctx, doc("_id", id))
+	if err != nil {
+		return ErrUnexpectedDeleteCoupon
+	}
+	if res.DeletedCount == 0 {
+		return ErrCouponNotFound
+	}
+	if _, err = r.redemptions().DeleteMany(ctx, doc("couponId", id)); err != nil {
+		r.logger.Error().Err(err).Str("couponId", id.Hex()).Msg("error occurred while deleting coupon redemptions")
+		return ErrUnexpectedDeleteCoupon
+	}
+	if _, err = r.userCounts().DeleteMany(ctx, doc("couponId", id)); err != nil {
+		r.logger.Error().Err(err).Str("couponId", id.Hex()).Msg("error occurred while deleting coupon user counts")
+		return ErrUnexpectedDeleteCoupon
+	}
+	return nil
+}
+
+// Redeem records the redemption when the coupon is active and neither its usage limit nor the limit of the user
+// is reached. The usage count of the coupon and the count of the user are incremented with conditional updates,
+// so concurrent redemptions can't exceed the limits; the increments are given back when a later step fails.
+// The redemption is stored in its own collection, keyed by the coupon and the redemption id the order keeps.
+func (r *CouponsRepo) Redeem(ctx context.Context, id primitive.ObjectID, redemption *data.CouponRedemption) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	now := time.Now()
+	if redemption.RedeemedAt.IsZero() {
+		redemption.RedeemedAt = now
+	}
+	redemption.CouponID = id
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		// missing bounds match, the window is open on that side
+		primitive.E{Key: "validFrom", Value: doc("$not", doc("$gt", now))},
+		primitive.E{Key: "validUntil", Value: doc("$not", doc("$lte", now))},
+		primitive.E{Key: "$or", Value: bson.A{
+			doc("usageLimit", 0),
+			doc("$expr", doc("$lt", bson.A{"$usageCount", "$usageLimit"})),
+		}},
+	}
+	var coupon data.Coupon
+	err := r.collection().FindOneAndUpdate(ctx, filter, doc("$inc", doc("usageCount", 1)),
+		options.FindOneAndUpdate().SetProjection(doc("perUserLimit", 1))).Decode(&coupon)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return r.notRedeemable(ctx, id, now)
+	}
+	if err != nil {
+		r.logger.Error().Err(err).Msg("error occurred while redeeming coupon")
+		return ErrUnexpectedRedeem
+	}
+
+	if err = r.countUser(ctx, id, redemption.User, coupon.PerUserLimit); err != nil {
+		_ = r.giveBack(ctx, id, redemption.User, false)
+		return err
+	}
+	if _, err = r.redemptions().InsertOne(ctx, redemption); err != nil {
+		r.logger.Error().Err(err).Msg("error occurred while recording coupon redemption")
+		_ = r.giveBack(ctx, id, redemption.User, true)
+		return ErrUnexpectedRedeem
+	}
+	return nil
+}
+
+// countUser increments the redemption count of the user unless it reached limit, a limit of 0 is no limit. The
+// count is created by the first redemption of the user, a count at the limit doesn't match and the upsert fails
+// on the unique index instead. Two first redemptions of a user race for the insert, the loser tries once more.
+func (r *CouponsRepo) countUser(ctx context.Context, id primitive.ObjectID, user string, limit int64) error {
+	filter := bson.D{
+		primitive.E{Key: "couponId", Value: id},
+		primitive.E{Key: "user", Value: user},
+	}
+	if limit > 0 {
+		filter = append(filter, primitive.E{Key: "count", Value: doc("$lt", limit)})
+	}
+	var err error
+	for range 2 {
+		_, err = r.userCounts().UpdateOne(ctx, filter, doc("$inc", doc("count", 1)), options.Update().SetUpsert(true))
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return ErrCouponUserLimit
+	case err != nil:
+		r.logger.Error().Err(err).Msg("error occurred while counting coupon redemption")
+		return ErrUnexpectedRedeem
+	}
+	return nil
+}
+
+// giveBack decrements the usage count of the coupon and, when userCounted, the count of the user. Failures are
+// logged, the counts stay too high which rejects redemptions rather than exceeding the limits.
+func (r *CouponsRepo) giveBack(ctx context.Context, id primitive.ObjectID, user string, userCounted bool) error {
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "usageCount", Value: doc("$gt", 0)},
+	}
+	if _, err := r.collection().UpdateOne(ctx, filter, doc("$inc", doc("usageCount", -1))); err != nil {
+		r.logger.Error().Err(err).Str("couponId", id.Hex()).Msg("error occurred while giving back coupon usage")
+		return ErrUnexpectedRedeem
+	}
+	if !userCounted {
+		return nil
+	}
+	filter = bson.D{
+		primitive.E{Key: "couponId", Value: id},
+		primitive.E{Key: "user", Value: user},
+		primitive.E{Key: "count", Value: doc("$gt", 0)},
+	}
+	if _, err := r.userCounts().UpdateOne(ctx, filter, doc("$inc", doc("count", -1))); err != nil {
+		r.logger.Error().Err(err).Str("couponId", id.Hex()).Msg("error occurred while giving back coupon user count")
+		return ErrUnexpectedRedeem
+	}
+	return nil
+}
+
+// notRedeemable tells why a redemption matched no coupon.
+func (r *CouponsRepo) notRedeemable(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	var coupon data.Coupon
+	if err := r.collection().FindOne(ctx, doc("_id", id)).Decode(&coupon); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrCouponNotFound
+		}
+		r.logger.Error().Err(err).Msg("error occurred while reading coupon")
+		return ErrUnexpectedRedeem
+	}
+	if !coupon.ActiveAt(now) {
+		return ErrCouponNotActive
+	}
+	// the only condition left, also when a redemption was released in between
+	return ErrCouponUsageLimit
+}
+
+// Release gives a redemption back so that it no longer counts against the limits, releasing a redemption that
+// is not recorded does nothing. The redemption is removed before the counts are decremented, a failure in between
+// leaves the counts too high rather than letting a retry decrement them twice.
+func (r *CouponsRepo) Release(ctx context.Context, id, redemptionID primitive.ObjectID) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: redemptionID},
+		primitive.E{Key: "couponId", Value: id},
+	}
+	var redemption data.CouponRedemption
+	if err := r.redemptions().FindOneAndDelete(ctx, filter).Decode(&redemption); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		r.logger.Error().Err(err).Msg("error occurred while releasing coupon redemption")
+		return ErrUnexpectedRedeem
+	}
+	return r.giveBack(ctx, id, redemption.User, true)
+}
@@ -0,0 +1,183 @@
+package db_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/go-faker/faker/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newCoupon(t *testing.T, repo *db.CouponsRepo, usageLimit, perUserLimit int64) *data.Coupon {
+	t.Helper()
+	// the user limits rely on the unique index of the user counts
+	require.NoError(t, repo.EnsureIndexes(context.TODO()))
+	percent := money.MustParseAmount("10")
+	coupon := &data.Coupon{
+		Code:         strings.ToUpper(faker.Password()),
+		CouponTerms:  data.CouponTerms{Type: data.PercentageDiscount, Percent: &percent},
+		UsageLimit:   usageLimit,
+		PerUserLimit: perUserLimit,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	_, err := repo.Create(context.TODO(), coupon)
+	require.NoError(t, err)
+	return coupon
+}
+
+func redemption(user string) *data.CouponRedemption {
+	return &data.CouponRedemption{ID: primitive.NewObjectID(), User: user}
+}
+
+func TestCouponsRepo_CreateAndGet(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	require.NoError(t, repo.EnsureIndexes(context.TODO()))
+	coupon := newCoupon(t, repo, 0, 0)
+
+	found, err := repo.GetByCode(context.TODO(), coupon.Code)
+	require.NoError(t, err)
+	assert.Equal(t, coupon.ID, found.ID)
+	assert.Equal(t, "10", found.Percent.String())
+
+	duplicate := *coupon
+	duplicate.ID = primitive.NilObjectID
+	_, err = repo.Create(context.TODO(), &duplicate)
+	assert.ErrorIs(t, err, db.ErrCouponCodeExists)
+
+	_, err = repo.GetByID(context.TODO(), primitive.NewObjectID())
+	assert.ErrorIs(t, err, db.ErrCouponNotFound)
+}
+
+func TestCouponsRepo_Update(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	coupon := newCoupon(t, repo, 0, 0)
+	require.NoError(t, repo.Redeem(context.TODO(), coupon.ID, redemption("user")))
+
+	amount := money.MustParseAmount("5")
+	coupon.CouponTerms = data.CouponTerms{Type: data.FixedDiscount, Amount: &amount, Currency: "USD"}
+	coupon.UsageCount = 0
+	require.NoError(t, repo.Update(context.TODO(), coupon))
+
+	updated, err := repo.GetByID(context.TODO(), coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, data.FixedDiscount, updated.Type)
+	assert.Nil(t, updated.Percent, "percent should be removed")
+	assert.Equal(t, int64(1), updated.UsageCount, "updates should not reset the usage count")
+
+	assert.ErrorIs(t, repo.Update(context.TODO(), &data.Coupon{ID: primitive.NewObjectID()}), db.ErrCouponNotFound)
+}
+
+func TestCouponsRepo_Redeem_Limits(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	coupon := newCoupon(t, repo, 2, 1)
+
+	require.NoError(t, repo.Redeem(context.TODO(), coupon.ID, redemption("alice")))
+	assert.ErrorIs(t, repo.Redeem(context.TODO(), coupon.ID, redemption("alice")), db.ErrCouponUserLimit)
+	require.NoError(t, repo.Redeem(context.TODO(), coupon.ID, redemption("bob")))
+	assert.ErrorIs(t, repo.Redeem(context.TODO(), coupon.ID, redemption("carol")), db.ErrCouponUsageLimit)
+	assert.ErrorIs(t, repo.Redeem(context.TODO(), primitive.NewObjectID(), redemption("carol")), db.ErrCouponNotFound)
+}
+
+func TestCouponsRepo_Redeem_NotActive(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	coupon := newCoupon(t, repo, 0, 0)
+	validUntil := time.Now().Add(-time.Hour)
+	coupon.ValidUntil = &validUntil
+	require.NoError(t, repo.Update(context.TODO(), coupon))
+	assert.ErrorIs(t, repo.Redeem(context.TODO(), coupon.ID, redemption("alice")), db.ErrCouponNotActive)
+}
+
+func TestCouponsRepo_Redeem_Concurrently(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	coupon := newCoupon(t, repo, 5, 0)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.Redeem(context.TODO(), coupon.ID, redemption(faker.Username()))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	redeemed := 0
+	for err := range errs {
+		if err == nil {
+			redeemed++
+			continue
+		}
+		assert.ErrorIs(t, err, db.ErrCouponUsageLimit)
+	}
+	assert.Equal(t, 5, redeemed)
+	stored, err := repo.GetByID(context.TODO(), coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stored.UsageCount)
+}
+
+func TestCouponsRepo_Release(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	coupon := newCoupon(t, repo, 1, 0)
+	first := redemption("alice")
+	require.NoError(t, repo.Redeem(context.TODO(), coupon.ID, first))
+
+	require.NoError(t, repo.Release(context.TODO(), coupon.ID, first.ID))
+	require.NoError(t, repo.Release(context.TODO(), coupon.ID, first.ID), "releasing twice should do nothing")
+	stored, err := repo.GetByID(context.TODO(), coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stored.UsageCount)
+	assert.NoError(t, repo.Redeem(context.TODO(), coupon.ID, redemption("bob")), "released redemptions should be usable")
+}
+
+func TestCouponsRepo_Redeem_UserLimitConcurrently(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	coupon := newCoupon(t, repo, 0, 2)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.Redeem(context.TODO(), coupon.ID, redemption("alice"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	redeemed := 0
+	for err := range errs {
+		if err == nil {
+			redeemed++
+			continue
+		}
+		assert.ErrorIs(t, err, db.ErrCouponUserLimit)
+	}
+	assert.Equal(t, 2, redeemed)
+	stored, err := repo.GetByID(context.TODO(), coupon.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.UsageCount, "rejected redemptions should give the usage back")
+}
+
+func TestCouponsRepo_Release_UserLimit(t *testing.T) {
+	repo := db.NewCouponsRepo(testDBMgr.Database(), lgr)
+	coupon := newCoupon(t, repo, 0, 1)
+	first := redemption("alice")
+	require.NoError(t, repo.Redeem(context.TODO(), coupon.ID, first))
+	assert.ErrorIs(t, repo.Redeem(context.TODO(), coupon.ID, redemption("alice")), db.ErrCouponUserLimit)
+
+	require.NoError(t, repo.Release(context.TODO(), coupon.ID, first.ID))
+	assert.NoError(t, repo.Redeem(context.TODO(), coupon.ID, redemption("alice")),
+		"a released redemption should no longer count against the user")
+	assert.NoError(t, repo.Release(context.TODO(), primitive.NewObjectID(), first.ID),
+		"redemptions are released from their own coupon only")
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const CustomersCollection = "customers"
+
+var (
+	ErrInvalidCustomerID        = errors.New("invalid customer id")
+	ErrCustomerNotFound         = errors.New("customer doesn't exist")
+	ErrCustomerEmailExists      = errors.New("a customer with the same email already exists")
+	ErrFailedToCreateCustomer   = errors.New("failed to create customer")
+	ErrUnexpectedUpdateCustomer = errors.New("unexpected error occurred while updating customer")
+	ErrUnexpectedDeleteCustomer = errors.New("unexpected error occurred while deleting customer")
+)
+
+type CustomersDataService interface {
+	Create(ctx context.Context, customer *data.Customer) (string, error)
+	Update(ctx context.Context, customer *data.Customer) error
+	GetAll(ctx context.Context, query *CustomersQuery) ([]data.Customer, error)
+	GetByID(ctx context.Context, id primitive.ObjectID) (*data.Customer, error)
+	DeleteByID(ctx context.Context, id primitive.ObjectID) error
+}
+
+// CustomersQuery pages through the customers sorted by email, Email restricts the list to the customer with
+// that email and User to the customers of that user.
+type CustomersQuery struct {
+	Email  string
+	User   string
+	Limit  int64
+	Offset int64
+}
+
+type CustomersRepo struct {
+	database MongoDatabase
+	logger   *logger.AppLogger
+}
+
+func NewCustomersRepo(db MongoDatabase, lgr *logger.AppLogger) *CustomersRepo {
+	return &CustomersRepo{
+		database: db,
+		logger:   lgr,
+	}
+}
+
+// collection is resolved per operation, see OrdersRepo.collection.
+func (r *CustomersRepo) collection() *mongo.Collection {
+	if r.database == nil {
+		return nil
+	}
+	return r.database.Collection(CustomersCollection)
+}
+
+// legacyCustomerIndexes are dropped by EnsureIndexes, emails used to be unique across the users.
+var legacyCustomerIndexes = []string{"email_unique", "user_email"}
+
+// EnsureIndexes makes the emails unique among the customers of a user and drops the indexes it replaces, it is
+// safe to call on every start.
+func (r *CustomersRepo) EnsureIndexes(ctx context.Context) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	for _, name := range legacyCustomerIndexes {
+		if _, err := r.collection().Indexes().DropOne(ctx, name); err != nil && !isIndexNotFound(err) {
+			r.logger.Error().Err(err).Str("index", name).Msg("failed to drop customers index")
+			return err
+		}
+	}
+	_, err := r.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			primitive.E{Key: "user", Value: 1},
+			primitive.E{Key: "email", Value: 1},
+		},
+		Options: options.Index().SetName("user_email_unique").SetUnique(true),
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("failed to create customers indexes")
+		return err
+	}
+	return nil
+}
+
+// isIndexNotFound reports the errors of dropping an index, or the index of a collection, that doesn't exist.
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")
+}
+
+func (r *CustomersRepo) Create(ctx context.Context, customer *data.Customer) (string, error) {
+	if err := validate(r.collection()); err != nil {
+		return "", err
+	}
+	if !customer.ID.IsZero() {
+		return "", ErrInvalidCustomerID
+	}
+	result, err := r.collection().InsertOne(ctx, customer)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", ErrCustomerEmailExists
+		}
+		r.logger.Error().Err(err).Msg("error occurred while creating customer")
+		return "", ErrFailedToCreateCustomer
+	}
+	customer.ID = result.InsertedID.(primitive.ObjectID)
+	r.logger.Info().Str("customerId", customer.ID.Hex()).Msg("customer created successfully")
+	return customer.ID.Hex(), nil
+}
+
+// Update replaces the profile and the addresses of the customer, the orders keep the addresses they were
+// created with.
+func (r *CustomersRepo) Update(ctx context.Context, customer *data.Customer) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	if customer.ID.IsZero() {
+		return ErrInvalidCustomerID
+	}
+	customer.UpdatedAt = time.Now()
+	fields := bson.D{
+		primitive.E{Key: "name", Value: customer.Name},
+		primitive.E{Key: "email", Value: customer.Email},
+		primitive.E{Key: "addresses", Value: customer.Addresses},
+		primitive.E{Key: "updatedAt", Value: customer.UpdatedAt},
+	}
+	if customer.Phone != "" {
+		fields = append(fields, primitive.E{Key: "phone", Value: customer.Phone})
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: fields}}
+	if customer.Phone == "" {
+		update = append(update, primitive.E{Key: "$unset", Value: doc("phone", "")})
+	}
+	result, err := r.collection().UpdateByID(ctx, customer.ID, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrCustomerEmailExists
+		}
+		r.logger.Error().Err(err).Msg("error occurred while updating customer")
+		return ErrUnexpectedUpdateCustomer
+	}
+	if result.MatchedCount == 0 {
+		return ErrCustomerNotFound
+	}
+	return nil
+}
+
+// GetAll returns a page of the customers sorted by email.
+func (r *CustomersRepo) GetAll(ctx context.Context, query *CustomersQuery) ([]data.Customer, error) {
+	if err := validate(r.collection()); err != nil {
+		return nil, err
+	}
+	filter := bson.D{}
+	if query.Email != "" {
+		filter = append(filter, primitive.E{Key: "email", Value: query.Email})
+	}
+	if query.User != "" {
+		filter = append(filter, primitive.E{Key: "user", Value: query.User})
+	}
+	findOptions := options.Find().SetSort(doc("email", 1)).SetSkip(query.Offset)
+	if query.Limit > 0 {
+		findOptions.SetLimit(query.Limit)
+	}
+	cursor, err := r.collection().Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	customers := []data.Customer{}
+	if err = cursor.All(ctx, &customers); err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+func (r *CustomersRepo) GetByID(ctx context.Context, id primitive.ObjectID) (*data.Customer, error) {
+	if err := validate(r.collection()); err != nil {
+		return nil, err
+	}
+	var customer data.Customer
+	if err := r.collection().FindOne(ctx, doc("_id", id)).Decode(&customer); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// DeleteByID removes the customer, its orders are kept with the addresses they were created with.
+func (r *CustomersRepo) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	if err := validate(r.collection()); err != nil {
+		return err
+	}
+	res, err := r.collection().DeleteOne(ctx, doc("_id", id))
+	if err != nil {
+		return ErrUnexpectedDeleteCustomer
+	}
+	if res.DeletedCount == 0 {
+		return ErrCustomerNotFound
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package db_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/go-faker/faker/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newCustomer(t *testing.T, repo *db.CustomersRepo) *data.Customer {
+	t.Helper()
+	customer := &data.Customer{
+		User:  "customer-1",
+		Name:  faker.Name(),
+		Email: strings.ToLower(faker.Email()),
+		Phone: "+14155552671",
+		Addresses: []data.CustomerAddress{{
+			ID:      primitive.NewObjectID(),
+			Type:    data.ShippingAddressType,
+			Default: true,
+			Address: data.Address{Name: "Jane Doe", Line1: "1 Main St", City: "San Francisco", Region: "CA",
+				PostalCode: "94105", Country: "US"},
+		}},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	_, err := repo.Create(context.TODO(), customer)
+	require.NoError(t, err)
+	return customer
+}
+
+func TestCustomersRepo_CreateAndGet(t *testing.T) {
+	repo := db.NewCustomersRepo(testDBMgr.Database(), lgr)
+	require.NoError(t, repo.EnsureIndexes(context.TODO()))
+	customer := newCustomer(t, repo)
+
+	found, err := repo.GetByID(context.TODO(), customer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, customer.Email, found.Email)
+	require.Len(t, found.Addresses, 1)
+	assert.Equal(t, "94105", found.Addresses[0].PostalCode)
+
+	duplicate := *customer
+	duplicate.ID = primitive.NilObjectID
+	_, err = repo.Create(context.TODO(), &duplicate)
+	assert.ErrorIs(t, err, db.ErrCustomerEmailExists)
+
+	customers, err := repo.GetAll(context.TODO(), &db.CustomersQuery{Email: customer.Email})
+	require.NoError(t, err)
+	require.Len(t, customers, 1)
+	assert.Equal(t, customer.ID, customers[0].ID)
+
+	customers, err = repo.GetAll(context.TODO(), &db.CustomersQuery{Email: customer.Email, User: "customer-2"})
+	require.NoError(t, err)
+	assert.Empty(t, customers, "the customers of other users should not be listed")
+
+	_, err = repo.GetByID(context.TODO(), primitive.NewObjectID())
+	assert.ErrorIs(t, err, db.ErrCustomerNotFound)
+}
+
+func TestCustomersRepo_Update(t *testing.T) {
+	repo := db.NewCustomersRepo(testDBMgr.Database(), lgr)
+	customer := newCustomer(t, repo)
+
+	customer.Phone = ""
+	customer.Addresses = append(customer.Addresses, data.CustomerAddress{
+		ID: primitive.NewObjectID(), Type: data.BillingAddressType, Address: data.Address{Country: "DE"},
+	})
+	require.NoError(t, repo.Update(context.TODO(), customer))
+
+	updated, err := repo.GetByID(context.TODO(), customer.ID)
+	require.NoError(t, err)
+	assert.Empty(t, updated.Phone, "phone should be removed")
+	assert.Len(t, updated.Addresses, 2)
+
+	assert.ErrorIs(t, repo.Update(context.TODO(), &data.Customer{ID: primitive.NewObjectID()}), db.ErrCustomerNotFound)
+}
+
+func TestCustomersRepo_DeleteByID(t *testing.T) {
+	repo := db.NewCustomersRepo(testDBMgr.Database(), lgr)
+	customer := newCustomer(t, repo)
+	require.NoError(t, repo.DeleteByID(context.TODO(), customer.ID))
+	assert.ErrorIs(t, repo.DeleteByID(context.TODO(), customer.ID), db.ErrCustomerNotFound)
+}
+
+func TestCustomersRepo_EmailUniquePerUser(t *testing.T) {
+	repo := db.NewCustomersRepo(testDBMgr.Database(), lgr)
+	require.NoError(t, repo.EnsureIndexes(context.TODO()))
+	customer := newCustomer(t, repo)
+
+	another := *customer
+	another.ID = primitive.NilObjectID
+	another.User = "customer-2"
+	_, err := repo.Create(context.TODO(), &another)
+	require.NoError(t, err, "another user should have a customer with the same email")
+
+	duplicate := *customer
+	duplicate.ID = primitive.NilObjectID
+	_, err = repo.Create(context.TODO(), &duplicate)
+	assert.ErrorIs(t, err, db.ErrCustomerEmailExists)
+
+	other := newCustomer(t, repo)
+	other.Email = customer.Email
+	assert.ErrorIs(t, repo.Update(context.TODO(), other), db.ErrCustomerEmailExists)
+}
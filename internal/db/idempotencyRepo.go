@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const IdempotencyCollection = "idempotencyKeys"
+
+var (
+	ErrIdempotencyKeyExists   = errors.New("idempotency key was already used")
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key doesn't exist")
+	ErrIdempotencyLockLost    = errors.New("idempotency key is no longer locked by the request")
+	ErrUnexpectedIdempotency  = errors.New("unexpected error occurred while storing idempotency key")
+)
+
+type IdempotencyDataService interface {
+	Begin(ctx context.Context, record *data.IdempotencyRecord) (*data.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *data.IdempotencyRecord, response *data.IdempotencyResponse) error
+	Release(ctx context.Context, record *data.IdempotencyRecord) error
+}
+
+type IdempotencyRepo struct {
+	database MongoDatabase
+	logger   *logger.AppLogger
+}
+
+func NewIdempotencyRepo(db MongoDatabase, lgr *logger.AppLogger) *IdempotencyRepo {
+	return &IdempotencyRepo{
+		database: db,
+		logger:   lgr,
+	}
+}
+
+// collection is resolved per operation, see OrdersRepo.collection.
+func (i *IdempotencyRepo) collection() *mongo.Collection {
+	if i.database == nil {
+		return nil
+	}
+	return i.database.Collection(IdempotencyCollection)
+}
+
+// EnsureIndexes creates the TTL index that removes records once they expire, it is safe to call on every start.
+func (i *IdempotencyRepo) EnsureIndexes(ctx context.Context) error {
+	if err := validate(i.collection()); err != nil {
+		return err
+	}
+	_, err := i.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{primitive.E{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		i.logger.Error().Err(err).Msg("failed to create idempotency indexes")
+		return err
+	}
+	return nil
+}
+
+// Begin stores record as in flight. When the key is already taken the stored record is returned with
+// ErrIdempotencyKeyExists, unless it is an in flight record whose lock expired (the first request never finished),
+// in which case record takes it over.
+func (i *IdempotencyRepo) Begin(ctx context.Context, record *data.IdempotencyRecord) (*data.IdempotencyRecord, error) {
+	if err := validate(i.collection()); err != nil {
+		return nil, err
+	}
+	record.Status = data.IdempotencyInFlight
+	record.Response = nil
+	_, err := i.collection().InsertOne(ctx, record)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		i.logger.Error().Err(err).Msg("error occurred while storing idempotency key")
+		return nil, ErrUnexpectedIdempotency
+	}
+
+	staleLock := bson.D{
+		primitive.E{Key: "_id", Value: record.Key},
+		primitive.E{Key: "status", Value: data.IdempotencyInFlight},
+		primitive.E{Key: "lockedUntil", Value: bson.D{primitive.E{Key: "$lt", Value: time.Now()}}},
+	}
+	result, err := i.collection().ReplaceOne(ctx, staleLock, record)
+	if err != nil {
+		i.logger.Error().Err(err).Msg("error occurred while taking over idempotency key")
+		return nil, ErrUnexpectedIdempotency
+	}
+	if result.MatchedCount == 1 {
+		return nil, nil
+	}
+
+	var existing data.IdempotencyRecord
+	err = i.collection().FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: record.Key}}).Decode(&existing)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// expired and removed in between, the caller may retry
+			return nil, ErrIdempotencyKeyNotFound
+		}
+		i.logger.Error().Err(err).Msg("error occurred while reading idempotency key")
+		return nil, ErrUnexpectedIdempotency
+	}
+	return &existing, ErrIdempotencyKeyExists
+}
+
+// Complete stores the response of the request that holds the lock of record, it is replayed for later retries.
+// ErrIdempotencyLockLost is returned when the lock expired and was taken over or released, the response of the
+// request that holds the key now is kept.
+func (i *IdempotencyRepo) Complete(ctx context.Context, record *data.IdempotencyRecord,
+	response *data.IdempotencyResponse) error {
+	if err := validate(i.collection()); err != nil {
+		return err
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: data.IdempotencyCompleted},
+		primitive.E{Key: "response", Value: response},
+	}}}
+	result, err := i.collection().UpdateOne(ctx, ownLock(record), update)
+	if err != nil {
+		i.logger.Error().Err(err).Msg("error occurred while storing idempotent response")
+		return ErrUnexpectedIdempotency
+	}
+	if result.MatchedCount == 0 {
+		return ErrIdempotencyLockLost
+	}
+	return nil
+}
+
+// Release removes the in flight record so that a retry is processed again, used when the request failed
+// unexpectedly. Only the lock of record is removed, a request that took the key over after the lock of record
+// expired keeps it.
+func (i *IdempotencyRepo) Release(ctx context.Context, record *data.IdempotencyRecord) error {
+	if err := validate(i.collection()); err != nil {
+		return err
+	}
+	_, err := i.collection().DeleteOne(ctx, ownLock(record))
+	if err != nil {
+		i.logger.Error().Err(err).Msg("error occurred while releasing idempotency key")
+		return ErrUnexpectedIdempotency
+	}
+	return nil
+}
+
+// ownLock matches the key of record while the request of record still holds it.
+func ownLock(record *data.IdempotencyRecord) bson.D {
+	return bson.D{
+		primitive.E{Key: "_id", Value: record.Key},
+		primitive.E{Key: "status", Value: data.IdempotencyInFlight},
+		primitive.E{Key: "lockedUntil", Value: record.LockedUntil},
+	}
+}
@@ -0,0 +1,114 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/go-faker/faker/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIdempotencyRecord(lockedFor time.Duration) *data.IdempotencyRecord {
+	now := time.Now()
+	return &data.IdempotencyRecord{
+		Key:         faker.UUIDHyphenated(),
+		RequestHash: "hash",
+		CreatedAt:   now,
+		LockedUntil: now.Add(lockedFor),
+		ExpiresAt:   now.Add(time.Hour),
+	}
+}
+
+func TestIdempotencyRepo_BeginAndComplete(t *testing.T) {
+	repo := db.NewIdempotencyRepo(testDBMgr.Database(), lgr)
+	require.NoError(t, repo.EnsureIndexes(context.TODO()))
+
+	record := newIdempotencyRecord(time.Minute)
+	existing, err := repo.Begin(context.TODO(), record)
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	retry := *record
+	existing, err = repo.Begin(context.TODO(), &retry)
+	assert.ErrorIs(t, err, db.ErrIdempotencyKeyExists)
+	require.NotNil(t, existing)
+	assert.Equal(t, data.IdempotencyInFlight, existing.Status)
+
+	response := &data.IdempotencyResponse{StatusCode: 201, Headers: map[string]string{"ETag": `"x-1"`}, Body: []byte(`{}`)}
+	require.NoError(t, repo.Complete(context.TODO(), record, response))
+	existing, err = repo.Begin(context.TODO(), &retry)
+	assert.ErrorIs(t, err, db.ErrIdempotencyKeyExists)
+	assert.Equal(t, data.IdempotencyCompleted, existing.Status)
+	assert.Equal(t, response, existing.Response)
+}
+
+func TestIdempotencyRepo_StaleLockIsTakenOver(t *testing.T) {
+	repo := db.NewIdempotencyRepo(testDBMgr.Database(), lgr)
+	record := newIdempotencyRecord(-time.Second)
+	_, err := repo.Begin(context.TODO(), record)
+	require.NoError(t, err)
+
+	retry := *record
+	retry.LockedUntil = time.Now().Add(time.Minute)
+	existing, err := repo.Begin(context.TODO(), &retry)
+	assert.NoError(t, err)
+	assert.Nil(t, existing)
+}
+
+func TestIdempotencyRepo_Release(t *testing.T) {
+	repo := db.NewIdempotencyRepo(testDBMgr.Database(), lgr)
+	record := newIdempotencyRecord(time.Minute)
+	_, err := repo.Begin(context.TODO(), record)
+	require.NoError(t, err)
+	require.NoError(t, repo.Release(context.TODO(), record))
+	assert.ErrorIs(t, repo.Complete(context.TODO(), record, &data.IdempotencyResponse{}), db.ErrIdempotencyLockLost)
+}
+
+func TestIdempotencyRepo_ReleaseKeepsTakenOverKey(t *testing.T) {
+	repo := db.NewIdempotencyRepo(testDBMgr.Database(), lgr)
+	record := newIdempotencyRecord(-time.Second)
+	_, err := repo.Begin(context.TODO(), record)
+	require.NoError(t, err)
+
+	retry := *record
+	retry.LockedUntil = time.Now().Add(time.Minute)
+	_, err = repo.Begin(context.TODO(), &retry)
+	require.NoError(t, err)
+
+	// the slow first request gives up after the retry took the key over
+	require.NoError(t, repo.Release(context.TODO(), record))
+	another := retry
+	existing, err := repo.Begin(context.TODO(), &another)
+	assert.ErrorIs(t, err, db.ErrIdempotencyKeyExists)
+	require.NotNil(t, existing)
+	assert.Equal(t, data.IdempotencyInFlight, existing.Status)
+}
+
+func TestIdempotencyRepo_CompleteKeepsTakenOverKey(t *testing.T) {
+	repo := db.NewIdempotencyRepo(testDBMgr.Database(), lgr)
+	record := newIdempotencyRecord(-time.Second)
+	_, err := repo.Begin(context.TODO(), record)
+	require.NoError(t, err)
+
+	retry := *record
+	retry.LockedUntil = time.Now().Add(time.Minute)
+	_, err = repo.Begin(context.TODO(), &retry)
+	require.NoError(t, err)
+
+	// the slow first request finishes after the retry took the key over
+	stale := &data.IdempotencyResponse{StatusCode: 201, Body: []byte(`{"orderId": "1"}`)}
+	assert.ErrorIs(t, repo.Complete(context.TODO(), record, stale), db.ErrIdempotencyLockLost)
+	another := retry
+	existing, err := repo.Begin(context.TODO(), &another)
+	assert.ErrorIs(t, err, db.ErrIdempotencyKeyExists)
+	require.NotNil(t, existing)
+	assert.Equal(t, data.IdempotencyInFlight, existing.Status, "the retry should still hold the key")
+	assert.Nil(t, existing.Response)
+
+	response := &data.IdempotencyResponse{StatusCode: 201, Body: []byte(`{"orderId": "2"}`)}
+	require.NoError(t, repo.Complete(context.TODO(), &retry, response))
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const SchemaMigrationsCollection = "schemaMigrations"
+
+var ErrMigrationFailed = errors.New("failed to apply migration")
+
+// Migration is an index or schema change, it runs once per database and must be safe to run again
+// if it was interrupted before being recorded.
+type Migration struct {
+	ID          string
+	Description string
+	Up          func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error
+}
+
+type migrationRecord struct {
+	ID          string    `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// Migrations are applied in order, new migrations are appended.
+var Migrations = []Migration{
+	{
+		ID:          "0001_orders_indexes",
+		Description: "index orders by creation time for pagination",
+		Up: func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+			return NewOrderRepo(db, lgr).EnsureIndexes(ctx)
+		},
+	},
+	{
+		ID:          "0002_idempotency_keys_ttl",
+		Description: "expire idempotency keys",
+		Up: func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+			return NewIdempotencyRepo(db, lgr).EnsureIndexes(ctx)
+		},
+	},
+	{
+		ID:          "0003_orders_decimal_money",
+		Description: "store order prices and totals as decimal128 and give orders a currency",
+		Up: func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+			return migrateOrderAmounts(ctx, db.Collection(OrdersCollection), lgr)
+		},
+	},
+	{
+		ID:          "0004_coupons_indexes",
+		Description: "make coupon codes unique",
+		Up: func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+			return NewCouponsRepo(db, lgr).EnsureIndexes(ctx)
+		},
+	},
+	{
+		ID:          "0005_customers_indexes",
+		Description: "make customer emails unique and index the orders of a customer",
+		Up: func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+			if err := NewCustomersRepo(db, lgr).EnsureIndexes(ctx); err != nil {
+				return err
+			}
+			return NewOrderRepo(db, lgr).EnsureIndexes(ctx)
+		},
+	},
+	{
+		ID:          "0006_coupon_redemptions",
+		Description: "move the redemptions of the coupons to their own collection and count them per user",
+		Up: func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+			if err := NewCouponsRepo(db, lgr).EnsureIndexes(ctx); err != nil {
+				return err
+			}
+			return migrateCouponRedemptions(ctx, db, lgr)
+		},
+	},
+	{
+		ID:          "0007_customers_user_email",
+		Description: "make customer emails unique per user instead of across the users",
+		Up: func(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+			return NewCustomersRepo(db, lgr).EnsureIndexes(ctx)
+		},
+	},
+}
+
+// Migrate applies the migrations that were not applied yet and returns their ids.
+func Migrate(ctx context.Context, db MongoDatabase, migrations []Migration, lgr *logger.AppLogger) ([]string, error) {
+	collection := db.Collection(SchemaMigrationsCollection)
+	if err := validate(collection); err != nil {
+		return nil, err
+	}
+	var applied []string
+	for _, m := range migrations {
+		err := collection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: m.ID}}).Err()
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return applied, err
+		}
+		lgr.Info().Str("migration", m.ID).Str("description", m.Description).Msg("applying migration")
+		if err = m.Up(ctx, db, lgr); err != nil {
+			lgr.Error().Err(err).Str("migration", m.ID).Msg("migration failed")
+			return applied, errors.Join(ErrMigrationFailed, err)
+		}
+		record := migrationRecord{ID: m.ID, Description: m.Description, AppliedAt: time.Now()}
+		if _, err = collection.InsertOne(ctx, record); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return applied, err
+		}
+		applied = append(applied, m.ID)
+	}
+	return applied, nil
+}
+
+// migrateOrderAmounts converts the float64 prices of the orders stored before amounts were decimals, they are
+// rounded half to even to the minor unit of money.DefaultCurrency, the currency the orders get. Totals are
+// recomputed from the converted prices instead of converting the stored totals, which may have drifted.
+func migrateOrderAmounts(ctx context.Context, collection *mongo.Collection, lgr *logger.AppLogger) error {
+	numeric := doc("$type", bson.A{"double", "int", "long"})
+	filter := doc("$or", bson.A{
+		doc("currency", doc("$exists", false)),
+		doc("totalAmount", numeric),
+		doc("products.price", numeric),
+	})
+	places := money.DefaultCurrency.MinorUnits()
+	price := doc("$round", bson.A{doc("$toDecimal", "$$product.price"), places})
+	pipeline := mongo.Pipeline{
+		doc("$set", bson.D{
+			primitive.E{Key: "currency", Value: doc("$ifNull", bson.A{"$currency", money.DefaultCurrency})},
+			primitive.E{Key: "products", Value: doc("$map", bson.D{
+				primitive.E{Key: "input", Value: doc("$ifNull", bson.A{"$products", bson.A{}})},
+				primitive.E{Key: "as", Value: "product"},
+				primitive.E{Key: "in", Value: doc("$mergeObjects", bson.A{"$$product", doc("price", price)})},
+			})},
+		}),
+		doc("$set", doc("totalAmount", doc("$round", bson.A{
+			doc("$sum", doc("$map", bson.D{
+				primitive.E{Key: "input", Value: "$products"},
+				primitive.E{Key: "as", Value: "product"},
+				primitive.E{Key: "in", Value: doc("$multiply", bson.A{
+					"$$product.price", doc("$ifNull", bson.A{"$$product.quantity", 0}),
+				})},
+			})),
+			places,
+		}))),
+	}
+	result, err := collection.UpdateMany(ctx, filter, pipeline)
+	if err != nil {
+		return err
+	}
+	lgr.Info().Int64("orders", result.ModifiedCount).Msg("converted order amounts to decimal128")
+	return nil
+}
+
+// migrateCouponRedemptions moves the redemptions embedded in the coupons to CouponRedemptionsCollection and
+// sets the user counts from them. The embedded redemptions are removed last, so an interrupted migration
+// starts over with the same coupon.
+func migrateCouponRedemptions(ctx context.Context, db MongoDatabase, lgr *logger.AppLogger) error {
+	coupons := db.Collection(CouponsCollection)
+	cursor, err := coupons.Find(ctx, doc("redemptions", doc("$exists", true)),
+		options.Find().SetProjection(doc("redemptions", 1)))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	migrated := 0
+	for cursor.Next(ctx) {
+		var coupon struct {
+			ID          primitive.ObjectID      `bson:"_id"`
+			Redemptions []data.CouponRedemption `bson:"redemptions"`
+		}
+		if err = cursor.Decode(&coupon); err != nil {
+			return err
+		}
+		counts := map[string]int64{}
+		for _, redemption := range coupon.Redemptions {
+			redemption.CouponID = coupon.ID
+			counts[redemption.User]++
+			_, err = db.Collection(CouponRedemptionsCollection).InsertOne(ctx, redemption)
+			if err != nil && !mongo.IsDuplicateKeyError(err) {
+				return err
+			}
+		}
+		for user, count := range counts {
+			filter := bson.D{
+				primitive.E{Key: "couponId", Value: coupon.ID},
+				primitive.E{Key: "user", Value: user},
+			}
+			_, err = db.Collection(CouponUserCountsCollection).UpdateOne(ctx, filter, doc("$set", doc("count", count)),
+				options.Update().SetUpsert(true))
+			if err != nil {
+				return err
+			}
+		}
+		if _, err = coupons.UpdateByID(ctx, coupon.ID, doc("$unset", doc("redemptions", ""))); err != nil {
+			return err
+		}
+		migrated++
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	lgr.Info().Int("coupons", migrated).Msg("moved coupon redemptions to their own collection")
+	return nil
+}
+
+// doc is a single field document.
+func doc(key string, value interface{}) bson.D {
+	return bson.D{primitive.E{Key: key, Value: value}}
+}
@@ -0,0 +1,165 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMigrate(t *testing.T) {
+	runs := 0
+	migrations := []db.Migration{
+		{ID: "test_0001", Description: "counts runs", Up: func(context.Context, db.MongoDatabase, *logger.AppLogger) error {
+			runs++
+			return nil
+		}},
+	}
+	applied, err := db.Migrate(context.TODO(), testDBMgr.Database(), migrations, lgr)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test_0001"}, applied)
+
+	applied, err = db.Migrate(context.TODO(), testDBMgr.Database(), migrations, lgr)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.Equal(t, 1, runs)
+}
+
+func TestMigrate_Failure(t *testing.T) {
+	failure := errors.New("boom")
+	migrations := []db.Migration{
+		{ID: "test_failing", Up: func(context.Context, db.MongoDatabase, *logger.AppLogger) error {
+			return failure
+		}},
+	}
+	_, err := db.Migrate(context.TODO(), testDBMgr.Database(), migrations, lgr)
+	assert.ErrorIs(t, err, db.ErrMigrationFailed)
+	assert.ErrorIs(t, err, failure)
+}
+
+func TestMigration_OrderAmounts(t *testing.T) {
+	ctx := context.TODO()
+	collection := testDBMgr.Database().Collection(db.OrdersCollection)
+	result, err := collection.InsertOne(ctx, bson.D{
+		primitive.E{Key: "user", Value: "legacy"},
+		primitive.E{Key: "status", Value: data.OrderPending},
+		primitive.E{Key: "totalAmount", Value: 0.1 * 3},
+		primitive.E{Key: "products", Value: bson.A{
+			bson.D{
+				primitive.E{Key: "name", Value: "product 1"},
+				primitive.E{Key: "price", Value: 0.1},
+				primitive.E{Key: "quantity", Value: 3},
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	var migration db.Migration
+	for _, m := range db.Migrations {
+		if m.ID == "0003_orders_decimal_money" {
+			migration = m
+		}
+	}
+	require.NotNil(t, migration.Up)
+	require.NoError(t, migration.Up(ctx, testDBMgr.Database(), lgr))
+	// the migration is safe to run again
+	require.NoError(t, migration.Up(ctx, testDBMgr.Database(), lgr))
+
+	filter := bson.D{primitive.E{Key: "_id", Value: result.InsertedID}}
+	raw, err := collection.FindOne(ctx, filter).Raw()
+	require.NoError(t, err)
+	assert.Equal(t, bson.TypeDecimal128, raw.Lookup("totalAmount").Type)
+
+	var order data.Order
+	require.NoError(t, collection.FindOne(ctx, filter).Decode(&order))
+	assert.Equal(t, money.DefaultCurrency, order.Currency)
+	assert.Equal(t, "0.10", order.Products[0].Price.String())
+	assert.Equal(t, "0.30", order.TotalAmount.String())
+}
+
+func TestMigration_CouponRedemptions(t *testing.T) {
+	ctx := context.TODO()
+	database := testDBMgr.Database()
+	redemptions := bson.A{
+		data.CouponRedemption{ID: primitive.NewObjectID(), User: "alice", RedeemedAt: time.Now()},
+		data.CouponRedemption{ID: primitive.NewObjectID(), User: "alice", RedeemedAt: time.Now()},
+		data.CouponRedemption{ID: primitive.NewObjectID(), User: "bob", RedeemedAt: time.Now()},
+	}
+	result, err := database.Collection(db.CouponsCollection).InsertOne(ctx, bson.D{
+		primitive.E{Key: "code", Value: "LEGACY"},
+		primitive.E{Key: "type", Value: data.PercentageDiscount},
+		primitive.E{Key: "perUserLimit", Value: 2},
+		primitive.E{Key: "usageCount", Value: 3},
+		primitive.E{Key: "redemptions", Value: redemptions},
+	})
+	require.NoError(t, err)
+	couponID := result.InsertedID.(primitive.ObjectID)
+
+	var migration db.Migration
+	for _, m := range db.Migrations {
+		if m.ID == "0006_coupon_redemptions" {
+			migration = m
+		}
+	}
+	require.NotNil(t, migration.Up)
+	require.NoError(t, migration.Up(ctx, database, lgr))
+	// the migration is safe to run again
+	require.NoError(t, migration.Up(ctx, database, lgr))
+
+	raw, err := database.Collection(db.CouponsCollection).FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: couponID}}).Raw()
+	require.NoError(t, err)
+	_, err = raw.LookupErr("redemptions")
+	assert.Error(t, err, "the embedded redemptions should be removed")
+	moved, err := database.Collection(db.CouponRedemptionsCollection).CountDocuments(ctx,
+		bson.D{primitive.E{Key: "couponId", Value: couponID}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), moved)
+
+	repo := db.NewCouponsRepo(database, lgr)
+	assert.ErrorIs(t, repo.Redeem(ctx, couponID, redemption("alice")), db.ErrCouponUserLimit,
+		"the redemptions of the user should still count")
+	assert.NoError(t, repo.Redeem(ctx, couponID, redemption("bob")))
+}
+
+func TestMigration_CustomersUserEmail(t *testing.T) {
+	ctx := context.TODO()
+	database := testDBMgr.Database()
+	customers := database.Collection(db.CustomersCollection)
+	// not unique like the old index, other tests share emails between users
+	_, err := customers.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{primitive.E{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_unique"),
+	})
+	require.NoError(t, err)
+
+	var migration db.Migration
+	for _, m := range db.Migrations {
+		if m.ID == "0007_customers_user_email" {
+			migration = m
+		}
+	}
+	require.NotNil(t, migration.Up)
+	require.NoError(t, migration.Up(ctx, database, lgr))
+	// the migration is safe to run again
+	require.NoError(t, migration.Up(ctx, database, lgr))
+
+	specs, err := customers.Indexes().ListSpecifications(ctx)
+	require.NoError(t, err)
+	var names []string
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	assert.NotContains(t, names, "email_unique", "emails should not be unique across the users")
+	assert.Contains(t, names, "user_email_unique")
+}
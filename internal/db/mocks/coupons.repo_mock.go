@@ -0,0 +1,51 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockCouponsDataService struct {
+	CreateFunc     func(ctx context.Context, coupon *data.Coupon) (string, error)
+	UpdateFunc     func(ctx context.Context, coupon *data.Coupon) error
+	GetAllFunc     func(ctx context.Context) ([]data.Coupon, error)
+	GetByIDFunc    func(ctx context.Context, id primitive.ObjectID) (*data.Coupon, error)
+	GetByCodeFunc  func(ctx context.Context, code string) (*data.Coupon, error)
+	DeleteByIDFunc func(ctx context.Context, id primitive.ObjectID) error
+	RedeemFunc     func(ctx context.Context, id primitive.ObjectID, redemption *data.CouponRedemption) error
+	ReleaseFunc    func(ctx context.Context, id, redemptionID primitive.ObjectID) error
+}
+
+func (m *MockCouponsDataService) Create(ctx context.Context, coupon *data.Coupon) (string, error) {
+	return m.CreateFunc(ctx, coupon)
+}
+
+func (m *MockCouponsDataService) Update(ctx context.Context, coupon *data.Coupon) error {
+	return m.UpdateFunc(ctx, coupon)
+}
+
+func (m *MockCouponsDataService) GetAll(ctx context.Context) ([]data.Coupon, error) {
+	return m.GetAllFunc(ctx)
+}
+
+func (m *MockCouponsDataService) GetByID(ctx context.Context, id primitive.ObjectID) (*data.Coupon, error) {
+	return m.GetByIDFunc(ctx, id)
+}
+
+func (m *MockCouponsDataService) GetByCode(ctx context.Context, code string) (*data.Coupon, error) {
+	return m.GetByCodeFunc(ctx, code)
+}
+
+func (m *MockCouponsDataService) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	return m.DeleteByIDFunc(ctx, id)
+}
+
+func (m *MockCouponsDataService) Redeem(ctx context.Context, id primitive.ObjectID, redemption *data.CouponRedemption) error {
+	return m.RedeemFunc(ctx, id, redemption)
+}
+
+func (m *MockCouponsDataService) Release(ctx context.Context, id, redemptionID primitive.ObjectID) error {
+	return m.ReleaseFunc(ctx, id, redemptionID)
+}
@@ -0,0 +1,37 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MockCustomersDataService struct {
+	CreateFunc     func(ctx context.Context, customer *data.Customer) (string, error)
+	UpdateFunc     func(ctx context.Context, customer *data.Customer) error
+	GetAllFunc     func(ctx context.Context, query *db.CustomersQuery) ([]data.Customer, error)
+	GetByIDFunc    func(ctx context.Context, id primitive.ObjectID) (*data.Customer, error)
+	DeleteByIDFunc func(ctx context.Context, id primitive.ObjectID) error
+}
+
+func (m *MockCustomersDataService) Create(ctx context.Context, customer *data.Customer) (string, error) {
+	return m.CreateFunc(ctx, customer)
+}
+
+func (m *MockCustomersDataService) Update(ctx context.Context, customer *data.Customer) error {
+	return m.UpdateFunc(ctx, customer)
+}
+
+func (m *MockCustomersDataService) GetAll(ctx context.Context, query *db.CustomersQuery) ([]data.Customer, error) {
+	return m.GetAllFunc(ctx, query)
+}
+
+func (m *MockCustomersDataService) GetByID(ctx context.Context, id primitive.ObjectID) (*data.Customer, error) {
+	return m.GetByIDFunc(ctx, id)
+}
+
+func (m *MockCustomersDataService) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
+	return m.DeleteByIDFunc(ctx, id)
+}
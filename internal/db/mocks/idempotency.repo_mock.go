@@ -0,0 +1,26 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+)
+
+type MockIdempotencyDataService struct {
+	BeginFunc    func(ctx context.Context, record *data.IdempotencyRecord) (*data.IdempotencyRecord, error)
+	CompleteFunc func(ctx context.Context, record *data.IdempotencyRecord, response *data.IdempotencyResponse) error
+	ReleaseFunc  func(ctx context.Context, record *data.IdempotencyRecord) error
+}
+
+func (m *MockIdempotencyDataService) Begin(ctx context.Context, record *data.IdempotencyRecord) (*data.IdempotencyRecord, error) {
+	return m.BeginFunc(ctx, record)
+}
+
+func (m *MockIdempotencyDataService) Complete(ctx context.Context, record *data.IdempotencyRecord,
+	response *data.IdempotencyResponse) error {
+	return m.CompleteFunc(ctx, record, response)
+}
+
+func (m *MockIdempotencyDataService) Release(ctx context.Context, record *data.IdempotencyRecord) error {
+	return m.ReleaseFunc(ctx, record)
+}
@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 
+	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/models/data"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -11,8 +12,11 @@ type MockOrdersDataService struct {
 	CreateFunc     func(ctx context.Context, purchaseOrder *data.Order) (string, error)
 	UpdateFunc     func(ctx context.Context, purchaseOrder *data.Order) error
 	GetByIDFunc    func(ctx context.Context, id primitive.ObjectID) (*data.Order, error)
-	GetAllFunc     func(ctx context.Context, limit int64) (*[]data.Order, error)
+	GetAllFunc     func(ctx context.Context, query *db.OrdersQuery) (*db.OrdersPage, error)
 	DeleteByIDFunc func(ctx context.Context, id primitive.ObjectID) error
+
+	DeleteByIDAndVersionFunc func(ctx context.Context, id primitive.ObjectID, version int64) error
+	TotalsFunc               func(ctx context.Context, filters []db.OrderFilter) ([]db.OrderTotals, error)
 }
 
 func (m *MockOrdersDataService) Create(ctx context.Context, purchaseOrder *data.Order) (string, error) {
@@ -23,8 +27,8 @@ func (m *MockOrdersDataService) Update(ctx context.Context, purchaseOrder *data.
 	return m.UpdateFunc(ctx, purchaseOrder)
 }
 
-func (m *MockOrdersDataService) GetAll(ctx context.Context, limit int64) (*[]data.Order, error) {
-	return m.GetAllFunc(ctx, limit)
+func (m *MockOrdersDataService) GetAll(ctx context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
+	return m.GetAllFunc(ctx, query)
 }
 
 func (m *MockOrdersDataService) GetByID(ctx context.Context, id primitive.ObjectID) (*data.Order, error) {
@@ -34,3 +38,11 @@ func (m *MockOrdersDataService) GetByID(ctx context.Context, id primitive.Object
 func (m *MockOrdersDataService) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
 	return m.DeleteByIDFunc(ctx, id)
 }
+
+func (m *MockOrdersDataService) DeleteByIDAndVersion(ctx context.Context, id primitive.ObjectID, version int64) error {
+	return m.DeleteByIDAndVersionFunc(ctx, id, version)
+}
+
+func (m *MockOrdersDataService) Totals(ctx context.Context, filters []db.OrderFilter) ([]db.OrderTotals, error) {
+	return m.TotalsFunc(ctx, filters)
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/derickit/go-rest-api/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongo_command_duration_seconds",
+		Help:    "Duration of the commands sent to mongo by command name and collection.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"command", "collection"})
+	commandFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongo_command_failures_total",
+		Help: "Commands sent to mongo that failed by command name and collection.",
+	}, []string{"command", "collection"})
+	poolConnectionsInUse = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongo_pool_connections_in_use",
+		Help: "Connections to mongo checked out of the pool.",
+	})
+	poolConnectionsIdle = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongo_pool_connections_idle",
+		Help: "Open connections to mongo waiting in the pool.",
+	})
+)
+
+// commandObserver records the metrics of commands and traces them as child spans of the operation context.
+// The collection is only part of the started event so it is kept with the span by request id until the
+// command finishes.
+type commandObserver struct {
+	inFlight sync.Map
+}
+
+type observedCommand struct {
+	collection string
+	span       trace.Span
+}
+
+func (o *commandObserver) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	collection, _ := evt.Command.Lookup(evt.CommandName).StringValueOK()
+	spanName := evt.CommandName
+	if collection != "" {
+		spanName += " " + collection
+	}
+	_, span := tracing.Tracer().Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBNamespace(evt.DatabaseName),
+			semconv.DBOperationName(evt.CommandName),
+			semconv.DBCollectionName(collection),
+		))
+	o.inFlight.Store(evt.RequestID, observedCommand{collection: collection, span: span})
+}
+
+func (o *commandObserver) finished(evt event.CommandFinishedEvent, failure error) {
+	var cmd observedCommand
+	if v, ok := o.inFlight.LoadAndDelete(evt.RequestID); ok {
+		cmd = v.(observedCommand)
+	}
+	commandDuration.WithLabelValues(evt.CommandName, cmd.collection).Observe(evt.Duration.Seconds())
+	if failure != nil {
+		commandFailures.WithLabelValues(evt.CommandName, cmd.collection).Inc()
+	}
+	if cmd.span == nil {
+		return
+	}
+	if failure != nil {
+		cmd.span.RecordError(failure)
+		cmd.span.SetStatus(codes.Error, failure.Error())
+	}
+	cmd.span.End()
+}
+
+// commandMonitor observes the commands and logs them when printQueries is set.
+func (c *ConnectionManager) commandMonitor(printQueries bool) *event.CommandMonitor {
+	observer := &commandObserver{}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			observer.started(ctx, evt)
+			if printQueries {
+				c.logger.Info().Str("dbQuery", evt.Command.String()).Send()
+			}
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			observer.finished(evt.CommandFinishedEvent, nil)
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			observer.finished(evt.CommandFinishedEvent, errors.New(evt.Failure))
+		},
+	}
+}
+
+// poolMonitor keeps the connection gauges, a connection is idle from its creation until it is checked out
+// and again once it is checked in, until it is closed.
+func poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			switch evt.Type {
+			case event.ConnectionCreated, event.ConnectionReturned:
+				poolConnectionsIdle.Inc()
+			case event.ConnectionClosed:
+				poolConnectionsIdle.Dec()
+			}
+			switch evt.Type {
+			case event.GetSucceeded:
+				poolConnectionsIdle.Dec()
+				poolConnectionsInUse.Inc()
+			case event.ConnectionReturned:
+				poolConnectionsInUse.Dec()
+			}
+		},
+	}
+}
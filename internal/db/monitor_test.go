@@ -0,0 +1,35 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandMetrics(t *testing.T) {
+	_, err := db.NewOrderRepo(testDBMgr.Database(), lgr).GetAll(context.TODO(), &db.OrdersQuery{Limit: 1})
+	require.NoError(t, err)
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	var found bool
+	for _, family := range families {
+		if family.GetName() != "mongo_command_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["command"] == "find" && labels["collection"] == db.OrdersCollection {
+				found = metric.GetHistogram().GetSampleCount() > 0
+			}
+		}
+	}
+	assert.True(t, found, "find commands on the orders collection should be recorded")
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidFilter      = errors.New("unsupported order filter")
+	ErrInvalidSort        = errors.New("unsupported order sort field")
+	ErrCursorWithSort     = errors.New("cursor pagination is only supported with the default sort order")
+	ErrInvalidFilterOp    = errors.New("unsupported order filter operator")
+	ErrInvalidFilterValue = errors.New("invalid order filter value")
+)
+
+type FilterOp string
+
+const (
+	FilterEq       FilterOp = "eq"
+	FilterIn       FilterOp = "in"
+	FilterGt       FilterOp = "gt"
+	FilterGte      FilterOp = "gte"
+	FilterLt       FilterOp = "lt"
+	FilterLte      FilterOp = "lte"
+	FilterContains FilterOp = "contains"
+)
+
+type FilterKind int
+
+const (
+	FilterString FilterKind = iota
+	FilterTime
+	FilterNumber
+)
+
+// OrderFilterField describes a filterable order field, Path is the document path it is translated to
+// and Allowed, when set, restricts the accepted string values.
+type OrderFilterField struct {
+	Path    string
+	Kind    FilterKind
+	Ops     []FilterOp
+	Allowed func(value string) bool
+}
+
+// OrderFilterFields lists the fields the order list can be filtered on, keyed by query param name.
+var OrderFilterFields = map[string]OrderFilterField{
+	"status": {Path: "status", Kind: FilterString, Ops: []FilterOp{FilterEq, FilterIn}, Allowed: func(value string) bool {
+		return data.OrderStatus(value).IsValid()
+	}},
+	"currency": {Path: "currency", Kind: FilterString, Ops: []FilterOp{FilterEq, FilterIn}, Allowed: func(value string) bool {
+		return money.Currency(value).IsValid()
+	}},
+	"user":        {Path: "user", Kind: FilterString, Ops: []FilterOp{FilterEq}},
+	"customerId":  {Path: "customerId", Kind: FilterString, Ops: []FilterOp{FilterEq}, Allowed: primitive.IsValidObjectID},
+	"createdAt":   {Path: "createdAt", Kind: FilterTime, Ops: []FilterOp{FilterGt, FilterGte, FilterLt, FilterLte}},
+	"totalAmount": {Path: "totalAmount", Kind: FilterNumber, Ops: []FilterOp{FilterGt, FilterGte, FilterLt, FilterLte}},
+	"productName": {Path: "products.name", Kind: FilterString, Ops: []FilterOp{FilterEq, FilterContains}},
+}
+
+// OrderSortFields lists the fields the order list can be sorted on, keyed by query param name.
+var OrderSortFields = map[string]string{
+	"createdAt":   "createdAt",
+	"updatedAt":   "updatedAt",
+	"totalAmount": "totalAmount",
+	"status":      "status",
+}
+
+// OrderFilter is a single condition on an order field, Value holds a string, []string, time.Time or money.Amount
+// depending on the field kind and operator.
+type OrderFilter struct {
+	Field string
+	Op    FilterOp
+	Value interface{}
+}
+
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// ParseFilterParam splits a filter query param such as createdAt[gte] into the field and the operator,
+// a param without operator is an equality filter.
+func ParseFilterParam(param string) (string, FilterOp) {
+	open := strings.IndexByte(param, '[')
+	if open < 0 || !strings.HasSuffix(param, "]") {
+		return param, FilterEq
+	}
+	return param[:open], FilterOp(param[open+1 : len(param)-1])
+}
+
+// OrderFilterQueryParams returns every query param accepted by the order filters.
+func OrderFilterQueryParams() map[string]bool {
+	params := map[string]bool{}
+	for name, field := range OrderFilterFields {
+		for _, op := range field.Ops {
+			if op == FilterEq {
+				params[name] = true
+			}
+			params[name+"["+string(op)+"]"] = true
+		}
+	}
+	return params
+}
+
+// SupportsOp reports whether the filter field accepts the operator.
+func (f OrderFilterField) SupportsOp(op FilterOp) bool {
+	for _, allowed := range f.Ops {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// ordersFilterBSON translates the filters to a mongo filter, only fields and operators from OrderFilterFields
+// are accepted and values are always used as literals.
+func ordersFilterBSON(filters []OrderFilter) (bson.D, error) {
+	conditions := bson.A{}
+	for _, filter := range filters {
+		field, ok := OrderFilterFields[filter.Field]
+		if !ok {
+			return nil, ErrInvalidFilter
+		}
+		if !field.SupportsOp(filter.Op) {
+			return nil, ErrInvalidFilterOp
+		}
+		condition, err := filterCondition(field, filter)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, bson.D{primitive.E{Key: field.Path, Value: condition}})
+	}
+	if len(conditions) == 0 {
+		return bson.D{}, nil
+	}
+	return bson.D{primitive.E{Key: "$and", Value: conditions}}, nil
+}
+
+func filterCondition(field OrderFilterField, filter OrderFilter) (interface{}, error) {
+	switch filter.Op {
+	case FilterIn:
+		values, ok := filter.Value.([]string)
+		if !ok {
+			return nil, ErrInvalidFilter
+		}
+		return bson.D{primitive.E{Key: "$in", Value: values}}, nil
+	case FilterContains:
+		value, ok := filter.Value.(string)
+		if !ok {
+			return nil, ErrInvalidFilter
+		}
+		return primitive.Regex{Pattern: regexp.QuoteMeta(value), Options: "i"}, nil
+	case FilterEq:
+		value, ok := filter.Value.(string)
+		if !ok {
+			return nil, ErrInvalidFilter
+		}
+		return bson.D{primitive.E{Key: "$eq", Value: value}}, nil
+	}
+	var value interface{}
+	switch v := filter.Value.(type) {
+	case time.Time:
+		if field.Kind != FilterTime {
+			return nil, ErrInvalidFilter
+		}
+		value = v
+	case money.Amount:
+		if field.Kind != FilterNumber {
+			return nil, ErrInvalidFilter
+		}
+		value = v
+	default:
+		return nil, ErrInvalidFilter
+	}
+	return bson.D{primitive.E{Key: "$" + string(filter.Op), Value: value}}, nil
+}
+
+// ordersSortBSON returns the sort document, the id is always added as a tie breaker for a stable order.
+func ordersSortBSON(sort []SortField, defaultOrder int) (bson.D, error) {
+	if len(sort) == 0 {
+		return bson.D{
+			primitive.E{Key: "createdAt", Value: defaultOrder},
+			primitive.E{Key: "_id", Value: defaultOrder},
+		}, nil
+	}
+	sortDoc := bson.D{}
+	for _, s := range sort {
+		path, ok := OrderSortFields[s.Field]
+		if !ok {
+			return nil, ErrInvalidSort
+		}
+		order := 1
+		if s.Descending {
+			order = -1
+		}
+		sortDoc = append(sortDoc, primitive.E{Key: path, Value: order})
+	}
+	return append(sortDoc, primitive.E{Key: "_id", Value: 1}), nil
+}
@@ -0,0 +1,61 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilterParam(t *testing.T) {
+	field, op := db.ParseFilterParam("status")
+	assert.Equal(t, "status", field)
+	assert.Equal(t, db.FilterEq, op)
+
+	field, op = db.ParseFilterParam("createdAt[gte]")
+	assert.Equal(t, "createdAt", field)
+	assert.Equal(t, db.FilterGte, op)
+
+	assert.False(t, db.OrderFilterFields["status"].SupportsOp(db.FilterGt))
+	assert.True(t, db.OrderFilterQueryParams()["totalAmount[lte]"])
+	assert.False(t, db.OrderFilterQueryParams()["user[contains]"])
+}
+
+func TestOrdersRepo_GetAll_Filters(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderRepo(d, lgr)
+
+	page, err := dSvc.GetAll(context.TODO(), &db.OrdersQuery{
+		Limit: 50,
+		Filters: []db.OrderFilter{
+			{Field: "status", Op: db.FilterIn, Value: []string{string(data.OrderPending)}},
+			{Field: "totalAmount", Op: db.FilterGte, Value: money.Amount{}},
+		},
+		Sort: []db.SortField{{Field: "totalAmount", Descending: true}},
+	})
+	require.NoError(t, err)
+	for i, order := range page.Orders {
+		assert.Equal(t, data.OrderPending, order.Status)
+		if i > 0 {
+			assert.GreaterOrEqual(t, page.Orders[i-1].TotalAmount.Cmp(order.TotalAmount), 0)
+		}
+	}
+
+	_, err = dSvc.GetAll(context.TODO(), &db.OrdersQuery{
+		Limit:   10,
+		Filters: []db.OrderFilter{{Field: "status", Op: db.FilterOp("$where"), Value: "1"}},
+	})
+	assert.ErrorIs(t, err, db.ErrInvalidFilterOp)
+
+	_, err = dSvc.GetAll(context.TODO(), &db.OrdersQuery{
+		Limit:  10,
+		Sort:   []db.SortField{{Field: "totalAmount"}},
+		Cursor: &util.Cursor{},
+	})
+	assert.ErrorIs(t, err, db.ErrCursorWithSort)
+}
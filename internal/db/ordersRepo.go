@@ -3,10 +3,13 @@ package db
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
 	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -26,29 +29,70 @@ var (
 	ErrPOIDNotFound          = errors.New("purchase order doesn't exist with given id")
 	ErrFailedToCreateOrder   = errors.New("faild to create order")
 	ErrUnexpectedDeleteOrder = errors.New("unexpected error occurred while deleting orfer")
+	ErrVersionConflict       = errors.New("purchase order was modified by another request, version mismatch")
 )
 
 type OrdersDataService interface {
 	Create(ctx context.Context, purchaseOrder *data.Order) (string, error)
 	Update(ctx context.Context, purchaseOrder *data.Order) error
-	GetAll(ctx context.Context, limit int64) (*[]data.Order, error)
+	GetAll(ctx context.Context, query *OrdersQuery) (*OrdersPage, error)
 	GetByID(ctx context.Context, id primitive.ObjectID) (*data.Order, error)
 	DeleteByID(ctx context.Context, id primitive.ObjectID) error
+	DeleteByIDAndVersion(ctx context.Context, id primitive.ObjectID, version int64) error
+	Totals(ctx context.Context, filters []OrderFilter) ([]OrderTotals, error)
+}
+
+// OrdersQuery selects a page of orders, sorted newest first unless Sort is given.
+// Cursor selects the page next to a position (keyset pagination), Offset is the fallback when no cursor is given.
+// Cursors can only be combined with the default sort order.
+type OrdersQuery struct {
+	Limit        int64
+	Offset       int64
+	Cursor       *util.Cursor
+	IncludeTotal bool
+	Filters      []OrderFilter
+	Sort         []SortField
+}
+
+// OrdersPage is a page of orders, TotalCount is only set when requested by the query.
+type OrdersPage struct {
+	Orders     []data.Order
+	HasNext    bool
+	HasPrev    bool
+	TotalCount *int64
+}
+
+// OrderTotals sums the orders in Currency whose exchange rate snapshot is to BaseCurrency, BaseCurrency is empty
+// for the orders without snapshot.
+type OrderTotals struct {
+	Currency        money.Currency `bson:"currency"`
+	BaseCurrency    money.Currency `bson:"baseCurrency"`
+	Count           int64          `bson:"count"`
+	TotalAmount     money.Amount   `bson:"totalAmount"`
+	BaseTotalAmount money.Amount   `bson:"baseTotalAmount"`
 }
 
 type OrdersRepo struct {
-	collection *mongo.Collection
-	logger     *logger.AppLogger
+	database MongoDatabase
+	logger   *logger.AppLogger
 }
 
 func NewOrderRepo(db MongoDatabase, lgr *logger.AppLogger) *OrdersRepo {
 	iDBSvc := &OrdersRepo{
-		collection: db.Collection(OrdersCollection),
-		logger:     lgr,
+		database: db,
+		logger:   lgr,
 	}
 	return iDBSvc
 }
 
+// collection is resolved on every operation, so operations use the current client after credentials are reloaded.
+func (o *OrdersRepo) collection() *mongo.Collection {
+	if o.database == nil {
+		return nil
+	}
+	return o.database.Collection(OrdersCollection)
+}
+
 func validate(collection *mongo.Collection) error {
 	if collection == nil {
 		return ErrInvalidInitialization
@@ -56,14 +100,14 @@ func validate(collection *mongo.Collection) error {
 	return nil
 }
 func (o *OrdersRepo) Create(ctx context.Context, po *data.Order) (string, error) {
-	if err := validate(o.collection); err != nil {
+	if err := validate(o.collection()); err != nil {
 		return "", err
 	}
 	if !po.ID.IsZero() {
 		return "", ErrInvalidPOIDCreate
 	}
 
-	result, err := o.collection.InsertOne(ctx, po)
+	result, err := o.collection().InsertOne(ctx, po)
 	if err != nil {
 		o.logger.Error().Err(err).Msg("error occurred while creating order")
 		return "", ErrFailedToCreateOrder
@@ -71,37 +115,109 @@ func (o *OrdersRepo) Create(ctx context.Context, po *data.Order) (string, error)
 	o.logger.Info().Str("orderId", result.InsertedID.(primitive.ObjectID).Hex()).Msg("order created successfully")
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
+
+// Update replaces the order when its stored version still matches po.Version, the version is incremented atomically
+// and po.Version is set to the new version. ErrVersionConflict is returned when the order was modified in between.
 func (o *OrdersRepo) Update(ctx context.Context, po *data.Order) error {
-	if err := validate(o.collection); err != nil {
-		return nil
+	if err := validate(o.collection()); err != nil {
+		return err
 	}
 	oID, err := primitive.ObjectIDFromHex(po.ID.Hex())
 	if oID.IsZero() || err != nil {
 		return ErrInvalidPOIDUpdate
 	}
 	po.UpdatedAt = time.Now()
-	filter := bson.D{primitive.E{Key: "_id", Value: po.ID}}
-	update := bson.D{primitive.E{Key: "$set", Value: po}}
-	result, err := o.collection.UpdateOne(ctx, filter, update, nil)
+	fields, err := orderUpdateFields(po)
+	if err != nil {
+		o.logger.Error().Err(err).Msg("error occurred while encoding order for update")
+		return ErrUnexpectedUpdateOrder
+	}
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: po.ID},
+		primitive.E{Key: "version", Value: po.Version},
+	}
+	update := bson.D{
+		primitive.E{Key: "$set", Value: fields},
+		primitive.E{Key: "$inc", Value: bson.D{primitive.E{Key: "version", Value: 1}}},
+	}
+	result, err := o.collection().UpdateOne(ctx, filter, update, nil)
 	if err != nil {
 		o.logger.Error().Err(err).Msg("error occurred while updating order")
 		return ErrUnexpectedUpdateOrder
 	}
 	if result.MatchedCount == 0 {
-		o.logger.Info().Msg("order id given for updating the order is not found")
-		return ErrPOIDNotFound
+		return o.notFoundOrConflict(ctx, po.ID)
 	}
+	po.Version++
 	return nil
 }
 
-func (o *OrdersRepo) GetAll(ctx context.Context, limit int64) (*[]data.Order, error) {
-	if vErr := validate(o.collection); vErr != nil {
+// orderUpdateFields returns the fields of po to $set, the id and version are left out as they are never overwritten.
+func orderUpdateFields(po *data.Order) (bson.M, error) {
+	doc, err := bson.Marshal(po)
+	if err != nil {
+		return nil, err
+	}
+	var fields bson.M
+	if err = bson.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "_id")
+	delete(fields, "version")
+	return fields, nil
+}
+
+// notFoundOrConflict tells apart a missing order from a version mismatch after a conditional write matched nothing.
+func (o *OrdersRepo) notFoundOrConflict(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	count, err := o.collection().CountDocuments(ctx, filter)
+	if err != nil {
+		o.logger.Error().Err(err).Msg("error occurred while checking order existence")
+		return err
+	}
+	if count == 0 {
+		o.logger.Info().Str("orderId", id.Hex()).Msg("order id given for updating the order is not found")
+		return ErrPOIDNotFound
+	}
+	o.logger.Info().Str("orderId", id.Hex()).Msg("order was modified concurrently")
+	return ErrVersionConflict
+}
+
+func (o *OrdersRepo) GetAll(ctx context.Context, query *OrdersQuery) (*OrdersPage, error) {
+	if vErr := validate(o.collection()); vErr != nil {
 		return nil, vErr
 	}
-	filter := bson.M{}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if query.Cursor != nil && len(query.Sort) > 0 {
+		return nil, ErrCursorWithSort
+	}
+	filter, err := ordersFilterBSON(query.Filters)
+	if err != nil {
+		return nil, err
+	}
+	pageFilter := filter
+	sortOrder := -1
+	if query.Cursor != nil {
+		pageFilter = bson.D{primitive.E{Key: "$and", Value: bson.A{filter, keysetFilter(query.Cursor)}}}
+		if query.Cursor.Backward {
+			sortOrder = 1
+		}
+	}
+	sort, err := ordersSortBSON(query.Sort, sortOrder)
+	if err != nil {
+		return nil, err
+	}
 	findOptions := options.Find()
-	findOptions.SetLimit(limit)
-	cursor, err := o.collection.Find(ctx, filter, findOptions)
+	findOptions.SetSort(sort)
+	// one extra order tells if there is another page
+	findOptions.SetLimit(limit + 1)
+	if query.Cursor == nil && query.Offset > 0 {
+		findOptions.SetSkip(query.Offset)
+	}
+	cursor, err := o.collection().Find(ctx, pageFilter, findOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -109,16 +225,153 @@ func (o *OrdersRepo) GetAll(ctx context.Context, limit int64) (*[]data.Order, er
 	if err = cursor.All(ctx, &results); err != nil {
 		return nil, err
 	}
-	return &results, nil
+	hasMore := int64(len(results)) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+	page := &OrdersPage{Orders: results}
+	if query.Cursor != nil && query.Cursor.Backward {
+		slices.Reverse(page.Orders)
+		page.HasPrev = hasMore
+		page.HasNext = true
+	} else {
+		page.HasNext = hasMore
+		page.HasPrev = query.Cursor != nil || query.Offset > 0
+	}
+	if query.IncludeTotal {
+		total, cErr := o.collection().CountDocuments(ctx, filter)
+		if cErr != nil {
+			return nil, cErr
+		}
+		page.TotalCount = &total
+	}
+	return page, nil
+}
+
+// keysetFilter selects the orders after the cursor position in newest first order, or before it for backward cursors.
+func keysetFilter(cur *util.Cursor) bson.D {
+	op := "$lt"
+	if cur.Backward {
+		op = "$gt"
+	}
+	return bson.D{primitive.E{Key: "$or", Value: bson.A{
+		bson.D{primitive.E{Key: "createdAt", Value: bson.D{primitive.E{Key: op, Value: cur.CreatedAt}}}},
+		bson.D{
+			primitive.E{Key: "createdAt", Value: cur.CreatedAt},
+			primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: op, Value: cur.ID}}},
+		},
+	}}}
+}
+
+// Totals sums the orders matching the filters by currency and base currency of their exchange rate snapshot.
+func (o *OrdersRepo) Totals(ctx context.Context, filters []OrderFilter) ([]OrderTotals, error) {
+	if err := validate(o.collection()); err != nil {
+		return nil, err
+	}
+	filter, err := ordersFilterBSON(filters)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: filter}},
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: bson.D{
+				primitive.E{Key: "currency", Value: "$currency"},
+				primitive.E{Key: "baseCurrency", Value: "$exchangeRate.baseCurrency"},
+			}},
+			primitive.E{Key: "count", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}},
+			primitive.E{Key: "totalAmount", Value: bson.D{primitive.E{Key: "$sum", Value: "$totalAmount"}}},
+			primitive.E{Key: "baseTotalAmount", Value: bson.D{primitive.E{Key: "$sum", Value: "$exchangeRate.baseTotalAmount"}}},
+		}}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{
+			primitive.E{Key: "_id", Value: 0},
+			primitive.E{Key: "currency", Value: "$_id.currency"},
+			primitive.E{Key: "baseCurrency", Value: "$_id.baseCurrency"},
+			primitive.E{Key: "count", Value: 1},
+			primitive.E{Key: "totalAmount", Value: 1},
+			primitive.E{Key: "baseTotalAmount", Value: 1},
+		}}},
+		bson.D{primitive.E{Key: "$sort", Value: bson.D{
+			primitive.E{Key: "currency", Value: 1},
+			primitive.E{Key: "baseCurrency", Value: 1},
+		}}},
+	}
+	cursor, err := o.collection().Aggregate(ctx, pipeline)
+	if err != nil {
+		o.logger.Error().Err(err).Msg("error occurred while summing orders")
+		return nil, err
+	}
+	var totals []OrderTotals
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// Import inserts the orders or replaces the stored ones with the same id, so that an export can be imported again.
+func (o *OrdersRepo) Import(ctx context.Context, orders []data.Order) (int64, error) {
+	if err := validate(o.collection()); err != nil {
+		return 0, err
+	}
+	if len(orders) == 0 {
+		return 0, nil
+	}
+	models := make([]mongo.WriteModel, 0, len(orders))
+	for _, po := range orders {
+		if po.ID.IsZero() {
+			return 0, ErrInvalidPOIDUpdate
+		}
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{primitive.E{Key: "_id", Value: po.ID}}).
+			SetReplacement(po).
+			SetUpsert(true))
+	}
+	result, err := o.collection().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		o.logger.Error().Err(err).Msg("error occurred while importing orders")
+		return 0, err
+	}
+	return result.UpsertedCount + result.ModifiedCount, nil
+}
+
+// EnsureIndexes creates the indexes the orders queries rely on, it is safe to call on every start.
+func (o *OrdersRepo) EnsureIndexes(ctx context.Context) error {
+	if err := validate(o.collection()); err != nil {
+		return err
+	}
+	_, err := o.collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				primitive.E{Key: "createdAt", Value: -1},
+				primitive.E{Key: "_id", Value: -1},
+			},
+			Options: options.Index().SetName("createdAt_id"),
+		},
+		{
+			// the orders of a customer, newest first
+			Keys: bson.D{
+				primitive.E{Key: "customerId", Value: 1},
+				primitive.E{Key: "createdAt", Value: -1},
+				primitive.E{Key: "_id", Value: -1},
+			},
+			Options: options.Index().SetName("customerId_createdAt_id").SetPartialFilterExpression(
+				doc("customerId", doc("$exists", true))),
+		},
+	})
+	if err != nil {
+		o.logger.Error().Err(err).Msg("failed to create orders indexes")
+		return err
+	}
+	return nil
 }
 
 func (o *OrdersRepo) GetByID(ctx context.Context, oID primitive.ObjectID) (*data.Order, error) {
-	if err := validate(o.collection); err != nil {
+	if err := validate(o.collection()); err != nil {
 		return nil, err
 	}
 	filter := bson.D{primitive.E{Key: "_id", Value: oID}}
 	var result data.Order
-	err := o.collection.FindOne(ctx, filter).Decode(&result)
+	err := o.collection().FindOne(ctx, filter).Decode(&result)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrPOIDNotFound
@@ -129,11 +382,11 @@ func (o *OrdersRepo) GetByID(ctx context.Context, oID primitive.ObjectID) (*data
 }
 
 func (o *OrdersRepo) DeleteByID(ctx context.Context, id primitive.ObjectID) error {
-	if err := validate(o.collection); err != nil {
+	if err := validate(o.collection()); err != nil {
 		return err
 	}
 	filter := bson.D{primitive.E{Key: "_id", Value: id}}
-	res, err := o.collection.DeleteOne(ctx, filter)
+	res, err := o.collection().DeleteOne(ctx, filter)
 	if err != nil {
 		return ErrUnexpectedDeleteOrder
 	}
@@ -142,3 +395,22 @@ func (o *OrdersRepo) DeleteByID(ctx context.Context, id primitive.ObjectID) erro
 	}
 	return nil
 }
+
+// DeleteByIDAndVersion deletes the order only when its stored version matches the given version.
+func (o *OrdersRepo) DeleteByIDAndVersion(ctx context.Context, id primitive.ObjectID, version int64) error {
+	if err := validate(o.collection()); err != nil {
+		return err
+	}
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "version", Value: version},
+	}
+	res, err := o.collection().DeleteOne(ctx, filter)
+	if err != nil {
+		return ErrUnexpectedDeleteOrder
+	}
+	if res.DeletedCount == 0 {
+		return o.notFoundOrConflict(ctx, id)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
 	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/go-faker/faker/v4"
 	"github.com/stretchr/testify/assert"
@@ -38,7 +39,7 @@ func TestOrdersRepo_Create_Success(t *testing.T) {
 		UpdatedAt:   time.Now(),
 		User:        faker.Name(),
 		Status:      data.OrderPending,
-		TotalAmount: util.CalculateTotalAmount(products),
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 	}
 	resultID, err := dSvc.Create(context.TODO(), po)
 	if err != nil {
@@ -86,7 +87,7 @@ func TestOrdersRepo_GetByIDSuccess(t *testing.T) {
 		UpdatedAt:   time.Now(),
 		User:        faker.Email(),
 		Status:      data.OrderPending,
-		TotalAmount: util.CalculateTotalAmount(products),
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 	}
 
 	resultID, _ := dSvc.Create(context.TODO(), po)
@@ -123,7 +124,7 @@ func TestOrdersRepo_DeleteByIDSuccess(t *testing.T) {
 		UpdatedAt:   time.Now(),
 		User:        faker.Email(),
 		Status:      data.OrderPending,
-		TotalAmount: util.CalculateTotalAmount(products),
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 	}
 
 	resultID, _ := dSvc.Create(context.TODO(), po)
@@ -143,9 +144,84 @@ func TestOrdersRepo_DeleteByIDSuccess_NoData(t *testing.T) {
 func TestOrdersRepo_GetAll(t *testing.T) {
 	d := testDBMgr.Database()
 	dSvc := db.NewOrderRepo(d, lgr)
-	results, _ := dSvc.GetAll(context.TODO(), int64(4))
-	assert.Len(t, *results, 4)
+	page, err := dSvc.GetAll(context.TODO(), &db.OrdersQuery{Limit: 4})
+	require.NoError(t, err)
+	assert.Len(t, page.Orders, 4)
+	assert.True(t, page.HasNext)
+	assert.False(t, page.HasPrev)
+	assert.Nil(t, page.TotalCount)
+}
+
+func TestOrdersRepo_GetAll_Cursor(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderRepo(d, lgr)
+	all, err := dSvc.GetAll(context.TODO(), &db.OrdersQuery{Limit: 6, IncludeTotal: true})
+	require.NoError(t, err)
+	require.Len(t, all.Orders, 6)
+	require.NotNil(t, all.TotalCount)
+	assert.GreaterOrEqual(t, *all.TotalCount, int64(6))
+
+	first, err := dSvc.GetAll(context.TODO(), &db.OrdersQuery{Limit: 3})
+	require.NoError(t, err)
+	last := first.Orders[2]
+	second, err := dSvc.GetAll(context.TODO(), &db.OrdersQuery{
+		Limit:  3,
+		Cursor: &util.Cursor{CreatedAt: last.CreatedAt, ID: last.ID},
+	})
+	require.NoError(t, err)
+	assert.True(t, second.HasPrev)
+	for i := range second.Orders {
+		assert.Equal(t, all.Orders[i+3].ID, second.Orders[i].ID)
+	}
+
+	head := second.Orders[0]
+	back, err := dSvc.GetAll(context.TODO(), &db.OrdersQuery{
+		Limit:  3,
+		Cursor: &util.Cursor{CreatedAt: head.CreatedAt, ID: head.ID, Backward: true},
+	})
+	require.NoError(t, err)
+	assert.False(t, back.HasPrev)
+	for i := range back.Orders {
+		assert.Equal(t, all.Orders[i].ID, back.Orders[i].ID)
+	}
+
+	offset, err := dSvc.GetAll(context.TODO(), &db.OrdersQuery{Limit: 3, Offset: 3})
+	require.NoError(t, err)
+	for i := range offset.Orders {
+		assert.Equal(t, all.Orders[i+3].ID, offset.Orders[i].ID)
+	}
 }
+func TestOrdersRepo_Totals(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderRepo(d, lgr)
+	user := faker.Email()
+	orders := []data.Order{
+		{User: user, Currency: "EUR", TotalAmount: money.MustParseAmount("10.00"), ExchangeRate: &data.ExchangeRate{
+			BaseCurrency: "USD", Rate: money.MustParseAmount("1.1"), BaseTotalAmount: money.MustParseAmount("11.00"),
+		}},
+		{User: user, Currency: "EUR", TotalAmount: money.MustParseAmount("5.50"), ExchangeRate: &data.ExchangeRate{
+			BaseCurrency: "USD", Rate: money.MustParseAmount("1.2"), BaseTotalAmount: money.MustParseAmount("6.60"),
+		}},
+		{User: user, Currency: "EUR", TotalAmount: money.MustParseAmount("1.00")},
+	}
+	for i := range orders {
+		_, err := dSvc.Create(context.TODO(), &orders[i])
+		require.NoError(t, err)
+	}
+
+	totals, err := dSvc.Totals(context.TODO(), []db.OrderFilter{{Field: "user", Op: db.FilterEq, Value: user}})
+	require.NoError(t, err)
+	require.Len(t, totals, 2)
+	assert.Equal(t, money.Currency(""), totals[0].BaseCurrency, "orders without rate snapshot sort first")
+	assert.Equal(t, int64(1), totals[0].Count)
+	assert.Equal(t, "1.00", totals[0].TotalAmount.String())
+	assert.Equal(t, money.Currency("EUR"), totals[1].Currency)
+	assert.Equal(t, money.Currency("USD"), totals[1].BaseCurrency)
+	assert.Equal(t, int64(2), totals[1].Count)
+	assert.Equal(t, "15.50", totals[1].TotalAmount.String())
+	assert.Equal(t, "17.60", totals[1].BaseTotalAmount.String())
+}
+
 func TestOrdersRepo_UpdateOrdersSucess(t *testing.T) {
 	d := testDBMgr.Database()
 	dSvc := db.NewOrderRepo(d, lgr)
@@ -163,7 +239,7 @@ func TestOrdersRepo_UpdateOrdersSucess(t *testing.T) {
 		UpdatedAt:   time.Now(),
 		User:        faker.Email(),
 		Status:      data.OrderPending,
-		TotalAmount: util.CalculateTotalAmount(products),
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 	}
 	resultID, _ := dSvc.Create(context.TODO(), po)
 	orderID, _ := primitive.ObjectIDFromHex(resultID)
@@ -190,7 +266,7 @@ func TestOrdersRepo_UpdateOrder_EmptyOrderID(t *testing.T) {
 		UpdatedAt:   time.Now(),
 		User:        faker.Email(),
 		Status:      data.OrderPending,
-		TotalAmount: util.CalculateTotalAmount(products),
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 	}
 	po.Status = data.OrderDelivered
 	err := dSvc.Update(context.TODO(), po)
@@ -215,7 +291,7 @@ func TestOrdersRepo_UpdateOrder_BadOrderID(t *testing.T) {
 		UpdatedAt:   time.Now(),
 		User:        faker.Email(),
 		Status:      data.OrderPending,
-		TotalAmount: util.CalculateTotalAmount(products),
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 	}
 	po.Status = data.OrderDelivered
 	err := dSvc.Update(context.TODO(), po)
@@ -240,10 +316,69 @@ func TestOrdersRepo_UpdateOrder_NonExistingID(t *testing.T) {
 		UpdatedAt:   time.Now(),
 		User:        faker.Email(),
 		Status:      data.OrderPending,
-		TotalAmount: util.CalculateTotalAmount(products),
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 	}
 
 	po.Status = data.OrderDelivered
 	err := dSvc.Update(context.TODO(), po)
 	assert.EqualError(t, err, db.ErrInvalidPOIDUpdate.Error())
 }
+
+func TestOrdersRepo_UpdateOrder_VersionConflict(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderRepo(d, lgr)
+	products := []data.Product{
+		{
+			Name:     faker.Name(),
+			Price:    util.RandomPrice(),
+			UpdateAt: time.Now(),
+		},
+	}
+	po := &data.Order{
+		Version:     1,
+		Products:    products,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		User:        faker.Email(),
+		Status:      data.OrderPending,
+		TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
+	}
+	resultID, _ := dSvc.Create(context.TODO(), po)
+	orderID, _ := primitive.ObjectIDFromHex(resultID)
+	po.ID = orderID
+	stale := *po
+
+	po.Status = data.OrderProcessing
+	err := dSvc.Update(context.TODO(), po)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), po.Version)
+
+	stale.Status = data.OrderCancelled
+	err = dSvc.Update(context.TODO(), &stale)
+	assert.ErrorIs(t, err, db.ErrVersionConflict)
+
+	result, _ := dSvc.GetByID(context.TODO(), orderID)
+	assert.Equal(t, int64(2), result.Version)
+	assert.Equal(t, data.OrderProcessing, result.Status)
+}
+
+func TestOrdersRepo_DeleteByIDAndVersion(t *testing.T) {
+	d := testDBMgr.Database()
+	dSvc := db.NewOrderRepo(d, lgr)
+	po := &data.Order{
+		Version:   1,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		User:      faker.Email(),
+		Status:    data.OrderPending,
+	}
+	resultID, _ := dSvc.Create(context.TODO(), po)
+	orderID, _ := primitive.ObjectIDFromHex(resultID)
+
+	err := dSvc.DeleteByIDAndVersion(context.TODO(), orderID, 2)
+	assert.ErrorIs(t, err, db.ErrVersionConflict)
+	err = dSvc.DeleteByIDAndVersion(context.TODO(), orderID, 1)
+	require.NoError(t, err)
+	err = dSvc.DeleteByIDAndVersion(context.TODO(), orderID, 1)
+	assert.ErrorIs(t, err, db.ErrPOIDNotFound)
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	DefSideCarPollInterval = 10 * time.Second
+	DefReloadDrainTimeout  = 30 * time.Second
+
+	reloadSuccess = "success"
+	reloadFailure = "failure"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("mongo credentials are invalid")
+	ErrConnectionClosed   = errors.New("connection to DB is closed")
+)
+
+var (
+	credentialReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongo_credentials_reloads_total",
+		Help: "Reloads of the mongo credentials from the sidecar file by result.",
+	}, []string{"result"})
+	credentialReloadTime = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongo_credentials_last_reload_success_timestamp_seconds",
+		Help: "Time of the last successful reload of the mongo credentials.",
+	})
+)
+
+// ReloadOpts configures how the sidecar file is watched, missing values are filled with defaults.
+type ReloadOpts struct {
+	SideCarFile  string        // defaults to DefaultMongoDBSidecar
+	PollInterval time.Duration // how often the file is checked for changes
+	DrainTimeout time.Duration // how long in-flight operations of a replaced client may take before it is disconnected
+}
+
+func FillReloadOpts(opts *ReloadOpts) *ReloadOpts {
+	if opts == nil {
+		opts = &ReloadOpts{}
+	}
+	if opts.SideCarFile == "" {
+		opts.SideCarFile = DefaultMongoDBSidecar
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefSideCarPollInterval
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = DefReloadDrainTimeout
+	}
+	return opts
+}
+
+// ValidateCredentials checks mc can be turned into a connection url.
+func ValidateCredentials(mc *MongoDBCredentials) error {
+	if mc == nil || mc.HostName == "" {
+		return errors.Join(ErrInvalidCredentials, errors.New("hostname is missing"))
+	}
+	if (mc.User == "") != (mc.Password == "") {
+		return errors.Join(ErrInvalidCredentials, errors.New("user and password should be set together"))
+	}
+	return nil
+}
+
+// Reload connects with the credentials mc and swaps the client, repos pick up the new client with their next
+// operation. The replaced client is disconnected in the background, the driver waits for its in-use connections
+// to be returned for up to drainTimeout before closing them.
+func (c *ConnectionManager) Reload(mc *MongoDBCredentials, drainTimeout time.Duration) error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	if c.closed {
+		return ErrConnectionClosed
+	}
+	if err := ValidateCredentials(mc); err != nil {
+		credentialReloads.WithLabelValues(reloadFailure).Inc()
+		return err
+	}
+	conn, err := c.connect(mc)
+	if err != nil {
+		credentialReloads.WithLabelValues(reloadFailure).Inc()
+		return err
+	}
+	old := c.conn.Swap(conn)
+	credentialReloads.WithLabelValues(reloadSuccess).Inc()
+	credentialReloadTime.SetToCurrentTime()
+	c.logger.Info().Msg("reloaded db credentials")
+
+	c.draining.Add(1)
+	go func() {
+		defer c.draining.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if dErr := old.client.Disconnect(ctx); dErr != nil {
+			c.logger.Error().Err(dErr).Msg("failed to disconnect replaced db client")
+			return
+		}
+		c.logger.Info().Msg("disconnected replaced db client")
+	}()
+	return nil
+}
+
+// WatchSideCar reloads the credentials whenever the content of the sidecar file changes until ctx is done.
+// A change that cannot be applied is retried with the next poll, the current client is kept meanwhile.
+func (c *ConnectionManager) WatchSideCar(ctx context.Context, opts *ReloadOpts) {
+	opts = FillReloadOpts(opts)
+	applied, _ := fileDigest(opts.SideCarFile)
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		digest, err := fileDigest(opts.SideCarFile)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("file", opts.SideCarFile).Msg("unable to read mongo sidecar file")
+			continue
+		}
+		if digest == applied {
+			continue
+		}
+		mc, err := MongoDBCredentialFromSideCar(opts.SideCarFile)
+		if err != nil {
+			credentialReloads.WithLabelValues(reloadFailure).Inc()
+		} else {
+			err = c.Reload(mc, opts.DrainTimeout)
+		}
+		if err != nil {
+			c.logger.Error().Err(err).Msg("failed to reload db credentials, keeping the current ones")
+			continue
+		}
+		applied = digest
+	}
+}
+
+func fileDigest(file string) ([sha256.Size]byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
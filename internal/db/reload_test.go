@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCredentials(t *testing.T) {
+	assert.ErrorIs(t, db.ValidateCredentials(nil), db.ErrInvalidCredentials)
+	assert.ErrorIs(t, db.ValidateCredentials(&db.MongoDBCredentials{}), db.ErrInvalidCredentials)
+	assert.ErrorIs(t, db.ValidateCredentials(&db.MongoDBCredentials{HostName: "localhost", User: "orders"}),
+		db.ErrInvalidCredentials)
+	assert.NoError(t, db.ValidateCredentials(&db.MongoDBCredentials{HostName: "localhost", User: "orders", Password: "secret"}))
+}
+
+func TestConnectionManager_Reload(t *testing.T) {
+	connMgr, err := db.NewMongoManager(testCreds, &db.ConnectionOpts{Database: "test"}, lgr)
+	require.NoError(t, err)
+	defer connMgr.Disconnect()
+	repo := db.NewOrderRepo(connMgr.Database(), lgr)
+
+	require.NoError(t, connMgr.Reload(testCreds, time.Second))
+	_, err = repo.GetAll(context.TODO(), &db.OrdersQuery{Limit: 1})
+	assert.NoError(t, err, "repos should use the new client")
+
+	assert.ErrorIs(t, connMgr.Reload(&db.MongoDBCredentials{}, time.Second), db.ErrInvalidCredentials)
+	assert.NoError(t, connMgr.Ping(), "the current client should be kept when a reload fails")
+}
+
+func TestConnectionManager_WatchSideCar(t *testing.T) {
+	connMgr, err := db.NewMongoManager(testCreds, &db.ConnectionOpts{Database: "test"}, lgr)
+	require.NoError(t, err)
+	defer connMgr.Disconnect()
+
+	sideCar := filepath.Join(t.TempDir(), "db.json")
+	require.NoError(t, os.WriteFile(sideCar, []byte(`{}`), 0o600))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		connMgr.WatchSideCar(ctx, &db.ReloadOpts{SideCarFile: sideCar, PollInterval: 10 * time.Millisecond})
+		close(done)
+	}()
+
+	rotated, err := json.Marshal(testCreds)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(sideCar, rotated, 0o600))
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, connMgr.Ping())
+	_, err = db.NewOrderRepo(connMgr.Database(), lgr).GetAll(context.TODO(), &db.OrdersQuery{Limit: 1})
+	assert.NoError(t, err)
+
+	cancel()
+	<-done
+}
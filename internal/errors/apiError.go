@@ -0,0 +1,20 @@
+package errors
+
+// APIError is rendered as an RFC 7807 problem details document, debugId, errorCode and errors are extension members.
+type APIError struct {
+	Type           string       `json:"type"`
+	Title          string       `json:"title"`
+	HTTPStatusCode int          `json:"status"`
+	Message        string       `json:"detail"`
+	Instance       string       `json:"instance,omitempty"`
+	DebugID        string       `json:"debugId"`
+	ErrorCode      string       `json:"errorCode"`
+	Errors         []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is the problem of a single field of an invalid request, either a member of the body or a parameter.
+type FieldError struct {
+	Pointer   string `json:"pointer,omitempty"`   // JSON pointer (RFC 6901) to the invalid body member, e.g. /products/0/price
+	Parameter string `json:"parameter,omitempty"` // name of the invalid query, path or header parameter
+	Reason    string `json:"reason"`
+}
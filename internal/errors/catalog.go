@@ -0,0 +1,164 @@
+package errors
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Op is the kind of operation an error happened in, it picks the error code reported for the error.
+type Op string
+
+const (
+	OpCreate Op = "create"
+	OpGet    Op = "get"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+
+	OpCouponCreate Op = "couponCreate"
+	OpCouponGet    Op = "couponGet"
+	OpCouponUpdate Op = "couponUpdate"
+	OpCouponDelete Op = "couponDelete"
+
+	OpCustomerCreate Op = "customerCreate"
+	OpCustomerGet    Op = "customerGet"
+	OpCustomerUpdate Op = "customerUpdate"
+	OpCustomerDelete Op = "customerDelete"
+)
+
+// Errors raised by the handlers, they and the repo errors are reported through the catalog of package problems.
+var (
+	ErrInvalidInput         = stdErrors.New("invalid request body")
+	ErrInvalidQueryParam    = stdErrors.New("invalid query param")
+	ErrPreconditionFailed   = stdErrors.New("If-Match does not match the current version")
+	ErrTransitionNotAllowed = stdErrors.New("order status transition is not allowed")
+	ErrProductsLocked       = stdErrors.New("order products can't change")
+	ErrUnsupportedMediaType = stdErrors.New("unsupported media type")
+)
+
+// InvalidFields is an ErrInvalidInput listing the problem of every invalid field.
+type InvalidFields []FieldError
+
+func (f InvalidFields) Error() string {
+	problems := make([]string, 0, len(f))
+	for _, field := range f {
+		problem := field.Reason
+		if location := field.Pointer + field.Parameter; location != "" {
+			problem = location + ": " + problem
+		}
+		problems = append(problems, problem)
+	}
+	return ErrInvalidInput.Error() + ": " + strings.Join(problems, "; ")
+}
+
+func (f InvalidFields) Unwrap() error {
+	return ErrInvalidInput
+}
+
+// FieldErrors returns the invalid fields err reports, from InvalidFields, struct validation and JSON decoding errors.
+func FieldErrors(err error) []FieldError {
+	var invalidFields InvalidFields
+	if stdErrors.As(err, &invalidFields) {
+		return invalidFields
+	}
+	var validationErrs validator.ValidationErrors
+	if stdErrors.As(err, &validationErrs) {
+		fields := make([]FieldError, len(validationErrs))
+		for i, fieldErr := range validationErrs {
+			fields[i] = FieldError{Pointer: fieldPointer(fieldErr.Namespace()), Reason: validationReason(fieldErr)}
+		}
+		return fields
+	}
+	var typeErr *json.UnmarshalTypeError
+	if stdErrors.As(err, &typeErr) {
+		pointer := ""
+		if typeErr.Field != "" {
+			pointer = "/" + strings.ReplaceAll(typeErr.Field, ".", "/")
+		}
+		return []FieldError{{Pointer: pointer, Reason: "should be of type " + jsonType(typeErr.Type)}}
+	}
+	return nil
+}
+
+// fieldPointer converts the namespace of a validated field to a JSON pointer, the struct name is dropped:
+// OrderInput.products[0].name becomes /products/0/name.
+func fieldPointer(namespace string) string {
+	_, path, ok := strings.Cut(namespace, ".")
+	if !ok {
+		return ""
+	}
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	return "/" + strings.ReplaceAll(path, ".", "/")
+}
+
+// jsonType names a Go type the way clients know it.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+func validationReason(fieldErr validator.FieldError) string {
+	unit := ""
+	switch fieldErr.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	case reflect.String:
+		unit = " characters"
+	}
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "notblank":
+		return "should not be blank"
+	case "min":
+		if unit == "" {
+			return "should be at least " + fieldErr.Param()
+		}
+		return "should have at least " + fieldErr.Param() + unit
+	case "max":
+		if unit == "" {
+			return "should be at most " + fieldErr.Param()
+		}
+		return "should have at most " + fieldErr.Param() + unit
+	case "gt":
+		return "should be greater than " + fieldErr.Param()
+	case "gte":
+		return "should be at least " + fieldErr.Param()
+	case "lte":
+		return "should be at most " + fieldErr.Param()
+	case "currency":
+		return "should be an ISO 4217 currency code"
+	case "iso3166_1_alpha2":
+		return "should be an ISO 3166-1 alpha-2 country code"
+	case "region":
+		return "should be an ISO 3166-2 subdivision code without the country, e.g. CA"
+	case "email":
+		return "should be an email address"
+	case "e164":
+		return "should be an E.164 phone number, e.g. +14155552671"
+	case "mongodb":
+		return "should be a 24 character hex id"
+	case "postcode_iso3166_alpha2_field":
+		return "should be a postal code of the country"
+	case "couponcode":
+		return "should have 3 to 32 letters, digits, - or _"
+	case "oneof":
+		return "should be one of " + fieldErr.Param()
+	}
+	return "failed the " + fieldErr.Tag() + " validation"
+}
@@ -7,24 +7,110 @@ const UnexpectedErrorMessage = "unexpected error occurred"
 const (
 	OrderGetInvalidParams     = prefix + "get_invalid_params"
 	OrderGetUnAuthorized      = prefix + "get_unauthorized"
+	OrderGetForbidden         = prefix + "get_forbidden"
 	OrderGetNotFound          = prefix + "get_not_found"
 	OrderGetRateLimitExceeded = prefix + "get_rate_limit_exceeded"
 	OrderGetServerError       = prefix + "get_server_error"
+	OrderGetInvalidFilter     = prefix + "get_invalid_filter_value"
+	OrderGetInvalidSort       = prefix + "get_invalid_sort"
+	OrderGetInvalidID         = prefix + "get_invalid_order_id"
+
+	Forbidden         = prefix + "forbidden"
+	InternalForbidden = prefix + "internal_forbidden"
+
+	UnsupportedQueryParam    = prefix + "unsupported_query_param"
+	UnsupportedQueryOperator = prefix + "unsupported_query_operator"
+	RequestSchemaViolation   = prefix + "request_schema_violation"
+	UnsupportedMediaType     = prefix + "unsupported_media_type"
+	UnsupportedRoute         = prefix + "unsupported_route"
+	UnsupportedCurrency      = prefix + "unsupported_currency"
 
 	OrderCreateInvalidInput      = prefix + "create_invalid_input"
 	OrderCreateUnauthorized      = prefix + "create_unauthorized"
+	OrderCreateForbidden         = prefix + "create_forbidden"
 	OrderCreateServerError       = prefix + "create_server_error"
 	OrderCreateRateLimitExceeded = prefix + "create_rate_limit_exceeded"
+	OrderCreateCustomerNotFound  = prefix + "create_customer_not_found"
+
+	OrderCreateIdempotencyKeyInvalid = prefix + "create_idempotency_key_invalid"
+	OrderCreateIdempotencyKeyReused  = prefix + "create_idempotency_key_reused"
+	OrderCreateIdempotencyInFlight   = prefix + "create_idempotency_request_in_flight"
 
 	OrderUpdateInvalidInput      = prefix + "update_invalid_input"
 	OrderUpdateUnauthorized      = prefix + "update_unauthorized"
+	OrderUpdateForbidden         = prefix + "update_forbidden"
 	OrderUpdateNotFound          = prefix + "update_not_found"
 	OrderUpdateRateLimitExceeded = prefix + "update_rate_limit_exceeded"
 	OrderUpdateServerError       = prefix + "update_server_error"
+	OrderUpdateVersionConflict   = prefix + "update_version_conflict"
+	OrderUpdatePreconditionFail  = prefix + "update_precondition_failed"
+	OrderUpdateInvalidID         = prefix + "update_invalid_order_id"
+	OrderUpdateProductsLocked    = prefix + "update_products_locked"
+
+	OrderTransitionNotAllowed = prefix + "transition_not_allowed"
 
 	OrderDeleteInvalidID         = prefix + "delete_invalid_order_id"
 	OrderDeleteUnauthorized      = prefix + "delete_unauthorized"
+	OrderDeleteForbidden         = prefix + "delete_forbidden"
 	OrderDeleteNotFound          = prefix + "delete_not_found"
 	OrderDeleteRateLimitExceeded = prefix + "delete_rate_limit_exceeded"
 	OrderDeleteServerError       = prefix + "delete_server_error"
+	OrderDeleteVersionConflict   = prefix + "delete_version_conflict"
+	OrderDeletePreconditionFail  = prefix + "delete_precondition_failed"
+
+	CouponCreateInvalidInput      = prefix + "coupon_create_invalid_input"
+	CouponCreateForbidden         = prefix + "coupon_create_forbidden"
+	CouponCreateRateLimitExceeded = prefix + "coupon_create_rate_limit_exceeded"
+	CouponCreateServerError       = prefix + "coupon_create_server_error"
+	CouponCodeExists              = prefix + "coupon_code_exists"
+
+	CouponGetForbidden         = prefix + "coupon_get_forbidden"
+	CouponGetNotFound          = prefix + "coupon_get_not_found"
+	CouponGetInvalidID         = prefix + "coupon_get_invalid_coupon_id"
+	CouponGetRateLimitExceeded = prefix + "coupon_get_rate_limit_exceeded"
+	CouponGetServerError       = prefix + "coupon_get_server_error"
+
+	CouponUpdateInvalidInput      = prefix + "coupon_update_invalid_input"
+	CouponUpdateForbidden         = prefix + "coupon_update_forbidden"
+	CouponUpdateNotFound          = prefix + "coupon_update_not_found"
+	CouponUpdateInvalidID         = prefix + "coupon_update_invalid_coupon_id"
+	CouponUpdateRateLimitExceeded = prefix + "coupon_update_rate_limit_exceeded"
+	CouponUpdateServerError       = prefix + "coupon_update_server_error"
+
+	CouponDeleteForbidden         = prefix + "coupon_delete_forbidden"
+	CouponDeleteNotFound          = prefix + "coupon_delete_not_found"
+	CouponDeleteInvalidID         = prefix + "coupon_delete_invalid_coupon_id"
+	CouponDeleteRateLimitExceeded = prefix + "coupon_delete_rate_limit_exceeded"
+	CouponDeleteServerError       = prefix + "coupon_delete_server_error"
+
+	CouponNotApplicable     = prefix + "coupon_not_applicable"
+	CouponNotActive         = prefix + "coupon_not_active"
+	CouponUsageLimitReached = prefix + "coupon_usage_limit_reached"
+	CouponUserLimitReached  = prefix + "coupon_user_limit_reached"
+
+	CustomerCreateInvalidInput      = prefix + "customer_create_invalid_input"
+	CustomerCreateForbidden         = prefix + "customer_create_forbidden"
+	CustomerCreateRateLimitExceeded = prefix + "customer_create_rate_limit_exceeded"
+	CustomerCreateServerError       = prefix + "customer_create_server_error"
+	CustomerEmailExists             = prefix + "customer_email_exists"
+
+	CustomerGetInvalidParams     = prefix + "customer_get_invalid_params"
+	CustomerGetForbidden         = prefix + "customer_get_forbidden"
+	CustomerGetNotFound          = prefix + "customer_get_not_found"
+	CustomerGetInvalidID         = prefix + "customer_get_invalid_customer_id"
+	CustomerGetRateLimitExceeded = prefix + "customer_get_rate_limit_exceeded"
+	CustomerGetServerError       = prefix + "customer_get_server_error"
+
+	CustomerUpdateInvalidInput      = prefix + "customer_update_invalid_input"
+	CustomerUpdateForbidden         = prefix + "customer_update_forbidden"
+	CustomerUpdateNotFound          = prefix + "customer_update_not_found"
+	CustomerUpdateInvalidID         = prefix + "customer_update_invalid_customer_id"
+	CustomerUpdateRateLimitExceeded = prefix + "customer_update_rate_limit_exceeded"
+	CustomerUpdateServerError       = prefix + "customer_update_server_error"
+
+	CustomerDeleteForbidden         = prefix + "customer_delete_forbidden"
+	CustomerDeleteNotFound          = prefix + "customer_delete_not_found"
+	CustomerDeleteInvalidID         = prefix + "customer_delete_invalid_customer_id"
+	CustomerDeleteRateLimitExceeded = prefix + "customer_delete_rate_limit_exceeded"
+	CustomerDeleteServerError       = prefix + "customer_delete_server_error"
 )
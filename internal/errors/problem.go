@@ -0,0 +1,32 @@
+package errors
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	// ProblemTypePrefix prefixes the error code to identify the problem type
+	ProblemTypePrefix = "urn:problem-type:"
+)
+
+// Abort writes apiErr as an RFC 7807 problem details response and aborts the request. The type, title and instance
+// members are derived from the error code, the status and the request path when they are not set.
+func Abort(c *gin.Context, apiErr *APIError) {
+	if apiErr.Type == "" {
+		apiErr.Type = "about:blank"
+		if apiErr.ErrorCode != "" {
+			apiErr.Type = ProblemTypePrefix + apiErr.ErrorCode
+		}
+	}
+	if apiErr.Title == "" {
+		apiErr.Title = http.StatusText(apiErr.HTTPStatusCode)
+	}
+	if apiErr.Instance == "" && c.Request != nil {
+		apiErr.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+}
@@ -0,0 +1,57 @@
+package errors_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/ecommerce/v1/orders/42?x=1", nil)
+
+	errors.Abort(c, &external.APIError{
+		HTTPStatusCode: http.StatusNotFound,
+		ErrorCode:      errors.OrderGetNotFound,
+		Message:        "order not found",
+		DebugID:        "req-1",
+	})
+
+	assert.True(t, c.IsAborted())
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, errors.ProblemContentType, recorder.Header().Get("Content-Type"))
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	assert.Equal(t, map[string]any{
+		"type":      "urn:problem-type:orders_get_not_found",
+		"title":     "Not Found",
+		"status":    float64(http.StatusNotFound),
+		"detail":    "order not found",
+		"instance":  "/ecommerce/v1/orders/42",
+		"debugId":   "req-1",
+		"errorCode": errors.OrderGetNotFound,
+	}, problem)
+}
+
+func TestAbort_WithoutErrorCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	errors.Abort(c, &external.APIError{HTTPStatusCode: http.StatusTooManyRequests, Title: "slow down"})
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, "about:blank", apiErr.Type)
+	assert.Equal(t, "slow down", apiErr.Title)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const CouponIDPath = "id"
+
+type CouponsHandler struct {
+	cDataSvc db.CouponsDataService
+	logger   *logger.AppLogger
+}
+
+func NewCouponsHandler(dSvc db.CouponsDataService, lgr *logger.AppLogger) *CouponsHandler {
+	return &CouponsHandler{
+		cDataSvc: dSvc,
+		logger:   lgr,
+	}
+}
+
+func (h *CouponsHandler) Create(c *gin.Context) {
+	var couponInput external.CouponInput
+	if err := bindInput(c.Request.Body, &couponInput, func() errors.InvalidFields {
+		return checkCoupon(&couponInput)
+	}); err != nil {
+		abort(c, h.logger, errors.OpCouponCreate, err)
+		return
+	}
+	coupon := toDataCoupon(&couponInput)
+	coupon.CreatedAt = time.Now()
+	coupon.UpdatedAt = coupon.CreatedAt
+	if _, err := h.cDataSvc.Create(c, coupon); err != nil {
+		abort(c, h.logger, errors.OpCouponCreate, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toExternalCoupon(coupon))
+}
+
+func (h *CouponsHandler) GetAll(c *gin.Context) {
+	coupons, err := h.cDataSvc.GetAll(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCouponGet, err)
+		return
+	}
+	extCoupons := make([]external.Coupon, len(coupons))
+	for i := range coupons {
+		extCoupons[i] = toExternalCoupon(&coupons[i])
+	}
+	c.JSON(http.StatusOK, extCoupons)
+}
+
+func (h *CouponsHandler) GetByID(c *gin.Context) {
+	cID, err := couponID(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCouponGet, err)
+		return
+	}
+	coupon, err := h.cDataSvc.GetByID(c, cID)
+	if err != nil {
+		abort(c, h.logger, errors.OpCouponGet, err)
+		return
+	}
+	c.JSON(http.StatusOK, toExternalCoupon(coupon))
+}
+
+// Update replaces the terms of a coupon (PUT), the orders that redeemed it keep the terms they were priced with.
+func (h *CouponsHandler) Update(c *gin.Context) {
+	cID, err := couponID(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCouponUpdate, err)
+		return
+	}
+	var couponInput external.CouponInput
+	if err = bindInput(c.Request.Body, &couponInput, func() errors.InvalidFields {
+		return checkCoupon(&couponInput)
+	}); err != nil {
+		abort(c, h.logger, errors.OpCouponUpdate, err)
+		return
+	}
+	coupon := toDataCoupon(&couponInput)
+	coupon.ID = cID
+	if err = h.cDataSvc.Update(c, coupon); err != nil {
+		abort(c, h.logger, errors.OpCouponUpdate, err)
+		return
+	}
+	updated, err := h.cDataSvc.GetByID(c, cID)
+	if err != nil {
+		abort(c, h.logger, errors.OpCouponUpdate, err)
+		return
+	}
+	c.JSON(http.StatusOK, toExternalCoupon(updated))
+}
+
+func (h *CouponsHandler) DeleteByID(c *gin.Context) {
+	cID, err := couponID(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCouponDelete, err)
+		return
+	}
+	if err = h.cDataSvc.DeleteByID(c, cID); err != nil {
+		abort(c, h.logger, errors.OpCouponDelete, err)
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// couponID reads the coupon id path param.
+func couponID(c *gin.Context) (primitive.ObjectID, error) {
+	id := c.Param(CouponIDPath)
+	cID, err := primitive.ObjectIDFromHex(id)
+	if err != nil || cID.IsZero() {
+		return primitive.NilObjectID, fmt.Errorf("%w %q", db.ErrInvalidCouponID, id)
+	}
+	return cID, nil
+}
+
+// checkCoupon reports the discount fields that don't fit the coupon type, the amounts without currency or more
+// precise than its minor unit, and a validity window that ends before it starts.
+func checkCoupon(input *external.CouponInput) errors.InvalidFields {
+	var fields errors.InvalidFields
+	invalid := func(pointer, reason string) {
+		fields = append(fields, external.FieldError{Pointer: pointer, Reason: reason})
+	}
+	switch input.Type {
+	case data.PercentageDiscount:
+		if input.Percent == nil {
+			invalid("/percent", "is required for percentage coupons")
+		}
+		if input.Amount != nil {
+			invalid("/amount", "should not be set for percentage coupons")
+		}
+	case data.FixedDiscount:
+		if input.Amount == nil {
+			invalid("/amount", "is required for fixed coupons")
+		}
+		if input.Percent != nil {
+			invalid("/percent", "should not be set for fixed coupons")
+		}
+	}
+	amounts := []struct {
+		name   string
+		amount *money.Amount
+	}{{"amount", input.Amount}, {"minSpend", input.MinSpend}}
+	for _, a := range amounts {
+		switch {
+		case a.amount == nil:
+		case input.Currency == "":
+			invalid("/currency", "is required with "+a.name)
+		case input.Currency.IsValid() && a.amount.DecimalPlaces() > input.Currency.MinorUnits():
+			invalid("/"+a.name, fmt.Sprintf("should have at most %d decimal places in %s",
+				input.Currency.MinorUnits(), input.Currency))
+		}
+	}
+	if input.ValidFrom != nil && input.ValidUntil != nil && !input.ValidUntil.After(*input.ValidFrom) {
+		invalid("/validUntil", "should be after validFrom")
+	}
+	return fields
+}
+
+func toDataCoupon(input *external.CouponInput) *data.Coupon {
+	coupon := &data.Coupon{
+		Code:        strings.ToUpper(input.Code),
+		Description: input.Description,
+		CouponTerms: data.CouponTerms{
+			Type:     input.Type,
+			Percent:  input.Percent,
+			Amount:   input.Amount,
+			Currency: input.Currency,
+			MinSpend: input.MinSpend,
+		},
+		ValidFrom:    input.ValidFrom,
+		ValidUntil:   input.ValidUntil,
+		UsageLimit:   input.UsageLimit,
+		PerUserLimit: input.PerUserLimit,
+	}
+	if coupon.Amount != nil && coupon.Currency.IsValid() {
+		rounded := coupon.Currency.Round(*coupon.Amount)
+		coupon.Amount = &rounded
+	}
+	return coupon
+}
+
+func toExternalCoupon(coupon *data.Coupon) external.Coupon {
+	extCoupon := external.Coupon{
+		ID:           coupon.ID.Hex(),
+		Code:         coupon.Code,
+		Description:  coupon.Description,
+		CouponTerms:  coupon.CouponTerms,
+		UsageLimit:   coupon.UsageLimit,
+		PerUserLimit: coupon.PerUserLimit,
+		UsageCount:   coupon.UsageCount,
+		CreatedAt:    util.FormatTimeToISO(coupon.CreatedAt),
+		UpdatedAt:    util.FormatTimeToISO(coupon.UpdatedAt),
+	}
+	if coupon.ValidFrom != nil {
+		extCoupon.ValidFrom = util.FormatTimeToISO(*coupon.ValidFrom)
+	}
+	if coupon.ValidUntil != nil {
+		extCoupon.ValidUntil = util.FormatTimeToISO(*coupon.ValidUntil)
+	}
+	return extCoupon
+}
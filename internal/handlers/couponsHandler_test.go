@@ -0,0 +1,241 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	errors2 "github.com/derickit/go-rest-api/internal/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/db/mocks"
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const couponID = "609d9ed771df2a0d99bf0077"
+
+func couponsRouter(svc db.CouponsDataService) (*gin.Engine, *httptest.ResponseRecorder) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	handler := handlers.NewCouponsHandler(svc, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.GET("/coupons", handler.GetAll)
+	r.GET("/coupons/:id", handler.GetByID)
+	r.POST("/coupons", handler.Create)
+	r.PUT("/coupons/:id", handler.Update)
+	r.DELETE("/coupons/:id", handler.DeleteByID)
+	return r, recorder
+}
+
+func TestCouponsHandler_Create(t *testing.T) {
+	var created *data.Coupon
+	r, recorder := couponsRouter(&mocks.MockCouponsDataService{
+		CreateFunc: func(_ context.Context, coupon *data.Coupon) (string, error) {
+			coupon.ID = primitive.NewObjectID()
+			created = coupon
+			return coupon.ID.Hex(), nil
+		},
+	})
+	body := `{"code": "five-off", "type": "fixed", "amount": "5", "currency": "USD", "minSpend": "20",
+		"validFrom": "2024-05-01T00:00:00Z", "validUntil": "2024-06-01T00:00:00Z", "usageLimit": 100, "perUserLimit": 1}`
+	req, _ := http.NewRequest(http.MethodPost, "/coupons", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	require.NotNil(t, created)
+	assert.Equal(t, "FIVE-OFF", created.Code, "codes should be stored upper case")
+	assert.Equal(t, "5.00", created.Amount.String())
+	assert.Equal(t, int64(100), created.UsageLimit)
+
+	var extCoupon external.Coupon
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &extCoupon))
+	assert.Equal(t, created.ID.Hex(), extCoupon.ID)
+	assert.Equal(t, data.FixedDiscount, extCoupon.Type)
+	assert.Equal(t, "2024-06-01T00:00:00Z", extCoupon.ValidUntil)
+	assert.Equal(t, int64(0), extCoupon.UsageCount)
+}
+
+func TestCouponsHandler_Create_FieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		fields []external.FieldError
+	}{
+		{name: "code and type", body: `{"code": "10% off", "type": "bogo"}`, fields: []external.FieldError{
+			{Pointer: "/code", Reason: "should have 3 to 32 letters, digits, - or _"},
+			{Pointer: "/type", Reason: "should be one of percentage fixed"},
+		}},
+		{name: "percentage without percent", body: `{"code": "SALE", "type": "percentage", "amount": "5", "currency": "USD"}`,
+			fields: []external.FieldError{
+				{Pointer: "/percent", Reason: "is required for percentage coupons"},
+				{Pointer: "/amount", Reason: "should not be set for percentage coupons"},
+			}},
+		{name: "percent above 100", body: `{"code": "SALE", "type": "percentage", "percent": "120"}`,
+			fields: []external.FieldError{{Pointer: "/percent", Reason: "should be at most 100"}}},
+		{name: "amount without currency", body: `{"code": "SALE", "type": "fixed", "amount": "5", "minSpend": "10"}`,
+			fields: []external.FieldError{
+				{Pointer: "/currency", Reason: "is required with amount"},
+				{Pointer: "/currency", Reason: "is required with minSpend"},
+			}},
+		{name: "amount precision", body: `{"code": "SALE", "type": "fixed", "amount": "5.5", "currency": "JPY"}`,
+			fields: []external.FieldError{{Pointer: "/amount", Reason: "should have at most 0 decimal places in JPY"}}},
+		{name: "validity window", body: `{"code": "SALE", "type": "percentage", "percent": "5",
+			"validFrom": "2024-06-01T00:00:00Z", "validUntil": "2024-05-01T00:00:00Z"}`,
+			fields: []external.FieldError{{Pointer: "/validUntil", Reason: "should be after validFrom"}}},
+		{name: "negative limit", body: `{"code": "SALE", "type": "percentage", "percent": "5", "usageLimit": -1}`,
+			fields: []external.FieldError{{Pointer: "/usageLimit", Reason: "should be at least 0"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, recorder := couponsRouter(&mocks.MockCouponsDataService{})
+			req, _ := http.NewRequest(http.MethodPost, "/coupons", bytes.NewReader([]byte(tt.body)))
+			r.ServeHTTP(recorder, req)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Equal(t, errors2.CouponCreateInvalidInput, apiErr.ErrorCode)
+			assert.Equal(t, tt.fields, apiErr.Errors)
+		})
+	}
+}
+
+func TestCouponsHandler_Create_CodeExists(t *testing.T) {
+	r, recorder := couponsRouter(&mocks.MockCouponsDataService{
+		CreateFunc: func(_ context.Context, _ *data.Coupon) (string, error) {
+			return "", db.ErrCouponCodeExists
+		},
+	})
+	body := `{"code": "SALE", "type": "percentage", "percent": "5"}`
+	req, _ := http.NewRequest(http.MethodPost, "/coupons", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, errors2.CouponCodeExists, apiErr.ErrorCode)
+}
+
+func TestCouponsHandler_GetAll(t *testing.T) {
+	percent := money.MustParseAmount("10")
+	r, recorder := couponsRouter(&mocks.MockCouponsDataService{
+		GetAllFunc: func(_ context.Context) ([]data.Coupon, error) {
+			return []data.Coupon{{ID: primitive.NewObjectID(), Code: "SALE", UsageCount: 3,
+				CouponTerms: data.CouponTerms{Type: data.PercentageDiscount, Percent: &percent}}}, nil
+		},
+	})
+	req, _ := http.NewRequest(http.MethodGet, "/coupons", nil)
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var extCoupons []external.Coupon
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &extCoupons))
+	require.Len(t, extCoupons, 1)
+	assert.Equal(t, "10", extCoupons[0].Percent.String())
+	assert.Equal(t, int64(3), extCoupons[0].UsageCount)
+}
+
+func TestCouponsHandler_GetByID(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		err       error
+		status    int
+		errorCode string
+	}{
+		{name: "found", id: couponID, status: http.StatusOK},
+		{name: "not found", id: couponID, err: db.ErrCouponNotFound, status: http.StatusNotFound,
+			errorCode: errors2.CouponGetNotFound},
+		{name: "invalid id", id: "123", status: http.StatusBadRequest, errorCode: errors2.CouponGetInvalidID},
+		{name: "db failure", id: couponID, err: context.DeadlineExceeded, status: http.StatusInternalServerError,
+			errorCode: errors2.CouponGetServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, recorder := couponsRouter(&mocks.MockCouponsDataService{
+				GetByIDFunc: func(_ context.Context, id primitive.ObjectID) (*data.Coupon, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &data.Coupon{ID: id, Code: "SALE", CreatedAt: time.Now()}, nil
+				},
+			})
+			req, _ := http.NewRequest(http.MethodGet, "/coupons/"+tt.id, nil)
+			r.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.status, recorder.Code)
+			if tt.errorCode != "" {
+				var apiErr external.APIError
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.errorCode, apiErr.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestCouponsHandler_Update(t *testing.T) {
+	var updated *data.Coupon
+	r, recorder := couponsRouter(&mocks.MockCouponsDataService{
+		UpdateFunc: func(_ context.Context, coupon *data.Coupon) error {
+			updated = coupon
+			return nil
+		},
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Coupon, error) {
+			stored := *updated
+			stored.UsageCount = 7
+			return &stored, nil
+		},
+	})
+	body := `{"code": "sale", "type": "percentage", "percent": "15", "usageLimit": 10}`
+	req, _ := http.NewRequest(http.MethodPut, "/coupons/"+couponID, bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	require.NotNil(t, updated)
+	assert.Equal(t, couponID, updated.ID.Hex())
+	assert.Equal(t, "SALE", updated.Code)
+	var extCoupon external.Coupon
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &extCoupon))
+	assert.Equal(t, int64(7), extCoupon.UsageCount, "the response should be the stored coupon")
+}
+
+func TestCouponsHandler_Update_NotFound(t *testing.T) {
+	r, recorder := couponsRouter(&mocks.MockCouponsDataService{
+		UpdateFunc: func(_ context.Context, _ *data.Coupon) error {
+			return db.ErrCouponNotFound
+		},
+	})
+	body := `{"code": "sale", "type": "percentage", "percent": "15"}`
+	req, _ := http.NewRequest(http.MethodPut, "/coupons/"+couponID, bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, errors2.CouponUpdateNotFound, apiErr.ErrorCode)
+}
+
+func TestCouponsHandler_DeleteByID(t *testing.T) {
+	r, recorder := couponsRouter(&mocks.MockCouponsDataService{
+		DeleteByIDFunc: func(_ context.Context, id primitive.ObjectID) error {
+			assert.Equal(t, couponID, id.Hex())
+			return nil
+		},
+	})
+	req, _ := http.NewRequest(http.MethodDelete, "/coupons/"+couponID, nil)
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
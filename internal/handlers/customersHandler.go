@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const CustomerIDPath = "id"
+
+type CustomersHandler struct {
+	cDataSvc db.CustomersDataService
+	logger   *logger.AppLogger
+}
+
+func NewCustomersHandler(dSvc db.CustomersDataService, lgr *logger.AppLogger) *CustomersHandler {
+	return &CustomersHandler{
+		cDataSvc: dSvc,
+		logger:   lgr,
+	}
+}
+
+func (h *CustomersHandler) Create(c *gin.Context) {
+	var customerInput external.CustomerInput
+	if err := bindInput(c.Request.Body, &customerInput, func() errors.InvalidFields {
+		return checkCustomer(&customerInput, nil)
+	}); err != nil {
+		abort(c, h.logger, errors.OpCustomerCreate, err)
+		return
+	}
+	customer := toDataCustomer(&customerInput, nil)
+	customer.User = handledBy(c)
+	customer.CreatedAt = time.Now()
+	customer.UpdatedAt = customer.CreatedAt
+	if _, err := h.cDataSvc.Create(c, customer); err != nil {
+		abort(c, h.logger, errors.OpCustomerCreate, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toExternalCustomer(customer))
+}
+
+// GetAll lists the customers sorted by email, the email query param looks up a single customer. Only the admins
+// see the customers of every user.
+func (h *CustomersHandler) GetAll(c *gin.Context) {
+	query, err := parseCustomersQuery(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCustomerGet, err)
+		return
+	}
+	if user, all := accessScope(c); !all {
+		query.User = user
+	}
+	customers, err := h.cDataSvc.GetAll(c, query)
+	if err != nil {
+		abort(c, h.logger, errors.OpCustomerGet, err)
+		return
+	}
+	extCustomers := make([]external.Customer, len(customers))
+	for i := range customers {
+		extCustomers[i] = toExternalCustomer(&customers[i])
+	}
+	c.JSON(http.StatusOK, extCustomers)
+}
+
+func (h *CustomersHandler) GetByID(c *gin.Context) {
+	customer, err := h.customer(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCustomerGet, err)
+		return
+	}
+	c.JSON(http.StatusOK, toExternalCustomer(customer))
+}
+
+// Update replaces the profile and the addresses of a customer (PUT), the addresses listed with their addressId keep
+// it and the addresses left out are removed.
+func (h *CustomersHandler) Update(c *gin.Context) {
+	existing, err := h.customer(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCustomerUpdate, err)
+		return
+	}
+	var customerInput external.CustomerInput
+	if err = bindInput(c.Request.Body, &customerInput, func() errors.InvalidFields {
+		return checkCustomer(&customerInput, existing)
+	}); err != nil {
+		abort(c, h.logger, errors.OpCustomerUpdate, err)
+		return
+	}
+	customer := toDataCustomer(&customerInput, existing)
+	if err = h.cDataSvc.Update(c, customer); err != nil {
+		abort(c, h.logger, errors.OpCustomerUpdate, err)
+		return
+	}
+	c.JSON(http.StatusOK, toExternalCustomer(customer))
+}
+
+func (h *CustomersHandler) DeleteByID(c *gin.Context) {
+	customer, err := h.customer(c)
+	if err != nil {
+		abort(c, h.logger, errors.OpCustomerDelete, err)
+		return
+	}
+	if err = h.cDataSvc.DeleteByID(c, customer.ID); err != nil {
+		abort(c, h.logger, errors.OpCustomerDelete, err)
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// customer loads the customer of the id path param, the customers of other users are not found.
+func (h *CustomersHandler) customer(c *gin.Context) (*data.Customer, error) {
+	cID, err := customerID(c)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := h.cDataSvc.GetByID(c, cID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccessCustomer(c, customer) {
+		return nil, db.ErrCustomerNotFound
+	}
+	return customer, nil
+}
+
+func canAccessCustomer(c *gin.Context, customer *data.Customer) bool {
+	user, all := accessScope(c)
+	return all || customer.User == user
+}
+
+// customerID reads the customer id path param.
+func customerID(c *gin.Context) (primitive.ObjectID, error) {
+	id := c.Param(CustomerIDPath)
+	cID, err := primitive.ObjectIDFromHex(id)
+	if err != nil || cID.IsZero() {
+		return primitive.NilObjectID, fmt.Errorf("%w %q", db.ErrInvalidCustomerID, id)
+	}
+	return cID, nil
+}
+
+// parseCustomersQuery reads the email, limit and offset query params.
+func parseCustomersQuery(c *gin.Context) (*db.CustomersQuery, error) {
+	query := &db.CustomersQuery{Limit: db.DefaultPageSize}
+	invalidParam := func(message string) error {
+		return fmt.Errorf("%w: %s", errors.ErrInvalidQueryParam, message)
+	}
+	if input, exists := c.GetQuery("limit"); exists && input != "" {
+		limit, err := strconv.ParseInt(input, 10, 64)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return nil, invalidParam(fmt.Sprintf("integer value within 1 and %d is expected for limit query param",
+				MaxPageSize))
+		}
+		query.Limit = limit
+	}
+	if input, exists := c.GetQuery("offset"); exists && input != "" {
+		offset, err := strconv.ParseInt(input, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, invalidParam("non negative integer value is expected for offset query param")
+		}
+		query.Offset = offset
+	}
+	query.Email = strings.ToLower(c.Query("email"))
+	return query, nil
+}
+
+// checkCustomer reports a second default address of a type and the address ids that are not addresses of the
+// existing customer, new customers have no addresses to refer to.
+func checkCustomer(input *external.CustomerInput, existing *data.Customer) errors.InvalidFields {
+	var fields errors.InvalidFields
+	defaults := map[data.AddressType]bool{}
+	for i, addr := range input.Addresses {
+		if addr.Default {
+			if defaults[addr.Type] {
+				fields = append(fields, external.FieldError{
+					Pointer: fmt.Sprintf("/addresses/%d/default", i),
+					Reason:  fmt.Sprintf("only one %s address can be the default", addr.Type),
+				})
+			}
+			defaults[addr.Type] = true
+		}
+		if addr.ID == "" {
+			continue
+		}
+		if addrID, err := primitive.ObjectIDFromHex(addr.ID); err == nil && !hasAddress(existing, addrID) {
+			fields = append(fields, external.FieldError{
+				Pointer: fmt.Sprintf("/addresses/%d/addressId", i),
+				Reason:  "is not an address of the customer",
+			})
+		}
+	}
+	return fields
+}
+
+func hasAddress(customer *data.Customer, id primitive.ObjectID) bool {
+	if customer == nil {
+		return false
+	}
+	for _, addr := range customer.Addresses {
+		if addr.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// toDataCustomer converts the input, the id, user and creation time of the existing customer are kept on updates.
+func toDataCustomer(input *external.CustomerInput, existing *data.Customer) *data.Customer {
+	customer := &data.Customer{
+		Name:      input.Name,
+		Email:     strings.ToLower(input.Email),
+		Phone:     input.Phone,
+		Addresses: make([]data.CustomerAddress, len(input.Addresses)),
+	}
+	if existing != nil {
+		customer.ID = existing.ID
+		customer.User = existing.User
+		customer.CreatedAt = existing.CreatedAt
+	}
+	for i, addr := range input.Addresses {
+		addrID, err := primitive.ObjectIDFromHex(addr.ID)
+		if err != nil {
+			addrID = primitive.NewObjectID()
+		}
+		customer.Addresses[i] = data.CustomerAddress{
+			ID:      addrID,
+			Type:    addr.Type,
+			Default: addr.Default,
+			Address: data.Address{
+				Name:       addr.Name,
+				Line1:      addr.Line1,
+				Line2:      addr.Line2,
+				City:       addr.City,
+				Region:     addr.Region,
+				PostalCode: addr.PostalCode,
+				Country:    addr.Country,
+			},
+		}
+	}
+	return customer
+}
+
+func toExternalCustomer(customer *data.Customer) external.Customer {
+	addresses := customer.Addresses
+	if addresses == nil {
+		addresses = []data.CustomerAddress{}
+	}
+	return external.Customer{
+		ID:        customer.ID.Hex(),
+		User:      customer.User,
+		Name:      customer.Name,
+		Email:     customer.Email,
+		Phone:     customer.Phone,
+		Addresses: addresses,
+		CreatedAt: util.FormatTimeToISO(customer.CreatedAt),
+		UpdatedAt: util.FormatTimeToISO(customer.UpdatedAt),
+	}
+}
@@ -0,0 +1,354 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	errors2 "github.com/derickit/go-rest-api/internal/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/db/mocks"
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const customerID = "609d9ed771df2a0d99bf0099"
+
+var testCustomerUser = &auth.Principal{Subject: "customer-1", Scopes: []string{auth.ScopeCustomersRead,
+	auth.ScopeCustomersWrite}}
+
+func customersRouter(svc db.CustomersDataService) (*gin.Engine, *httptest.ResponseRecorder) {
+	return customersRouterAs(svc, testAdmin)
+}
+
+func customersRouterAs(svc db.CustomersDataService,
+	principal *auth.Principal) (*gin.Engine, *httptest.ResponseRecorder) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	handler := handlers.NewCustomersHandler(svc, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(principal))
+	r.GET("/customers", handler.GetAll)
+	r.GET("/customers/:id", handler.GetByID)
+	r.POST("/customers", handler.Create)
+	r.PUT("/customers/:id", handler.Update)
+	r.DELETE("/customers/:id", handler.DeleteByID)
+	return r, recorder
+}
+
+func TestCustomersHandler_Create(t *testing.T) {
+	var created *data.Customer
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{
+		CreateFunc: func(_ context.Context, customer *data.Customer) (string, error) {
+			customer.ID = primitive.NewObjectID()
+			created = customer
+			return customer.ID.Hex(), nil
+		},
+	})
+	body := `{"name": "Jane Doe", "email": "Jane@Example.com", "phone": "+14155552671", "addresses": [
+		{"type": "shipping", "default": true, "name": "Jane Doe", "line1": "1 Main St", "city": "San Francisco",
+		"region": "CA", "postalCode": "94105", "country": "US"},
+		{"type": "billing", "name": "Jane Doe", "line1": "Unter den Linden 1", "city": "Berlin", "postalCode": "10117",
+		"country": "DE"}]}`
+	req, _ := http.NewRequest(http.MethodPost, "/customers", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	require.NotNil(t, created)
+	assert.Equal(t, "jane@example.com", created.Email, "emails should be stored lower case")
+	assert.Equal(t, testAdmin.Subject, created.User, "the customer should belong to the caller")
+	require.Len(t, created.Addresses, 2)
+	assert.False(t, created.Addresses[0].ID.IsZero(), "addresses should get an id")
+	assert.Equal(t, "94105", created.Addresses[0].PostalCode)
+
+	var extCustomer external.Customer
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &extCustomer))
+	assert.Equal(t, created.ID.Hex(), extCustomer.ID)
+	assert.Equal(t, created.Addresses[1].ID, extCustomer.Addresses[1].ID)
+	assert.Equal(t, data.BillingAddressType, extCustomer.Addresses[1].Type)
+}
+
+func TestCustomersHandler_Create_FieldErrors(t *testing.T) {
+	address := `"name": "Jane Doe", "line1": "1 Main St", "city": "San Francisco", "country": "US"`
+	tests := []struct {
+		name   string
+		body   string
+		fields []external.FieldError
+	}{
+		{name: "profile", body: `{"name": " ", "email": "jane", "phone": "555-0100"}`, fields: []external.FieldError{
+			{Pointer: "/name", Reason: "should not be blank"},
+			{Pointer: "/email", Reason: "should be an email address"},
+			{Pointer: "/phone", Reason: "should be an E.164 phone number, e.g. +14155552671"},
+		}},
+		{name: "address fields", body: `{"name": "Jane", "email": "jane@example.com", "addresses": [
+			{"type": "home", "country": "USA", "postalCode": "1", "city": " "}]}`, fields: []external.FieldError{
+			{Pointer: "/addresses/0/type", Reason: "should be one of shipping billing"},
+			{Pointer: "/addresses/0/country", Reason: "should be an ISO 3166-1 alpha-2 country code"},
+			{Pointer: "/addresses/0/name", Reason: "is required"},
+			{Pointer: "/addresses/0/line1", Reason: "is required"},
+			{Pointer: "/addresses/0/city", Reason: "should not be blank"},
+			{Pointer: "/addresses/0/postalCode", Reason: "should be a postal code of the country"},
+		}},
+		{name: "postal code of another country", body: `{"name": "Jane", "email": "jane@example.com", "addresses": [
+			{"type": "shipping", ` + address + `, "postalCode": "SW1A 1AA"}]}`, fields: []external.FieldError{
+			{Pointer: "/addresses/0/postalCode", Reason: "should be a postal code of the country"},
+		}},
+		{name: "two defaults", body: `{"name": "Jane", "email": "jane@example.com", "addresses": [
+			{"type": "shipping", "default": true, ` + address + `}, {"type": "shipping", "default": true, ` + address + `}]}`,
+			fields: []external.FieldError{{Pointer: "/addresses/1/default", Reason: "only one shipping address can be the default"}}},
+		{name: "address id of a new customer", body: `{"name": "Jane", "email": "jane@example.com", "addresses": [
+			{"addressId": "` + customerID + `", "type": "billing", ` + address + `}]}`,
+			fields: []external.FieldError{{Pointer: "/addresses/0/addressId", Reason: "is not an address of the customer"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, recorder := customersRouter(&mocks.MockCustomersDataService{})
+			req, _ := http.NewRequest(http.MethodPost, "/customers", bytes.NewReader([]byte(tt.body)))
+			r.ServeHTTP(recorder, req)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Equal(t, errors2.CustomerCreateInvalidInput, apiErr.ErrorCode)
+			assert.Equal(t, tt.fields, apiErr.Errors)
+		})
+	}
+}
+
+func TestCustomersHandler_Create_EmailExists(t *testing.T) {
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{
+		CreateFunc: func(_ context.Context, _ *data.Customer) (string, error) {
+			return "", db.ErrCustomerEmailExists
+		},
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/customers",
+		bytes.NewReader([]byte(`{"name": "Jane", "email": "jane@example.com"}`)))
+	r.ServeHTTP(recorder, req)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, errors2.CustomerEmailExists, apiErr.ErrorCode)
+}
+
+func TestCustomersHandler_GetAll(t *testing.T) {
+	var gotQuery *db.CustomersQuery
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{
+		GetAllFunc: func(_ context.Context, query *db.CustomersQuery) ([]data.Customer, error) {
+			gotQuery = query
+			return []data.Customer{{ID: primitive.NewObjectID(), Name: "Jane", Email: "jane@example.com"}}, nil
+		},
+	})
+	req, _ := http.NewRequest(http.MethodGet, "/customers?email=Jane@Example.com&limit=10&offset=20", nil)
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Equal(t, &db.CustomersQuery{Email: "jane@example.com", Limit: 10, Offset: 20}, gotQuery)
+	var extCustomers []external.Customer
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &extCustomers))
+	require.Len(t, extCustomers, 1)
+	assert.NotNil(t, extCustomers[0].Addresses, "addresses should be an empty list")
+}
+
+func TestCustomersHandler_GetAll_ScopedToUser(t *testing.T) {
+	var gotQuery *db.CustomersQuery
+	r, recorder := customersRouterAs(&mocks.MockCustomersDataService{
+		GetAllFunc: func(_ context.Context, query *db.CustomersQuery) ([]data.Customer, error) {
+			gotQuery = query
+			return []data.Customer{}, nil
+		},
+	}, testCustomerUser)
+	req, _ := http.NewRequest(http.MethodGet, "/customers?email=jane@example.com", nil)
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Equal(t, &db.CustomersQuery{Email: "jane@example.com", User: "customer-1", Limit: db.DefaultPageSize},
+		gotQuery)
+}
+
+func TestCustomersHandler_GetAll_InvalidLimit(t *testing.T) {
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{})
+	req, _ := http.NewRequest(http.MethodGet, "/customers?limit=1000", nil)
+	r.ServeHTTP(recorder, req)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, errors2.CustomerGetInvalidParams, apiErr.ErrorCode)
+}
+
+func TestCustomersHandler_GetByID(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		err       error
+		status    int
+		errorCode string
+	}{
+		{name: "found", id: customerID, status: http.StatusOK},
+		{name: "not found", id: customerID, err: db.ErrCustomerNotFound, status: http.StatusNotFound,
+			errorCode: errors2.CustomerGetNotFound},
+		{name: "invalid id", id: "123", status: http.StatusBadRequest, errorCode: errors2.CustomerGetInvalidID},
+		{name: "db failure", id: customerID, err: context.DeadlineExceeded, status: http.StatusInternalServerError,
+			errorCode: errors2.CustomerGetServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, recorder := customersRouter(&mocks.MockCustomersDataService{
+				GetByIDFunc: func(_ context.Context, id primitive.ObjectID) (*data.Customer, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &data.Customer{ID: id, Name: "Jane", CreatedAt: time.Now()}, nil
+				},
+			})
+			req, _ := http.NewRequest(http.MethodGet, "/customers/"+tt.id, nil)
+			r.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.status, recorder.Code)
+			if tt.errorCode != "" {
+				var apiErr external.APIError
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.errorCode, apiErr.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestCustomersHandler_Update(t *testing.T) {
+	cID, _ := primitive.ObjectIDFromHex(customerID)
+	kept := primitive.NewObjectID()
+	createdAt := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	existing := &data.Customer{ID: cID, User: "customer-1", Name: "Jane", Email: "jane@example.com", CreatedAt: createdAt,
+		Addresses: []data.CustomerAddress{
+			{ID: kept, Type: data.ShippingAddressType, Address: data.Address{Country: "US"}},
+			{ID: primitive.NewObjectID(), Type: data.BillingAddressType, Address: data.Address{Country: "US"}},
+		}}
+	var updated *data.Customer
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Customer, error) {
+			return existing, nil
+		},
+		UpdateFunc: func(_ context.Context, customer *data.Customer) error {
+			updated = customer
+			return nil
+		},
+	})
+	body := `{"name": "Jane Roe", "email": "jane@example.com", "addresses": [
+		{"addressId": "` + kept.Hex() + `", "type": "shipping", "default": true, "name": "Jane Roe", "line1": "2 Main St",
+		"city": "San Francisco", "country": "US"},
+		{"type": "billing", "name": "Jane Roe", "line1": "2 Main St", "city": "San Francisco", "country": "US"}]}`
+	req, _ := http.NewRequest(http.MethodPut, "/customers/"+customerID, bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	require.NotNil(t, updated)
+	assert.Equal(t, cID, updated.ID)
+	assert.Equal(t, createdAt, updated.CreatedAt)
+	assert.Equal(t, existing.User, updated.User, "the customer should keep its user")
+	require.Len(t, updated.Addresses, 2)
+	assert.Equal(t, kept, updated.Addresses[0].ID, "listed addresses should keep their id")
+	assert.Equal(t, "2 Main St", updated.Addresses[0].Line1)
+	assert.NotEqual(t, existing.Addresses[1].ID, updated.Addresses[1].ID, "addresses without id should be new")
+}
+
+func TestCustomersHandler_Update_UnknownAddress(t *testing.T) {
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{
+		GetByIDFunc: func(_ context.Context, id primitive.ObjectID) (*data.Customer, error) {
+			return &data.Customer{ID: id}, nil
+		},
+	})
+	body := `{"name": "Jane", "email": "jane@example.com", "addresses": [{"addressId": "` + couponID + `",
+		"type": "billing", "name": "Jane", "line1": "1 Main St", "city": "Austin", "country": "US"}]}`
+	req, _ := http.NewRequest(http.MethodPut, "/customers/"+customerID, bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, errors2.CustomerUpdateInvalidInput, apiErr.ErrorCode)
+	assert.Equal(t, []external.FieldError{{Pointer: "/addresses/0/addressId", Reason: "is not an address of the customer"}},
+		apiErr.Errors)
+}
+
+func TestCustomersHandler_Update_NotFound(t *testing.T) {
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Customer, error) {
+			return nil, db.ErrCustomerNotFound
+		},
+	})
+	req, _ := http.NewRequest(http.MethodPut, "/customers/"+customerID,
+		bytes.NewReader([]byte(`{"name": "Jane", "email": "jane@example.com"}`)))
+	r.ServeHTTP(recorder, req)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, errors2.CustomerUpdateNotFound, apiErr.ErrorCode)
+}
+
+func TestCustomersHandler_DeleteByID(t *testing.T) {
+	r, recorder := customersRouter(&mocks.MockCustomersDataService{
+		GetByIDFunc: func(_ context.Context, id primitive.ObjectID) (*data.Customer, error) {
+			return &data.Customer{ID: id}, nil
+		},
+		DeleteByIDFunc: func(_ context.Context, id primitive.ObjectID) error {
+			assert.Equal(t, customerID, id.Hex())
+			return nil
+		},
+	})
+	req, _ := http.NewRequest(http.MethodDelete, "/customers/"+customerID, nil)
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestCustomersHandler_CustomerOfAnotherUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		errorCode string
+	}{
+		{name: "get", method: http.MethodGet, errorCode: errors2.CustomerGetNotFound},
+		{name: "update", method: http.MethodPut, body: `{"name": "Jane", "email": "jane@example.com"}`,
+			errorCode: errors2.CustomerUpdateNotFound},
+		{name: "delete", method: http.MethodDelete, errorCode: errors2.CustomerDeleteNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, recorder := customersRouterAs(&mocks.MockCustomersDataService{
+				GetByIDFunc: func(_ context.Context, id primitive.ObjectID) (*data.Customer, error) {
+					return &data.Customer{ID: id, User: "customer-2", Name: "Jane"}, nil
+				},
+				UpdateFunc: func(_ context.Context, _ *data.Customer) error {
+					t.Fatal("the customer should not be updated")
+					return nil
+				},
+				DeleteByIDFunc: func(_ context.Context, _ primitive.ObjectID) error {
+					t.Fatal("the customer should not be deleted")
+					return nil
+				},
+			}, testCustomerUser)
+			req, _ := http.NewRequest(tt.method, "/customers/"+customerID, bytes.NewReader([]byte(tt.body)))
+			r.ServeHTTP(recorder, req)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+			assert.Equal(t, tt.errorCode, apiErr.ErrorCode)
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
 	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/gin-gonic/gin"
 	"github.com/go-faker/faker/v4"
@@ -13,21 +15,43 @@ import (
 
 const (
 	seedRecoedCount = 10000
+	// DefSeedRecordCount is the number of orders the seed endpoint creates
+	DefSeedRecordCount = seedRecoedCount
 )
 
 type SeedHandler struct {
 	oDataSvc db.OrdersDataService
+	count    int
 }
 
-func NewDataSeedHandler(svc db.OrdersDataService) *SeedHandler {
+// NewDataSeedHandler returns a handler creating count orders per request, DefSeedRecordCount when count is not positive.
+func NewDataSeedHandler(svc db.OrdersDataService, count int) *SeedHandler {
+	if count <= 0 {
+		count = DefSeedRecordCount
+	}
 	sc := &SeedHandler{
 		oDataSvc: svc,
+		count:    count,
 	}
 	return sc
 }
 
 func (s *SeedHandler) SeedDB(c *gin.Context) {
-	for i := 0; i < seedRecoedCount; i++ {
+	if err := SeedOrders(c, s.oDataSvc, s.count); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"Message": "Failed to seed data",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Message": "Data seeded successfully",
+		"Count":   s.count,
+	})
+}
+
+// SeedOrders creates count orders with random products and users.
+func SeedOrders(ctx context.Context, svc db.OrdersDataService, count int) error {
+	for i := 0; i < count; i++ {
 		products := []data.Product{
 			{
 				Name:     faker.Name(),
@@ -47,19 +71,13 @@ func (s *SeedHandler) SeedDB(c *gin.Context) {
 			Products:    products,
 			User:        faker.Email(),
 			Status:      data.OrderPending,
-			TotalAmount: util.CalculateTotalAmount(products),
+			Currency:    money.DefaultCurrency,
+			TotalAmount: util.CalculateTotalAmount(products, money.DefaultCurrency),
 		}
 
-		_, err := s.oDataSvc.Create(c, po)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-				"Message": "Failed to seed data",
-			})
-			return
+		if _, err := svc.Create(ctx, po); err != nil {
+			return err
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"Message": "Data seeded successfully",
-		"Count":   seedRecoedCount,
-	})
+	return nil
 }
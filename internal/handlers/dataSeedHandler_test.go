@@ -14,7 +14,7 @@ import (
 )
 
 func TestNewSeedHandler(t *testing.T) {
-	sd := handlers.NewDataSeedHandler(&mocks.MockOrdersDataService{})
+	sd := handlers.NewDataSeedHandler(&mocks.MockOrdersDataService{}, 0)
 	assert.IsType(t, &handlers.SeedHandler{}, sd)
 }
 
@@ -26,7 +26,7 @@ func TestSeedDB_Success(t *testing.T) {
 		CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
 			return "random-id", nil
 		},
-	})
+	}, 10)
 
 	sd.SeedDB(c)
 	resp := recorder.Result()
@@ -42,10 +42,27 @@ func TestSeedDB_Failure(t *testing.T) {
 		CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
 			return "", assert.AnError
 		},
-	})
+	}, 10)
 
 	sd.SeedDB(c)
 	resp := recorder.Result()
 	assert.EqualValues(t, http.StatusInternalServerError, resp.StatusCode)
 
 }
+
+func TestSeedDB_ConfiguredCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	created := 0
+	sd := handlers.NewDataSeedHandler(&mocks.MockOrdersDataService{
+		CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
+			created++
+			return "random-id", nil
+		},
+	}, 25)
+
+	sd.SeedDB(c)
+	assert.EqualValues(t, http.StatusOK, recorder.Result().StatusCode)
+	assert.Equal(t, 25, created)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ETagHeader    = "ETag"
+	IfMatchHeader = "If-Match"
+)
+
+// OrderETag returns the strong entity tag of an order, it changes whenever the order version changes.
+func OrderETag(id string, version int64) string {
+	return `"` + id + "-" + strconv.FormatInt(version, 10) + `"`
+}
+
+// ordersListETag returns a weak entity tag for a page of orders.
+func ordersListETag(orders []data.Order) string {
+	h := sha256.New()
+	for _, order := range orders {
+		h.Write([]byte(OrderETag(order.ID.Hex(), order.Version)))
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+// hasIfMatch reports whether the request is conditional on the current order version.
+func hasIfMatch(c *gin.Context) bool {
+	return strings.TrimSpace(c.GetHeader(IfMatchHeader)) != ""
+}
+
+// ifMatch reports whether the If-Match header allows a write on a resource with the given etag.
+// Requests without If-Match are always allowed, weak tags never match as If-Match requires strong comparison.
+func ifMatch(c *gin.Context, etag string) bool {
+	header := strings.TrimSpace(c.GetHeader(IfMatchHeader))
+	if header == "" || header == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/derickit/go-rest-api/internal/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// DocsPath is the route of the Swagger UI page, registered in dev mode only.
+const DocsPath = "/docs"
+
+// swaggerUIAssets is where the Swagger UI page loads its scripts and styles from.
+const swaggerUIAssets = "https://unpkg.com/swagger-ui-dist@5"
+
+// docsCSP lets the Swagger UI page load its assets, the default policy only allows same origin resources.
+const docsCSP = "default-src 'self'; script-src 'self' 'unsafe-inline' " + swaggerUIAssets +
+	"/; style-src 'self' 'unsafe-inline' " + swaggerUIAssets + "/; img-src 'self' data:"
+
+var swaggerUIPage = []byte(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Orders API</title>
+  <link rel="stylesheet" href="` + swaggerUIAssets + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + swaggerUIAssets + `/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "` + openapi.DocumentPath + `", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`)
+
+// OpenAPIDocument serves the OpenAPI document of the service.
+func OpenAPIDocument(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openapi.Document())
+}
+
+// SwaggerUI serves a Swagger UI page of the OpenAPI document.
+func SwaggerUI(c *gin.Context) {
+	c.Header("Content-Security-Policy", docsCSP)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerUIPage)
+}
@@ -0,0 +1,37 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/openapi"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	handlers.OpenAPIDocument(c)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, openapi.Document(), recorder.Body.Bytes())
+}
+
+func TestSwaggerUI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	handlers.SwaggerUI(c)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, recorder.Body.String(), `url: "`+openapi.DocumentPath+`"`)
+	assert.Contains(t, recorder.Header().Get("Content-Security-Policy"), "https://unpkg.com/swagger-ui-dist@5/")
+}
@@ -1,232 +1,833 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stdErrors "errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/derickit/go-rest-api/internal/auth"
 	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/errors"
 	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/models/data"
 	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/pricing"
+	"github.com/derickit/go-rest-api/internal/problems"
+	"github.com/derickit/go-rest-api/internal/rates"
 	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/gin-gonic/gin"
-	"github.com/go-faker/faker/v4"
+	"github.com/gin-gonic/gin/binding"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
 	OrderIDPath = "id"
+	// MaxPageSize is the default of the largest page of orders a client can request
 	MaxPageSize = 100
+
+	MergePatchContentType = "application/merge-patch+json"
+
+	anonymousHandler = "anonymous"
+
+	// couponReleaseAttempts is how many times the redemption of a cancelled, deleted or unsaved order is given back
+	couponReleaseAttempts = 3
+	couponReleaseBackoff  = 50 * time.Millisecond
 )
 
 type OrdersHandler struct {
-	oDataSvc db.OrdersDataService
-	logger   *logger.AppLogger
+	oDataSvc     db.OrdersDataService
+	cursors      *util.CursorCodec
+	maxPageSize  int
+	maxLineItems int
+	maxQuantity  int
+	rates        rates.ExchangeRateProvider
+	baseCurrency money.Currency
+	pricing      *pricing.Pipeline
+	coupons      db.CouponsDataService
+	customers    db.CustomersDataService
+	logger       *logger.AppLogger
+}
+
+// OrdersHandlerOpts configures an OrdersHandler, missing values are filled with defaults.
+type OrdersHandlerOpts struct {
+	Cursors     *util.CursorCodec // signs the pagination cursors, a codec with a random key is used when nil
+	MaxPageSize int               // largest page of orders a client can request, defaults to MaxPageSize
+	// MaxLineItems is the largest number of products of an order, defaults to DefMaxLineItems
+	MaxLineItems int
+	// MaxQuantity is the largest quantity of a single product of an order, defaults to DefMaxQuantity
+	MaxQuantity int
+	// BaseCurrency is the currency order totals are reported in, defaults to money.DefaultCurrency
+	BaseCurrency money.Currency
+	// Rates converts order totals to the base currency, only orders in the base currency are accepted when nil
+	Rates rates.ExchangeRateProvider
+	// Pricing prices orders, only coupon discounts apply when nil
+	Pricing *pricing.Pipeline
+	// Coupons are redeemed by the orders with a coupon code, orders with a coupon code are rejected when nil
+	Coupons db.CouponsDataService
+	// Customers provide the addresses of the orders placed for a customer, orders with a customer are rejected
+	// when nil
+	Customers db.CustomersDataService
 }
 
-func NewOrdersHandler(dSvc db.OrdersDataService, lgr *logger.AppLogger) *OrdersHandler {
+func NewOrdersHandler(dSvc db.OrdersDataService, opts *OrdersHandlerOpts, lgr *logger.AppLogger) *OrdersHandler {
+	if opts == nil {
+		opts = &OrdersHandlerOpts{}
+	}
+	if opts.Cursors == nil {
+		opts.Cursors = util.NewCursorCodec(nil)
+	}
+	if opts.MaxPageSize <= 0 {
+		opts.MaxPageSize = MaxPageSize
+	}
+	if opts.MaxLineItems <= 0 {
+		opts.MaxLineItems = DefMaxLineItems
+	}
+	if opts.MaxQuantity <= 0 {
+		opts.MaxQuantity = DefMaxQuantity
+	}
+	if opts.BaseCurrency == "" {
+		opts.BaseCurrency = money.DefaultCurrency
+	}
+	if opts.Rates == nil {
+		opts.Rates = &rates.Table{Base: opts.BaseCurrency}
+	}
+	if opts.Pricing == nil {
+		opts.Pricing = pricing.NewPipeline(pricing.CouponDiscount{})
+	}
 	o := &OrdersHandler{
-		oDataSvc: dSvc,
-		logger:   lgr,
+		oDataSvc:     dSvc,
+		cursors:      opts.Cursors,
+		maxPageSize:  opts.MaxPageSize,
+		maxLineItems: opts.MaxLineItems,
+		maxQuantity:  opts.MaxQuantity,
+		rates:        opts.Rates,
+		baseCurrency: opts.BaseCurrency,
+		pricing:      opts.Pricing,
+		coupons:      opts.Coupons,
+		customers:    opts.Customers,
+		logger:       lgr,
 	}
 	return o
 }
 
 func (o *OrdersHandler) Create(c *gin.Context) {
-	lgr, requestID := o.logger.WithReqID(c)
 	var orderInput external.OrderInput
-	if err := c.ShouldBindJSON(&orderInput); err != nil {
-		apiErr := &external.APIError{
-			HTTPStatusCode: http.StatusBadRequest,
-			ErrorCode:      errors.OrderCreateInvalidInput,
-			Message:        "Invalid order request body",
-			DebugID:        requestID,
-		}
-		lgr.Error().Err(err).Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).Msg(apiErr.Message)
-		c.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
-		return
+	if orderInput.Currency == "" {
+		orderInput.Currency = money.DefaultCurrency
 	}
-	var products []data.Product
-	for _, productInput := range orderInput.Products {
-		product := data.Product{
-			Name:     productInput.Name,
-			Price:    productInput.Price,
-			Quantity: productInput.Quantity,
-		}
-		products = append(products, product)
+	if err := bindInput(c.Request.Body, &orderInput, func() errors.InvalidFields {
+		return append(o.checkProducts(orderInput.Currency, orderInput.Products), checkOrderAddresses(&orderInput)...)
+	}); err != nil {
+		o.abort(c, errors.OpCreate, err)
+		return
 	}
+	products := toDataProducts(orderInput.Products, orderInput.Currency)
 
 	order := data.Order{
-		Version:     1,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
-		Products:    products,
-		User:        faker.Email(),
-		TotalAmount: util.CalculateTotalAmount(products),
-		Status:      data.OrderPending,
-	}
+		Version:   1,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Products:  products,
+		User:      handledBy(c),
+		Currency:  orderInput.Currency,
+		Status:    data.OrderPending,
 
-	if id, err := o.oDataSvc.Create(c, &order); err == nil {
-		extOrder := external.Order{
-			ID:          id,
-			Version:     order.Version,
-			CreatedAt:   util.FormatTimeToISO(order.CreatedAt),
-			UpdatedAt:   util.FormatTimeToISO(order.UpdatedAt),
-			Products:    order.Products,
-			User:        order.User,
-			TotalAmount: order.TotalAmount,
-			Status:      order.Status,
+		ShippingAddress: toDataAddress(orderInput.ShippingAddress),
+		BillingAddress:  toDataAddress(orderInput.BillingAddress),
+	}
+	if orderInput.CustomerID != "" {
+		if err := o.customerAddresses(c, &orderInput, &order); err != nil {
+			o.abort(c, errors.OpCreate, err)
+			return
 		}
-		c.JSON(http.StatusCreated, extOrder)
+	}
+	if orderInput.CouponCode != "" {
+		coupon, err := o.couponForOrder(c, orderInput.CouponCode)
+		if err != nil {
+			o.abort(c, errors.OpCreate, err)
+			return
+		}
+		order.Coupon = coupon
+	}
+	if err := o.price(c, &order); err != nil {
+		o.abort(c, errors.OpCreate, err)
 		return
 	}
-
-	apiErr := &external.APIError{
-		HTTPStatusCode: http.StatusInternalServerError,
-		ErrorCode:      errors.OrderCreateServerError,
-		Message:        errors.UnexpectedErrorMessage,
-		DebugID:        requestID,
+	rate, err := o.rates.Rate(c, order.Currency, o.baseCurrency)
+	if err != nil {
+		o.abort(c, errors.OpCreate, err)
+		return
+	}
+	order.ExchangeRate = &data.ExchangeRate{
+		BaseCurrency:    rate.To,
+		Rate:            rate.Value,
+		AsOf:            rate.AsOf,
+		BaseTotalAmount: rate.Convert(order.TotalAmount),
+	}
+	if rate.AsOf.IsZero() {
+		// orders in the base currency are converted without rates being published
+		order.ExchangeRate.AsOf = order.CreatedAt
+	}
+	if order.Coupon != nil {
+		// redeemed last, so that only orders which passed every other check count against the coupon limits
+		redemption := data.CouponRedemption{ID: primitive.NewObjectID(), User: order.User, RedeemedAt: order.CreatedAt}
+		if err = o.coupons.Redeem(c, order.Coupon.CouponID, &redemption); err != nil {
+			o.abort(c, errors.OpCreate, err)
+			return
+		}
+		order.Coupon.RedemptionID = redemption.ID
 	}
 
-	lgr.Error().Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).Msg(apiErr.Message)
-	c.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+	id, err := o.oDataSvc.Create(c, &order)
+	if err != nil {
+		o.releaseCoupon(c, &order)
+		o.abort(c, errors.OpCreate, err)
+		return
+	}
+	extOrder := external.Order{
+		ID:          id,
+		Version:     order.Version,
+		CreatedAt:   util.FormatTimeToISO(order.CreatedAt),
+		UpdatedAt:   util.FormatTimeToISO(order.UpdatedAt),
+		Products:    order.Products,
+		User:        order.User,
+		Currency:    order.Currency,
+		TotalAmount: order.TotalAmount,
+		Status:      order.Status,
 
+		ExchangeRate:    order.ExchangeRate,
+		ShippingAddress: order.ShippingAddress,
+		BillingAddress:  order.BillingAddress,
+		CustomerID:      order.CustomerID,
+		Pricing:         order.Pricing,
+		Coupon:          order.Coupon,
+	}
+	c.Header(ETagHeader, OrderETag(id, order.Version))
+	c.JSON(http.StatusCreated, extOrder)
 }
 
 func (o *OrdersHandler) GetAll(c *gin.Context) {
-	lgr, requestID := o.logger.WithReqID(c)
-	limit, apiErr := o.parseLimitQueryParam(c)
 	// Validate  inputs : fail fast order
 	// Parse query params
-	if apiErr != nil {
-		c.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+	query, err := o.parseOrdersQuery(c)
+	if err != nil {
+		o.abort(c, errors.OpGet, err)
+		return
+	}
+	o.listOrders(c, errors.OpGet, query)
+}
+
+// GetByCustomer lists the orders placed for the customer of the id path param, with the query params of GetAll.
+func (o *OrdersHandler) GetByCustomer(c *gin.Context) {
+	cID, err := customerID(c)
+	if err != nil {
+		o.abort(c, errors.OpCustomerGet, err)
+		return
+	}
+	if o.customers == nil {
+		o.abort(c, errors.OpCustomerGet, db.ErrCustomerNotFound)
+		return
+	}
+	customer, err := o.customers.GetByID(c, cID)
+	if err == nil && !canAccessCustomer(c, customer) {
+		err = db.ErrCustomerNotFound
+	}
+	if err != nil {
+		o.abort(c, errors.OpCustomerGet, err)
+		return
+	}
+	query, err := o.parseOrdersQuery(c)
+	if err != nil {
+		o.abort(c, errors.OpCustomerGet, err)
+		return
+	}
+	query.Filters = append(query.Filters, db.OrderFilter{Field: "customerId", Op: db.FilterEq, Value: cID.Hex()})
+	o.listOrders(c, errors.OpCustomerGet, query)
+}
+
+// listOrders writes the page of orders matching the query to the response.
+func (o *OrdersHandler) listOrders(c *gin.Context, op errors.Op, query *db.OrdersQuery) {
+	// non admins only ever see their own orders, admins can narrow down with the user filter
+	if user, all := accessScope(c); !all {
+		query.Filters = append(query.Filters, db.OrderFilter{Field: "user", Op: db.FilterEq, Value: user})
+	}
+
+	page, err := o.oDataSvc.GetAll(c, query)
+	if err != nil {
+		o.abort(c, op, err)
 		return
 	}
 
-	orders, err := o.oDataSvc.GetAll(c, limit)
-	var extOrders []external.Order
-	if orders != nil {
-		extOrders = make([]external.Order, len(*orders))
-		for i, o := range *orders {
-			extOrders[i] = external.Order{
-				ID:          o.ID.Hex(),
-				Version:     o.Version,
-				Status:      o.Status,
-				TotalAmount: o.TotalAmount,
-				User:        o.User,
-				CreatedAt:   util.FormatTimeToISO(o.CreatedAt),
-				UpdatedAt:   util.FormatTimeToISO(o.UpdatedAt),
-				Products:    o.Products,
-			}
+	extPage := external.OrdersPage{
+		Items:      make([]external.Order, len(page.Orders)),
+		TotalCount: page.TotalCount,
+	}
+	for i := range page.Orders {
+		extPage.Items[i] = toExternalOrder(&page.Orders[i])
+	}
+	// cursors are positions in the default sort order only
+	if n := len(page.Orders); n > 0 && query.Sort == nil {
+		first, last := page.Orders[0], page.Orders[n-1]
+		if page.HasNext {
+			extPage.NextCursor = o.cursors.Encode(util.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+		if page.HasPrev {
+			extPage.PrevCursor = o.cursors.Encode(util.Cursor{CreatedAt: first.CreatedAt, ID: first.ID, Backward: true})
 		}
 	}
+	c.Header(ETagHeader, ordersListETag(page.Orders))
+	c.JSON(http.StatusOK, extPage)
+}
+
+func (o *OrdersHandler) GetByID(c *gin.Context) {
+	oID, err := orderID(c)
+	if err != nil {
+		o.abort(c, errors.OpGet, err)
+		return
+	}
+	order, err := o.oDataSvc.GetByID(c, oID)
+	if err == nil && !canAccess(c, order) {
+		// other users' orders are reported as missing to not leak which ids exist
+		err = db.ErrPOIDNotFound
+	}
+	if err != nil {
+		o.abort(c, errors.OpGet, err)
+		return
+	}
+	c.Header(ETagHeader, OrderETag(order.ID.Hex(), order.Version))
+	c.JSON(http.StatusOK, toExternalOrder(order))
+}
 
+// DeleteByID removes the order and gives back its coupon redemption.
+func (o *OrdersHandler) DeleteByID(c *gin.Context) {
+	oID, err := orderID(c)
 	if err != nil {
-		aErr := &external.APIError{
-			HTTPStatusCode: http.StatusInternalServerError,
-			ErrorCode:      errors.OrderGetServerError,
-			Message:        errors.UnexpectedErrorMessage,
-			DebugID:        requestID,
+		o.abort(c, errors.OpDelete, err)
+		return
+	}
+	order, err := o.oDataSvc.GetByID(c, oID)
+	switch {
+	case err == nil && !canAccess(c, order):
+		err = db.ErrPOIDNotFound
+	case err == nil && !ifMatch(c, OrderETag(order.ID.Hex(), order.Version)):
+		err = errors.ErrPreconditionFailed
+	}
+	if err == nil {
+		if _, all := accessScope(c); hasIfMatch(c) || !all {
+			err = o.oDataSvc.DeleteByIDAndVersion(c, oID, order.Version)
+		} else {
+			err = o.oDataSvc.DeleteByID(c, oID)
 		}
-		lgr.Error().
-			Int("HttpStatusCode", aErr.HTTPStatusCode).
-			Str("ErrorCode", aErr.ErrorCode).
-			Msg(aErr.Message)
-		c.AbortWithStatusJSON(aErr.HTTPStatusCode, aErr)
+	}
+	if stdErrors.Is(err, db.ErrVersionConflict) {
+		// the order changed after its version was checked against If-Match
+		err = fmt.Errorf("%w: %w", errors.ErrPreconditionFailed, err)
+	}
+	if err != nil {
+		o.abort(c, errors.OpDelete, err)
 		return
 	}
-	c.JSON(http.StatusOK, extOrders)
+	if order.Coupon != nil && order.Coupon.ReleasedAt == nil {
+		// given back once the order is gone, so the redemption counts as long as the order exists
+		o.releaseCoupon(c, order)
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
 
+func (o *OrdersHandler) abort(c *gin.Context, op errors.Op, err error) {
+	abort(c, o.logger, op, err)
 }
 
-func (o *OrdersHandler) GetByID(c *gin.Context) {
-	lgr, requestID := o.logger.WithReqID(c)
+// abort reports err to the client as the problem the catalog of package problems maps it to for op.
+func abort(c *gin.Context, appLogger *logger.AppLogger, op errors.Op, err error) {
+	lgr, requestID := appLogger.WithReqID(c)
+	apiErr := problems.For(op, err)
+	apiErr.DebugID = requestID
+	lgr.Error().Err(err).Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).Msg(apiErr.Message)
+	errors.Abort(c, apiErr)
+}
+
+// orderID reads the order id path param.
+func orderID(c *gin.Context) (primitive.ObjectID, error) {
 	id := c.Param(OrderIDPath)
 	oID, err := primitive.ObjectIDFromHex(id)
-	if oID.IsZero() || err != nil {
-		aErr := &external.APIError{
-			HTTPStatusCode: http.StatusBadRequest,
-			ErrorCode:      "",
-			Message:        "Invalid order id",
-			DebugID:        requestID,
+	if err != nil || oID.IsZero() {
+		return primitive.NilObjectID, fmt.Errorf("%w %q", db.ErrInvalidPOIDUpdate, id)
+	}
+	return oID, nil
+}
+
+// parseOrdersQuery reads the pagination, filter and sort query params.
+func (o *OrdersHandler) parseOrdersQuery(c *gin.Context) (*db.OrdersQuery, error) {
+	limit, err := o.parseLimitQueryParam(c)
+	if err != nil {
+		return nil, err
+	}
+	query := &db.OrdersQuery{Limit: limit}
+	invalidParam := func(message string) error {
+		return fmt.Errorf("%w: %s", errors.ErrInvalidQueryParam, message)
+	}
+	if input, exists := c.GetQuery("offset"); exists && input != "" {
+		offset, err := strconv.ParseInt(input, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, invalidParam("non negative integer value is expected for offset query param")
+		}
+		query.Offset = offset
+	}
+	if input, exists := c.GetQuery("cursor"); exists && input != "" {
+		if query.Offset > 0 {
+			return nil, invalidParam("cursor and offset query params can't be used together")
 		}
-		lgr.Error().Int("HttpStatusCode", aErr.HTTPStatusCode).Str("ErrorCode", aErr.ErrorCode).Msg(aErr.Message)
+		cursor, err := o.cursors.Decode(input)
+		if err != nil {
+			return nil, invalidParam("cursor query param is not a cursor of this service")
+		}
+		query.Cursor = cursor
+	}
+	if input, exists := c.GetQuery("includeTotal"); exists && input != "" {
+		includeTotal, err := strconv.ParseBool(input)
+		if err != nil {
+			return nil, invalidParam("boolean value is expected for includeTotal query param")
+		}
+		query.IncludeTotal = includeTotal
+	}
+	if query.Filters, err = parseOrderFilters(c, PaginationQueryParams); err != nil {
+		return nil, err
+	}
+	if query.Sort, err = parseOrderSort(c); err != nil {
+		return nil, err
+	}
+	if query.Cursor != nil && query.Sort != nil {
+		return nil, db.ErrCursorWithSort
+	}
+	return query, nil
+}
+
+func (o *OrdersHandler) parseLimitQueryParam(c *gin.Context) (int64, error) {
+	l := min(db.DefaultPageSize, o.maxPageSize)
+	if input, exists := c.GetQuery("limit"); exists && input != "" {
+		var err error
+		l, err = strconv.Atoi(input)
+		if err != nil || l < 1 || l > o.maxPageSize {
+			return 0, fmt.Errorf("%w: integer value within 1 and %d is expected for limit query param",
+				errors.ErrInvalidQueryParam, o.maxPageSize)
+		}
+	}
+	return int64(l), nil
+}
+
+// Update replaces the products and status of an order (PUT).
+func (o *OrdersHandler) Update(c *gin.Context) {
+	order, err := o.orderForUpdate(c)
+	if err != nil {
+		o.abort(c, errors.OpUpdate, err)
+		return
+	}
+	var updateInput external.OrderUpdateInput
+	if err := o.bindOrderInput(c.Request.Body, &updateInput, func() (money.Currency, []external.ProductInput) {
+		return order.Currency, updateInput.Products
+	}); err != nil {
+		o.abort(c, errors.OpUpdate, err)
 		return
 	}
+	o.saveUpdate(c, order, &updateInput)
+}
+
+// Patch applies a JSON merge patch (RFC 7396) to the products and status of an order (PATCH).
+func (o *OrdersHandler) Patch(c *gin.Context) {
+	contentType := c.ContentType()
+	if contentType != MergePatchContentType && contentType != binding.MIMEJSON {
+		o.abort(c, errors.OpUpdate, fmt.Errorf("%w %q, %s is expected for order patch",
+			errors.ErrUnsupportedMediaType, contentType, MergePatchContentType))
+		return
+	}
+	order, err := o.orderForUpdate(c)
+	if err != nil {
+		o.abort(c, errors.OpUpdate, err)
+		return
+	}
+	patched, err := patchOrder(order, c.Request.Body)
+	if err != nil {
+		o.abort(c, errors.OpUpdate, fmt.Errorf("%w: %w", errors.ErrInvalidInput, err))
+		return
+	}
+	var patchedInput external.OrderUpdateInput
+	if err := o.bindOrderInput(bytes.NewReader(patched), &patchedInput, func() (money.Currency, []external.ProductInput) {
+		return order.Currency, patchedInput.Products
+	}); err != nil {
+		o.abort(c, errors.OpUpdate, err)
+		return
+	}
+	o.saveUpdate(c, order, &patchedInput)
+}
+
+// orderForUpdate loads the order referenced by the id path param.
+func (o *OrdersHandler) orderForUpdate(c *gin.Context) (*data.Order, error) {
+	oID, err := orderID(c)
+	if err != nil {
+		return nil, err
+	}
 	order, err := o.oDataSvc.GetByID(c, oID)
+	if err == nil && !canAccess(c, order) {
+		err = db.ErrPOIDNotFound
+	}
 	if err != nil {
-		aErr := &external.APIError{
-			HTTPStatusCode: http.StatusInternalServerError,
-			ErrorCode:      "",
-			Message:        "fill this in with a meaningful error message",
-			DebugID:        requestID,
+		return nil, err
+	}
+	if !ifMatch(c, OrderETag(order.ID.Hex(), order.Version)) {
+		return nil, errors.ErrPreconditionFailed
+	}
+	return order, nil
+}
+
+// saveUpdate applies the update input to the order, persists it and writes the updated order to the response.
+// The products are only replaced and repriced when they changed, which the orders that are or become delivered,
+// completed or cancelled don't allow.
+func (o *OrdersHandler) saveUpdate(c *gin.Context, order *data.Order, updateInput *external.OrderUpdateInput) {
+	from := order.Status
+	if updateInput.Status != order.Status {
+		if err := changeStatus(c, order, updateInput.Status, "status changed by order update"); err != nil {
+			o.abort(c, errors.OpUpdate, err)
+			return
 		}
-		lgr.Error().Int("HttpStatusCode", aErr.HTTPStatusCode).Str("ErrorCode", aErr.ErrorCode).Msg(aErr.Message)
-		c.AbortWithStatusJSON(aErr.HTTPStatusCode, aErr)
+	}
+	products := toDataProducts(updateInput.Products, order.Currency)
+	if !productsChanged(order.Products, products) {
+		o.persistUpdate(c, order)
 		return
 	}
-	c.JSON(http.StatusOK, order)
+	for _, status := range []data.OrderStatus{from, order.Status} {
+		if !status.ProductsCanChange() {
+			o.abort(c, errors.OpUpdate, fmt.Errorf("%w: order is %s", errors.ErrProductsLocked, status))
+			return
+		}
+	}
+	order.Products = products
+	if err := o.price(c, order); err != nil {
+		o.abort(c, errors.OpUpdate, err)
+		return
+	}
+	if order.ExchangeRate != nil {
+		// the total changes, the rate the order was created with doesn't
+		order.ExchangeRate.BaseTotalAmount = order.ExchangeRate.Convert(order.TotalAmount)
+	}
+	o.persistUpdate(c, order)
 }
 
-func (o *OrdersHandler) DeleteByID(c *gin.Context) {
-	lgr, requestID := o.logger.WithReqID(c)
-	id := c.Param(OrderIDPath)
-	oID, err := primitive.ObjectIDFromHex(id)
-	if oID.IsZero() || err != nil {
-		aErr := &external.APIError{
-			HTTPStatusCode: http.StatusBadRequest,
-			ErrorCode:      "",
-			Message:        "Invalid order id",
-			DebugID:        requestID,
+// price runs the pricing rules on the order, the total of the order is the total of the resulting breakdown.
+func (o *OrdersHandler) price(c *gin.Context, order *data.Order) error {
+	breakdown, err := o.pricing.Price(c, &pricing.Quote{
+		Currency:        order.Currency,
+		Products:        order.Products,
+		ShippingAddress: order.ShippingAddress,
+		Coupon:          order.Coupon,
+	})
+	if err != nil {
+		return err
+	}
+	order.Pricing = breakdown
+	order.TotalAmount = breakdown.Total
+	return nil
+}
+
+// couponForOrder looks up the coupon with the code, the order keeps a snapshot of its terms.
+func (o *OrdersHandler) couponForOrder(c *gin.Context, code string) (*data.AppliedCoupon, error) {
+	if o.coupons == nil {
+		return nil, fmt.Errorf("%w: coupons are not supported", pricing.ErrCouponNotApplicable)
+	}
+	coupon, err := o.coupons.GetByCode(c, strings.ToUpper(code))
+	if stdErrors.Is(err, db.ErrCouponNotFound) {
+		return nil, fmt.Errorf("%w: coupon %s doesn't exist", pricing.ErrCouponNotApplicable, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &data.AppliedCoupon{CouponID: coupon.ID, Code: coupon.Code, CouponTerms: coupon.CouponTerms}, nil
+}
+
+// checkOrderAddresses reports the address ids given without a customer and the addresses given both inline and
+// by id.
+func checkOrderAddresses(input *external.OrderInput) errors.InvalidFields {
+	var fields errors.InvalidFields
+	addresses := []struct {
+		name    string
+		address *external.AddressInput
+		id      string
+	}{
+		{"shippingAddress", input.ShippingAddress, input.ShippingAddressID},
+		{"billingAddress", input.BillingAddress, input.BillingAddressID},
+	}
+	for _, a := range addresses {
+		switch {
+		case a.id == "":
+		case input.CustomerID == "":
+			fields = append(fields, external.FieldError{Pointer: "/" + a.name + "Id", Reason: "requires customerId"})
+		case a.address != nil:
+			fields = append(fields, external.FieldError{
+				Pointer: "/" + a.name + "Id",
+				Reason:  "should not be set with " + a.name,
+			})
+		}
+	}
+	return fields
+}
+
+// customerAddresses links the order and its user to the customer and copies the addresses of the customer the order
+// uses, the addresses given with the order are kept. The customers of other users are not found.
+func (o *OrdersHandler) customerAddresses(c *gin.Context, input *external.OrderInput, order *data.Order) error {
+	if o.customers == nil {
+		return errors.InvalidFields{{Pointer: "/customerId", Reason: "customers are not supported"}}
+	}
+	cID, _ := primitive.ObjectIDFromHex(input.CustomerID)
+	customer, err := o.customers.GetByID(c, cID)
+	if err != nil {
+		return err
+	}
+	if !canAccessCustomer(c, customer) {
+		return db.ErrCustomerNotFound
+	}
+	order.CustomerID = customer.ID.Hex()
+	if customer.User != "" {
+		// the customers created before they had users keep the caller as the user of the order
+		order.User = customer.User
+	}
+	var fields errors.InvalidFields
+	addresses := []struct {
+		name     string
+		addrType data.AddressType
+		id       string
+		address  **data.Address
+	}{
+		{"shippingAddress", data.ShippingAddressType, input.ShippingAddressID, &order.ShippingAddress},
+		{"billingAddress", data.BillingAddressType, input.BillingAddressID, &order.BillingAddress},
+	}
+	for _, a := range addresses {
+		if *a.address != nil {
+			continue
+		}
+		// an empty id picks the default address of the type
+		addrID, _ := primitive.ObjectIDFromHex(a.id)
+		*a.address = customer.AddressOf(a.addrType, addrID)
+		if *a.address == nil && a.id != "" {
+			fields = append(fields, external.FieldError{
+				Pointer: "/" + a.name + "Id",
+				Reason:  fmt.Sprintf("is not a %s address of the customer", a.addrType),
+			})
+		}
+	}
+	if len(fields) > 0 {
+		return fields
+	}
+	return nil
+}
+
+// releaseCoupon gives back the coupon redemption of an order that was cancelled, deleted or not created, releasing
+// it again does nothing. The order is written first, a redemption that can't be given back keeps counting against
+// the coupon limits and is logged.
+func (o *OrdersHandler) releaseCoupon(c *gin.Context, order *data.Order) {
+	if order.Coupon == nil || order.Coupon.RedemptionID.IsZero() || o.coupons == nil {
+		return
+	}
+	// the order is already written, the release goes on when the client goes away
+	ctx := context.WithoutCancel(c.Request.Context())
+	var err error
+	for attempt := 1; attempt <= couponReleaseAttempts; attempt++ {
+		if err = o.coupons.Release(ctx, order.Coupon.CouponID, order.Coupon.RedemptionID); err == nil {
+			return
 		}
-		lgr.Error().Int("HttpStatusCode", aErr.HTTPStatusCode).Str("ErrorCode", aErr.ErrorCode).Msg(aErr.Message)
-		c.AbortWithStatusJSON(aErr.HTTPStatusCode, aErr)
+		if attempt < couponReleaseAttempts {
+			time.Sleep(couponReleaseBackoff * time.Duration(attempt))
+		}
+	}
+	lgr, _ := o.logger.WithReqID(c)
+	lgr.Error().Err(err).Str("couponId", order.Coupon.CouponID.Hex()).
+		Str("redemptionId", order.Coupon.RedemptionID.Hex()).Msg("coupon redemption could not be released")
+}
+
+// Transition moves an order to another status, following the order status state machine.
+func (o *OrdersHandler) Transition(c *gin.Context) {
+	order, err := o.orderForUpdate(c)
+	if err != nil {
+		o.abort(c, errors.OpUpdate, err)
+		return
+	}
+	var transitionInput external.OrderTransitionInput
+	if err = bindInput(c.Request.Body, &transitionInput, nil); err != nil {
+		o.abort(c, errors.OpUpdate, err)
 		return
 	}
-	dErr := o.oDataSvc.DeleteByID(c, oID)
-	if dErr != nil {
-		aErr := &external.APIError{
-			HTTPStatusCode: http.StatusInternalServerError,
-			ErrorCode:      "",
-			Message:        "fill this in with a meaningful error message",
-			DebugID:        requestID,
+	if err = changeStatus(c, order, transitionInput.Status, transitionInput.Notes); err != nil {
+		o.abort(c, errors.OpUpdate, err)
+		return
+	}
+	o.persistUpdate(c, order)
+}
+
+// changeStatus moves the order to the target status and records the change in the order updates,
+// an error is returned when the state machine doesn't allow the transition.
+func changeStatus(c *gin.Context, order *data.Order, target data.OrderStatus, notes string) error {
+	if !target.IsValid() {
+		return errors.InvalidFields{{Pointer: "/status", Reason: fmt.Sprintf("%q is not an order status", target)}}
+	}
+	if !order.Status.CanTransitionTo(target) {
+		return fmt.Errorf("%w: order can't move from %s to %s", errors.ErrTransitionNotAllowed, order.Status, target)
+	}
+	order.Updates = append(order.Updates, data.OrderUpdate{
+		UpdateAt:   time.Now(),
+		Notes:      notes,
+		HandleBy:   handledBy(c),
+		FromStatus: order.Status,
+		ToStatus:   target,
+	})
+	order.Status = target
+	return nil
+}
+
+// persistUpdate saves the order and writes the updated order to the response. Cancelled orders give their coupon
+// redemption back before they are saved and ReleasedAt is only saved once that succeeded, a failed save can be
+// retried as releasing again does nothing.
+func (o *OrdersHandler) persistUpdate(c *gin.Context, order *data.Order) {
+	release := order.Status == data.OrderCancelled && order.Coupon != nil && order.Coupon.ReleasedAt == nil
+	if release {
+		// saved with the cancellation and its version check, the redemption is given back once that succeeded
+		releasedAt := time.Now()
+		order.Coupon.ReleasedAt = &releasedAt
+	}
+	if err := o.oDataSvc.Update(c, order); err != nil {
+		if stdErrors.Is(err, db.ErrVersionConflict) && hasIfMatch(c) {
+			// the order changed after its version was checked against If-Match
+			err = fmt.Errorf("%w: %w", errors.ErrPreconditionFailed, err)
 		}
-		lgr.Error().Int("HttpStatusCode", aErr.HTTPStatusCode).Str("ErrorCode", aErr.ErrorCode).Msg(aErr.Message)
+		o.abort(c, errors.OpUpdate, err)
 		return
 	}
-	c.JSON(http.StatusNoContent, nil)
+	if release {
+		o.releaseCoupon(c, order)
+	}
+	c.Header(ETagHeader, OrderETag(order.ID.Hex(), order.Version))
+	c.JSON(http.StatusOK, toExternalOrder(order))
 }
 
-func (o *OrdersHandler) parseLimitQueryParam(c *gin.Context) (int64, *external.APIError) {
-	lgr, requestID := o.logger.WithReqID(c)
-	l := db.DefaultPageSize
-	if input, exists := c.GetQuery("limit"); exists && input != "" {
-		var err error
-		l, err = strconv.Atoi(input)
-		if err != nil {
-			apiErr := &external.APIError{
-				HTTPStatusCode: http.StatusBadRequest,
-				ErrorCode:      "",
-				Message:        fmt.Sprintf("Integer value within 1 and %d is expected for limit query param", MaxPageSize),
-				DebugID:        requestID,
-			}
-			lgr.Error().Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).Msg(apiErr.Message)
-			return 0, apiErr
-		}
-		if l < 1 || l > MaxPageSize {
-			apiErr := &external.APIError{
-				HTTPStatusCode: http.StatusBadRequest,
-				ErrorCode:      "",
-				Message:        fmt.Sprintf("Integer value within 1 and %d is expected for limit query param", MaxPageSize),
-				DebugID:        requestID,
-			}
-			lgr.Error().Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).Msg(apiErr.Message)
-			return 0, apiErr
-		}
-
-	}
-	return int64(1), nil
+// patchOrder applies the merge patch read from body to the updatable fields of the order, the patched
+// fields are returned as an OrderUpdateInput document.
+func patchOrder(order *data.Order, body io.Reader) ([]byte, error) {
+	patch, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	current, err := json.Marshal(external.OrderUpdateInput{
+		Products: toProductInputs(order.Products),
+		Status:   order.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return util.MergePatch(current, patch)
+}
+
+// handledBy identifies who made a change to an order, it is also the user new orders belong to.
+func handledBy(c *gin.Context) string {
+	if principal, ok := auth.PrincipalFrom(c); ok {
+		return principal.Subject
+	}
+	return anonymousHandler
+}
+
+// accessScope returns the user whose orders the caller may access, all is true for admins who may access every order.
+func accessScope(c *gin.Context) (user string, all bool) {
+	if principal, ok := auth.PrincipalFrom(c); ok && principal.HasScope(auth.ScopeAdmin) {
+		return "", true
+	}
+	return handledBy(c), false
+}
+
+func canAccess(c *gin.Context, order *data.Order) bool {
+	user, all := accessScope(c)
+	return all || order.User == user
+}
+
+// toDataProducts converts the product inputs, prices get the scale of the minor unit of the currency.
+func toDataProducts(productInputs []external.ProductInput, currency money.Currency) []data.Product {
+	var products []data.Product
+	for _, productInput := range productInputs {
+		product := data.Product{
+			Name:     strings.TrimSpace(productInput.Name),
+			Price:    currency.Round(productInput.Price),
+			Quantity: productInput.Quantity,
+			UpdateAt: time.Now(),
+		}
+		products = append(products, product)
+	}
+	return products
+}
+
+// productsChanged reports whether the updated products differ from the current ones in name, price or quantity.
+func productsChanged(current, updated []data.Product) bool {
+	if len(current) != len(updated) {
+		return true
+	}
+	for i := range current {
+		if current[i].Name != updated[i].Name || !current[i].Price.Equal(updated[i].Price) ||
+			current[i].Quantity != updated[i].Quantity {
+			return true
+		}
+	}
+	return false
+}
+
+func toDataAddress(addressInput *external.AddressInput) *data.Address {
+	if addressInput == nil {
+		return nil
+	}
+	return &data.Address{
+		Name:       addressInput.Name,
+		Line1:      addressInput.Line1,
+		Line2:      addressInput.Line2,
+		City:       addressInput.City,
+		Region:     addressInput.Region,
+		PostalCode: addressInput.PostalCode,
+		Country:    addressInput.Country,
+	}
+}
+
+func toProductInputs(products []data.Product) []external.ProductInput {
+	productInputs := make([]external.ProductInput, len(products))
+	for i, product := range products {
+		productInputs[i] = external.ProductInput{
+			Name:     product.Name,
+			Price:    product.Price,
+			Quantity: product.Quantity,
+		}
+	}
+	return productInputs
+}
+
+func toExternalOrder(order *data.Order) external.Order {
+	return external.Order{
+		ID:          order.ID.Hex(),
+		Version:     order.Version,
+		CreatedAt:   util.FormatTimeToISO(order.CreatedAt),
+		UpdatedAt:   util.FormatTimeToISO(order.UpdatedAt),
+		Products:    order.Products,
+		User:        order.User,
+		Currency:    order.Currency,
+		TotalAmount: order.TotalAmount,
+		Status:      order.Status,
+		Updates:     order.Updates,
+
+		ExchangeRate:    order.ExchangeRate,
+		ShippingAddress: order.ShippingAddress,
+		BillingAddress:  order.BillingAddress,
+		CustomerID:      order.CustomerID,
+		Pricing:         order.Pricing,
+		Coupon:          order.Coupon,
+	}
 }
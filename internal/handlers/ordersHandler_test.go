@@ -9,21 +9,37 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	errors2 "github.com/derickit/go-rest-api/internal/errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/db/mocks"
 	"github.com/derickit/go-rest-api/internal/handlers"
 	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/models"
 	"github.com/derickit/go-rest-api/internal/models/data"
 	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/pricing"
+	"github.com/derickit/go-rest-api/internal/rates"
+	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+var testAdmin = &auth.Principal{Subject: "admin@example.com", Scopes: []string{auth.ScopeAdmin}}
+
+func withPrincipal(p *auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth.SetPrincipal(c, p)
+	}
+}
+
 func UnMarshalOrderData(d []byte) (*data.Order, error) {
 	var r data.Order
 	err := json.Unmarshal(d, &r)
@@ -47,11 +63,12 @@ func TestOrdersHandler_Create_Success(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
 		CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
 			return "1", nil
 		},
-	}, lgr)
+	}, nil, lgr)
 
 	r.POST("/orders", handler.Create)
 
@@ -59,8 +76,8 @@ func TestOrdersHandler_Create_Success(t *testing.T) {
 
 		Products: []external.ProductInput{
 			{Name: "product 1",
-				Price:    10.0,
-				Quantity: 1},
+				Price:    money.MustParseAmount("0.1"),
+				Quantity: 3},
 		},
 	}
 	body, _ := json.Marshal(orderInput)
@@ -75,9 +92,10 @@ func TestOrdersHandler_Create_Success(t *testing.T) {
 	assert.NotNil(t, responseOrder.CreatedAt)
 	assert.NotNil(t, responseOrder.UpdatedAt)
 	assert.Equal(t, orderInput.Products[0].Name, responseOrder.Products[0].Name)
-	assert.InEpsilon(t, orderInput.Products[0].Name, responseOrder.Products[0].Price, 0)
+	assert.Equal(t, "0.10", responseOrder.Products[0].Price.String())
 	assert.Equal(t, orderInput.Products[0].Quantity, responseOrder.Products[0].Quantity)
-	assert.InEpsilon(t, 20.0, responseOrder.TotalAmount, 0)
+	assert.Equal(t, money.DefaultCurrency, responseOrder.Currency)
+	assert.Equal(t, "0.30", responseOrder.TotalAmount.String(), "totals are exact")
 	assert.Equal(t, data.OrderPending, responseOrder.Status)
 }
 
@@ -86,11 +104,12 @@ func TestOrderHandler_Create_InvalidInput(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
 		CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
 			return "MOCK_ORDER_ID", nil
 		},
-	}, lgr)
+	}, nil, lgr)
 	r.POST("/orders", handler.Create)
 	invalidInput := "{invalid JSON}"
 	c.Request, _ = http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(invalidInput)))
@@ -101,7 +120,367 @@ func TestOrderHandler_Create_InvalidInput(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusBadRequest, apiErr.HTTPStatusCode)
 	assert.Equal(t, "orders_create_invalid_input", apiErr.ErrorCode)
-	assert.Equal(t, "invalid order request body", apiErr.Message)
+	assert.Equal(t, "invalid request body", apiErr.Message)
+}
+
+func TestOrderHandler_Create_FieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		fields []external.FieldError
+	}{
+		{
+			name:   "missing products",
+			body:   `{}`,
+			fields: []external.FieldError{{Pointer: "/products", Reason: "is required"}},
+		},
+		{
+			name:   "no products",
+			body:   `{"products": []}`,
+			fields: []external.FieldError{{Pointer: "/products", Reason: "should have at least 1 items"}},
+		},
+		{
+			name: "every invalid field",
+			body: `{"products": [{"name": " ", "price": 0, "quantity": 0}, {"price": 1.005, "quantity": 1}]}`,
+			fields: []external.FieldError{
+				{Pointer: "/products/0/name", Reason: "should not be blank"},
+				{Pointer: "/products/0/price", Reason: "should be greater than 0"},
+				{Pointer: "/products/0/quantity", Reason: "should be at least 1"},
+				{Pointer: "/products/1/name", Reason: "is required"},
+				{Pointer: "/products/1/price", Reason: "should have at most 2 decimal places in USD"},
+			},
+		},
+		{
+			name: "limits",
+			body: `{"products": [{"name": "a", "price": 1, "quantity": 6}, {"name": "b", "price": 1, "quantity": 1},
+				{"name": "c", "price": 1.5, "quantity": 5}]}`,
+			fields: []external.FieldError{
+				{Pointer: "/products", Reason: "should have at most 2 items"},
+				{Pointer: "/products/0/quantity", Reason: "should be at most 5"},
+			},
+		},
+		{
+			name: "currency",
+			body: `{"currency": "JPY", "products": [{"name": "a", "price": 100.5, "quantity": 1}]}`,
+			fields: []external.FieldError{
+				{Pointer: "/products/0/price", Reason: "should have at most 0 decimal places in JPY"},
+			},
+		},
+		{
+			name:   "unknown currency",
+			body:   `{"currency": "usd", "products": [{"name": "a", "price": "1.00", "quantity": 1}]}`,
+			fields: []external.FieldError{{Pointer: "/currency", Reason: "should be an ISO 4217 currency code"}},
+		},
+		{
+			name: "mixed currencies",
+			body: `{"currency": "EUR", "products": [{"name": "a", "price": 1, "quantity": 1, "currency": "EUR"},
+				{"name": "b", "price": 1, "quantity": 1, "currency": "USD"}]}`,
+			fields: []external.FieldError{{Pointer: "/products/1/currency", Reason: "should be the order currency EUR"}},
+		},
+		{
+			name: "shipping address",
+			body: `{"products": [{"name": "a", "price": 1, "quantity": 1}],
+				"shippingAddress": {"country": "United States", "region": "california"}}`,
+			fields: []external.FieldError{
+				{Pointer: "/shippingAddress/country", Reason: "should be an ISO 3166-1 alpha-2 country code"},
+				{Pointer: "/shippingAddress/region", Reason: "should be an ISO 3166-2 subdivision code without the country, e.g. CA"},
+			},
+		},
+		{
+			name:   "wrong type",
+			body:   `{"products": [{"name": "a", "price": 1, "quantity": -1}]}`,
+			fields: []external.FieldError{{Pointer: "/products/0/quantity", Reason: "should be of type integer"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, &handlers.OrdersHandlerOpts{
+				MaxLineItems: 2,
+				MaxQuantity:  5,
+			}, lgr)
+			r.POST("/orders", handler.Create)
+
+			req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(tt.body)))
+			r.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, errors2.OrderCreateInvalidInput, apiErr.ErrorCode)
+			assert.Equal(t, tt.fields, apiErr.Errors)
+		})
+	}
+}
+
+func TestOrdersHandler_Create_TrimsProductNames(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var created *data.Order
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		CreateFunc: func(_ context.Context, po *data.Order) (string, error) {
+			created = po
+			return "1", nil
+		},
+	}, nil, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/orders", handler.Create)
+
+	body := `{"products": [{"name": "  product 1\t", "price": "1.00", "quantity": 1}]}`
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	require.Len(t, created.Products, 1)
+	assert.Equal(t, "product 1", created.Products[0].Name)
+	var responseOrder external.Order
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &responseOrder))
+	assert.Equal(t, "product 1", responseOrder.Products[0].Name)
+}
+
+var testRates = &rates.Table{
+	Base:  "USD",
+	AsOf:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	Rates: map[money.Currency]money.Amount{"EUR": money.MustParseAmount("0.8")},
+}
+
+func TestOrdersHandler_Create_RecordsExchangeRate(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var created *data.Order
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		CreateFunc: func(_ context.Context, po *data.Order) (string, error) {
+			created = po
+			return "1", nil
+		},
+	}, &handlers.OrdersHandlerOpts{Rates: testRates}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/orders", handler.Create)
+
+	body := `{"currency": "EUR", "products": [{"name": "a", "price": "10.01", "quantity": 3}]}`
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	require.NotNil(t, created.ExchangeRate)
+	assert.Equal(t, money.DefaultCurrency, created.ExchangeRate.BaseCurrency)
+	assert.Equal(t, "1.25", created.ExchangeRate.Rate.String())
+	assert.Equal(t, testRates.AsOf, created.ExchangeRate.AsOf)
+	assert.Equal(t, "37.54", created.ExchangeRate.BaseTotalAmount.String(), "30.03 EUR at 1.25")
+	var responseOrder external.Order
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &responseOrder))
+	require.NotNil(t, responseOrder.ExchangeRate)
+	assert.Equal(t, "37.54", responseOrder.ExchangeRate.BaseTotalAmount.String())
+}
+
+var testPricing = pricing.NewPipeline(
+	pricing.LineDiscount{Name: "bulk", Percent: money.MustParseAmount("10"), MinQuantity: 3},
+	pricing.Shipping{{Name: "flat", Currency: "USD", Fee: money.MustParseAmount("5")}},
+	pricing.Taxes{{Name: "Texas", Country: "US", Region: "TX", Percent: money.MustParseAmount("6.25")}},
+)
+
+func TestOrdersHandler_Create_Priced(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var created *data.Order
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		CreateFunc: func(_ context.Context, po *data.Order) (string, error) {
+			created = po
+			return "1", nil
+		},
+	}, &handlers.OrdersHandlerOpts{Pricing: testPricing}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/orders", handler.Create)
+
+	body := `{"products": [{"name": "a", "price": "10", "quantity": 3}, {"name": "b", "price": "2.50", "quantity": 1}],
+		"shippingAddress": {"country": "US", "region": "TX"}}`
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	assert.Equal(t, &data.Address{Country: "US", Region: "TX"}, created.ShippingAddress)
+	require.NotNil(t, created.Pricing)
+	assert.Equal(t, "32.50", created.Pricing.Subtotal.String())
+	assert.Equal(t, "-3.00", created.Pricing.LineDiscounts.String())
+	assert.Equal(t, "5.00", created.Pricing.Shipping.String())
+	assert.Equal(t, "1.84", created.Pricing.Tax.String(), "6.25% of 29.50")
+	assert.Equal(t, "36.34", created.TotalAmount.String(), "the total amount should be the priced total")
+	assert.Len(t, created.Pricing.Adjustments, 3)
+	assert.Equal(t, "36.34", created.ExchangeRate.BaseTotalAmount.String())
+
+	var responseOrder external.Order
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &responseOrder))
+	require.NotNil(t, responseOrder.Pricing)
+	assert.Equal(t, created.Pricing.Adjustments, responseOrder.Pricing.Adjustments)
+}
+
+func testCoupons(redeem func(redemption *data.CouponRedemption) error) *mocks.MockCouponsDataService {
+	percent := money.MustParseAmount("10")
+	coupon := &data.Coupon{
+		ID:          primitive.NewObjectID(),
+		Code:        "SPRING10",
+		CouponTerms: data.CouponTerms{Type: data.PercentageDiscount, Percent: &percent},
+	}
+	return &mocks.MockCouponsDataService{
+		GetByCodeFunc: func(_ context.Context, code string) (*data.Coupon, error) {
+			if code != coupon.Code {
+				return nil, db.ErrCouponNotFound
+			}
+			return coupon, nil
+		},
+		RedeemFunc: func(_ context.Context, id primitive.ObjectID, redemption *data.CouponRedemption) error {
+			if id != coupon.ID {
+				return db.ErrCouponNotFound
+			}
+			return redeem(redemption)
+		},
+	}
+}
+
+func TestOrdersHandler_Create_RedeemsCoupon(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var created *data.Order
+	var redeemed *data.CouponRedemption
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		CreateFunc: func(_ context.Context, po *data.Order) (string, error) {
+			created = po
+			return "1", nil
+		},
+	}, &handlers.OrdersHandlerOpts{Coupons: testCoupons(func(redemption *data.CouponRedemption) error {
+		redeemed = redemption
+		return nil
+	})}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/orders", handler.Create)
+
+	body := `{"products": [{"name": "a", "price": "12.50", "quantity": 2}], "couponCode": "spring10"}`
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	require.NotNil(t, redeemed)
+	assert.Equal(t, testAdmin.Subject, redeemed.User, "redemptions should count against the order user")
+	require.NotNil(t, created.Coupon)
+	assert.Equal(t, "SPRING10", created.Coupon.Code)
+	assert.Equal(t, redeemed.ID, created.Coupon.RedemptionID)
+	assert.Equal(t, "22.50", created.TotalAmount.String(), "10% off 25.00 without a pricing rules file")
+	assert.Equal(t, "coupon SPRING10", created.Pricing.Adjustments[0].Rule)
+
+	var responseOrder external.Order
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &responseOrder))
+	require.NotNil(t, responseOrder.Coupon)
+	assert.Equal(t, "SPRING10", responseOrder.Coupon.Code)
+}
+
+func TestOrdersHandler_Create_CouponRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		coupons   bool
+		redeemErr error
+		errorCode string
+	}{
+		{name: "unknown code", code: "WINTER", coupons: true, errorCode: errors2.CouponNotApplicable},
+		{name: "coupons not configured", code: "SPRING10", errorCode: errors2.CouponNotApplicable},
+		{name: "usage limit", code: "SPRING10", coupons: true, redeemErr: db.ErrCouponUsageLimit,
+			errorCode: errors2.CouponUsageLimitReached},
+		{name: "user limit", code: "SPRING10", coupons: true, redeemErr: db.ErrCouponUserLimit,
+			errorCode: errors2.CouponUserLimitReached},
+		{name: "expired", code: "SPRING10", coupons: true, redeemErr: db.ErrCouponNotActive,
+			errorCode: errors2.CouponNotActive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			opts := &handlers.OrdersHandlerOpts{}
+			if tt.coupons {
+				opts.Coupons = testCoupons(func(_ *data.CouponRedemption) error { return tt.redeemErr })
+			}
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
+					t.Error("orders whose coupon was rejected should not be created")
+					return "", nil
+				},
+			}, opts, lgr)
+			gin.SetMode(gin.TestMode)
+			recorder := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			r.POST("/orders", handler.Create)
+
+			body := `{"products": [{"name": "a", "price": "1", "quantity": 1}], "couponCode": "` + tt.code + `"}`
+			req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+			r.ServeHTTP(recorder, req)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			assert.Equal(t, tt.errorCode, apiErr.ErrorCode)
+		})
+	}
+}
+
+func TestOrdersHandler_Create_ReleasesCouponWhenCreateFails(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var redeemed, released primitive.ObjectID
+	coupons := testCoupons(func(redemption *data.CouponRedemption) error {
+		redeemed = redemption.ID
+		return nil
+	})
+	coupons.ReleaseFunc = func(_ context.Context, _, redemptionID primitive.ObjectID) error {
+		released = redemptionID
+		return nil
+	}
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
+			return "", db.ErrFailedToCreateOrder
+		},
+	}, &handlers.OrdersHandlerOpts{Coupons: coupons}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/orders", handler.Create)
+
+	body := `{"products": [{"name": "a", "price": "1", "quantity": 1}], "couponCode": "SPRING10"}`
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.False(t, redeemed.IsZero())
+	assert.Equal(t, redeemed, released, "the redemption of an order that wasn't created should be released")
+}
+
+func TestOrdersHandler_Create_UnsupportedCurrency(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, &handlers.OrdersHandlerOpts{Rates: testRates}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/orders", handler.Create)
+
+	body := `{"currency": "CHF", "products": [{"name": "a", "price": "10", "quantity": 1}]}`
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, errors2.UnsupportedCurrency, apiErr.ErrorCode)
+	assert.Equal(t, "exchange rate not found from CHF to USD", apiErr.Message)
 }
 
 func TestOrdersHandler_Create_InternalServerError(t *testing.T) {
@@ -109,16 +488,17 @@ func TestOrdersHandler_Create_InternalServerError(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
 		CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
 			return "", assert.AnError
 		},
-	}, lgr)
+	}, nil, lgr)
 	r.POST("/orders", handler.Create)
 	orderInput := external.OrderInput{
 		Products: []external.ProductInput{
 			{Name: "product 1",
-				Price:    10.0,
+				Price:    money.NewAmount(10, 0),
 				Quantity: 3},
 		},
 	}
@@ -139,41 +519,139 @@ func TestGetAllOrdersSuccess(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
-		GetAllFunc: func(ctx context.Context, limit int64) (*[]data.Order, error) {
+		GetAllFunc: func(ctx context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
 			dataBytes, err := os.ReadFile("../mockData/orders.json")
 			if err != nil {
 				return nil, err
 			}
 			dataOrders, _ := UnMarshalOrdersData(dataBytes)
-			return dataOrders, nil
+			return &db.OrdersPage{Orders: *dataOrders}, nil
 		},
-	}, lgr)
+	}, nil, lgr)
 	r.GET("/orders", handler.GetAll)
 	c.Request, _ = http.NewRequest(http.MethodGet, "/orders", nil)
 	r.ServeHTTP(recorder, c.Request)
 	assert.Equal(t, http.StatusOK, recorder.Code)
-	var respOrders []external.Order
-	err := json.Unmarshal(recorder.Body.Bytes(), &respOrders)
+	var respPage external.OrdersPage
+	err := json.Unmarshal(recorder.Body.Bytes(), &respPage)
 	require.NoError(t, err)
-	assert.Len(t, respOrders, 10)
+	assert.Len(t, respPage.Items, 10)
+	assert.Empty(t, respPage.NextCursor)
+	assert.Empty(t, respPage.PrevCursor)
+	assert.Nil(t, respPage.TotalCount)
+	assert.NotEmpty(t, recorder.Header().Get(handlers.ETagHeader))
 }
 
-func TestGetAllOrdersFailure_DBRead(t *testing.T) {
+func TestGetAllOrders_Pagination(t *testing.T) {
 	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
-	recorder := httptest.NewRecorder()
-	gin.SetMode(gin.TestMode)
-	c, r := gin.CreateTestContext(recorder)
+	cursors := util.NewCursorCodec([]byte("test-key"))
+	var gotQuery *db.OrdersQuery
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
-		GetAllFunc: func(ctx context.Context, limit int64) (*[]data.Order, error) {
-			dataBytes, err := os.ReadFile("../mockData/non-existent.json")
+		GetAllFunc: func(_ context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
+			gotQuery = query
+			dataBytes, err := os.ReadFile("../mockData/orders.json")
 			if err != nil {
 				return nil, err
 			}
 			dataOrders, _ := UnMarshalOrdersData(dataBytes)
-			return dataOrders, nil
+			total := int64(25)
+			orders := *dataOrders
+			if int64(len(orders)) > query.Limit {
+				orders = orders[:query.Limit]
+			}
+			return &db.OrdersPage{Orders: orders, HasNext: true, HasPrev: true, TotalCount: &total}, nil
 		},
-	}, lgr)
+	}, &handlers.OrdersHandlerOpts{Cursors: cursors}, lgr)
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.GET("/orders", handler.GetAll)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/orders?limit=5&includeTotal=true", nil)
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, int64(5), gotQuery.Limit)
+	assert.True(t, gotQuery.IncludeTotal)
+
+	var respPage external.OrdersPage
+	err := json.Unmarshal(recorder.Body.Bytes(), &respPage)
+	require.NoError(t, err)
+	assert.Len(t, respPage.Items, 5)
+	require.NotNil(t, respPage.TotalCount)
+	assert.Equal(t, int64(25), *respPage.TotalCount)
+
+	next, err := cursors.Decode(respPage.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, respPage.Items[4].ID, next.ID.Hex())
+	assert.False(t, next.Backward)
+	prev, err := cursors.Decode(respPage.PrevCursor)
+	require.NoError(t, err)
+	assert.Equal(t, respPage.Items[0].ID, prev.ID.Hex())
+	assert.True(t, prev.Backward)
+
+	recorder = httptest.NewRecorder()
+	c.Request, _ = http.NewRequest(http.MethodGet, "/orders?limit=5&cursor="+respPage.NextCursor, nil)
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	require.NotNil(t, gotQuery.Cursor)
+	assert.Equal(t, *next, *gotQuery.Cursor)
+
+	recorder = httptest.NewRecorder()
+	c.Request, _ = http.NewRequest(http.MethodGet, "/orders?offset=20", nil)
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, int64(20), gotQuery.Offset)
+	assert.Equal(t, int64(db.DefaultPageSize), gotQuery.Limit)
+}
+
+func TestGetAllOrdersFailure_InvalidPaginationParams(t *testing.T) {
+	testCases := []struct {
+		description string
+		rawQuery    string
+	}{
+		{description: "negative offset", rawQuery: "offset=-1"},
+		{description: "tampered cursor", rawQuery: "cursor=abcdef"},
+		{description: "cursor with offset", rawQuery: "offset=10&cursor=" + util.NewCursorCodec([]byte("test-key")).Encode(util.Cursor{})},
+		{description: "invalid includeTotal", rawQuery: "includeTotal=maybe"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			c, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, &handlers.OrdersHandlerOpts{
+				Cursors: util.NewCursorCodec([]byte("test-key")),
+			}, lgr)
+			r.GET("/orders", handler.GetAll)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/orders?"+tc.rawQuery, nil)
+			r.ServeHTTP(recorder, c.Request)
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			var apiErr external.APIError
+			err := json.Unmarshal(recorder.Body.Bytes(), &apiErr)
+			require.NoError(t, err)
+			assert.Equal(t, errors2.OrderGetInvalidParams, apiErr.ErrorCode)
+		})
+	}
+}
+
+func TestGetAllOrdersFailure_DBRead(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetAllFunc: func(ctx context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
+			_, err := os.ReadFile("../mockData/non-existent.json")
+			return nil, err
+		},
+	}, nil, lgr)
 	r.GET("/orders", handler.GetAll)
 	c.Request, _ = http.NewRequest(http.MethodGet, "/orders", nil)
 	r.ServeHTTP(recorder, c.Request)
@@ -184,8 +662,9 @@ func TestGetAllOrdersFailure_LimitOutOfBounds(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
-	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, lgr)
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, nil, lgr)
 	r.GET("/orders", handler.GetAll)
 	c.Request, _ = http.NewRequest(http.MethodGet, "/orders", nil)
 	q := c.Request.URL.Query()
@@ -201,7 +680,8 @@ func TestGetAllOrdersFailure_InvalidLimit(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
-	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, lgr)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, nil, lgr)
 	r.GET("/orders", handler.GetAll)
 	c.Request, _ = http.NewRequest(http.MethodGet, "/orders", nil)
 	q := c.Request.URL.Query()
@@ -217,6 +697,7 @@ func TestGetOrderByIDSuccess(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
 		GetByIDFunc: func(ctx context.Context, id primitive.ObjectID) (*data.Order, error) {
 			dataBytes, err := os.ReadFile("../mockData/order.json")
@@ -226,16 +707,16 @@ func TestGetOrderByIDSuccess(t *testing.T) {
 			dataOrder, _ := UnMarshalOrderData(dataBytes)
 			return dataOrder, nil
 		},
-	}, lgr)
+	}, nil, lgr)
 	r.GET("/ecommerce/v1/orders/:id", handler.GetByID)
-	c.Request, _ = http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/1", nil)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
 
 	r.ServeHTTP(recorder, c.Request)
 	assert.Equal(t, http.StatusOK, recorder.Code)
 	var respOrders external.Order
 	err := json.Unmarshal(recorder.Body.Bytes(), &respOrders)
 	require.NoError(t, err)
-	assert.Equal(t, "1", respOrders.ID)
+	assert.Equal(t, "609d9ed771df2a0d99bf0077", respOrders.ID)
 
 }
 
@@ -244,14 +725,15 @@ func TestGetOrderByID_DBReadFailure(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
 		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
 			return nil, errors.New("db error")
 		},
-	}, lgr)
+	}, nil, lgr)
 
 	r.GET("/ecommerce/v1/orders/:id", handler.GetByID)
-	c.Request, _ = http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/1", nil)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
 	r.ServeHTTP(recorder, c.Request)
 	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
@@ -261,15 +743,21 @@ func TestGetOrderByID_BadPathParam(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
 		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
 			return nil, errors.New("db error")
 		},
-	}, lgr)
+	}, nil, lgr)
 	r.GET("/ecommerce/v1/orders/:id", handler.GetByID)
 	c.Request, _ = http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/''", nil)
 	r.ServeHTTP(recorder, c.Request)
 	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, errors2.ProblemContentType, recorder.Header().Get("Content-Type"))
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, errors2.OrderGetInvalidID, apiErr.ErrorCode)
+	assert.Equal(t, "/ecommerce/v1/orders/''", apiErr.Instance)
 }
 
 func TestDeleteOrderByIDSuccess(t *testing.T) {
@@ -277,13 +765,17 @@ func TestDeleteOrderByIDSuccess(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
 		DeleteByIDFunc: func(_ context.Context, _ primitive.ObjectID) error {
 			return nil
 		},
-	}, lgr)
+	}, nil, lgr)
 	r.DELETE("/ecommerce/v1/orders/:id", handler.DeleteByID)
-	c.Request, _ = http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/1", nil)
+	c.Request, _ = http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
 	r.ServeHTTP(recorder, c.Request)
 	assert.Equal(t, http.StatusNoContent, recorder.Code)
 }
@@ -293,29 +785,1132 @@ func TestDeleteOrderByID_DBFailure(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
 		DeleteByIDFunc: func(_ context.Context, _ primitive.ObjectID) error {
 			return errors.New("db error")
 		},
-	}, lgr)
-	r.DELETE("/ecommerce/v1/roders/:id", handler.DeleteByID)
-	c.Request, _ = http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/1", nil)
+	}, nil, lgr)
+	r.DELETE("/ecommerce/v1/orders/:id", handler.DeleteByID)
+	c.Request, _ = http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
 	r.ServeHTTP(recorder, c.Request)
 	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
+func TestDeleteOrderByID_ReleasesCoupon(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	couponID, redemptionID := primitive.NewObjectID(), primitive.NewObjectID()
+	var steps []string
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Coupon = &data.AppliedCoupon{CouponID: couponID, Code: "SPRING10", RedemptionID: redemptionID}
+			return order, nil
+		},
+		DeleteByIDFunc: func(_ context.Context, _ primitive.ObjectID) error {
+			steps = append(steps, "delete")
+			return nil
+		},
+	}, &handlers.OrdersHandlerOpts{Coupons: &mocks.MockCouponsDataService{
+		ReleaseFunc: func(_ context.Context, id, rID primitive.ObjectID) error {
+			assert.Equal(t, couponID, id)
+			assert.Equal(t, redemptionID, rID)
+			steps = append(steps, "release")
+			return nil
+		},
+	}}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.DELETE("/ecommerce/v1/orders/:id", handler.DeleteByID)
+
+	req, _ := http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, []string{"delete", "release"}, steps)
+}
+
+func TestDeleteOrderByID_KeepsCouponWhenDeleteFails(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	releases := 0
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Coupon = &data.AppliedCoupon{CouponID: primitive.NewObjectID(), Code: "SPRING10",
+				RedemptionID: primitive.NewObjectID()}
+			return order, nil
+		},
+		DeleteByIDAndVersionFunc: func(_ context.Context, _ primitive.ObjectID, _ int64) error {
+			return db.ErrVersionConflict
+		},
+	}, &handlers.OrdersHandlerOpts{Coupons: &mocks.MockCouponsDataService{
+		ReleaseFunc: func(_ context.Context, _, _ primitive.ObjectID) error {
+			releases++
+			return nil
+		},
+	}}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.DELETE("/ecommerce/v1/orders/:id", handler.DeleteByID)
+
+	req, _ := http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
+	req.Header.Set(handlers.IfMatchHeader, handlers.OrderETag("609d9ed771df2a0d99bf0077", 1))
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	assert.Zero(t, releases, "the order still exists, its redemption should keep counting")
+}
+
 func TestDeleteOrderByID_BadPathParam(t *testing.T) {
 	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
 	recorder := httptest.NewRecorder()
 	gin.SetMode(gin.TestMode)
 	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
 	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
 		DeleteByIDFunc: func(ctx context.Context, id primitive.ObjectID) error {
 			return nil
 		},
-	}, lgr)
+	}, nil, lgr)
 	r.DELETE("/ecommerce/v1/orders/:id", handler.DeleteByID)
 	c.Request, _ = http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/''", nil)
 	r.ServeHTTP(recorder, c.Request)
 	assert.Equal(t, http.StatusBadRequest, recorder.Code)
 }
+
+func mockOrder(t *testing.T) *data.Order {
+	dataBytes, err := os.ReadFile("../mockData/order.json")
+	require.NoError(t, err)
+	order, err := UnMarshalOrderData(dataBytes)
+	require.NoError(t, err)
+	return order
+}
+
+func TestUpdateOrderSuccess(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	var updated *data.Order
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
+		UpdateFunc: func(_ context.Context, po *data.Order) error {
+			po.Version++
+			updated = po
+			return nil
+		},
+	}, nil, lgr)
+	r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+	updateInput := external.OrderUpdateInput{
+		Products: []external.ProductInput{
+			{Name: "product 1", Price: money.NewAmount(10, 0), Quantity: 3},
+		},
+		Status: data.OrderProcessing,
+	}
+	body, _ := json.Marshal(updateInput)
+	c.Request, _ = http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", bytes.NewReader(body))
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var respOrder external.Order
+	err := json.Unmarshal(recorder.Body.Bytes(), &respOrder)
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, "609d9ed771df2a0d99bf0077", respOrder.ID)
+	assert.Equal(t, int64(2), respOrder.Version)
+	assert.Equal(t, data.OrderProcessing, respOrder.Status)
+	assert.Len(t, respOrder.Products, 1)
+	assert.Equal(t, "30.00", respOrder.TotalAmount.String())
+	assert.Equal(t, "30.00", updated.TotalAmount.String())
+	assert.Equal(t, `"609d9ed771df2a0d99bf0077-2"`, recorder.Header().Get(handlers.ETagHeader))
+}
+
+func TestUpdateOrder_KeepsExchangeRate(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	order := mockOrder(t)
+	order.Currency = "EUR"
+	order.ExchangeRate = &data.ExchangeRate{
+		BaseCurrency:    "USD",
+		Rate:            money.MustParseAmount("1.1"),
+		BaseTotalAmount: money.MustParseAmount("11.00"),
+	}
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return order, nil
+		},
+		UpdateFunc: func(_ context.Context, _ *data.Order) error {
+			return nil
+		},
+	}, &handlers.OrdersHandlerOpts{Rates: testRates}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+
+	body := `{"status": "OrderPending", "products": [{"name": "a", "price": "20", "quantity": 1}]}`
+	req, _ := http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Equal(t, "1.1", order.ExchangeRate.Rate.String(), "updates should not take the current rate")
+	assert.Equal(t, "22.00", order.ExchangeRate.BaseTotalAmount.String())
+}
+
+func TestUpdateOrder_Repriced(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	order := mockOrder(t)
+	order.Currency = "USD"
+	order.ShippingAddress = &data.Address{Country: "US", Region: "TX"}
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return order, nil
+		},
+		UpdateFunc: func(_ context.Context, _ *data.Order) error {
+			return nil
+		},
+	}, &handlers.OrdersHandlerOpts{Pricing: testPricing}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+
+	body := `{"status": "OrderPending", "products": [{"name": "a", "price": "20", "quantity": 1}]}`
+	req, _ := http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Equal(t, "26.25", order.TotalAmount.String(), "20.00, 5.00 shipping and 6.25% tax of 20.00")
+	require.NotNil(t, order.Pricing)
+	assert.Equal(t, "1.25", order.Pricing.Tax.String(), "the shipping address of the order should decide the taxes")
+}
+
+func TestUpdateOrder_InvalidStatus(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
+	}, nil, lgr)
+	r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+	body := `{"products":[{"name":"product 1","price":10,"quantity":1}],"status":"Shipped"}`
+	c.Request, _ = http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	var apiErr external.APIError
+	err := json.Unmarshal(recorder.Body.Bytes(), &apiErr)
+	require.NoError(t, err)
+	assert.Equal(t, errors2.OrderUpdateInvalidInput, apiErr.ErrorCode)
+}
+
+func TestUpdateOrder_NotFound(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return nil, db.ErrPOIDNotFound
+		},
+	}, nil, lgr)
+	r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+	body := `{"products":[{"name":"product 1","price":10,"quantity":1}],"status":"OrderPending"}`
+	c.Request, _ = http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestUpdateOrder_BadPathParam(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, nil, lgr)
+	r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+	c.Request, _ = http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/''", bytes.NewReader([]byte(`{}`)))
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestPatchOrderSuccess(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
+		UpdateFunc: func(_ context.Context, po *data.Order) error {
+			po.Version++
+			return nil
+		},
+	}, nil, lgr)
+	r.PATCH("/ecommerce/v1/orders/:id", handler.Patch)
+	c.Request, _ = http.NewRequest(http.MethodPatch, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077",
+		bytes.NewReader([]byte(`{"status":"OrderProcessing"}`)))
+	c.Request.Header.Set("Content-Type", handlers.MergePatchContentType)
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var respOrder external.Order
+	err := json.Unmarshal(recorder.Body.Bytes(), &respOrder)
+	require.NoError(t, err)
+	assert.Equal(t, data.OrderProcessing, respOrder.Status)
+	assert.Equal(t, int64(2), respOrder.Version)
+	assert.Len(t, respOrder.Products, 2, "products should be untouched by the patch")
+	assert.Equal(t, "36.75", respOrder.TotalAmount.String())
+}
+
+func TestPatchOrder_UnsupportedContentType(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, nil, lgr)
+	r.PATCH("/ecommerce/v1/orders/:id", handler.Patch)
+	c.Request, _ = http.NewRequest(http.MethodPatch, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077",
+		bytes.NewReader([]byte(`{"status":"OrderProcessing"}`)))
+	c.Request.Header.Set("Content-Type", "text/plain")
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+}
+
+func TestPatchOrder_RemovingProductsIsInvalid(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
+	}, nil, lgr)
+	r.PATCH("/ecommerce/v1/orders/:id", handler.Patch)
+	c.Request, _ = http.NewRequest(http.MethodPatch, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077",
+		bytes.NewReader([]byte(`{"products":null}`)))
+	c.Request.Header.Set("Content-Type", handlers.MergePatchContentType)
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestGetOrderByID_ETag(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
+	}, nil, lgr)
+	r.GET("/ecommerce/v1/orders/:id", handler.GetByID)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, handlers.OrderETag("609d9ed771df2a0d99bf0077", 1), recorder.Header().Get(handlers.ETagHeader))
+}
+
+func TestUpdateOrder_IfMatchMismatch(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return mockOrder(t), nil
+		},
+	}, nil, lgr)
+	r.PATCH("/ecommerce/v1/orders/:id", handler.Patch)
+	c.Request, _ = http.NewRequest(http.MethodPatch, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077",
+		bytes.NewReader([]byte(`{"status":"OrderProcessing"}`)))
+	c.Request.Header.Set("Content-Type", handlers.MergePatchContentType)
+	c.Request.Header.Set(handlers.IfMatchHeader, handlers.OrderETag("609d9ed771df2a0d99bf0077", 7))
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+
+	var apiErr external.APIError
+	err := json.Unmarshal(recorder.Body.Bytes(), &apiErr)
+	require.NoError(t, err)
+	assert.Equal(t, errors2.OrderUpdatePreconditionFail, apiErr.ErrorCode)
+}
+
+func TestUpdateOrder_VersionConflict(t *testing.T) {
+	testCases := []struct {
+		description  string
+		ifMatch      string
+		expectedCode int
+		expectedErr  string
+	}{
+		{
+			description:  "concurrent write without If-Match is a conflict",
+			expectedCode: http.StatusConflict,
+			expectedErr:  errors2.OrderUpdateVersionConflict,
+		},
+		{
+			description:  "concurrent write with If-Match fails the precondition",
+			ifMatch:      handlers.OrderETag("609d9ed771df2a0d99bf0077", 1),
+			expectedCode: http.StatusPreconditionFailed,
+			expectedErr:  errors2.OrderUpdatePreconditionFail,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			c, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+					return mockOrder(t), nil
+				},
+				UpdateFunc: func(_ context.Context, _ *data.Order) error {
+					return db.ErrVersionConflict
+				},
+			}, nil, lgr)
+			r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+			body := `{"products":[{"name":"product 1","price":10,"quantity":1}],"status":"OrderPending"}`
+			c.Request, _ = http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", bytes.NewReader([]byte(body)))
+			if tc.ifMatch != "" {
+				c.Request.Header.Set(handlers.IfMatchHeader, tc.ifMatch)
+			}
+			r.ServeHTTP(recorder, c.Request)
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+
+			var apiErr external.APIError
+			err := json.Unmarshal(recorder.Body.Bytes(), &apiErr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedErr, apiErr.ErrorCode)
+		})
+	}
+}
+
+func TestDeleteOrderByID_IfMatch(t *testing.T) {
+	testCases := []struct {
+		description  string
+		ifMatch      string
+		expectedCode int
+	}{
+		{
+			description:  "matching version deletes the order",
+			ifMatch:      handlers.OrderETag("609d9ed771df2a0d99bf0077", 1),
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			description:  "stale version fails the precondition",
+			ifMatch:      handlers.OrderETag("609d9ed771df2a0d99bf0077", 0),
+			expectedCode: http.StatusPreconditionFailed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			c, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+					return mockOrder(t), nil
+				},
+				DeleteByIDAndVersionFunc: func(_ context.Context, _ primitive.ObjectID, version int64) error {
+					assert.Equal(t, int64(1), version)
+					return nil
+				},
+			}, nil, lgr)
+			r.DELETE("/ecommerce/v1/orders/:id", handler.DeleteByID)
+			c.Request, _ = http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
+			c.Request.Header.Set(handlers.IfMatchHeader, tc.ifMatch)
+			r.ServeHTTP(recorder, c.Request)
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+		})
+	}
+}
+
+func TestTransitionOrderSuccess(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	var updated *data.Order
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Status = data.OrderPending
+			return order, nil
+		},
+		UpdateFunc: func(_ context.Context, po *data.Order) error {
+			po.Version++
+			updated = po
+			return nil
+		},
+	}, nil, lgr)
+	r.POST("/ecommerce/v1/orders/:id/transitions", handler.Transition)
+	body := `{"status":"OrderProcessing","notes":"picked from warehouse"}`
+	c.Request, _ = http.NewRequest(http.MethodPost, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077/transitions", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	require.NotNil(t, updated)
+	assert.Equal(t, data.OrderProcessing, updated.Status)
+	lastUpdate := updated.Updates[len(updated.Updates)-1]
+	assert.Equal(t, "picked from warehouse", lastUpdate.Notes)
+	assert.Equal(t, data.OrderPending, lastUpdate.FromStatus)
+	assert.Equal(t, data.OrderProcessing, lastUpdate.ToStatus)
+	assert.NotEmpty(t, lastUpdate.HandleBy)
+	assert.False(t, lastUpdate.UpdateAt.IsZero())
+}
+
+func TestTransitionOrder_CancelReleasesCoupon(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	couponID, redemptionID := primitive.NewObjectID(), primitive.NewObjectID()
+	releases := 0
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Status = data.OrderPending
+			order.Coupon = &data.AppliedCoupon{CouponID: couponID, Code: "SPRING10", RedemptionID: redemptionID}
+			return order, nil
+		},
+		UpdateFunc: func(_ context.Context, po *data.Order) error {
+			require.NotNil(t, po.Coupon.ReleasedAt, "the release should be saved with the cancellation")
+			po.Version++
+			return nil
+		},
+	}, &handlers.OrdersHandlerOpts{Coupons: &mocks.MockCouponsDataService{
+		ReleaseFunc: func(_ context.Context, id, rID primitive.ObjectID) error {
+			assert.Equal(t, couponID, id)
+			assert.Equal(t, redemptionID, rID)
+			releases++
+			return nil
+		},
+	}}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/ecommerce/v1/orders/:id/transitions", handler.Transition)
+
+	body := `{"status":"OrderCancelled","notes":"changed my mind"}`
+	req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077/transitions",
+		bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 1, releases)
+}
+
+func TestTransitionOrder_CancelKeepsCouponWhenSaveFails(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	// the usage count of the coupon, the order holds one redemption
+	usageCount := 1
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Status = data.OrderPending
+			order.Coupon = &data.AppliedCoupon{CouponID: primitive.NewObjectID(), Code: "SPRING10",
+				RedemptionID: primitive.NewObjectID()}
+			return order, nil
+		},
+		UpdateFunc: func(_ context.Context, _ *data.Order) error {
+			// a concurrent PATCH saved the order first
+			return db.ErrVersionConflict
+		},
+	}, &handlers.OrdersHandlerOpts{Coupons: &mocks.MockCouponsDataService{
+		ReleaseFunc: func(_ context.Context, _, _ primitive.ObjectID) error {
+			usageCount--
+			return nil
+		},
+	}}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/ecommerce/v1/orders/:id/transitions", handler.Transition)
+
+	body := `{"status":"OrderCancelled"}`
+	req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077/transitions",
+		bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, 1, usageCount, "the order isn't cancelled, its redemption should keep counting")
+}
+
+func TestTransitionOrder_CancelRetriesRelease(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	saved, releases := false, 0
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Status = data.OrderPending
+			order.Coupon = &data.AppliedCoupon{CouponID: primitive.NewObjectID(), Code: "SPRING10",
+				RedemptionID: primitive.NewObjectID()}
+			return order, nil
+		},
+		UpdateFunc: func(_ context.Context, po *data.Order) error {
+			saved = true
+			po.Version++
+			return nil
+		},
+	}, &handlers.OrdersHandlerOpts{Coupons: &mocks.MockCouponsDataService{
+		ReleaseFunc: func(_ context.Context, _, _ primitive.ObjectID) error {
+			assert.True(t, saved, "the cancellation should be saved before the redemption is released")
+			releases++
+			if releases == 1 {
+				return db.ErrUnexpectedRedeem
+			}
+			return nil
+		},
+	}}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.POST("/ecommerce/v1/orders/:id/transitions", handler.Transition)
+
+	body := `{"status":"OrderCancelled"}`
+	req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077/transitions",
+		bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 2, releases, "a failed release should be retried")
+}
+
+func TestTransitionOrder_NotAllowed(t *testing.T) {
+	testCases := []struct {
+		description string
+		from        data.OrderStatus
+		to          data.OrderStatus
+	}{
+		{description: "skip processing", from: data.OrderPending, to: data.OrderDelivered},
+		{description: "cancel after delivery", from: data.OrderDelivered, to: data.OrderCancelled},
+		{description: "reopen a cancelled order", from: data.OrderCancelled, to: data.OrderPending},
+		{description: "completed is final", from: data.OrderCompleted, to: data.OrderProcessing},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			c, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+					order := mockOrder(t)
+					order.Status = tc.from
+					return order, nil
+				},
+			}, nil, lgr)
+			r.POST("/ecommerce/v1/orders/:id/transitions", handler.Transition)
+			body, _ := json.Marshal(external.OrderTransitionInput{Status: tc.to})
+			c.Request, _ = http.NewRequest(http.MethodPost, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077/transitions", bytes.NewReader(body))
+			r.ServeHTTP(recorder, c.Request)
+			assert.Equal(t, http.StatusConflict, recorder.Code)
+
+			var apiErr external.APIError
+			err := json.Unmarshal(recorder.Body.Bytes(), &apiErr)
+			require.NoError(t, err)
+			assert.Equal(t, errors2.OrderTransitionNotAllowed, apiErr.ErrorCode)
+		})
+	}
+}
+
+func TestTransitionOrder_InvalidInput(t *testing.T) {
+	testCases := []struct {
+		description string
+		body        string
+		fields      []external.FieldError
+	}{
+		{description: "missing status", body: `{"notes": "lost"}`,
+			fields: []external.FieldError{{Pointer: "/status", Reason: "is required"}}},
+		{description: "unknown status", body: `{"status": "OrderLost"}`,
+			fields: []external.FieldError{{Pointer: "/status", Reason: `"OrderLost" is not an order status`}}},
+		{description: "status of the wrong type", body: `{"status": 1}`,
+			fields: []external.FieldError{{Pointer: "/status", Reason: "should be of type string"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+					order := mockOrder(t)
+					order.Status = data.OrderPending
+					return order, nil
+				},
+			}, nil, lgr)
+			r.POST("/ecommerce/v1/orders/:id/transitions", handler.Transition)
+			req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077/transitions",
+				bytes.NewReader([]byte(tc.body)))
+			r.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, errors2.OrderUpdateInvalidInput, apiErr.ErrorCode)
+			assert.Equal(t, tc.fields, apiErr.Errors)
+		})
+	}
+}
+
+func TestTransitionOrder_UnknownField(t *testing.T) {
+	binding.EnableDecoderDisallowUnknownFields = true
+	defer func() { binding.EnableDecoderDisallowUnknownFields = false }()
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Status = data.OrderPending
+			return order, nil
+		},
+	}, nil, lgr)
+	r.POST("/ecommerce/v1/orders/:id/transitions", handler.Transition)
+	req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077/transitions",
+		bytes.NewReader([]byte(`{"status": "OrderProcessing", "force": true}`)))
+	r.ServeHTTP(recorder, req)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, errors2.OrderUpdateInvalidInput, apiErr.ErrorCode)
+}
+
+func TestUpdateOrder_StatusFollowsStateMachine(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	c, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			order := mockOrder(t)
+			order.Status = data.OrderPending
+			return order, nil
+		},
+	}, nil, lgr)
+	r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+	body := `{"products":[{"name":"product 1","price":10,"quantity":1}],"status":"OrderCompleted"}`
+	c.Request, _ = http.NewRequest(http.MethodPut, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", bytes.NewReader([]byte(body)))
+	r.ServeHTTP(recorder, c.Request)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestUpdateOrder_ProductsLockedOnceDelivered(t *testing.T) {
+	sameProducts := `[{"name":"Product 1","price":"10.50","quantity":2},{"name":"Product 2","price":"15.75","quantity":1}]`
+	testCases := []struct {
+		description string
+		method      string
+		status      data.OrderStatus
+		body        string
+		wantStatus  int
+	}{
+		{"put on delivered order", http.MethodPut, data.OrderDelivered,
+			`{"products":[{"name":"Product 1","price":"10.50","quantity":3}],"status":"OrderDelivered"}`,
+			http.StatusConflict},
+		{"put delivering the order", http.MethodPut, data.OrderProcessing,
+			`{"products":[{"name":"Product 3","price":"1.00","quantity":1}],"status":"OrderDelivered"}`,
+			http.StatusConflict},
+		{"patch on cancelled order", http.MethodPatch, data.OrderCancelled,
+			`{"products":[{"name":"Product 1","price":"1.00","quantity":1}]}`, http.StatusConflict},
+		{"patch on completed order", http.MethodPatch, data.OrderCompleted,
+			`{"products":[{"name":"Product 1","price":"10.50","quantity":2}]}`, http.StatusConflict},
+		{"put completing the order with the same products", http.MethodPut, data.OrderDelivered,
+			`{"products":` + sameProducts + `,"status":"OrderCompleted"}`, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			var saved *data.Order
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+					order := mockOrder(t)
+					order.Status = tc.status
+					return order, nil
+				},
+				UpdateFunc: func(_ context.Context, po *data.Order) error {
+					saved = po
+					po.Version++
+					return nil
+				},
+			}, nil, lgr)
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			r.PUT("/ecommerce/v1/orders/:id", handler.Update)
+			r.PATCH("/ecommerce/v1/orders/:id", handler.Patch)
+			req, _ := http.NewRequest(tc.method, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077",
+				bytes.NewReader([]byte(tc.body)))
+			req.Header.Set("Content-Type", handlers.MergePatchContentType)
+			if tc.method == http.MethodPut {
+				req.Header.Set("Content-Type", binding.MIMEJSON)
+			}
+			r.ServeHTTP(recorder, req)
+			require.Equal(t, tc.wantStatus, recorder.Code, recorder.Body.String())
+
+			if tc.wantStatus == http.StatusOK {
+				require.NotNil(t, saved)
+				assert.Equal(t, mockOrder(t).Products, saved.Products, "unchanged products are kept as they are")
+				return
+			}
+			assert.Nil(t, saved)
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, errors2.OrderUpdateProductsLocked, apiErr.ErrorCode)
+		})
+	}
+}
+
+func TestOrdersHandler_Create_UserFromPrincipal(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	recorder := httptest.NewRecorder()
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(&auth.Principal{Subject: "customer-1", Scopes: []string{auth.ScopeOrdersWrite}}))
+	var created *data.Order
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		CreateFunc: func(_ context.Context, po *data.Order) (string, error) {
+			created = po
+			return primitive.NewObjectID().Hex(), nil
+		},
+	}, nil, lgr)
+	r.POST("/ecommerce/v1/orders", handler.Create)
+	body := `{"products":[{"name":"shoe","price":10,"quantity":1}]}`
+	req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders", bytes.NewBufferString(body))
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "customer-1", created.User)
+}
+
+func TestOrdersHandler_OtherUsersOrdersAreNotFound(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	customer := &auth.Principal{Subject: "customer-1", Scopes: []string{auth.ScopeOrdersRead, auth.ScopeOrdersDelete}}
+	order := mockOrder(t)
+	require.NotEqual(t, customer.Subject, order.User)
+	deleted := false
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetByIDFunc: func(_ context.Context, _ primitive.ObjectID) (*data.Order, error) {
+			return order, nil
+		},
+		DeleteByIDAndVersionFunc: func(_ context.Context, _ primitive.ObjectID, _ int64) error {
+			deleted = true
+			return nil
+		},
+	}, nil, lgr)
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.Use(withPrincipal(customer))
+	r.GET("/ecommerce/v1/orders/:id", handler.GetByID)
+	r.DELETE("/ecommerce/v1/orders/:id", handler.DeleteByID)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, errors2.OrderGetNotFound, apiErr.ErrorCode)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodDelete, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.False(t, deleted)
+
+	order.User = customer.Subject
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/ecommerce/v1/orders/609d9ed771df2a0d99bf0077", nil)
+	r.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestGetAllOrders_ScopedToUser(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var gotQuery *db.OrdersQuery
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetAllFunc: func(_ context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
+			gotQuery = query
+			return &db.OrdersPage{}, nil
+		},
+	}, nil, lgr)
+	testCases := []struct {
+		description     string
+		principal       *auth.Principal
+		rawQuery        string
+		expectedFilters []db.OrderFilter
+	}{
+		{
+			description:     "customers only see their own orders",
+			principal:       &auth.Principal{Subject: "customer-1", Scopes: []string{auth.ScopeOrdersRead}},
+			rawQuery:        "user=customer-2",
+			expectedFilters: []db.OrderFilter{{Field: "user", Op: db.FilterEq, Value: "customer-2"}, {Field: "user", Op: db.FilterEq, Value: "customer-1"}},
+		},
+		{
+			description:     "admins query on behalf of a user",
+			principal:       testAdmin,
+			rawQuery:        "user=customer-2",
+			expectedFilters: []db.OrderFilter{{Field: "user", Op: db.FilterEq, Value: "customer-2"}},
+		},
+		{
+			description: "admins see every order",
+			principal:   testAdmin,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(tc.principal))
+			r.GET("/ecommerce/v1/orders", handler.GetAll)
+			req, _ := http.NewRequest(http.MethodGet, "/ecommerce/v1/orders?"+tc.rawQuery, nil)
+			r.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.expectedFilters, gotQuery.Filters)
+		})
+	}
+}
+
+const testCustomerID = "609d9ed771df2a0d99bf0088"
+
+func testCustomers() (*mocks.MockCustomersDataService, *data.Customer) {
+	cID, _ := primitive.ObjectIDFromHex(testCustomerID)
+	customer := &data.Customer{ID: cID, User: "customer-1", Name: "Jane Doe", Email: "jane@example.com",
+		Addresses: []data.CustomerAddress{
+			{ID: primitive.NewObjectID(), Type: data.ShippingAddressType, Default: true,
+				Address: data.Address{Name: "Jane Doe", Line1: "1 Main St", City: "San Francisco", Region: "CA", Country: "US"}},
+			{ID: primitive.NewObjectID(), Type: data.ShippingAddressType,
+				Address: data.Address{Name: "Jane Doe", Line1: "5 Rue Royale", City: "Paris", Country: "FR"}},
+			{ID: primitive.NewObjectID(), Type: data.BillingAddressType,
+				Address: data.Address{Name: "Jane Doe", Line1: "9 Elm St", City: "Austin", Region: "TX", Country: "US"}},
+		}}
+	return &mocks.MockCustomersDataService{
+		GetByIDFunc: func(_ context.Context, id primitive.ObjectID) (*data.Customer, error) {
+			if id != customer.ID {
+				return nil, db.ErrCustomerNotFound
+			}
+			return customer, nil
+		},
+	}, customer
+}
+
+func TestOrdersHandler_Create_CustomerAddresses(t *testing.T) {
+	customers, customer := testCustomers()
+	products := `"products": [{"name": "a", "price": "10", "quantity": 1}], "customerId": "` + testCustomerID + `"`
+	tests := []struct {
+		name     string
+		body     string
+		shipping *data.Address
+		billing  *data.Address
+	}{
+		{name: "default addresses", body: `{` + products + `}`, shipping: &customer.Addresses[0].Address},
+		{name: "addresses by id", body: `{` + products + `, "shippingAddressId": "` + customer.Addresses[1].ID.Hex() +
+			`", "billingAddressId": "` + customer.Addresses[2].ID.Hex() + `"}`,
+			shipping: &customer.Addresses[1].Address, billing: &customer.Addresses[2].Address},
+		{name: "address of the order", body: `{` + products + `, "shippingAddress": {"country": "DE", "postalCode": "10115"}}`,
+			shipping: &data.Address{Country: "DE", PostalCode: "10115"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			var created *data.Order
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				CreateFunc: func(_ context.Context, po *data.Order) (string, error) {
+					created = po
+					return "1", nil
+				},
+			}, &handlers.OrdersHandlerOpts{Customers: customers}, lgr)
+			gin.SetMode(gin.TestMode)
+			recorder := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			r.POST("/orders", handler.Create)
+
+			req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(tt.body)))
+			r.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+			assert.Equal(t, testCustomerID, created.CustomerID)
+			assert.Equal(t, customer.User, created.User, "the order should be placed for the user of the customer")
+			assert.Equal(t, tt.shipping, created.ShippingAddress)
+			assert.Equal(t, tt.billing, created.BillingAddress)
+			var responseOrder external.Order
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &responseOrder))
+			assert.Equal(t, testCustomerID, responseOrder.CustomerID)
+		})
+	}
+}
+
+func TestOrdersHandler_Create_CustomerAddressErrors(t *testing.T) {
+	customers, customer := testCustomers()
+	products := `"products": [{"name": "a", "price": "10", "quantity": 1}]`
+	tests := []struct {
+		name   string
+		body   string
+		fields []external.FieldError
+	}{
+		{name: "address id without customer", body: `{` + products + `, "billingAddressId": "` + testCustomerID + `"}`,
+			fields: []external.FieldError{{Pointer: "/billingAddressId", Reason: "requires customerId"}}},
+		{name: "address and address id", body: `{` + products + `, "customerId": "` + testCustomerID + `",
+			"shippingAddress": {"country": "US"}, "shippingAddressId": "` + customer.Addresses[1].ID.Hex() + `"}`,
+			fields: []external.FieldError{{Pointer: "/shippingAddressId", Reason: "should not be set with shippingAddress"}}},
+		{name: "address of another type", body: `{` + products + `, "customerId": "` + testCustomerID + `",
+			"shippingAddressId": "` + customer.Addresses[2].ID.Hex() + `"}`,
+			fields: []external.FieldError{{Pointer: "/shippingAddressId", Reason: "is not a shipping address of the customer"}}},
+		{name: "invalid ids and postal code", body: `{` + products + `, "customerId": "42",
+			"billingAddress": {"country": "US", "postalCode": "ABC"}}`,
+			fields: []external.FieldError{
+				{Pointer: "/billingAddress/postalCode", Reason: "should be a postal code of the country"},
+				{Pointer: "/customerId", Reason: "should be a 24 character hex id"},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{},
+				&handlers.OrdersHandlerOpts{Customers: customers}, lgr)
+			gin.SetMode(gin.TestMode)
+			recorder := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			r.POST("/orders", handler.Create)
+
+			req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(tt.body)))
+			r.ServeHTTP(recorder, req)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Equal(t, errors2.OrderCreateInvalidInput, apiErr.ErrorCode)
+			assert.Equal(t, tt.fields, apiErr.Errors)
+		})
+	}
+}
+
+func TestOrdersHandler_Create_CustomerNotFound(t *testing.T) {
+	customers, _ := testCustomers()
+	tests := []struct {
+		name       string
+		customerID string
+		principal  *auth.Principal
+	}{
+		{name: "unknown customer", customerID: couponID, principal: testAdmin},
+		{name: "customer of another user", customerID: testCustomerID,
+			principal: &auth.Principal{Subject: "customer-2", Scopes: []string{auth.ScopeOrdersWrite}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+				CreateFunc: func(_ context.Context, _ *data.Order) (string, error) {
+					t.Fatal("the order should not be created")
+					return "", nil
+				},
+			}, &handlers.OrdersHandlerOpts{Customers: customers}, lgr)
+			gin.SetMode(gin.TestMode)
+			recorder := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(tt.principal))
+			r.POST("/orders", handler.Create)
+
+			body := `{"products": [{"name": "a", "price": "10", "quantity": 1}], "customerId": "` + tt.customerID + `"}`
+			req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewReader([]byte(body)))
+			r.ServeHTTP(recorder, req)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+			assert.Equal(t, errors2.OrderCreateCustomerNotFound, apiErr.ErrorCode)
+		})
+	}
+}
+
+func TestGetOrdersByCustomer(t *testing.T) {
+	customers, _ := testCustomers()
+	var gotQuery *db.OrdersQuery
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetAllFunc: func(_ context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
+			gotQuery = query
+			return &db.OrdersPage{}, nil
+		},
+	}, &handlers.OrdersHandlerOpts{Customers: customers}, lgr)
+	tests := []struct {
+		name            string
+		customerID      string
+		principal       *auth.Principal
+		status          int
+		errorCode       string
+		expectedFilters []db.OrderFilter
+	}{
+		{name: "orders of the customer", customerID: testCustomerID, principal: testAdmin, status: http.StatusOK,
+			expectedFilters: []db.OrderFilter{
+				{Field: "status", Op: db.FilterEq, Value: "OrderPending"},
+				{Field: "customerId", Op: db.FilterEq, Value: testCustomerID},
+			}},
+		{name: "scoped to the user", customerID: testCustomerID, status: http.StatusOK,
+			principal: &auth.Principal{Subject: "customer-1", Scopes: []string{auth.ScopeCustomersRead}},
+			expectedFilters: []db.OrderFilter{
+				{Field: "status", Op: db.FilterEq, Value: "OrderPending"},
+				{Field: "customerId", Op: db.FilterEq, Value: testCustomerID},
+				{Field: "user", Op: db.FilterEq, Value: "customer-1"},
+			}},
+		{name: "unknown customer", customerID: couponID, principal: testAdmin, status: http.StatusNotFound,
+			errorCode: errors2.CustomerGetNotFound},
+		{name: "customer of another user", customerID: testCustomerID, status: http.StatusNotFound,
+			principal: &auth.Principal{Subject: "customer-2", Scopes: []string{auth.ScopeCustomersRead}},
+			errorCode: errors2.CustomerGetNotFound},
+		{name: "invalid customer id", customerID: "123", principal: testAdmin, status: http.StatusBadRequest,
+			errorCode: errors2.CustomerGetInvalidID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery = nil
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(tt.principal))
+			r.GET("/customers/:id/orders", handler.GetByCustomer)
+			req, _ := http.NewRequest(http.MethodGet, "/customers/"+tt.customerID+"/orders?status=OrderPending", nil)
+			r.ServeHTTP(recorder, req)
+			require.Equal(t, tt.status, recorder.Code)
+			if tt.errorCode != "" {
+				var apiErr external.APIError
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.errorCode, apiErr.ErrorCode)
+				assert.Nil(t, gotQuery, "orders should not be read")
+				return
+			}
+			assert.Equal(t, tt.expectedFilters, gotQuery.Filters)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/gin-gonic/gin"
+)
+
+const SortQueryParam = "sort"
+
+// PaginationQueryParams are the order list query params that are not filters.
+var PaginationQueryParams = map[string]bool{
+	"limit":        true,
+	"offset":       true,
+	"cursor":       true,
+	"includeTotal": true,
+}
+
+// parseOrderFilters reads the filter query params, e.g. status[in]=OrderPending,OrderProcessing&totalAmount[gte]=10,
+// every query param but sort and the other params of the route is a filter.
+func parseOrderFilters(c *gin.Context, otherParams map[string]bool) ([]db.OrderFilter, error) {
+	queryParams := c.Request.URL.Query()
+	params := make([]string, 0, len(queryParams))
+	for param := range queryParams {
+		if !otherParams[param] && param != SortQueryParam {
+			params = append(params, param)
+		}
+	}
+	sort.Strings(params)
+
+	var filters []db.OrderFilter
+	for _, param := range params {
+		fieldName, op := db.ParseFilterParam(param)
+		field, ok := db.OrderFilterFields[fieldName]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", db.ErrInvalidFilter, fieldName)
+		}
+		if !field.SupportsOp(op) {
+			return nil, fmt.Errorf("%w %s for filter field %s", db.ErrInvalidFilterOp, op, fieldName)
+		}
+		for _, raw := range queryParams[param] {
+			value, err := filterValue(field, op, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w for %s query param: %w", db.ErrInvalidFilterValue, param, err)
+			}
+			filters = append(filters, db.OrderFilter{Field: fieldName, Op: op, Value: value})
+		}
+	}
+	return filters, nil
+}
+
+func filterValue(field db.OrderFilterField, op db.FilterOp, raw string) (interface{}, error) {
+	if op == db.FilterIn {
+		var values []string
+		for _, v := range strings.Split(raw, ",") {
+			v = strings.TrimSpace(v)
+			if err := allowedFilterValue(field, v); err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	switch field.Kind {
+	case db.FilterTime:
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("RFC 3339 date time is expected")
+		}
+		return t, nil
+	case db.FilterNumber:
+		amount, err := money.ParseAmount(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decimal number is expected")
+		}
+		return amount, nil
+	default:
+		if err := allowedFilterValue(field, raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+}
+
+func allowedFilterValue(field db.OrderFilterField, value string) error {
+	if value == "" {
+		return fmt.Errorf("value can't be empty")
+	}
+	if field.Allowed != nil && !field.Allowed(value) {
+		return fmt.Errorf("%q is not an allowed value", value)
+	}
+	return nil
+}
+
+// parseOrderSort reads the sort query param, e.g. sort=-createdAt,totalAmount sorts newest first then by total amount.
+// The default order, newest first, is returned as nil as it is the only order supporting cursor pagination.
+func parseOrderSort(c *gin.Context) ([]db.SortField, error) {
+	input, exists := c.GetQuery(SortQueryParam)
+	if !exists || input == "" {
+		return nil, nil
+	}
+	var sortFields []db.SortField
+	seen := map[string]bool{}
+	for _, item := range strings.Split(input, ",") {
+		item = strings.TrimSpace(item)
+		sortField := db.SortField{Field: strings.TrimPrefix(item, "-"), Descending: strings.HasPrefix(item, "-")}
+		if _, ok := db.OrderSortFields[sortField.Field]; !ok || seen[sortField.Field] {
+			return nil, fmt.Errorf("%w %q, fields can be sorted on once", db.ErrInvalidSort, item)
+		}
+		seen[sortField.Field] = true
+		sortFields = append(sortFields, sortField)
+	}
+	if len(sortFields) == 1 && sortFields[0] == (db.SortField{Field: "createdAt", Descending: true}) {
+		return nil, nil
+	}
+	return sortFields, nil
+}
@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/db/mocks"
+	errors2 "github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAllOrders_FiltersAndSort(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var gotQuery *db.OrdersQuery
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		GetAllFunc: func(_ context.Context, query *db.OrdersQuery) (*db.OrdersPage, error) {
+			gotQuery = query
+			return &db.OrdersPage{Orders: []data.Order{*mockOrder(t)}, HasNext: true}, nil
+		},
+	}, &handlers.OrdersHandlerOpts{Cursors: util.NewCursorCodec([]byte("test-key"))}, lgr)
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(testAdmin))
+	r.GET("/orders", handler.GetAll)
+	q := url.Values{}
+	q.Add("status[in]", "OrderPending,OrderProcessing")
+	q.Add("createdAt[gte]", "2024-01-01T00:00:00Z")
+	q.Add("totalAmount[lt]", "99.5")
+	q.Add("productName[contains]", "shoe")
+	q.Add("sort", "-totalAmount,createdAt")
+	req, _ := http.NewRequest(http.MethodGet, "/orders?"+q.Encode(), nil)
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.ElementsMatch(t, []db.OrderFilter{
+		{Field: "status", Op: db.FilterIn, Value: []string{"OrderPending", "OrderProcessing"}},
+		{Field: "createdAt", Op: db.FilterGte, Value: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Field: "totalAmount", Op: db.FilterLt, Value: money.MustParseAmount("99.5")},
+		{Field: "productName", Op: db.FilterContains, Value: "shoe"},
+	}, gotQuery.Filters)
+	assert.Equal(t, []db.SortField{
+		{Field: "totalAmount", Descending: true},
+		{Field: "createdAt"},
+	}, gotQuery.Sort)
+
+	var respPage external.OrdersPage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &respPage))
+	assert.Empty(t, respPage.NextCursor, "cursors are only issued for the default sort")
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/orders?sort=-createdAt&status=OrderPending", nil)
+	r.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, gotQuery.Sort)
+	assert.Equal(t, []db.OrderFilter{{Field: "status", Op: db.FilterEq, Value: "OrderPending"}}, gotQuery.Filters)
+}
+
+func TestGetAllOrdersFailure_InvalidFiltersAndSort(t *testing.T) {
+	cursor := util.NewCursorCodec([]byte("test-key")).Encode(util.Cursor{})
+	testCases := []struct {
+		description string
+		rawQuery    string
+		errorCode   string
+	}{
+		{"unknown filter field", "colour=red", errors2.UnsupportedQueryParam},
+		{"unsupported operator", "status[gt]=OrderPending", errors2.UnsupportedQueryOperator},
+		{"unknown status", "status=Shipped", errors2.OrderGetInvalidFilter},
+		{"unknown status in list", "status[in]=OrderPending,Shipped", errors2.OrderGetInvalidFilter},
+		{"invalid date", "createdAt[gte]=yesterday", errors2.OrderGetInvalidFilter},
+		{"invalid amount", "totalAmount[gte]=NaN", errors2.OrderGetInvalidFilter},
+		{"operator injection", "user[$ne]=x", errors2.UnsupportedQueryOperator},
+		{"unknown sort field", "sort=-items", errors2.OrderGetInvalidSort},
+		{"repeated sort field", "sort=createdAt,-createdAt", errors2.OrderGetInvalidSort},
+		{"cursor with custom sort", "sort=totalAmount&cursor=" + cursor, errors2.OrderGetInvalidParams},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			recorder := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			_, r := gin.CreateTestContext(recorder)
+			r.Use(withPrincipal(testAdmin))
+			handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{}, &handlers.OrdersHandlerOpts{
+				Cursors: util.NewCursorCodec([]byte("test-key")),
+			}, lgr)
+			r.GET("/orders", handler.GetAll)
+			req, _ := http.NewRequest(http.MethodGet, "/orders?"+tc.rawQuery, nil)
+			r.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, tc.errorCode, apiErr.ErrorCode)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/gin-gonic/gin"
+)
+
+const BaseCurrencyQueryParam = "baseCurrency"
+
+// ReportQueryParams are the totals report query params that are not filters.
+var ReportQueryParams = map[string]bool{
+	BaseCurrencyQueryParam: true,
+}
+
+// Totals reports the totals of the orders matching the filter query params in a base currency, the configured base
+// currency unless the baseCurrency query param names another one. Non admins get the totals of their own orders.
+func (o *OrdersHandler) Totals(c *gin.Context) {
+	base := o.baseCurrency
+	if input, exists := c.GetQuery(BaseCurrencyQueryParam); exists && input != "" {
+		currency, err := money.ParseCurrency(input)
+		if err != nil {
+			o.abort(c, errors.OpGet, fmt.Errorf("%w: %w for %s query param", errors.ErrInvalidQueryParam, err,
+				BaseCurrencyQueryParam))
+			return
+		}
+		base = currency
+	}
+	filters, err := parseOrderFilters(c, ReportQueryParams)
+	if err != nil {
+		o.abort(c, errors.OpGet, err)
+		return
+	}
+	if user, all := accessScope(c); !all {
+		filters = append(filters, db.OrderFilter{Field: "user", Op: db.FilterEq, Value: user})
+	}
+	totals, err := o.oDataSvc.Totals(c, filters)
+	if err != nil {
+		o.abort(c, errors.OpGet, err)
+		return
+	}
+
+	byCurrency := map[money.Currency]*external.CurrencyTotals{}
+	for _, t := range totals {
+		currency := t.Currency
+		if currency == "" {
+			currency = money.DefaultCurrency
+		}
+		ct, ok := byCurrency[currency]
+		if !ok {
+			ct = &external.CurrencyTotals{Currency: currency}
+			byCurrency[currency] = ct
+		}
+		ct.OrderCount += t.Count
+		ct.TotalAmount = ct.TotalAmount.Add(t.TotalAmount)
+		if t.BaseCurrency == base {
+			ct.BaseTotalAmount = ct.BaseTotalAmount.Add(t.BaseTotalAmount)
+			continue
+		}
+		// orders without a snapshot of a rate to the base currency are converted at the current rate
+		rate, rErr := o.rates.Rate(c, currency, base)
+		if rErr != nil {
+			o.abort(c, errors.OpGet, rErr)
+			return
+		}
+		ct.BaseTotalAmount = ct.BaseTotalAmount.Add(rate.Convert(t.TotalAmount))
+		ct.CurrentRateOrderCount += t.Count
+	}
+
+	report := external.TotalsReport{
+		BaseCurrency: base,
+		TotalAmount:  base.Round(money.Amount{}),
+		Currencies:   make([]external.CurrencyTotals, 0, len(byCurrency)),
+	}
+	for _, ct := range byCurrency {
+		ct.TotalAmount = ct.Currency.Round(ct.TotalAmount)
+		ct.BaseTotalAmount = base.Round(ct.BaseTotalAmount)
+		report.OrderCount += ct.OrderCount
+		report.TotalAmount = report.TotalAmount.Add(ct.BaseTotalAmount)
+		report.Currencies = append(report.Currencies, *ct)
+	}
+	sort.Slice(report.Currencies, func(i, j int) bool {
+		return report.Currencies[i].Currency < report.Currencies[j].Currency
+	})
+	c.JSON(http.StatusOK, report)
+}
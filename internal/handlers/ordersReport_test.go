@@ -0,0 +1,137 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/db/mocks"
+	errors2 "github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderTotals are EUR orders recorded with rates to USD, EUR orders of before the snapshots and legacy USD orders
+// without currency.
+var orderTotals = []db.OrderTotals{
+	{Currency: "", Count: 1, TotalAmount: money.MustParseAmount("5")},
+	{Currency: "EUR", BaseCurrency: "USD", Count: 2, TotalAmount: money.MustParseAmount("20.00"),
+		BaseTotalAmount: money.MustParseAmount("21.50")},
+	{Currency: "EUR", Count: 1, TotalAmount: money.MustParseAmount("8.00")},
+	{Currency: "USD", BaseCurrency: "USD", Count: 3, TotalAmount: money.MustParseAmount("30.00"),
+		BaseTotalAmount: money.MustParseAmount("30.00")},
+}
+
+func serveTotals(t *testing.T, principal *auth.Principal, rawQuery string,
+	totals func(filters []db.OrderFilter) ([]db.OrderTotals, error)) *httptest.ResponseRecorder {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	handler := handlers.NewOrdersHandler(&mocks.MockOrdersDataService{
+		TotalsFunc: func(_ context.Context, filters []db.OrderFilter) ([]db.OrderTotals, error) {
+			return totals(filters)
+		},
+	}, &handlers.OrdersHandlerOpts{Rates: testRates}, lgr)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	_, r := gin.CreateTestContext(recorder)
+	r.Use(withPrincipal(principal))
+	r.GET("/ecommerce/v1/reports/order-totals", handler.Totals)
+	req, err := http.NewRequest(http.MethodGet, "/ecommerce/v1/reports/order-totals?"+rawQuery, nil)
+	require.NoError(t, err)
+	r.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestOrdersHandler_Totals(t *testing.T) {
+	recorder := serveTotals(t, testAdmin, "", func(_ []db.OrderFilter) ([]db.OrderTotals, error) {
+		return orderTotals, nil
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var report external.TotalsReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, money.Currency("USD"), report.BaseCurrency)
+	assert.Equal(t, int64(7), report.OrderCount)
+	assert.Equal(t, "66.50", report.TotalAmount.String())
+	require.Len(t, report.Currencies, 2)
+
+	eur := report.Currencies[0]
+	assert.Equal(t, money.Currency("EUR"), eur.Currency)
+	assert.Equal(t, int64(3), eur.OrderCount)
+	assert.Equal(t, "28.00", eur.TotalAmount.String())
+	assert.Equal(t, "31.50", eur.BaseTotalAmount.String(), "recorded 21.50 plus 8.00 EUR at the current 1.25")
+	assert.Equal(t, int64(1), eur.CurrentRateOrderCount)
+
+	usd := report.Currencies[1]
+	assert.Equal(t, money.Currency("USD"), usd.Currency)
+	assert.Equal(t, int64(4), usd.OrderCount, "orders without currency are in the default currency")
+	assert.Equal(t, "35.00", usd.BaseTotalAmount.String())
+	assert.Equal(t, int64(1), usd.CurrentRateOrderCount)
+}
+
+func TestOrdersHandler_Totals_OtherBaseCurrency(t *testing.T) {
+	recorder := serveTotals(t, testAdmin, "baseCurrency=EUR", func(_ []db.OrderFilter) ([]db.OrderTotals, error) {
+		return orderTotals, nil
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var report external.TotalsReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, money.Currency("EUR"), report.BaseCurrency)
+	assert.Equal(t, "56.00", report.TotalAmount.String(), "28.00 EUR and 35.00 USD at the current 0.8")
+	for _, ct := range report.Currencies {
+		assert.Equal(t, ct.OrderCount, ct.CurrentRateOrderCount, "no order recorded a rate to EUR")
+	}
+}
+
+func TestOrdersHandler_Totals_Filters(t *testing.T) {
+	var gotFilters []db.OrderFilter
+	customer := &auth.Principal{Subject: "customer-1", Scopes: []string{auth.ScopeOrdersRead}}
+	recorder := serveTotals(t, customer, "status=OrderPending", func(filters []db.OrderFilter) ([]db.OrderTotals, error) {
+		gotFilters = filters
+		return nil, nil
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []db.OrderFilter{
+		{Field: "status", Op: db.FilterEq, Value: "OrderPending"},
+		{Field: "user", Op: db.FilterEq, Value: "customer-1"},
+	}, gotFilters, "customers only get the totals of their own orders")
+
+	var report external.TotalsReport
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, "0.00", report.TotalAmount.String())
+	assert.Empty(t, report.Currencies)
+}
+
+func TestOrdersHandler_Totals_Errors(t *testing.T) {
+	testCases := []struct {
+		description string
+		rawQuery    string
+		status      int
+		errorCode   string
+	}{
+		{"invalid base currency", "baseCurrency=euro", http.StatusBadRequest, errors2.OrderGetInvalidParams},
+		{"invalid filter", "status=Unknown", http.StatusBadRequest, errors2.OrderGetInvalidFilter},
+		{"missing rate", "baseCurrency=CHF", http.StatusUnprocessableEntity, errors2.UnsupportedCurrency},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			recorder := serveTotals(t, testAdmin, tc.rawQuery, func(_ []db.OrderFilter) ([]db.OrderTotals, error) {
+				return orderTotals, nil
+			})
+			assert.Equal(t, tc.status, recorder.Code)
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+			assert.Equal(t, tc.errorCode, apiErr.ErrorCode)
+		})
+	}
+}
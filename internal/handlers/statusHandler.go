@@ -1,46 +1,101 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
-	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/health"
+	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 )
 
-type ServiceStatus string
+type ServiceStatus = health.Status
 
 const (
-	UP   ServiceStatus = "ok"
-	DOWN ServiceStatus = "down"
+	UP   = health.Up
+	DOWN = health.Down
+
+	DefReadinessTimeout = 2 * time.Second
 )
 
 type StatusResponse struct {
-	Status      ServiceStatus
-	ServiceName string
-	UpTime      string
-	Environment string
-	Version     string
+	Status      ServiceStatus        `json:"status"`
+	ServiceName string               `json:"serviceName,omitempty"`
+	UpTime      string               `json:"upTime,omitempty"`
+	Environment string               `json:"environment,omitempty"`
+	Version     string               `json:"version,omitempty"`
+	Reason      string               `json:"reason,omitempty"`
+	Checks      []health.CheckResult `json:"checks,omitempty"`
+}
+
+// StatusControllerOpts describes the service in the status response, missing values are filled with defaults.
+type StatusControllerOpts struct {
+	ServiceName      string
+	Environment      string
+	Version          string
+	StartedAt        time.Time       // defaults to the creation of the controller
+	Lifecycle        *util.Lifecycle // readiness fails once the service is shutting down
+	ReadinessTimeout time.Duration   // how long the critical checks of /readyz may take, defaults to DefReadinessTimeout
 }
 
 type StatusController struct {
-	dbMgr db.MongoManager
+	checks *health.Registry
+	opts   StatusControllerOpts
+}
+
+func NewStatusController(checks *health.Registry, opts *StatusControllerOpts) *StatusController {
+	o := StatusControllerOpts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.StartedAt.IsZero() {
+		o.StartedAt = time.Now()
+	}
+	if o.ReadinessTimeout <= 0 {
+		o.ReadinessTimeout = DefReadinessTimeout
+	}
+	return &StatusController{checks: checks, opts: o}
 }
 
-func NewStatusController(dbMgr db.MongoManager) *StatusController {
-	return &StatusController{dbMgr: dbMgr}
+// Live reports the process is running, it does not check any dependency.
+func (s *StatusController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, StatusResponse{Status: UP})
 }
 
+// Ready reports whether the service can take traffic: it is not shutting down and the critical checks pass.
+func (s *StatusController) Ready(c *gin.Context) {
+	if s.opts.Lifecycle.ShuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, StatusResponse{Status: DOWN, Reason: "shutting down"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c, s.opts.ReadinessTimeout)
+	defer cancel()
+	status, results := s.checks.Run(ctx, true)
+	code := http.StatusOK
+	if status == DOWN {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, StatusResponse{Status: status, Checks: results})
+}
+
+// CheckStatus describes the service and the state of every dependency.
 func (s *StatusController) CheckStatus(c *gin.Context) {
-	var stat ServiceStatus
-	var code int
-	if err := s.dbMgr.Ping(); err != nil {
-		stat = UP
-		code = http.StatusOK
-	} else {
-		log.Error().Msg("unable to connect to DB")
-		stat = DOWN
+	resp := StatusResponse{
+		Status:      UP,
+		ServiceName: s.opts.ServiceName,
+		UpTime:      time.Since(s.opts.StartedAt).Round(time.Second).String(),
+		Environment: s.opts.Environment,
+		Version:     s.opts.Version,
+	}
+	code := http.StatusOK
+	resp.Status, resp.Checks = s.checks.Run(c, false)
+	if resp.Status == DOWN {
 		code = http.StatusFailedDependency
 	}
-	c.JSON(code, stat)
+	if s.opts.Lifecycle.ShuttingDown() {
+		resp.Status, resp.Reason = DOWN, "shutting down"
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, resp)
 }
@@ -7,58 +7,131 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/db/mocks"
 	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/health"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func UnMarshalStatusResponse(resp *http.Response) (string, error) {
+func UnMarshalStatusResponse(resp *http.Response) (handlers.StatusResponse, error) {
 	body, _ := io.ReadAll(resp.Body)
-	var statusResponse string
+	var statusResponse handlers.StatusResponse
 	err := json.Unmarshal(body, &statusResponse)
 	return statusResponse, err
 }
 
+func newStatusController(pingErr error, lifecycle *util.Lifecycle) *handlers.StatusController {
+	mocks.PingFunc = func() error {
+		return pingErr
+	}
+	checks := health.NewRegistry(logger.Setup(models.ServiceEnv{Name: "test"}))
+	checks.Register("mongo", db.PingCheck(&mocks.MockMongoMgr{}), &health.CheckOpts{Critical: true})
+	return handlers.NewStatusController(checks, &handlers.StatusControllerOpts{
+		ServiceName: "orders",
+		Environment: "test",
+		Version:     "1.2.3",
+		StartedAt:   time.Now().Add(-time.Hour),
+		Lifecycle:   lifecycle,
+	})
+}
+
 func TestStatusSuccess(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	mocks.PingFunc = func() error {
-		return nil
-	}
-	s := handlers.NewStatusController(&mocks.MockMongoMgr{})
+	c.Request = httptest.NewRequest(http.MethodGet, "/status", nil)
+	s := newStatusController(nil, nil)
 
 	s.CheckStatus(c)
 
 	resp := w.Result()
 	statusResponse, err := UnMarshalStatusResponse(resp)
-	if err != nil {
-		t.Fail()
-	}
+	require.NoError(t, err)
 	assert.EqualValues(t, http.StatusOK, resp.StatusCode)
-	assert.EqualValues(t, handlers.UP, statusResponse)
-
+	assert.EqualValues(t, handlers.UP, statusResponse.Status)
+	assert.Equal(t, "orders", statusResponse.ServiceName)
+	assert.Equal(t, "test", statusResponse.Environment)
+	assert.Equal(t, "1.2.3", statusResponse.Version)
+	assert.Equal(t, "1h0m0s", statusResponse.UpTime)
+	require.Len(t, statusResponse.Checks, 1)
+	assert.Equal(t, "mongo", statusResponse.Checks[0].Name)
+	assert.Equal(t, handlers.UP, statusResponse.Checks[0].Status)
 }
 
 func TestStatusDown(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	mocks.PingFunc = func() error {
-		return errors.New("DB connection failed")
-	}
-	s := handlers.NewStatusController(&mocks.MockMongoMgr{})
+	c.Request = httptest.NewRequest(http.MethodGet, "/status", nil)
+	s := newStatusController(errors.New("DB connection failed"), nil)
 
 	s.CheckStatus(c)
 
 	resp := w.Result()
 	statusResponse, err := UnMarshalStatusResponse(resp)
-	if err != nil {
-		t.Fail()
+	require.NoError(t, err)
+	assert.EqualValues(t, http.StatusFailedDependency, resp.StatusCode)
+	assert.EqualValues(t, handlers.DOWN, statusResponse.Status)
+	require.Len(t, statusResponse.Checks, 1)
+	assert.Equal(t, "DB connection failed", statusResponse.Checks[0].Error)
+	assert.Equal(t, "DB connection failed", statusResponse.Checks[0].LastError)
+	assert.NotNil(t, statusResponse.Checks[0].LastErrorAt)
+}
+
+func TestStatus_ShuttingDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	lifecycle := &util.Lifecycle{}
+	lifecycle.BeginShutdown()
+	s := newStatusController(nil, lifecycle)
+
+	for _, handler := range []gin.HandlerFunc{s.CheckStatus, s.Ready} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		handler(c)
+		assert.EqualValues(t, http.StatusServiceUnavailable, w.Code)
 	}
+}
 
-	assert.EqualValues(t, http.StatusFailedDependency, resp.StatusCode)
-	assert.EqualValues(t, handlers.DOWN, statusResponse)
+func TestLive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	s := newStatusController(errors.New("DB connection failed"), nil)
+
+	s.Live(c)
+
+	assert.EqualValues(t, http.StatusOK, w.Code, "liveness should not depend on the database")
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		pingErr  error
+		wantCode int
+	}{
+		{name: "DBUp", wantCode: http.StatusOK},
+		{name: "DBDown", pingErr: errors.New("DB connection failed"), wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			s := newStatusController(tc.pingErr, nil)
+
+			s.Ready(c)
+
+			assert.EqualValues(t, tc.wantCode, w.Code)
+		})
+	}
 }
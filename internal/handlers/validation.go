@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+)
+
+const (
+	// DefMaxLineItems is the default of the largest number of products an order can have
+	DefMaxLineItems = 100
+	// DefMaxQuantity is the default of the largest quantity of a single product of an order
+	DefMaxQuantity = 1000
+)
+
+// regionCode is an ISO 3166-2 subdivision code without the country prefix, e.g. CA of US-CA.
+var regionCode = regexp.MustCompile(`^[A-Z0-9]{1,3}$`)
+
+// couponCode is the code customers enter, it is stored upper case.
+var couponCode = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		// validation errors name fields as clients know them, by their JSON name
+		v.RegisterTagNameFunc(jsonFieldName)
+		_ = v.RegisterValidation("notblank", validators.NotBlank)
+		_ = v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+			return money.Currency(fl.Field().String()).IsValid()
+		})
+		_ = v.RegisterValidation("region", func(fl validator.FieldLevel) bool {
+			return regionCode.MatchString(fl.Field().String())
+		})
+		_ = v.RegisterValidation("couponcode", func(fl validator.FieldLevel) bool {
+			return couponCode.MatchString(fl.Field().String())
+		})
+		// amounts are validated by value, e.g. gt=0
+		v.RegisterCustomTypeFunc(func(field reflect.Value) any {
+			return field.Interface().(money.Amount).Float64()
+		}, money.Amount{})
+	}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// bindOrderInput decodes the JSON body into input and validates it, the problem of every invalid field is reported
+// at once: the struct validation and the checks of the products against the order currency and limits.
+func (o *OrdersHandler) bindOrderInput(body io.Reader, input any,
+	products func() (money.Currency, []external.ProductInput)) error {
+	return bindInput(body, input, func() errors.InvalidFields {
+		return o.checkProducts(products())
+	})
+}
+
+// bindInput decodes the JSON body into input and validates the struct, check reports the problems the struct tags
+// can't express. It runs after the struct validation, also when fields are invalid, and may be nil.
+func bindInput(body io.Reader, input any, check func() errors.InvalidFields) error {
+	decoder := json.NewDecoder(body)
+	if binding.EnableDecoderDisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(input); err != nil {
+		return fmt.Errorf("%w: %w", errors.ErrInvalidInput, err)
+	}
+	var fields errors.InvalidFields
+	if err := binding.Validator.ValidateStruct(input); err != nil {
+		fields = errors.FieldErrors(err)
+		if len(fields) == 0 {
+			return fmt.Errorf("%w: %w", errors.ErrInvalidInput, err)
+		}
+	}
+	if check != nil {
+		fields = append(fields, check()...)
+	}
+	if len(fields) > 0 {
+		return fields
+	}
+	return nil
+}
+
+// checkProducts reports the line items beyond the largest number of line items, the products exceeding the largest
+// quantity, the products in another currency than the order and the prices more precise than the minor unit of
+// the currency.
+func (o *OrdersHandler) checkProducts(currency money.Currency, products []external.ProductInput) errors.InvalidFields {
+	var fields errors.InvalidFields
+	if len(products) > o.maxLineItems {
+		fields = append(fields, external.FieldError{
+			Pointer: "/products",
+			Reason:  fmt.Sprintf("should have at most %d items", o.maxLineItems),
+		})
+	}
+	for i, product := range products {
+		if product.Quantity > uint64(o.maxQuantity) {
+			fields = append(fields, external.FieldError{
+				Pointer: fmt.Sprintf("/products/%d/quantity", i),
+				Reason:  fmt.Sprintf("should be at most %d", o.maxQuantity),
+			})
+		}
+		if currency.IsValid() && product.Currency.IsValid() && product.Currency != currency {
+			fields = append(fields, external.FieldError{
+				Pointer: fmt.Sprintf("/products/%d/currency", i),
+				Reason:  fmt.Sprintf("should be the order currency %s", currency),
+			})
+		}
+		if currency.IsValid() && product.Price.DecimalPlaces() > currency.MinorUnits() {
+			fields = append(fields, external.FieldError{
+				Pointer: fmt.Sprintf("/products/%d/price", i),
+				Reason:  fmt.Sprintf("should have at most %d decimal places in %s", currency.MinorUnits(), currency),
+			})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+)
+
+type Status string
+
+const (
+	Up   Status = "ok"
+	Down Status = "down"
+
+	DefCheckTimeout = 2 * time.Second
+)
+
+// CheckFunc reports a dependency as healthy by returning nil, it should give up once ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+// CheckOpts configures a check, missing values are filled with defaults.
+type CheckOpts struct {
+	Timeout  time.Duration // how long the check may take, defaults to DefCheckTimeout
+	Critical bool          // a failing critical check makes the service not ready
+}
+
+// CheckResult is the outcome of the last run of a check, the last error is kept after the check recovers.
+type CheckResult struct {
+	Name          string     `json:"name"`
+	Status        Status     `json:"status"`
+	Critical      bool       `json:"critical"`
+	LatencyMillis float64    `json:"latencyMs"`
+	Error         string     `json:"error,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+	opts CheckOpts
+
+	mu            sync.Mutex
+	lastError     string
+	lastErrorAt   time.Time
+	lastSuccessAt time.Time
+}
+
+// Registry holds the health checks of the dependencies of the service, subsystems register their own checks.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]*check
+	logger *logger.AppLogger
+}
+
+func NewRegistry(lgr *logger.AppLogger) *Registry {
+	return &Registry{checks: map[string]*check{}, logger: lgr}
+}
+
+// Register adds the check name, replacing a check registered before with the same name.
+func (r *Registry) Register(name string, fn CheckFunc, opts *CheckOpts) {
+	o := CheckOpts{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefCheckTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = &check{name: name, fn: fn, opts: o}
+}
+
+// Run runs the checks concurrently, only the critical ones when criticalOnly is set. The returned status is Down
+// when a critical check fails, results are sorted by name.
+func (r *Registry) Run(ctx context.Context, criticalOnly bool) (Status, []CheckResult) {
+	r.mu.RLock()
+	checks := make([]*check, 0, len(r.checks))
+	for _, c := range r.checks {
+		if c.opts.Critical || !criticalOnly {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	status := Up
+	for _, result := range results {
+		if result.Critical && result.Status == Down {
+			status = Down
+		}
+	}
+	return status, results
+}
+
+func (r *Registry) run(ctx context.Context, c *check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.fn(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	latency := time.Since(start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := CheckResult{
+		Name:          c.name,
+		Status:        Up,
+		Critical:      c.opts.Critical,
+		LatencyMillis: float64(latency.Microseconds()) / 1000,
+	}
+	now := time.Now()
+	if err != nil {
+		if c.lastErrorAt.IsZero() || c.lastErrorAt.Before(c.lastSuccessAt) {
+			r.logger.Error().Err(err).Str("check", c.name).Msg("health check failed")
+		}
+		result.Status = Down
+		result.Error = err.Error()
+		c.lastError, c.lastErrorAt = err.Error(), now
+	} else {
+		c.lastSuccessAt = now
+	}
+	if !c.lastErrorAt.IsZero() {
+		lastErrorAt := c.lastErrorAt
+		result.LastError, result.LastErrorAt = c.lastError, &lastErrorAt
+	}
+	if !c.lastSuccessAt.IsZero() {
+		lastSuccessAt := c.lastSuccessAt
+		result.LastSuccessAt = &lastSuccessAt
+	}
+	return result
+}
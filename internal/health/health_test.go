@@ -0,0 +1,54 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/health"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lgr = logger.Setup(models.ServiceEnv{Name: "test"})
+
+func TestRegistry_Run(t *testing.T) {
+	checks := health.NewRegistry(lgr)
+	var cacheErr error
+	checks.Register("db", func(context.Context) error { return nil }, &health.CheckOpts{Critical: true})
+	checks.Register("cache", func(context.Context) error { return cacheErr }, nil)
+
+	cacheErr = errors.New("cache unavailable")
+	status, results := checks.Run(context.Background(), false)
+	assert.Equal(t, health.Up, status, "non critical checks should not fail the service")
+	require.Len(t, results, 2)
+	assert.Equal(t, "cache", results[0].Name)
+	assert.Equal(t, health.Down, results[0].Status)
+	assert.Equal(t, "cache unavailable", results[0].Error)
+
+	cacheErr = nil
+	_, results = checks.Run(context.Background(), false)
+	assert.Equal(t, health.Up, results[0].Status)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, "cache unavailable", results[0].LastError, "the last error should be kept after recovering")
+	assert.NotNil(t, results[0].LastSuccessAt)
+
+	_, results = checks.Run(context.Background(), true)
+	require.Len(t, results, 1)
+	assert.Equal(t, "db", results[0].Name)
+}
+
+func TestRegistry_Timeout(t *testing.T) {
+	checks := health.NewRegistry(lgr)
+	checks.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, &health.CheckOpts{Critical: true, Timeout: 10 * time.Millisecond})
+
+	status, results := checks.Run(context.Background(), true)
+	assert.Equal(t, health.Down, status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), results[0].Error)
+}
@@ -11,6 +11,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/pkgerrors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
 )
 
 var (
@@ -39,14 +45,18 @@ func Setup(env models.ServiceEnv) *AppLogger {
 	return appLogger
 }
 
+// WithReqID returns a logger with the request id and, when the request is traced, the trace and span ids.
 func (l *AppLogger) WithReqID(ctx *gin.Context) (zerolog.Logger, string) {
+	lCtx := l.zLogger.With()
+	if spanCtx := trace.SpanContextFromContext(ctx.Request.Context()); spanCtx.IsValid() {
+		lCtx = lCtx.Str(TraceIDKey, spanCtx.TraceID().String()).Str(SpanIDKey, spanCtx.SpanID().String())
+	}
 	if rID := ctx.Request.Context().Value(util.ContextKey(util.RequestIdentifier)); rID != nil {
 		if reqID, ok := rID.(string); ok {
-			return l.zLogger.With().Str(util.RequestIdentifier, reqID).Logger(), reqID
+			return lCtx.Str(util.RequestIdentifier, reqID).Logger(), reqID
 		}
-		return l.zLogger, ""
 	}
-	return l.zLogger, ""
+	return lCtx.Logger(), ""
 }
 
 func ZerologLevel(level string) zerolog.Level {
@@ -78,6 +88,11 @@ func (l *AppLogger) Error() *zerolog.Event {
 	return l.zLogger.Error()
 }
 
+// Warn logs a message with warn level.
+func (l *AppLogger) Warn() *zerolog.Event {
+	return l.zLogger.Warn()
+}
+
 // Info logs a message with info level.
 func (l *AppLogger) Info() *zerolog.Event {
 	return l.zLogger.Info()
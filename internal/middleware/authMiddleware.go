@@ -1,9 +1,82 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	stdErrors "errors"
+	"net/http"
+	"strings"
 
-func AuthMiddleware() gin.HandlerFunc {
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AuthorizationHeader   = "Authorization"
+	WWWAuthenticateHeader = "WWW-Authenticate"
+	bearerPrefix          = "Bearer "
+)
+
+var ErrMissingBearerToken = stdErrors.New("bearer token is missing")
+
+// AuthMiddleware authenticates the bearer token of the request and stores the principal in the context,
+// see auth.PrincipalFrom. Requests without a valid token are rejected with 401.
+// With auth.DisabledVerifier no token is needed and every request runs as auth.DevPrincipal. A principal
+// RateLimitMiddleware already authenticated is kept.
+func AuthMiddleware(verifier auth.TokenVerifier, lgr *logger.AppLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if _, ok := auth.PrincipalFrom(c); ok {
+			c.Next()
+			return
+		}
+		l, requestID := lgr.WithReqID(c)
+		principal, err := authenticate(c, verifier)
+		if err != nil {
+			apiErr := &external.APIError{
+				HTTPStatusCode: http.StatusUnauthorized,
+				ErrorCode:      unauthorizedErrorCode(c),
+				Message:        "Missing or invalid bearer token",
+				DebugID:        requestID,
+			}
+			l.Error().Err(err).Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).Msg(apiErr.Message)
+			c.Header(WWWAuthenticateHeader, `Bearer error="invalid_token"`)
+			errors.Abort(c, apiErr)
+			return
+		}
+		auth.SetPrincipal(c, principal)
 		c.Next()
 	}
 }
+
+func authenticate(c *gin.Context, verifier auth.TokenVerifier) (*auth.Principal, error) {
+	if verifier == nil {
+		return nil, auth.ErrInvalidToken
+	}
+	if _, disabled := verifier.(auth.DisabledVerifier); disabled {
+		return auth.DevPrincipal, nil
+	}
+	header := c.GetHeader(AuthorizationHeader)
+	if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return nil, ErrMissingBearerToken
+	}
+	return verifier.Verify(c, strings.TrimSpace(header[len(bearerPrefix):]))
+}
+
+// unauthorizedErrorCode picks the Order*Unauthorized code of the operation the request was made for.
+func unauthorizedErrorCode(c *gin.Context) string {
+	switch c.Request.Method {
+	case http.MethodPost:
+		if path := c.FullPath(); strings.HasSuffix(path, "/orders") || strings.HasSuffix(path, "/coupons") ||
+			strings.HasSuffix(path, "/customers") {
+			return errors.OrderCreateUnauthorized
+		}
+		return errors.OrderUpdateUnauthorized
+	case http.MethodPut, http.MethodPatch:
+		return errors.OrderUpdateUnauthorized
+	case http.MethodDelete:
+		return errors.OrderDeleteUnauthorized
+	default:
+		return errors.OrderGetUnAuthorized
+	}
+}
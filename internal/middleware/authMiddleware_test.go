@@ -1,18 +1,25 @@
 package middleware_test
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/external"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestAuthMiddleware(t *testing.T) {
 	router := gin.New()
-	router.Use(middleware.AuthMiddleware())
+	router.Use(middleware.AuthMiddleware(auth.DisabledVerifier{}, logger.Setup(models.ServiceEnv{Name: "test"})))
 	router.GET("/test", func(c *gin.Context) {
 		c.String(http.StatusOK, "test")
 	})
@@ -28,7 +35,7 @@ func TestAuthMiddleware(t *testing.T) {
 func TestAuthMiddleware_WithNext(t *testing.T) {
 	router := gin.New()
 	var nextCalled bool
-	router.Use(middleware.AuthMiddleware())
+	router.Use(middleware.AuthMiddleware(auth.DisabledVerifier{}, logger.Setup(models.ServiceEnv{Name: "test"})))
 
 	router.GET("/test", func(c *gin.Context) {
 		nextCalled = true
@@ -42,3 +49,77 @@ func TestAuthMiddleware_WithNext(t *testing.T) {
 
 	assert.True(t, nextCalled, "next should be called")
 }
+
+type stubVerifier struct {
+	principal *auth.Principal
+	err       error
+}
+
+func (s stubVerifier) Verify(_ context.Context, _ string) (*auth.Principal, error) {
+	return s.principal, s.err
+}
+
+func TestAuthMiddleware_Bearer(t *testing.T) {
+	valid := stubVerifier{principal: &auth.Principal{Subject: "user-1", Scopes: []string{"orders:read"}}}
+	invalid := stubVerifier{err: auth.ErrInvalidToken}
+	testCases := []struct {
+		description   string
+		verifier      auth.TokenVerifier
+		method        string
+		authorization string
+		expectedCode  int
+		errorCode     string
+	}{
+		{"valid token", valid, http.MethodGet, "Bearer token", http.StatusOK, ""},
+		{"scheme is case insensitive", valid, http.MethodGet, "bearer token", http.StatusOK, ""},
+		{"missing token on read", valid, http.MethodGet, "", http.StatusUnauthorized, errors.OrderGetUnAuthorized},
+		{"basic auth on create", valid, http.MethodPost, "Basic dXNlcjpwYXNz", http.StatusUnauthorized, errors.OrderCreateUnauthorized},
+		{"invalid token on update", invalid, http.MethodPut, "Bearer token", http.StatusUnauthorized, errors.OrderUpdateUnauthorized},
+		{"invalid token on delete", invalid, http.MethodDelete, "Bearer token", http.StatusUnauthorized, errors.OrderDeleteUnauthorized},
+		{"no verifier fails closed", nil, http.MethodGet, "Bearer token", http.StatusUnauthorized, errors.OrderGetUnAuthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			router := gin.New()
+			router.Use(middleware.AuthMiddleware(tc.verifier, logger.Setup(models.ServiceEnv{Name: "test"})))
+			var principal *auth.Principal
+			router.Handle(tc.method, "/ecommerce/v1/orders", func(c *gin.Context) {
+				principal, _ = auth.PrincipalFrom(c)
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest(tc.method, "/ecommerce/v1/orders", nil)
+			if tc.authorization != "" {
+				req.Header.Set(middleware.AuthorizationHeader, tc.authorization)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			if tc.errorCode == "" {
+				assert.Equal(t, "user-1", principal.Subject)
+				return
+			}
+			assert.NotEmpty(t, resp.Header().Get(middleware.WWWAuthenticateHeader))
+			var apiErr external.APIError
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+			assert.Equal(t, tc.errorCode, apiErr.ErrorCode)
+		})
+	}
+}
+
+func TestAuthMiddleware_Disabled(t *testing.T) {
+	router := gin.New()
+	router.Use(middleware.AuthMiddleware(auth.DisabledVerifier{}, logger.Setup(models.ServiceEnv{Name: "test"})))
+	var principal *auth.Principal
+	router.GET("/test", func(c *gin.Context) {
+		principal, _ = auth.PrincipalFrom(c)
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, auth.DevPrincipal, principal)
+}
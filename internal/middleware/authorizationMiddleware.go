@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/gin-gonic/gin"
+)
+
+// RoutePermission is the scope a route requires and the error code returned when it is missing.
+type RoutePermission struct {
+	Scope     string
+	ErrorCode string
+}
+
+// RoutePermissions is keyed like AllowedQueryParams by method and route path.
+var RoutePermissions = map[string]RoutePermission{
+	http.MethodGet + "/ecommerce/v1/orders":        {Scope: auth.ScopeOrdersRead, ErrorCode: errors.OrderGetForbidden},
+	http.MethodPost + "/ecommerce/v1/orders":       {Scope: auth.ScopeOrdersWrite, ErrorCode: errors.OrderCreateForbidden},
+	http.MethodGet + "/ecommerce/v1/orders/:id":    {Scope: auth.ScopeOrdersRead, ErrorCode: errors.OrderGetForbidden},
+	http.MethodPut + "/ecommerce/v1/orders/:id":    {Scope: auth.ScopeOrdersWrite, ErrorCode: errors.OrderUpdateForbidden},
+	http.MethodPatch + "/ecommerce/v1/orders/:id":  {Scope: auth.ScopeOrdersWrite, ErrorCode: errors.OrderUpdateForbidden},
+	http.MethodDelete + "/ecommerce/v1/orders/:id": {Scope: auth.ScopeOrdersDelete, ErrorCode: errors.OrderDeleteForbidden},
+
+	http.MethodPost + "/ecommerce/v1/orders/:id/transitions": {Scope: auth.ScopeOrdersWrite, ErrorCode: errors.OrderUpdateForbidden},
+
+	http.MethodGet + "/ecommerce/v1/reports/order-totals": {Scope: auth.ScopeOrdersRead, ErrorCode: errors.OrderGetForbidden},
+
+	http.MethodGet + "/ecommerce/v1/coupons":        {Scope: auth.ScopeCouponsRead, ErrorCode: errors.CouponGetForbidden},
+	http.MethodPost + "/ecommerce/v1/coupons":       {Scope: auth.ScopeCouponsWrite, ErrorCode: errors.CouponCreateForbidden},
+	http.MethodGet + "/ecommerce/v1/coupons/:id":    {Scope: auth.ScopeCouponsRead, ErrorCode: errors.CouponGetForbidden},
+	http.MethodPut + "/ecommerce/v1/coupons/:id":    {Scope: auth.ScopeCouponsWrite, ErrorCode: errors.CouponUpdateForbidden},
+	http.MethodDelete + "/ecommerce/v1/coupons/:id": {Scope: auth.ScopeCouponsWrite, ErrorCode: errors.CouponDeleteForbidden},
+
+	http.MethodGet + "/ecommerce/v1/customers":            {Scope: auth.ScopeCustomersRead, ErrorCode: errors.CustomerGetForbidden},
+	http.MethodPost + "/ecommerce/v1/customers":           {Scope: auth.ScopeCustomersWrite, ErrorCode: errors.CustomerCreateForbidden},
+	http.MethodGet + "/ecommerce/v1/customers/:id":        {Scope: auth.ScopeCustomersRead, ErrorCode: errors.CustomerGetForbidden},
+	http.MethodPut + "/ecommerce/v1/customers/:id":        {Scope: auth.ScopeCustomersWrite, ErrorCode: errors.CustomerUpdateForbidden},
+	http.MethodDelete + "/ecommerce/v1/customers/:id":     {Scope: auth.ScopeCustomersWrite, ErrorCode: errors.CustomerDeleteForbidden},
+	http.MethodGet + "/ecommerce/v1/customers/:id/orders": {Scope: auth.ScopeCustomersRead, ErrorCode: errors.CustomerGetForbidden},
+}
+
+// GroupPermissions apply to every route below a path prefix that has no entry in RoutePermissions.
+var GroupPermissions = map[string]RoutePermission{
+	"/internal/": {Scope: auth.ScopeAdmin, ErrorCode: errors.InternalForbidden},
+}
+
+// RoutePermissionFor looks up the permission of a route, ok is false for routes without one.
+func RoutePermissionFor(method, path string) (RoutePermission, bool) {
+	if permission, ok := RoutePermissions[method+path]; ok {
+		return permission, true
+	}
+	for prefix, permission := range GroupPermissions {
+		if strings.HasPrefix(path, prefix) {
+			return permission, true
+		}
+	}
+	return RoutePermission{}, false
+}
+
+// AuthorizationMiddleware checks that the authenticated principal was granted the scope the route requires,
+// routes without a permission are denied. It has to run after AuthMiddleware.
+func AuthorizationMiddleware(lgr *logger.AppLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l, requestID := lgr.WithReqID(c)
+		principal, _ := auth.PrincipalFrom(c)
+		permission, ok := RoutePermissionFor(c.Request.Method, c.FullPath())
+		if ok && principal.HasScope(permission.Scope) {
+			c.Next()
+			return
+		}
+		apiErr := &external.APIError{
+			HTTPStatusCode: http.StatusForbidden,
+			ErrorCode:      errors.Forbidden,
+			Message:        "Not allowed to access this resource",
+			DebugID:        requestID,
+		}
+		if ok {
+			apiErr.ErrorCode = permission.ErrorCode
+			apiErr.Message = "Missing scope " + permission.Scope
+		}
+		event := l.Error().Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).
+			Str("method", c.Request.Method).Str("path", c.FullPath())
+		if principal != nil {
+			event = event.Str("subject", principal.Subject)
+		}
+		event.Msg(apiErr.Message)
+		errors.Abort(c, apiErr)
+	}
+}
@@ -0,0 +1,67 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	testCases := []struct {
+		description  string
+		scopes       []string
+		method       string
+		path         string
+		expectedCode int
+		errorCode    string
+	}{
+		{"read with read scope", []string{auth.ScopeOrdersRead}, http.MethodGet, "/ecommerce/v1/orders/:id", http.StatusOK, ""},
+		{"create without write scope", []string{auth.ScopeOrdersRead}, http.MethodPost, "/ecommerce/v1/orders", http.StatusForbidden, errors.OrderCreateForbidden},
+		{"transition with write scope", []string{auth.ScopeOrdersWrite}, http.MethodPost, "/ecommerce/v1/orders/:id/transitions", http.StatusOK, ""},
+		{"delete with write scope", []string{auth.ScopeOrdersWrite}, http.MethodDelete, "/ecommerce/v1/orders/:id", http.StatusForbidden, errors.OrderDeleteForbidden},
+		{"delete with delete scope", []string{auth.ScopeOrdersDelete}, http.MethodDelete, "/ecommerce/v1/orders/:id", http.StatusOK, ""},
+		{"internal without admin", []string{auth.ScopeOrdersRead, auth.ScopeOrdersWrite}, http.MethodPost, "/internal/seed-local-db", http.StatusForbidden, errors.InternalForbidden},
+		{"internal with admin", []string{auth.ScopeAdmin}, http.MethodGet, "/internal/pprof/heap", http.StatusOK, ""},
+		{"route without permission", []string{auth.ScopeAdmin}, http.MethodGet, "/ecommerce/v1/unknown", http.StatusForbidden, errors.Forbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				auth.SetPrincipal(c, &auth.Principal{Subject: "user-1", Scopes: tc.scopes})
+			})
+			router.Use(middleware.AuthorizationMiddleware(logger.Setup(models.ServiceEnv{Name: "test"})))
+			router.Handle(tc.method, tc.path, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest(tc.method, tc.path, nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			if tc.errorCode != "" {
+				var apiErr external.APIError
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+				assert.Equal(t, tc.errorCode, apiErr.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestRoutePermissions_CoverAllowedQueryParams(t *testing.T) {
+	for route := range middleware.AllowedQueryParams {
+		_, ok := middleware.RoutePermissions[route]
+		assert.True(t, ok, "route %s has no permission", route)
+	}
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stdErrors "errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	MaxIdempotencyKeyLength  = 255
+
+	DefIdempotencyKeyTTL      = 24 * time.Hour
+	DefIdempotencyLockTimeout = time.Minute
+)
+
+// replayedHeaders are the response headers stored along with the response body.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+type IdempotencyOpts struct {
+	// TTL is how long a key and its response are kept
+	TTL time.Duration
+	// LockTimeout is how long a request may hold a key before a retry can take it over
+	LockTimeout time.Duration
+}
+
+// IdempotencyMiddleware makes a route safe to retry with an Idempotency-Key header: the first request is processed
+// and its response stored, identical retries get the stored response. A retry with a different body is rejected with 422
+// and a retry made while the first request is still in flight is rejected with 409. Requests without the header are
+// processed as usual.
+func IdempotencyMiddleware(repo db.IdempotencyDataService, opts *IdempotencyOpts, lgr *logger.AppLogger) gin.HandlerFunc {
+	ttl, lockTimeout := DefIdempotencyKeyTTL, DefIdempotencyLockTimeout
+	if opts != nil && opts.TTL > 0 {
+		ttl = opts.TTL
+	}
+	if opts != nil && opts.LockTimeout > 0 {
+		lockTimeout = opts.LockTimeout
+	}
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		l, requestID := lgr.WithReqID(c)
+		abort := func(err error, statusCode int, errorCode, message string) {
+			apiErr := &external.APIError{
+				HTTPStatusCode: statusCode,
+				ErrorCode:      errorCode,
+				Message:        message,
+				DebugID:        requestID,
+			}
+			l.Error().Err(err).Str("idempotencyKey", key).Int("HttpStatusCode", statusCode).
+				Str("ErrorCode", errorCode).Msg(message)
+			errors.Abort(c, apiErr)
+		}
+		if len(key) > MaxIdempotencyKeyLength {
+			abort(nil, http.StatusBadRequest, errors.OrderCreateIdempotencyKeyInvalid, "Idempotency-Key header is too long")
+			return
+		}
+
+		body, err := c.GetRawData()
+		if err != nil {
+			abort(err, http.StatusBadRequest, errors.OrderCreateInvalidInput, "Unable to read request body")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		record := &data.IdempotencyRecord{
+			Key:         idempotencyScope(c) + " " + key,
+			RequestHash: requestHash(body),
+			CreatedAt:   now,
+			LockedUntil: now.Add(lockTimeout),
+			ExpiresAt:   now.Add(ttl),
+		}
+		existing, err := repo.Begin(c, record)
+		switch {
+		case stdErrors.Is(err, db.ErrIdempotencyKeyExists):
+			replayOrReject(c, existing, record.RequestHash, abort)
+			return
+		case stdErrors.Is(err, db.ErrIdempotencyKeyNotFound):
+			abort(err, http.StatusConflict, errors.OrderCreateIdempotencyInFlight,
+				"A request with the same Idempotency-Key just expired, retry the request")
+			return
+		case err != nil:
+			abort(err, http.StatusInternalServerError, errors.OrderCreateServerError, errors.UnexpectedErrorMessage)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// the response is kept even if the client went away, that is the retry this middleware is for
+			ctx := context.WithoutCancel(c.Request.Context())
+			if !completed {
+				if rErr := repo.Release(ctx, record); rErr != nil {
+					l.Error().Err(rErr).Str("idempotencyKey", key).Msg("failed to release idempotency key")
+				}
+			}
+		}()
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+		response := &data.IdempotencyResponse{
+			StatusCode: recorder.Status(),
+			Headers:    map[string]string{},
+			Body:       recorder.body.Bytes(),
+		}
+		for _, h := range replayedHeaders {
+			if v := recorder.Header().Get(h); v != "" {
+				response.Headers[h] = v
+			}
+		}
+		if cErr := repo.Complete(context.WithoutCancel(c.Request.Context()), record, response); cErr != nil {
+			l.Error().Err(cErr).Str("idempotencyKey", key).Msg("failed to store idempotent response")
+			return
+		}
+		completed = true
+	}
+}
+
+func replayOrReject(c *gin.Context, existing *data.IdempotencyRecord, hash string,
+	abort func(err error, statusCode int, errorCode, message string)) {
+	switch {
+	case existing.RequestHash != hash:
+		abort(db.ErrIdempotencyKeyExists, http.StatusUnprocessableEntity, errors.OrderCreateIdempotencyKeyReused,
+			"Idempotency-Key was already used with a different request body")
+	case existing.Status != data.IdempotencyCompleted || existing.Response == nil:
+		abort(db.ErrIdempotencyKeyExists, http.StatusConflict, errors.OrderCreateIdempotencyInFlight,
+			"A request with the same Idempotency-Key is still being processed")
+	default:
+		for h, v := range existing.Response.Headers {
+			c.Header(h, v)
+		}
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Status(existing.Response.StatusCode)
+		_, _ = c.Writer.Write(existing.Response.Body)
+		c.Abort()
+	}
+}
+
+// idempotencyScope keeps the keys of different routes and callers apart.
+func idempotencyScope(c *gin.Context) string {
+	scope := c.Request.Method + " " + c.FullPath()
+	if principal, ok := auth.PrincipalFrom(c); ok {
+		scope += " " + principal.Subject
+	}
+	return scope
+}
+
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// responseRecorder keeps a copy of the response body while writing it through.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
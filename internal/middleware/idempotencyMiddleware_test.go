@@ -0,0 +1,187 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/db/mocks"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryIdempotencyStore is an in memory db.IdempotencyDataService backed by a mock.
+func memoryIdempotencyStore() (*mocks.MockIdempotencyDataService, map[string]*data.IdempotencyRecord) {
+	var mu sync.Mutex
+	records := map[string]*data.IdempotencyRecord{}
+	return &mocks.MockIdempotencyDataService{
+		BeginFunc: func(_ context.Context, record *data.IdempotencyRecord) (*data.IdempotencyRecord, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if existing, ok := records[record.Key]; ok {
+				return existing, db.ErrIdempotencyKeyExists
+			}
+			record.Status = data.IdempotencyInFlight
+			records[record.Key] = record
+			return nil, nil
+		},
+		CompleteFunc: func(_ context.Context, record *data.IdempotencyRecord, response *data.IdempotencyResponse) error {
+			mu.Lock()
+			defer mu.Unlock()
+			existing, ok := records[record.Key]
+			if !ok || existing.Status != data.IdempotencyInFlight || !existing.LockedUntil.Equal(record.LockedUntil) {
+				return db.ErrIdempotencyLockLost
+			}
+			existing.Status = data.IdempotencyCompleted
+			existing.Response = response
+			return nil
+		},
+		ReleaseFunc: func(_ context.Context, record *data.IdempotencyRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if existing, ok := records[record.Key]; ok && existing.LockedUntil.Equal(record.LockedUntil) {
+				delete(records, record.Key)
+			}
+			return nil
+		},
+	}, records
+}
+
+func idempotentRouter(repo db.IdempotencyDataService, handler gin.HandlerFunc) *gin.Engine {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.POST("/orders", middleware.IdempotencyMiddleware(repo, nil, lgr), handler)
+	return r
+}
+
+func postWithKey(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	}
+	r.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestIdempotencyMiddleware_ReplaysResponse(t *testing.T) {
+	repo, _ := memoryIdempotencyStore()
+	calls := 0
+	r := idempotentRouter(repo, func(c *gin.Context) {
+		calls++
+		c.Header("ETag", `"order-1"`)
+		c.JSON(http.StatusCreated, gin.H{"id": calls})
+	})
+
+	first := postWithKey(r, "key-1", `{"products":[]}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	second := postWithKey(r, "key-1", `{"products":[]}`)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, `"order-1"`, second.Header().Get("ETag"))
+	assert.Equal(t, "true", second.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	postWithKey(r, "", `{"products":[]}`)
+	postWithKey(r, "", `{"products":[]}`)
+	assert.Equal(t, 3, calls, "requests without a key are not deduplicated")
+}
+
+func TestIdempotencyMiddleware_DifferentBody(t *testing.T) {
+	repo, _ := memoryIdempotencyStore()
+	r := idempotentRouter(repo, func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+	postWithKey(r, "key-1", `{"products":[]}`)
+	resp := postWithKey(r, "key-1", `{"products":[{}]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+	assert.Equal(t, errors.OrderCreateIdempotencyKeyReused, apiErr.ErrorCode)
+}
+
+func TestIdempotencyMiddleware_InFlight(t *testing.T) {
+	repo, _ := memoryIdempotencyStore()
+	var r *gin.Engine
+	var inFlight *httptest.ResponseRecorder
+	r = idempotentRouter(repo, func(c *gin.Context) {
+		if inFlight == nil {
+			inFlight = postWithKey(r, "key-1", `{}`)
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+	resp := postWithKey(r, "key-1", `{}`)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	require.NotNil(t, inFlight)
+	assert.Equal(t, http.StatusConflict, inFlight.Code)
+
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(inFlight.Body.Bytes(), &apiErr))
+	assert.Equal(t, errors.OrderCreateIdempotencyInFlight, apiErr.ErrorCode)
+}
+
+func TestIdempotencyMiddleware_ServerErrorReleasesKey(t *testing.T) {
+	repo, records := memoryIdempotencyStore()
+	calls := 0
+	r := idempotentRouter(repo, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+	assert.Equal(t, http.StatusInternalServerError, postWithKey(r, "key-1", `{}`).Code)
+	assert.Empty(t, records)
+	assert.Equal(t, http.StatusCreated, postWithKey(r, "key-1", `{}`).Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyMiddleware_ReleaseKeepsTakenOverKey(t *testing.T) {
+	repo, records := memoryIdempotencyStore()
+	r := idempotentRouter(repo, func(c *gin.Context) {
+		// the lock expired while the request was processed and a retry took the key over
+		for _, record := range records {
+			takenOver := *record
+			takenOver.LockedUntil = record.LockedUntil.Add(time.Minute)
+			records[record.Key] = &takenOver
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{})
+	})
+	assert.Equal(t, http.StatusInternalServerError, postWithKey(r, "key-1", `{}`).Code)
+	assert.Len(t, records, 1)
+}
+
+func TestIdempotencyMiddleware_CompleteKeepsTakenOverKey(t *testing.T) {
+	repo, records := memoryIdempotencyStore()
+	r := idempotentRouter(repo, func(c *gin.Context) {
+		// the lock expired while the request was processed and a retry took the key over
+		for _, record := range records {
+			takenOver := *record
+			takenOver.LockedUntil = record.LockedUntil.Add(time.Minute)
+			records[record.Key] = &takenOver
+		}
+		c.JSON(http.StatusCreated, gin.H{"orderId": "1"})
+	})
+	assert.Equal(t, http.StatusCreated, postWithKey(r, "key-1", `{}`).Code)
+	require.Len(t, records, 1)
+	for _, record := range records {
+		assert.Equal(t, data.IdempotencyInFlight, record.Status, "the retry should still hold the key")
+		assert.Nil(t, record.Response)
+	}
+}
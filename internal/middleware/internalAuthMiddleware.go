@@ -1,9 +1,12 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/gin-gonic/gin"
+)
 
-func InternalAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Next()
-	}
+// InternalAuthMiddleware authenticates requests to the internal routes the same way AuthMiddleware does.
+func InternalAuthMiddleware(verifier auth.TokenVerifier, lgr *logger.AppLogger) gin.HandlerFunc {
+	return AuthMiddleware(verifier, lgr)
 }
@@ -5,14 +5,17 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/derickit/go-rest-api/internal/models"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestInternalAuthMiddleware(t *testing.T) {
 	router := gin.New()
-	router.Use(middleware.InternalAuthMiddleware())
+	router.Use(middleware.InternalAuthMiddleware(auth.DisabledVerifier{}, logger.Setup(models.ServiceEnv{Name: "test"})))
 
 	router.GET("/test", func(c *gin.Context) {
 		c.String(http.StatusOK, "Test")
@@ -29,7 +32,7 @@ func TestInternalAuthMiddleware_WithNext(t *testing.T) {
 	router := gin.New()
 	var nextCalled bool
 
-	router.Use(middleware.InternalAuthMiddleware())
+	router.Use(middleware.InternalAuthMiddleware(auth.DisabledVerifier{}, logger.Setup(models.ServiceEnv{Name: "test"})))
 
 	router.GET("/test", func(c *gin.Context) {
 		nextCalled = true
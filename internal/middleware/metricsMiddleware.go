@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unmatchedRoute labels requests without a route, so unknown paths cannot grow the number of series.
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Requests served by method, route and status class.",
+	}, []string{"method", "route", "status_class"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of the requests by method, route and status class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status_class"})
+	httpRequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Requests being served by method and route.",
+	}, []string{"method", "route"})
+)
+
+// MetricsMiddleware records the rate, errors and duration of the requests labelled by the route template,
+// c.FullPath(), rather than the requested url.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		inFlight := httpRequestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		start := time.Now()
+		defer func() {
+			inFlight.Dec()
+			statusClass := strconv.Itoa(c.Writer.Status()/100) + "xx"
+			httpRequests.WithLabelValues(method, route, statusClass).Inc()
+			httpRequestDuration.WithLabelValues(method, route, statusClass).Observe(time.Since(start).Seconds())
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.MetricsMiddleware())
+	router.GET("/metrics-test/:id", func(c *gin.Context) {
+		if c.Param("id") == "missing" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test/missing", "/no-such-route"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/metrics-test/:id",status_class="2xx"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/metrics-test/:id",status_class="4xx"} 1`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",status_class="4xx"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/metrics-test/:id",status_class="2xx"} 2`)
+	assert.Contains(t, body, `http_requests_in_flight{method="GET",route="/metrics-test/:id"} 0`)
+	assert.False(t, strings.Contains(body, `route="/metrics-test/1"`), "urls should not be used as labels")
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	stdErrors "errors"
+	"net/http"
+
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+type OpenAPIValidationOpts struct {
+	// ValidateResponses logs the responses that do not match the document, meant for development as the
+	// response bodies are buffered
+	ValidateResponses bool
+}
+
+// OpenAPIValidationMiddleware rejects requests whose params or body do not match their operation in spec with 400,
+// or 415 for an undocumented content type. Routes missing from spec are let through and logged.
+func OpenAPIValidationMiddleware(spec *openapi.Spec, opts *OpenAPIValidationOpts, lgr *logger.AppLogger) gin.HandlerFunc {
+	validateResponses := opts != nil && opts.ValidateResponses
+	return func(c *gin.Context) {
+		l, requestID := lgr.WithReqID(c)
+		route := c.FullPath()
+		if _, ok := spec.Operation(c.Request.Method, route); !ok {
+			l.Warn().Str("method", c.Request.Method).Str("path", route).Msg("route is missing from the openapi document")
+			c.Next()
+			return
+		}
+
+		pathParams := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			pathParams[param.Key] = param.Value
+		}
+		if errs := spec.ValidateRequest(c.Request, route, pathParams); len(errs) > 0 {
+			l.Error().Errs("violations", errs).
+				Str("method", c.Request.Method).
+				Str("path", route).
+				Msg("request does not match the openapi document")
+			apiErr := &external.APIError{
+				HTTPStatusCode: http.StatusBadRequest,
+				ErrorCode:      errors.RequestSchemaViolation,
+				Message:        "request does not match the API specification",
+				DebugID:        requestID,
+				Errors:         violations(errs),
+			}
+			if err := stdErrors.Join(errs...); stdErrors.Is(err, openapi.ErrUnsupportedMediaType) {
+				apiErr.HTTPStatusCode = http.StatusUnsupportedMediaType
+				apiErr.ErrorCode = errors.UnsupportedMediaType
+				apiErr.Message = err.Error()
+			}
+			errors.Abort(c, apiErr)
+			return
+		}
+
+		if !validateResponses {
+			c.Next()
+			return
+		}
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		if errs := spec.ValidateResponse(c.Request.Method, route, recorder.Status(), recorder.Header(),
+			recorder.body.Bytes()); len(errs) > 0 {
+			l.Error().Errs("violations", errs).
+				Str("method", c.Request.Method).
+				Str("path", route).
+				Int("status", recorder.Status()).
+				Msg("response does not match the openapi document")
+		}
+	}
+}
+
+// violations lists the invalid fields of the request.
+func violations(errs []error) []external.FieldError {
+	var fields []external.FieldError
+	for _, err := range errs {
+		var validationErr *openapi.ValidationError
+		if !stdErrors.As(err, &validationErr) {
+			continue
+		}
+		field := external.FieldError{Pointer: validationErr.Name, Reason: validationErr.Reason}
+		if validationErr.In != "body" {
+			field = external.FieldError{Parameter: validationErr.Name, Reason: validationErr.Reason}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
@@ -0,0 +1,103 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/openapi"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openAPIRouter(t *testing.T, opts *middleware.OpenAPIValidationOpts, lgr *logger.AppLogger,
+	handler gin.HandlerFunc) *gin.Engine {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.OpenAPIValidationMiddleware(spec, opts, lgr))
+	r.POST("/ecommerce/v1/orders/:id/transitions", handler)
+	r.GET("/undocumented", handler)
+	return r
+}
+
+func TestOpenAPIValidationMiddleware_Request(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	var received string
+	r := openAPIRouter(t, nil, lgr, func(c *gin.Context) {
+		body, _ := c.GetRawData()
+		received = string(body)
+		c.Status(http.StatusOK)
+	})
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+	}{
+		{name: "valid", target: "/ecommerce/v1/orders/65f1c3a2b4d5e6f708192a3b/transitions",
+			contentType: "application/json", body: `{"status": "OrderCancelled"}`, wantStatus: http.StatusOK},
+		{name: "invalid id", target: "/ecommerce/v1/orders/1/transitions",
+			contentType: "application/json", body: `{"status": "OrderCancelled"}`,
+			wantStatus: http.StatusBadRequest, wantCode: errors.RequestSchemaViolation},
+		{name: "invalid body", target: "/ecommerce/v1/orders/65f1c3a2b4d5e6f708192a3b/transitions",
+			contentType: "application/json", body: `{"status": "Lost"}`,
+			wantStatus: http.StatusBadRequest, wantCode: errors.RequestSchemaViolation},
+		{name: "unsupported media type", target: "/ecommerce/v1/orders/65f1c3a2b4d5e6f708192a3b/transitions",
+			contentType: "text/plain", body: `OrderCancelled`,
+			wantStatus: http.StatusUnsupportedMediaType, wantCode: errors.UnsupportedMediaType},
+		{name: "undocumented route", target: "/undocumented", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			method := http.MethodPost
+			if tt.target == "/undocumented" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatus, resp.Code)
+			if tt.wantCode == "" {
+				assert.Equal(t, tt.body, received, "handler should get the body")
+				return
+			}
+			var apiErr external.APIError
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+			assert.Equal(t, tt.wantCode, apiErr.ErrorCode)
+			assert.Equal(t, tt.wantStatus, apiErr.HTTPStatusCode)
+			assert.NotEmpty(t, apiErr.Message)
+		})
+	}
+}
+
+func TestOpenAPIValidationMiddleware_InvalidResponseIsNotAltered(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	order := gin.H{"orderId": "1"}
+	r := openAPIRouter(t, &middleware.OpenAPIValidationOpts{ValidateResponses: true}, lgr, func(c *gin.Context) {
+		c.JSON(http.StatusOK, order)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/ecommerce/v1/orders/65f1c3a2b4d5e6f708192a3b/transitions",
+		strings.NewReader(`{"status": "OrderCancelled"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code, "invalid responses are only logged")
+	assert.JSONEq(t, `{"orderId": "1"}`, resp.Body.String())
+}
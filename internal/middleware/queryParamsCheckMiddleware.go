@@ -2,13 +2,47 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/errors"
 	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/models/external"
 	"github.com/gin-gonic/gin"
 )
 
-var GetOrderListReqParams = map[string]bool{
+var GetOrderListReqParams = orderListReqParams()
+
+// orderListReqParams whitelists the pagination, sort and filter params of the order list,
+// filter params are derived from db.OrderFilterFields.
+func orderListReqParams() map[string]bool {
+	params := map[string]bool{
+		"limit":        true,
+		"offset":       true,
+		"cursor":       true,
+		"includeTotal": true,
+		"sort":         true,
+	}
+	for param := range db.OrderFilterQueryParams() {
+		params[param] = true
+	}
+	return params
+}
+
+// GetTotalsReportReqParams whitelists the base currency and the filter params of the order totals report.
+var GetTotalsReportReqParams = totalsReportReqParams()
+
+func totalsReportReqParams() map[string]bool {
+	params := map[string]bool{"baseCurrency": true}
+	for param := range db.OrderFilterQueryParams() {
+		params[param] = true
+	}
+	return params
+}
+
+// GetCustomerListReqParams whitelists the email lookup and the pagination params of the customer list.
+var GetCustomerListReqParams = map[string]bool{
+	"email":  true,
 	"limit":  true,
 	"offset": true,
 }
@@ -17,7 +51,27 @@ var AllowedQueryParams = map[string]map[string]bool{
 	http.MethodGet + "/ecommerce/v1/orders":        GetOrderListReqParams,
 	http.MethodPost + "/ecommerce/v1/orders":       nil,
 	http.MethodGet + "/ecommerce/v1/orders/:id":    nil,
+	http.MethodPut + "/ecommerce/v1/orders/:id":    nil,
+	http.MethodPatch + "/ecommerce/v1/orders/:id":  nil,
 	http.MethodDelete + "/ecommerce/v1/orders/:id": nil,
+
+	http.MethodPost + "/ecommerce/v1/orders/:id/transitions": nil,
+
+	http.MethodGet + "/ecommerce/v1/reports/order-totals": GetTotalsReportReqParams,
+
+	http.MethodGet + "/ecommerce/v1/coupons":        nil,
+	http.MethodPost + "/ecommerce/v1/coupons":       nil,
+	http.MethodGet + "/ecommerce/v1/coupons/:id":    nil,
+	http.MethodPut + "/ecommerce/v1/coupons/:id":    nil,
+	http.MethodDelete + "/ecommerce/v1/coupons/:id": nil,
+
+	http.MethodGet + "/ecommerce/v1/customers":        GetCustomerListReqParams,
+	http.MethodPost + "/ecommerce/v1/customers":       nil,
+	http.MethodGet + "/ecommerce/v1/customers/:id":    nil,
+	http.MethodPut + "/ecommerce/v1/customers/:id":    nil,
+	http.MethodDelete + "/ecommerce/v1/customers/:id": nil,
+
+	http.MethodGet + "/ecommerce/v1/customers/:id/orders": GetOrderListReqParams,
 }
 
 func QueryParamsCheckMiddleware(lgr *logger.AppLogger) gin.HandlerFunc {
@@ -32,11 +86,11 @@ func QueryParamsCheckMiddleware(lgr *logger.AppLogger) gin.HandlerFunc {
 				Msg("unspuuorted method or path")
 			apiErr := &external.APIError{
 				HTTPStatusCode: http.StatusNotFound,
-				ErrorCode:      "",
+				ErrorCode:      errors.UnsupportedRoute,
 				Message:        "Unsupported method or path",
 				DebugID:        requestID,
 			}
-			c.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+			errors.Abort(c, apiErr)
 			return
 		}
 
@@ -50,11 +104,11 @@ func QueryParamsCheckMiddleware(lgr *logger.AppLogger) gin.HandlerFunc {
 
 			apiErr := &external.APIError{
 				HTTPStatusCode: http.StatusBadRequest,
-				ErrorCode:      "",
+				ErrorCode:      unsupportedQueryParamCode(c.Request, allowedQueryParams),
 				Message:        "invalid query params",
 				DebugID:        requestID,
 			}
-			c.AbortWithStatusJSON(apiErr.HTTPStatusCode, apiErr)
+			errors.Abort(c, apiErr)
 			return
 		}
 		c.Next()
@@ -63,6 +117,27 @@ func QueryParamsCheckMiddleware(lgr *logger.AppLogger) gin.HandlerFunc {
 
 }
 
+// unsupportedQueryParamCode tells apart an unknown operator on a known field, e.g. createdAt[ne],
+// from an unknown query param.
+func unsupportedQueryParamCode(req *http.Request, supportedParams map[string]bool) string {
+	for param := range req.URL.Query() {
+		if supportedParams[param] {
+			continue
+		}
+		field, _ := db.ParseFilterParam(param)
+		if field == param {
+			return errors.UnsupportedQueryParam
+		}
+		for supported := range supportedParams {
+			if supported == field || strings.HasPrefix(supported, field+"[") {
+				return errors.UnsupportedQueryOperator
+			}
+		}
+		return errors.UnsupportedQueryParam
+	}
+	return errors.UnsupportedQueryParam
+}
+
 func HasUnSupportedQueryParams(req *http.Request, supportedParams map[string]bool) bool {
 	queryParams := req.URL.Query()
 	for param := range queryParams {
@@ -1,14 +1,17 @@
 package middleware_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
 
+	"github.com/derickit/go-rest-api/internal/errors"
 	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/middleware"
 	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/external"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -119,3 +122,39 @@ func TestHasUnSupportedQueryParams(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryParamsCheckMiddleware_FilterParams(t *testing.T) {
+	testCases := []struct {
+		description  string
+		rawQuery     string
+		expectedCode int
+		errorCode    string
+	}{
+		{"filter and sort params are allowed", "status[in]=OrderPending&totalAmount[gte]=10&sort=-createdAt", http.StatusOK, ""},
+		{"unknown filter field", "colour=red", http.StatusBadRequest, errors.UnsupportedQueryParam},
+		{"unknown operator on a known field", "createdAt[ne]=2024-01-01T00:00:00Z", http.StatusBadRequest, errors.UnsupportedQueryOperator},
+		{"unknown operator on an unknown field", "colour[eq]=red", http.StatusBadRequest, errors.UnsupportedQueryParam},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+			resp := httptest.NewRecorder()
+			gin.SetMode(gin.TestMode)
+			_, r := gin.CreateTestContext(resp)
+			r.Use(middleware.QueryParamsCheckMiddleware(lgr))
+			r.GET("/ecommerce/v1/orders", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"message": "success"})
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/ecommerce/v1/orders?"+tc.rawQuery, nil)
+			r.ServeHTTP(resp, req)
+
+			assert.Equal(t, tc.expectedCode, resp.Code)
+			if tc.errorCode != "" {
+				var apiErr external.APIError
+				assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+				assert.Equal(t, tc.errorCode, apiErr.ErrorCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
+
+	DefReadRequestsPerMinute  = 300
+	DefWriteRequestsPerMinute = 60
+)
+
+type RateLimitBudget string
+
+const (
+	ReadBudget  RateLimitBudget = "read"
+	WriteBudget RateLimitBudget = "write"
+)
+
+// RouteRateLimit is the budget a route draws from and the error code returned when it is exhausted.
+type RouteRateLimit struct {
+	Budget    RateLimitBudget
+	ErrorCode string
+}
+
+// RouteRateLimits is keyed like AllowedQueryParams by method and route path, routes without an entry are not limited.
+var RouteRateLimits = map[string]RouteRateLimit{
+	http.MethodGet + "/ecommerce/v1/orders":        {Budget: ReadBudget, ErrorCode: errors.OrderGetRateLimitExceeded},
+	http.MethodPost + "/ecommerce/v1/orders":       {Budget: WriteBudget, ErrorCode: errors.OrderCreateRateLimitExceeded},
+	http.MethodGet + "/ecommerce/v1/orders/:id":    {Budget: ReadBudget, ErrorCode: errors.OrderGetRateLimitExceeded},
+	http.MethodPut + "/ecommerce/v1/orders/:id":    {Budget: WriteBudget, ErrorCode: errors.OrderUpdateRateLimitExceeded},
+	http.MethodPatch + "/ecommerce/v1/orders/:id":  {Budget: WriteBudget, ErrorCode: errors.OrderUpdateRateLimitExceeded},
+	http.MethodDelete + "/ecommerce/v1/orders/:id": {Budget: WriteBudget, ErrorCode: errors.OrderDeleteRateLimitExceeded},
+
+	http.MethodPost + "/ecommerce/v1/orders/:id/transitions": {Budget: WriteBudget, ErrorCode: errors.OrderUpdateRateLimitExceeded},
+
+	http.MethodGet + "/ecommerce/v1/reports/order-totals": {Budget: ReadBudget, ErrorCode: errors.OrderGetRateLimitExceeded},
+
+	http.MethodGet + "/ecommerce/v1/coupons":        {Budget: ReadBudget, ErrorCode: errors.CouponGetRateLimitExceeded},
+	http.MethodPost + "/ecommerce/v1/coupons":       {Budget: WriteBudget, ErrorCode: errors.CouponCreateRateLimitExceeded},
+	http.MethodGet + "/ecommerce/v1/coupons/:id":    {Budget: ReadBudget, ErrorCode: errors.CouponGetRateLimitExceeded},
+	http.MethodPut + "/ecommerce/v1/coupons/:id":    {Budget: WriteBudget, ErrorCode: errors.CouponUpdateRateLimitExceeded},
+	http.MethodDelete + "/ecommerce/v1/coupons/:id": {Budget: WriteBudget, ErrorCode: errors.CouponDeleteRateLimitExceeded},
+
+	http.MethodGet + "/ecommerce/v1/customers":            {Budget: ReadBudget, ErrorCode: errors.CustomerGetRateLimitExceeded},
+	http.MethodPost + "/ecommerce/v1/customers":           {Budget: WriteBudget, ErrorCode: errors.CustomerCreateRateLimitExceeded},
+	http.MethodGet + "/ecommerce/v1/customers/:id":        {Budget: ReadBudget, ErrorCode: errors.CustomerGetRateLimitExceeded},
+	http.MethodPut + "/ecommerce/v1/customers/:id":        {Budget: WriteBudget, ErrorCode: errors.CustomerUpdateRateLimitExceeded},
+	http.MethodDelete + "/ecommerce/v1/customers/:id":     {Budget: WriteBudget, ErrorCode: errors.CustomerDeleteRateLimitExceeded},
+	http.MethodGet + "/ecommerce/v1/customers/:id/orders": {Budget: ReadBudget, ErrorCode: errors.CustomerGetRateLimitExceeded},
+}
+
+type RateLimitOpts struct {
+	Read  ratelimit.Limit
+	Write ratelimit.Limit
+	// Verifier authenticates the bearer token to key the budget by principal, the middleware runs before
+	// AuthMiddleware so that unauthenticated requests are limited as well
+	Verifier auth.TokenVerifier
+}
+
+func FillRateLimitOpts(opts *RateLimitOpts) *RateLimitOpts {
+	if opts == nil {
+		opts = &RateLimitOpts{}
+	}
+	if opts.Read.Burst == 0 {
+		opts.Read = ratelimit.PerMinute(DefReadRequestsPerMinute)
+	}
+	if opts.Write.Burst == 0 {
+		opts.Write = ratelimit.PerMinute(DefWriteRequestsPerMinute)
+	}
+	return opts
+}
+
+// RateLimitMiddleware limits the requests of every caller, identified by principal, API key or client IP,
+// with separate budgets for reads and writes. The remaining budget is reported with the RateLimit-* headers,
+// requests over budget are rejected with 429 and Retry-After. When the limiter fails requests are let through.
+// It is registered before AuthMiddleware: the principal of a valid bearer token is stored in the context so that the
+// token is not verified twice, requests without valid token are limited by API key or client IP and left to
+// AuthMiddleware to reject.
+func RateLimitMiddleware(limiter ratelimit.Limiter, opts *RateLimitOpts, lgr *logger.AppLogger) gin.HandlerFunc {
+	opts = FillRateLimitOpts(opts)
+	return func(c *gin.Context) {
+		route, ok := RouteRateLimits[c.Request.Method+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		limit := opts.Read
+		if route.Budget == WriteBudget {
+			limit = opts.Write
+		}
+		l, requestID := lgr.WithReqID(c)
+		result, err := limiter.Allow(c, rateLimitKey(c, opts.Verifier)+"|"+string(route.Budget), limit)
+		if err != nil {
+			l.Error().Err(err).Msg("rate limiter is unavailable, request is not limited")
+			c.Next()
+			return
+		}
+
+		c.Header(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+		c.Header(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		c.Header(RateLimitResetHeader, ceilSeconds(result.ResetAfter))
+		if !result.Allowed {
+			c.Header(RetryAfterHeader, ceilSeconds(result.RetryAfter))
+			apiErr := &external.APIError{
+				HTTPStatusCode: http.StatusTooManyRequests,
+				ErrorCode:      route.ErrorCode,
+				Message:        "Too many requests, retry later",
+				DebugID:        requestID,
+			}
+			l.Error().Int("HttpStatusCode", apiErr.HTTPStatusCode).Str("ErrorCode", apiErr.ErrorCode).Msg(apiErr.Message)
+			errors.Abort(c, apiErr)
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey identifies the caller by its verified principal, the other callers by client IP as anything else they
+// send could change on every request. With auth.DisabledVerifier every request runs as the same principal, callers
+// are told apart by client IP.
+func rateLimitKey(c *gin.Context, verifier auth.TokenVerifier) string {
+	if principal, ok := auth.PrincipalFrom(c); ok {
+		return "principal:" + principal.Subject
+	}
+	if _, disabled := verifier.(auth.DisabledVerifier); verifier != nil && !disabled {
+		if principal, err := authenticate(c, verifier); err == nil {
+			auth.SetPrincipal(c, principal)
+			return "principal:" + principal.Subject
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
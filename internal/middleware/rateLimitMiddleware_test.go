@@ -0,0 +1,166 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/auth"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/middleware"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimitedRouter(limiter ratelimit.Limiter, principal *auth.Principal) *gin.Engine {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	if principal != nil {
+		r.Use(func(c *gin.Context) { auth.SetPrincipal(c, principal) })
+	}
+	r.Use(middleware.RateLimitMiddleware(limiter, &middleware.RateLimitOpts{
+		Read:  ratelimit.PerMinute(2),
+		Write: ratelimit.PerMinute(1),
+	}, lgr))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/ecommerce/v1/orders", ok)
+	r.POST("/ecommerce/v1/orders", ok)
+	r.DELETE("/ecommerce/v1/orders/:id", ok)
+	return r
+}
+
+func serve(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	r.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRateLimitMiddleware_Budgets(t *testing.T) {
+	r := rateLimitedRouter(ratelimit.NewMemoryLimiter(nil), &auth.Principal{Subject: "user-1"})
+
+	first := serve(r, http.MethodGet, "/ecommerce/v1/orders")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "2", first.Header().Get(middleware.RateLimitLimitHeader))
+	assert.Equal(t, "1", first.Header().Get(middleware.RateLimitRemainingHeader))
+	assert.Equal(t, "30", first.Header().Get(middleware.RateLimitResetHeader))
+	assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/ecommerce/v1/orders").Code)
+
+	limited := serve(r, http.MethodGet, "/ecommerce/v1/orders")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "0", limited.Header().Get(middleware.RateLimitRemainingHeader))
+	assert.Equal(t, "30", limited.Header().Get(middleware.RetryAfterHeader))
+	var apiErr external.APIError
+	require.NoError(t, json.Unmarshal(limited.Body.Bytes(), &apiErr))
+	assert.Equal(t, errors.OrderGetRateLimitExceeded, apiErr.ErrorCode)
+
+	assert.Equal(t, http.StatusOK, serve(r, http.MethodPost, "/ecommerce/v1/orders").Code, "writes have their own budget")
+	limited = serve(r, http.MethodDelete, "/ecommerce/v1/orders/1")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	require.NoError(t, json.Unmarshal(limited.Body.Bytes(), &apiErr))
+	assert.Equal(t, errors.OrderDeleteRateLimitExceeded, apiErr.ErrorCode)
+}
+
+func TestRateLimitMiddleware_Keys(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter(nil)
+	user1 := rateLimitedRouter(limiter, &auth.Principal{Subject: "user-1"})
+	user2 := rateLimitedRouter(limiter, &auth.Principal{Subject: "user-2"})
+	assert.Equal(t, http.StatusOK, serve(user1, http.MethodPost, "/ecommerce/v1/orders").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(user1, http.MethodPost, "/ecommerce/v1/orders").Code)
+	assert.Equal(t, http.StatusOK, serve(user2, http.MethodPost, "/ecommerce/v1/orders").Code)
+
+	anonymous := rateLimitedRouter(limiter, nil)
+	withKey := func(key string) int {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-API-Key", key)
+		anonymous.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	assert.Equal(t, http.StatusOK, withKey("key-1"))
+	assert.Equal(t, http.StatusTooManyRequests, withKey("key-2"),
+		"unverified credentials should not get their own budget")
+	assert.Equal(t, http.StatusOK, serve(anonymous, http.MethodPost, "/ecommerce/v1/orders").Code,
+		"other clients should have their own budget")
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(_ context.Context, _ string, _ ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, stdErrors.New("store is down")
+}
+
+func TestRateLimitMiddleware_LimiterFailureLetsRequestsThrough(t *testing.T) {
+	r := rateLimitedRouter(failingLimiter{}, nil)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(r, http.MethodPost, "/ecommerce/v1/orders").Code)
+	}
+}
+
+func TestRouteRateLimits_CoverAllowedQueryParams(t *testing.T) {
+	for route := range middleware.AllowedQueryParams {
+		_, ok := middleware.RouteRateLimits[route]
+		assert.True(t, ok, "route %s has no rate limit", route)
+	}
+}
+
+// authenticatedRouter registers the rate limiter before AuthMiddleware like the server does.
+func authenticatedRouter(limiter ratelimit.Limiter, verifier auth.TokenVerifier) *gin.Engine {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	gin.SetMode(gin.TestMode)
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.Use(middleware.RateLimitMiddleware(limiter, &middleware.RateLimitOpts{
+		Read:     ratelimit.PerMinute(2),
+		Write:    ratelimit.PerMinute(1),
+		Verifier: verifier,
+	}, lgr))
+	r.Use(middleware.AuthMiddleware(verifier, lgr))
+	r.POST("/ecommerce/v1/orders", func(c *gin.Context) {
+		principal, _ := auth.PrincipalFrom(c)
+		c.String(http.StatusOK, principal.Subject)
+	})
+	return r
+}
+
+func serveFrom(r *gin.Engine, remoteAddr, token string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/ecommerce/v1/orders", nil)
+	req.RemoteAddr = remoteAddr
+	if token != "" {
+		req.Header.Set(middleware.AuthorizationHeader, "Bearer "+token)
+	}
+	r.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRateLimitMiddleware_BeforeAuth(t *testing.T) {
+	r := authenticatedRouter(ratelimit.NewMemoryLimiter(nil), stubVerifier{principal: &auth.Principal{Subject: "user-1"}})
+	ok := serveFrom(r, "10.0.0.1:1234", "token")
+	assert.Equal(t, http.StatusOK, ok.Code)
+	assert.Equal(t, "user-1", ok.Body.String(), "the principal authenticated by the limiter should be kept")
+	assert.Equal(t, http.StatusTooManyRequests, serveFrom(r, "10.0.0.2:1234", "token").Code,
+		"the budget of a principal should not depend on the client ip")
+
+	r = authenticatedRouter(ratelimit.NewMemoryLimiter(nil), stubVerifier{err: auth.ErrInvalidToken})
+	assert.Equal(t, http.StatusUnauthorized, serveFrom(r, "10.0.0.1:1234", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveFrom(r, "10.0.0.1:1234", "bad").Code,
+		"unauthenticated requests should be limited by client ip")
+	assert.Equal(t, http.StatusUnauthorized, serveFrom(r, "10.0.0.2:1234", "").Code)
+}
+
+func TestRateLimitMiddleware_DisabledAuthKeysByClientIP(t *testing.T) {
+	r := authenticatedRouter(ratelimit.NewMemoryLimiter(nil), auth.DisabledVerifier{})
+	assert.Equal(t, http.StatusOK, serveFrom(r, "10.0.0.1:1234", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveFrom(r, "10.0.0.1:1234", "").Code)
+	assert.Equal(t, http.StatusOK, serveFrom(r, "10.0.0.2:1234", "").Code, "callers should not share one bucket")
+}
@@ -2,12 +2,26 @@ package middleware
 
 import "github.com/gin-gonic/gin"
 
-func ResponseHeadersMiddleware() gin.HandlerFunc {
+// DefSecurityHeaders are the headers set on every response when none are configured.
+var DefSecurityHeaders = map[string]string{
+	"Content-Security-Policy":   "default-src 'self'",
+	"X-Frame-Options":           "SAMEORIGIN",
+	"X-XSS-Protection":          "1; mode=block",
+	"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+}
+
+// ResponseHeadersMiddleware sets headers on every response, DefSecurityHeaders when headers is nil.
+// Headers with an empty value are not set.
+func ResponseHeadersMiddleware(headers map[string]string) gin.HandlerFunc {
+	if headers == nil {
+		headers = DefSecurityHeaders
+	}
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Content-Security-Policy", "default-src 'self'")
-		c.Writer.Header().Set("X-Frame-Options", "SAMEORIGIN")
-		c.Writer.Header().Set("X-XSS-Protection", "1; mode=block")
-		c.Writer.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		for name, value := range headers {
+			if value != "" {
+				c.Writer.Header().Set(name, value)
+			}
+		}
 		c.Next()
 
 	}
@@ -12,7 +12,7 @@ import (
 
 func TestResponseHeadersMiddleware(t *testing.T) {
 	router := gin.New()
-	router.Use(middleware.ResponseHeadersMiddleware())
+	router.Use(middleware.ResponseHeadersMiddleware(nil))
 
 	router.GET("/test", func(c *gin.Context) {
 		c.String(http.StatusOK, "Test")
@@ -30,7 +30,7 @@ func TestResponseHeadersMiddleware(t *testing.T) {
 
 func TestResponseHeadersMiddleware_CustomHeaders(t *testing.T) {
 	router := gin.New()
-	router.Use(middleware.ResponseHeadersMiddleware())
+	router.Use(middleware.ResponseHeadersMiddleware(nil))
 
 	router.GET("/test", func(c *gin.Context) {
 		c.Writer.Header().Set("Custom-Header", "Custom-Value")
@@ -51,7 +51,7 @@ func TestResponseHeadersMiddleware_CustomHeaders(t *testing.T) {
 
 func TestRespOnseHeadersMiddleware_NoCache(t *testing.T) {
 	router := gin.New()
-	router.Use(middleware.ResponseHeadersMiddleware())
+	router.Use(middleware.ResponseHeadersMiddleware(nil))
 
 	router.GET("/test", func(c *gin.Context) {
 		c.Writer.Header().Set("Cache-Control", "no-cache")
@@ -69,7 +69,7 @@ func TestRespOnseHeadersMiddleware_NoCache(t *testing.T) {
 
 func TestResponseHeadersMiddleware_NoHeadersSet(t *testing.T) {
 	router := gin.New()
-	router.Use(middleware.ResponseHeadersMiddleware())
+	router.Use(middleware.ResponseHeadersMiddleware(nil))
 
 	router.GET("/test", func(c *gin.Context) {
 		c.String(http.StatusOK, "Test")
@@ -81,3 +81,23 @@ func TestResponseHeadersMiddleware_NoHeadersSet(t *testing.T) {
 
 	assert.Empty(t, resp.Header().Get("Custom-Header"), "Custom-Header should not be set")
 }
+
+func TestResponseHeadersMiddleware_ConfiguredHeaders(t *testing.T) {
+	router := gin.New()
+	router.Use(middleware.ResponseHeadersMiddleware(map[string]string{
+		"X-Frame-Options":         "DENY",
+		"Content-Security-Policy": "",
+	}))
+
+	router.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, "Test")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, "DENY", resp.Header().Get("X-Frame-Options"))
+	assert.Empty(t, resp.Header().Values("Content-Security-Policy"))
+	assert.Empty(t, resp.Header().Get("Strict-Transport-Security"), "only configured headers should be set")
+}
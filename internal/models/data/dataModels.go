@@ -3,6 +3,7 @@ package data
 import (
 	"time"
 
+	"github.com/derickit/go-rest-api/internal/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -16,6 +17,39 @@ const (
 	OrderDelivered  OrderStatus = "OrderDelivered"
 )
 
+// IsValid reports whether s is one of the known order statuses.
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderPending, OrderProcessing, OrderCompleted, OrderCancelled, OrderDelivered:
+		return true
+	}
+	return false
+}
+
+// orderStatusTransitions lists the statuses an order may move to from a given status,
+// an order can only be cancelled before it is delivered and Completed and Cancelled are final.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:    {OrderProcessing, OrderCancelled},
+	OrderProcessing: {OrderDelivered, OrderCancelled},
+	OrderDelivered:  {OrderCompleted},
+}
+
+// CanTransitionTo reports whether an order in status s may move to the target status.
+func (s OrderStatus) CanTransitionTo(target OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductsCanChange reports whether the products of an order in status s may still change, they are fixed once the
+// order is delivered, completed or cancelled.
+func (s OrderStatus) ProductsCanChange() bool {
+	return s == OrderPending || s == OrderProcessing
+}
+
 type Order struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"orderId"`
 	Version     int64              `json:"version" bson:"version"`
@@ -23,22 +57,220 @@ type Order struct {
 	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
 	Products    []Product          `json:"products" bson:"products"`
 	User        string             `json:"user" bson:"user"`
-	TotalAmount float64            `json:"totalAmount" bson:"totalAmount"`
+	Currency    money.Currency     `json:"currency" bson:"currency"`
+	TotalAmount money.Amount       `json:"totalAmount" bson:"totalAmount"`
 	Status      OrderStatus        `json:"status" bson:"status"`
 	Updates     []OrderUpdate      `json:"updates" bson:"updates"`
+	// ExchangeRate is missing on the orders created before orders recorded one
+	ExchangeRate *ExchangeRate `json:"exchangeRate,omitempty" bson:"exchangeRate,omitempty"`
+	// ShippingAddress is where the order ships to, the taxes of the order depend on it
+	ShippingAddress *Address `json:"shippingAddress,omitempty" bson:"shippingAddress,omitempty"`
+	BillingAddress  *Address `json:"billingAddress,omitempty" bson:"billingAddress,omitempty"`
+	// CustomerID is the customer who placed the order, the addresses of the order are copies of the addresses
+	// of the customer at the time, they don't change when the customer edits them
+	CustomerID string `json:"customerId,omitempty" bson:"customerId,omitempty"`
+	// Pricing explains TotalAmount, it is missing on the orders created before orders were priced by rules
+	Pricing *PriceBreakdown `json:"pricing,omitempty" bson:"pricing,omitempty"`
+	// Coupon is the coupon redeemed by the order
+	Coupon *AppliedCoupon `json:"coupon,omitempty" bson:"coupon,omitempty"`
+}
+
+// Address is a postal address, the country and region of the shipping address are the tax jurisdictions of an
+// order. The addresses of the orders created before customers had addresses only have a country and region.
+type Address struct {
+	Country    string `json:"country" bson:"country"`                   // ISO 3166-1 alpha-2 code, e.g. US
+	Region     string `json:"region,omitempty" bson:"region,omitempty"` // ISO 3166-2 subdivision code without the country, e.g. CA
+	Name       string `json:"name,omitempty" bson:"name,omitempty"`
+	Line1      string `json:"line1,omitempty" bson:"line1,omitempty"`
+	Line2      string `json:"line2,omitempty" bson:"line2,omitempty"`
+	City       string `json:"city,omitempty" bson:"city,omitempty"`
+	PostalCode string `json:"postalCode,omitempty" bson:"postalCode,omitempty"`
+}
+
+type AddressType string
+
+const (
+	ShippingAddressType AddressType = "shipping"
+	BillingAddressType  AddressType = "billing"
+)
+
+// Customer is the profile of someone placing orders. Emails are stored lower case and are unique among the customers
+// of a User, the principal who created the customer. Only they and the admins can access the customer and order for
+// it.
+type Customer struct {
+	ID        primitive.ObjectID `json:"customerId" bson:"_id,omitempty"`
+	User      string             `json:"user" bson:"user"`
+	Name      string             `json:"name" bson:"name"`
+	Email     string             `json:"email" bson:"email"`
+	Phone     string             `json:"phone,omitempty" bson:"phone,omitempty"` // E.164, e.g. +14155552671
+	Addresses []CustomerAddress  `json:"addresses" bson:"addresses"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CustomerAddress is an address saved by a customer, the Default address of each type is used by the orders
+// that don't say which address to use. The ids of the addresses don't change when the customer is updated.
+type CustomerAddress struct {
+	ID      primitive.ObjectID `json:"addressId" bson:"_id"`
+	Type    AddressType        `json:"type" bson:"type"`
+	Default bool               `json:"default" bson:"default"`
+	Address `bson:",inline"`
+}
+
+// AddressOf returns the address of the given type with the id, or the default address of the type when id is
+// zero. It returns nil when there is no such address.
+func (c *Customer) AddressOf(addrType AddressType, id primitive.ObjectID) *Address {
+	for i := range c.Addresses {
+		addr := &c.Addresses[i]
+		if addr.Type != addrType {
+			continue
+		}
+		if (id.IsZero() && addr.Default) || (!id.IsZero() && addr.ID == id) {
+			snapshot := addr.Address
+			return &snapshot
+		}
+	}
+	return nil
+}
+
+type AdjustmentKind string
+
+const (
+	LineDiscount  AdjustmentKind = "lineDiscount"
+	OrderDiscount AdjustmentKind = "orderDiscount"
+	ShippingFee   AdjustmentKind = "shipping"
+	Tax           AdjustmentKind = "tax"
+)
+
+// PriceBreakdown is how the pricing rules got to the total of an order. Discounts are negative amounts, the total is
+// the sum of the subtotal, the discounts, the shipping fees and the taxes.
+type PriceBreakdown struct {
+	Subtotal       money.Amount      `json:"subtotal" bson:"subtotal"`
+	LineDiscounts  money.Amount      `json:"lineDiscounts" bson:"lineDiscounts"`
+	OrderDiscounts money.Amount      `json:"orderDiscounts" bson:"orderDiscounts"`
+	Shipping       money.Amount      `json:"shipping" bson:"shipping"`
+	Tax            money.Amount      `json:"tax" bson:"tax"`
+	Total          money.Amount      `json:"total" bson:"total"`
+	Adjustments    []PriceAdjustment `json:"adjustments" bson:"adjustments"`
+}
+
+// PriceAdjustment is the change a pricing rule made to the price of an order, in the order the rules ran.
+type PriceAdjustment struct {
+	Rule        string         `json:"rule" bson:"rule"`
+	Kind        AdjustmentKind `json:"kind" bson:"kind"`
+	Line        *int           `json:"line,omitempty" bson:"line,omitempty"` // index of the product a line discount applies to
+	Description string         `json:"description" bson:"description"`
+	Amount      money.Amount   `json:"amount" bson:"amount"`
+}
+
+// ExchangeRate is the rate from the currency of an order to the base currency of the reports taken when the order
+// was created, so that the totals reported for past orders don't change with the rates.
+type ExchangeRate struct {
+	BaseCurrency    money.Currency `json:"baseCurrency" bson:"baseCurrency"`
+	Rate            money.Amount   `json:"rate" bson:"rate"`
+	AsOf            time.Time      `json:"asOf" bson:"asOf"`
+	BaseTotalAmount money.Amount   `json:"baseTotalAmount" bson:"baseTotalAmount"`
+}
+
+// Convert returns the amount of the order currency in the base currency at the recorded rate.
+func (r *ExchangeRate) Convert(a money.Amount) money.Amount {
+	return r.BaseCurrency.Round(a.Mul(r.Rate))
+}
+
+type DiscountType string
+
+const (
+	PercentageDiscount DiscountType = "percentage"
+	FixedDiscount      DiscountType = "fixed"
+)
+
+// CouponTerms are the discount of a coupon, percentage coupons take Percent off and fixed coupons take Amount off
+// the orders spending at least MinSpend. Amount and MinSpend are in Currency.
+type CouponTerms struct {
+	Type     DiscountType   `json:"type" bson:"type"`
+	Percent  *money.Amount  `json:"percent,omitempty" bson:"percent,omitempty"`
+	Amount   *money.Amount  `json:"amount,omitempty" bson:"amount,omitempty"`
+	Currency money.Currency `json:"currency,omitempty" bson:"currency,omitempty"`
+	MinSpend *money.Amount  `json:"minSpend,omitempty" bson:"minSpend,omitempty"`
+}
+
+// Coupon is a promotion code orders can redeem between ValidFrom and ValidUntil, a limit of 0 is no limit.
+// The redemptions are stored apart from the coupon, see CouponRedemption.
+type Coupon struct {
+	ID           primitive.ObjectID `json:"couponId" bson:"_id,omitempty"`
+	Code         string             `json:"code" bson:"code"`
+	Description  string             `json:"description" bson:"description"`
+	CouponTerms  `bson:",inline"`
+	ValidFrom    *time.Time `json:"validFrom,omitempty" bson:"validFrom,omitempty"`
+	ValidUntil   *time.Time `json:"validUntil,omitempty" bson:"validUntil,omitempty"`
+	UsageLimit   int64      `json:"usageLimit" bson:"usageLimit"`
+	PerUserLimit int64      `json:"perUserLimit" bson:"perUserLimit"`
+	UsageCount   int64      `json:"usageCount" bson:"usageCount"` // redemptions held by orders
+	CreatedAt    time.Time  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt" bson:"updatedAt"`
+}
+
+// ActiveAt reports whether t is within the validity window of the coupon, ValidUntil is excluded.
+func (c *Coupon) ActiveAt(t time.Time) bool {
+	return (c.ValidFrom == nil || !t.Before(*c.ValidFrom)) && (c.ValidUntil == nil || t.Before(*c.ValidUntil))
+}
+
+// CouponRedemption is a redemption held by an order, the order keeps its ID as AppliedCoupon.RedemptionID.
+type CouponRedemption struct {
+	ID         primitive.ObjectID `json:"redemptionId" bson:"_id"`
+	CouponID   primitive.ObjectID `json:"couponId" bson:"couponId"`
+	User       string             `json:"user" bson:"user"`
+	RedeemedAt time.Time          `json:"redeemedAt" bson:"redeemedAt"`
+}
+
+// AppliedCoupon is the coupon an order redeemed with the terms it had then, later changes of the coupon don't
+// change the price of the order. ReleasedAt is set when the order was cancelled and gave the redemption back.
+type AppliedCoupon struct {
+	CouponID     primitive.ObjectID `json:"couponId" bson:"couponId"`
+	Code         string             `json:"code" bson:"code"`
+	RedemptionID primitive.ObjectID `json:"redemptionId" bson:"redemptionId"`
+	CouponTerms  `bson:",inline"`
+	ReleasedAt   *time.Time `json:"releasedAt,omitempty" bson:"releasedAt,omitempty"`
 }
 
 type Product struct {
-	Name     string    `json:"name" bson:"name"`
-	UpdateAt time.Time `json:"updateAt" bson:"updateAt"`
-	Price    float64   `json:"price" bson:"price"`
-	Status   string    `json:"status" bson:"status"`
-	Remarks  string    `json:"remarks" bson:"remarks"`
-	Quantity uint64    `json:"quantity"`
+	Name     string       `json:"name" bson:"name"`
+	UpdateAt time.Time    `json:"updateAt" bson:"updateAt"`
+	Price    money.Amount `json:"price" bson:"price"`
+	Status   string       `json:"status" bson:"status"`
+	Remarks  string       `json:"remarks" bson:"remarks"`
+	Quantity uint64       `json:"quantity"`
 }
 
 type OrderUpdate struct {
-	UpdateAt time.Time `json:"updateAt" bson:"updateAt"`
-	Notes    string    `json:"notes" bson:"notes"`
-	HandleBy string    `json:"handleBy" bson:"handleBy"`
+	UpdateAt   time.Time   `json:"updateAt" bson:"updateAt"`
+	Notes      string      `json:"notes" bson:"notes"`
+	HandleBy   string      `json:"handleBy" bson:"handleBy"`
+	FromStatus OrderStatus `json:"fromStatus,omitempty" bson:"fromStatus,omitempty"`
+	ToStatus   OrderStatus `json:"toStatus,omitempty" bson:"toStatus,omitempty"`
+}
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyInFlight  IdempotencyStatus = "InFlight"
+	IdempotencyCompleted IdempotencyStatus = "Completed"
+)
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key header, the stored response is
+// replayed for retries of the same request until ExpiresAt.
+type IdempotencyRecord struct {
+	Key         string               `json:"key" bson:"_id"`
+	RequestHash string               `json:"requestHash" bson:"requestHash"`
+	Status      IdempotencyStatus    `json:"status" bson:"status"`
+	Response    *IdempotencyResponse `json:"response,omitempty" bson:"response,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt" bson:"createdAt"`
+	LockedUntil time.Time            `json:"lockedUntil" bson:"lockedUntil"`
+	ExpiresAt   time.Time            `json:"expiresAt" bson:"expiresAt"`
+}
+
+type IdempotencyResponse struct {
+	StatusCode int               `json:"statusCode" bson:"statusCode"`
+	Headers    map[string]string `json:"headers" bson:"headers"`
+	Body       []byte            `json:"body" bson:"body"`
 }
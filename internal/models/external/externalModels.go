@@ -1,22 +1,89 @@
 package external
 
-import "github.com/derickit/go-rest-api/internal/models/data"
+import (
+	"time"
 
-type APIError struct {
-	HTTPStatusCode int    `json:"httpStatusCode"`
-	Message        string `json:"message"`
-	DebugID        string `json:"debugId"`
-	ErrorCode      string `json:"errorCode"`
-}
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+)
+
+// APIError is the RFC 7807 problem details document, see errors.APIError.
+type APIError = errors.APIError
 
+// FieldError is the problem of a single field of an invalid request, see errors.FieldError.
+type FieldError = errors.FieldError
+
+// OrderInput creates an order, prices are in the currency of the order, money.DefaultCurrency when it is empty.
 type OrderInput struct {
-	Products []ProductInput `json:"products" binding:"required"`
+	Products []ProductInput `json:"products" binding:"required,min=1,dive"`
+	Currency money.Currency `json:"currency,omitempty" binding:"omitempty,currency"`
+	// ShippingAddress decides the shipping fees and taxes of the order, orders without one aren't taxed
+	ShippingAddress *AddressInput `json:"shippingAddress,omitempty"`
+	BillingAddress  *AddressInput `json:"billingAddress,omitempty"`
+	// CouponCode is redeemed by the order, its discount applies after the order discounts
+	CouponCode string `json:"couponCode,omitempty" binding:"omitempty,couponcode"`
+	// CustomerID places the order for a customer, the addresses of the customer with ShippingAddressID and
+	// BillingAddressID, or its default addresses, are used when the order has no address of that type
+	CustomerID        string `json:"customerId,omitempty" binding:"omitempty,mongodb"`
+	ShippingAddressID string `json:"shippingAddressId,omitempty" binding:"omitempty,mongodb"`
+	BillingAddressID  string `json:"billingAddressId,omitempty" binding:"omitempty,mongodb"`
+}
+
+// AddressInput is an address given with an order, only the country is required as it is all the taxes need.
+type AddressInput struct {
+	Country    string `json:"country" binding:"required,iso3166_1_alpha2"`
+	Region     string `json:"region,omitempty" binding:"omitempty,region"`
+	Name       string `json:"name,omitempty" binding:"max=100"`
+	Line1      string `json:"line1,omitempty" binding:"max=200"`
+	Line2      string `json:"line2,omitempty" binding:"max=200"`
+	City       string `json:"city,omitempty" binding:"max=100"`
+	PostalCode string `json:"postalCode,omitempty" binding:"omitempty,max=20,postcode_iso3166_alpha2_field=Country"`
+}
+
+// CustomerInput creates or replaces a customer, a customer has at most one default address of each type.
+type CustomerInput struct {
+	Name      string                 `json:"name" binding:"required,notblank,max=100"`
+	Email     string                 `json:"email" binding:"required,email,max=254"`
+	Phone     string                 `json:"phone,omitempty" binding:"omitempty,e164"`
+	Addresses []CustomerAddressInput `json:"addresses,omitempty" binding:"max=20,dive"`
+}
+
+// CustomerAddressInput is a saved address of a customer. Updates keep the id of the addresses they list with their
+// addressId, the addresses listed without one are new.
+type CustomerAddressInput struct {
+	ID         string           `json:"addressId,omitempty" binding:"omitempty,mongodb"`
+	Type       data.AddressType `json:"type" binding:"required,oneof=shipping billing"`
+	Default    bool             `json:"default"`
+	Country    string           `json:"country" binding:"required,iso3166_1_alpha2"`
+	Region     string           `json:"region,omitempty" binding:"omitempty,region"`
+	Name       string           `json:"name" binding:"required,notblank,max=100"`
+	Line1      string           `json:"line1" binding:"required,notblank,max=200"`
+	Line2      string           `json:"line2,omitempty" binding:"max=200"`
+	City       string           `json:"city" binding:"required,notblank,max=100"`
+	PostalCode string           `json:"postalCode,omitempty" binding:"omitempty,max=20,postcode_iso3166_alpha2_field=Country"`
+}
+
+// OrderUpdateInput is the replaceable part of an order, used by PUT and as the target document of a PATCH.
+type OrderUpdateInput struct {
+	Products []ProductInput   `json:"products" binding:"required,min=1,dive"`
+	Status   data.OrderStatus `json:"status" binding:"required"`
+}
+
+// OrderTransitionInput moves an order to another status.
+type OrderTransitionInput struct {
+	Status data.OrderStatus `json:"status" binding:"required"`
+	Notes  string           `json:"notes"`
 }
 
+// ProductInput is a line item of an order, the largest quantity and number of line items are configured on the handler
+// and prices can't have more decimal places than the minor unit of the order currency.
 type ProductInput struct {
-	Name     string  `json:"name" bingding:"required"`
-	Price    float64 `json:"price" binding:"required"`
-	Quantity uint64  `json:"quantity" binding:"required"`
+	Name     string       `json:"name" binding:"required,notblank"`
+	Price    money.Amount `json:"price" binding:"gt=0"`
+	Quantity uint64       `json:"quantity" binding:"min=1"`
+	// Currency is the order currency when empty, line items in another currency are rejected
+	Currency money.Currency `json:"currency,omitempty" binding:"omitempty,currency"`
 }
 
 type Order struct {
@@ -26,7 +93,83 @@ type Order struct {
 	UpdatedAt   string             `json:"updatedAt"`
 	Products    []data.Product     `json:"products"`
 	User        string             `json:"user"`
-	TotalAmount float64            `json:"totalAmount"`
+	Currency    money.Currency     `json:"currency"`
+	TotalAmount money.Amount       `json:"totalAmount"`
 	Status      data.OrderStatus   `json:"status"`
 	Updates     []data.OrderUpdate `json:"updates"`
+
+	ExchangeRate    *data.ExchangeRate   `json:"exchangeRate,omitempty"`
+	ShippingAddress *data.Address        `json:"shippingAddress,omitempty"`
+	BillingAddress  *data.Address        `json:"billingAddress,omitempty"`
+	CustomerID      string               `json:"customerId,omitempty"`
+	Pricing         *data.PriceBreakdown `json:"pricing,omitempty"`
+	Coupon          *data.AppliedCoupon  `json:"coupon,omitempty"`
+}
+
+// CouponInput creates or replaces a coupon. Percentage coupons take Percent off, fixed coupons take Amount off in
+// Currency, orders have to spend at least MinSpend in Currency. A limit of 0 is no limit.
+type CouponInput struct {
+	Code         string            `json:"code" binding:"required,couponcode"`
+	Description  string            `json:"description,omitempty" binding:"max=256"`
+	Type         data.DiscountType `json:"type" binding:"required,oneof=percentage fixed"`
+	Percent      *money.Amount     `json:"percent,omitempty" binding:"omitempty,gt=0,lte=100"`
+	Amount       *money.Amount     `json:"amount,omitempty" binding:"omitempty,gt=0"`
+	Currency     money.Currency    `json:"currency,omitempty" binding:"omitempty,currency"`
+	MinSpend     *money.Amount     `json:"minSpend,omitempty" binding:"omitempty,gte=0"`
+	ValidFrom    *time.Time        `json:"validFrom,omitempty"`
+	ValidUntil   *time.Time        `json:"validUntil,omitempty"`
+	UsageLimit   int64             `json:"usageLimit" binding:"min=0"`
+	PerUserLimit int64             `json:"perUserLimit" binding:"min=0"`
+}
+
+type Coupon struct {
+	ID          string `json:"couponId"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	data.CouponTerms
+	ValidFrom    string `json:"validFrom,omitempty"`
+	ValidUntil   string `json:"validUntil,omitempty"`
+	UsageLimit   int64  `json:"usageLimit"`
+	PerUserLimit int64  `json:"perUserLimit"`
+	UsageCount   int64  `json:"usageCount"`
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+type Customer struct {
+	ID        string                 `json:"customerId"`
+	User      string                 `json:"user"`
+	Name      string                 `json:"name"`
+	Email     string                 `json:"email"`
+	Phone     string                 `json:"phone,omitempty"`
+	Addresses []data.CustomerAddress `json:"addresses"`
+	CreatedAt string                 `json:"createdAt"`
+	UpdatedAt string                 `json:"updatedAt"`
+}
+
+// OrdersPage is a page of orders, the cursors are opaque tokens to pass as the cursor query param.
+type OrdersPage struct {
+	Items      []Order `json:"items"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+	PrevCursor string  `json:"prevCursor,omitempty"`
+	TotalCount *int64  `json:"totalCount,omitempty"`
+}
+
+// TotalsReport sums the totals of the orders matching the report filters in BaseCurrency. Orders are converted at the
+// exchange rate recorded when they were created, and at the current rate when they have none to BaseCurrency.
+type TotalsReport struct {
+	BaseCurrency money.Currency   `json:"baseCurrency"`
+	OrderCount   int64            `json:"orderCount"`
+	TotalAmount  money.Amount     `json:"totalAmount"`
+	Currencies   []CurrencyTotals `json:"currencies"`
+}
+
+// CurrencyTotals are the totals of the orders in one currency.
+type CurrencyTotals struct {
+	Currency        money.Currency `json:"currency"`
+	OrderCount      int64          `json:"orderCount"`
+	TotalAmount     money.Amount   `json:"totalAmount"`
+	BaseTotalAmount money.Amount   `json:"baseTotalAmount"`
+	// CurrentRateOrderCount is the number of orders converted at the current rate
+	CurrentRateOrderCount int64 `json:"currentRateOrderCount"`
 }
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type ServiceInfo struct {
 	Name        string
 	UpTime      string
@@ -8,11 +10,39 @@ type ServiceInfo struct {
 }
 
 type ServiceEnv struct {
-	Name              string // name of environment where this service is running
-	Port              string // port on which this service runs, defaults to DefaultPort
-	DBName            string // name of the database
-	PrintQueries      bool   // should we print the DB queries that are triggered through this service, defaults to false
-	MongoVaultSideCar string // path to find the mongo sidecar file
-	DisableAuth       bool   // disables authentication , added to make local development/testing easy
-	LogLevel          string // logger level for the service
+	ServiceName          string            // name of the service, set by the binary
+	Version              string            // version of the service, set by the binary
+	Name                 string            // name of environment where this service is running
+	Port                 string            // port on which this service runs, defaults to DefaultPort
+	DBName               string            // name of the database
+	PrintQueries         bool              // should we print the DB queries that are triggered through this service, defaults to false
+	MongoVaultSideCar    string            // path to find the mongo sidecar file
+	DisableAuth          bool              // disables authentication , added to make local development/testing easy
+	JWKSSource           string            // JWKS file path or URL holding the keys tokens are signed with
+	JWTIssuer            string            // expected issuer of tokens, not checked when empty
+	JWTAudience          string            // expected audience of tokens, not checked when empty
+	LogLevel             string            // logger level for the service
+	CursorSigningKey     string            // key used to sign pagination cursors, a random key is used when empty
+	IdempotencyKeyTTL    time.Duration     // how long Idempotency-Key responses are kept, defaults to 24h
+	ReadRateLimit        int               // read requests allowed per caller and minute, defaults to 300
+	WriteRateLimit       int               // write requests allowed per caller and minute, defaults to 60
+	ShutdownTimeout      time.Duration     // how long in-flight requests may take to drain on shutdown, defaults to 30s
+	ReadinessGracePeriod time.Duration     // how long requests are still served on shutdown once readiness fails, defaults to 5s
+	DBConnectionTimeout  time.Duration     // timeout to connect to and ping the database, defaults to 10s
+	SideCarPollInterval  time.Duration     // how often the mongo sidecar file is checked for rotated credentials, 0 disables reloading
+	MaxPageSize          int               // largest page of orders a client can request, defaults to 100
+	MaxLineItems         int               // largest number of products of an order, defaults to 100
+	MaxProductQuantity   int               // largest quantity of a single product of an order, defaults to 1000
+	BaseCurrency         string            // ISO 4217 currency order totals are reported in, defaults to USD
+	ExchangeRatesFile    string            // JSON file of exchange rates, only orders in the base currency are accepted when empty
+	RatesPollInterval    time.Duration     // how often the exchange rates file is read again, defaults to 1h
+	PricingRulesFile     string            // JSON file of the discount, shipping and tax rules, orders cost the sum of their products when empty
+	SeedRecordCount      int               // number of orders created when seeding a database, defaults to 10000
+	GzipLevel            int               // compression level of responses, 0 disables compression
+	SecurityHeaders      map[string]string // headers set on every response, a header with an empty value is not set
+	TraceExporter        string            // where spans are exported to: none, otlp, stdout or file
+	TraceEndpoint        string            // OTLP/HTTP url of the otlp exporter or path of the file exporter
+	TraceSampleRatio     float64           // share of the traces started by this service that are sampled
+	OpenAPIValidation    bool              // validates requests against the OpenAPI document, and responses in dev mode
+	TrustedProxies       []string          // IPs and CIDRs of the proxies whose X-Forwarded-For is trusted, none when empty
 }
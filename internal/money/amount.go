@@ -0,0 +1,288 @@
+// Package money holds exact decimal amounts and the ISO 4217 currencies they are expressed in.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// maxExponent bounds the exponent of parsed amounts, so that 1e999999 can't allocate a huge number.
+const maxExponent = 64
+
+// Amount is an exact decimal number, the value is coef * 10^-scale. Amounts are immutable, the zero value is 0.
+// Amounts are stored as Decimal128 in Mongo and serialized as strings in JSON, e.g. "10.50", so that no
+// client parses them as binary floating point numbers.
+type Amount struct {
+	coef  *big.Int // nil for zero, never modified once set
+	scale int32    // digits after the decimal point
+}
+
+// NewAmount returns coef * 10^-scale, NewAmount(1050, 2) is 10.50.
+func NewAmount(coef int64, scale int32) Amount {
+	return newAmount(big.NewInt(coef), scale)
+}
+
+func newAmount(coef *big.Int, scale int32) Amount {
+	if scale < 0 {
+		coef, scale = new(big.Int).Mul(coef, pow10(-scale)), 0
+	}
+	if coef.Sign() == 0 {
+		coef = nil
+	}
+	return Amount{coef: coef, scale: scale}
+}
+
+// ParseAmount parses a decimal number such as 10.50, -3 or 1.5e2 exactly.
+func ParseAmount(s string) (Amount, error) {
+	mantissa, exponent := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		mantissa = s[:i]
+		exponent, err = strconv.Atoi(s[i+1:])
+		if err != nil || exponent > maxExponent || exponent < -maxExponent {
+			return Amount{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+		}
+	}
+	whole, fraction, _ := strings.Cut(mantissa, ".")
+	digits := strings.TrimLeft(whole, "+-")
+	if len(whole)-len(digits) > 1 || !isDigits(digits+fraction) || digits == "" || strings.HasSuffix(mantissa, ".") {
+		return Amount{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	coef, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	return newAmount(coef, int32(len(fraction)-exponent)), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MustParseAmount is ParseAmount for constants known to be valid, it panics on invalid amounts.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) coefficient() *big.Int {
+	if a.coef == nil {
+		return new(big.Int)
+	}
+	return a.coef
+}
+
+// Scale is the number of digits after the decimal point.
+func (a Amount) Scale() int32 {
+	return a.scale
+}
+
+// DecimalPlaces is the number of significant digits after the decimal point, 10.50 has 1.
+func (a Amount) DecimalPlaces() int32 {
+	if a.coef == nil {
+		return 0
+	}
+	places := a.scale
+	ten := big.NewInt(10)
+	coef, rem := new(big.Int).Set(a.coef), new(big.Int)
+	for places > 0 {
+		if coef.QuoRem(coef, ten, rem); rem.Sign() != 0 {
+			break
+		}
+		places--
+	}
+	return places
+}
+
+func (a Amount) Sign() int {
+	return a.coefficient().Sign()
+}
+
+func (a Amount) IsZero() bool {
+	return a.coef == nil
+}
+
+// Cmp compares the values of a and b, 1.5 and 1.50 are equal.
+func (a Amount) Cmp(b Amount) int {
+	x, y := align(a, b)
+	return x.Cmp(y)
+}
+
+// Equal reports whether a and b have the same value, regardless of their scale.
+func (a Amount) Equal(b Amount) bool {
+	return a.Cmp(b) == 0
+}
+
+func (a Amount) Add(b Amount) Amount {
+	x, y := align(a, b)
+	return newAmount(x.Add(x, y), max(a.scale, b.scale))
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	x, y := align(a, b)
+	return newAmount(x.Sub(x, y), max(a.scale, b.scale))
+}
+
+func (a Amount) Neg() Amount {
+	return newAmount(new(big.Int).Neg(a.coefficient()), a.scale)
+}
+
+// Mul returns the exact product, its scale is the sum of the scales.
+func (a Amount) Mul(b Amount) Amount {
+	return newAmount(new(big.Int).Mul(a.coefficient(), b.coefficient()), a.scale+b.scale)
+}
+
+// MulInt returns a * n, e.g. the price of a quantity of a product.
+func (a Amount) MulInt(n int64) Amount {
+	return newAmount(new(big.Int).Mul(a.coefficient(), big.NewInt(n)), a.scale)
+}
+
+// QuoRound returns a / b rounded half to even to scale digits after the decimal point, b must not be zero.
+func (a Amount) QuoRound(b Amount, scale int32) Amount {
+	// a/b is ca/cb * 10^(sb-sa), its coefficient at scale is ca * 10^(scale+sb-sa) / cb
+	num, den := new(big.Int).Set(a.coefficient()), new(big.Int).Set(b.coefficient())
+	if shift := scale + b.scale - a.scale; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	return newAmount(quoHalfEven(num, den), scale)
+}
+
+// Round returns a with exactly scale digits after the decimal point, rounding half to even (banker's rounding):
+// 2.345 becomes 2.34 and 2.355 becomes 2.36, so that rounding errors don't accumulate in one direction.
+func (a Amount) Round(scale int32) Amount {
+	if scale >= a.scale {
+		return newAmount(new(big.Int).Mul(a.coefficient(), pow10(scale-a.scale)), scale)
+	}
+	return newAmount(quoHalfEven(a.coefficient(), pow10(a.scale-scale)), scale)
+}
+
+// quoHalfEven returns num / den rounded half to even.
+func quoHalfEven(num, den *big.Int) *big.Int {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// compare twice the remainder with the divisor to find out which side of the half the quotient is on
+	twiceRem := new(big.Int).Abs(rem)
+	twiceRem.Lsh(twiceRem, 1)
+	if c := twiceRem.Cmp(new(big.Int).Abs(den)); c > 0 || (c == 0 && quo.Bit(0) == 1) {
+		quo.Add(quo, big.NewInt(int64(num.Sign()*den.Sign())))
+	}
+	return quo
+}
+
+// Float64 returns the nearest float64, meant for metrics and validation of the sign, not for arithmetic.
+func (a Amount) Float64() float64 {
+	f, _ := strconv.ParseFloat(a.String(), 64)
+	return f
+}
+
+// String returns the amount with all its scale digits, e.g. 10.50.
+func (a Amount) String() string {
+	digits := new(big.Int).Abs(a.coefficient()).String()
+	sign := ""
+	if a.Sign() < 0 {
+		sign = "-"
+	}
+	if a.scale == 0 {
+		return sign + digits
+	}
+	if pad := int(a.scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - int(a.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts amounts as strings and, for clients written before amounts were strings, as numbers.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	s := string(b)
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d, ok := primitive.ParseDecimal128FromBigInt(a.coefficient(), -int(a.scale))
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: %s does not fit a decimal128", ErrInvalidAmount, a)
+	}
+	return bson.MarshalValue(d)
+}
+
+// UnmarshalBSONValue reads Decimal128 amounts, and the doubles and integers amounts were stored as before.
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, b []byte) error {
+	value := bson.RawValue{Type: t, Value: b}
+	switch t {
+	case bsontype.Decimal128:
+		coef, exp, err := value.Decimal128().BigInt()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidAmount, err)
+		}
+		*a = newAmount(coef, int32(-exp))
+	case bsontype.Double:
+		parsed, err := ParseAmount(strconv.FormatFloat(value.Double(), 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case bsontype.Int32:
+		*a = NewAmount(int64(value.Int32()), 0)
+	case bsontype.Int64:
+		*a = NewAmount(value.Int64(), 0)
+	case bsontype.Null:
+		*a = Amount{}
+	default:
+		return fmt.Errorf("%w: bson %s is not an amount", ErrInvalidAmount, t)
+	}
+	return nil
+}
+
+// align returns the coefficients of a and b scaled to the larger of their scales.
+func align(a, b Amount) (*big.Int, *big.Int) {
+	x, y := new(big.Int).Set(a.coefficient()), new(big.Int).Set(b.coefficient())
+	switch {
+	case a.scale < b.scale:
+		x.Mul(x, pow10(b.scale-a.scale))
+	case b.scale < a.scale:
+		y.Mul(y, pow10(a.scale-b.scale))
+	}
+	return x, y
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
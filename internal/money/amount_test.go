@@ -0,0 +1,120 @@
+package money_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"10.50", "10.50"},
+		{"-3", "-3"},
+		{"+0.1", "0.1"},
+		{"1.5e2", "150"},
+		{"15E-3", "0.015"},
+		{"0.00", "0.00"},
+		{"12345678901234567890.123456789", "12345678901234567890.123456789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			a, err := money.ParseAmount(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, a.String())
+		})
+	}
+
+	for _, invalid := range []string{"", "abc", "1.", ".5", "--1", "1.2.3", "1e", "1e999", "NaN", "1,5"} {
+		_, err := money.ParseAmount(invalid)
+		assert.ErrorIs(t, err, money.ErrInvalidAmount, invalid)
+	}
+}
+
+func TestAmount_Arithmetic(t *testing.T) {
+	tenth := money.MustParseAmount("0.1")
+	assert.Equal(t, "0.3", tenth.Add(tenth).Add(tenth).String(), "0.1 * 3 is exactly 0.3")
+	assert.Equal(t, "0.3", tenth.MulInt(3).String())
+	assert.True(t, tenth.MulInt(3).Equal(money.MustParseAmount("0.30")))
+	assert.Equal(t, "9.90", money.MustParseAmount("10").Sub(money.MustParseAmount("0.10")).String())
+	assert.Equal(t, "1.23450", money.MustParseAmount("2.5").Mul(money.MustParseAmount("0.4938")).String())
+	assert.Equal(t, "-0.5", money.MustParseAmount("0.5").Neg().String())
+	assert.Equal(t, -1, money.MustParseAmount("1.99").Cmp(money.MustParseAmount("2")))
+	assert.Equal(t, int32(1), money.MustParseAmount("10.50").DecimalPlaces())
+	assert.Equal(t, 0, money.Amount{}.Sign())
+	assert.True(t, money.Amount{}.IsZero())
+}
+
+func TestAmount_Round(t *testing.T) {
+	tests := []struct {
+		amount string
+		scale  int32
+		want   string
+	}{
+		{"2.345", 2, "2.34"},
+		{"2.355", 2, "2.36"},
+		{"2.3451", 2, "2.35"},
+		{"-2.345", 2, "-2.34"},
+		{"-2.355", 2, "-2.36"},
+		{"0.5", 0, "0"},
+		{"1.5", 0, "2"},
+		{"2.5", 0, "2"},
+		{"1.2", 3, "1.200"},
+		{"0.004", 2, "0.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			assert.Equal(t, tt.want, money.MustParseAmount(tt.amount).Round(tt.scale).String())
+		})
+	}
+}
+
+func TestAmount_QuoRound(t *testing.T) {
+	assert.Equal(t, "3.33", money.MustParseAmount("10").QuoRound(money.MustParseAmount("3"), 2).String())
+	assert.Equal(t, "0.12", money.MustParseAmount("0.25").QuoRound(money.MustParseAmount("2"), 2).String())
+	assert.Equal(t, "0.38", money.MustParseAmount("0.75").QuoRound(money.MustParseAmount("2"), 2).String())
+	assert.Equal(t, "-0.67", money.MustParseAmount("-2").QuoRound(money.MustParseAmount("3"), 2).String())
+	assert.Equal(t, "200", money.MustParseAmount("100").QuoRound(money.MustParseAmount("0.5"), 0).String())
+}
+
+func TestAmount_JSON(t *testing.T) {
+	type doc struct {
+		Price money.Amount `json:"price"`
+	}
+	b, err := json.Marshal(doc{Price: money.NewAmount(1050, 2)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price": "10.50"}`, string(b))
+
+	var fromString, fromNumber doc
+	require.NoError(t, json.Unmarshal([]byte(`{"price": "0.10"}`), &fromString))
+	assert.Equal(t, "0.10", fromString.Price.String())
+	require.NoError(t, json.Unmarshal([]byte(`{"price": 0.1}`), &fromNumber))
+	assert.Equal(t, "0.1", fromNumber.Price.String())
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"price": "ten"}`), &fromString), money.ErrInvalidAmount)
+}
+
+func TestAmount_BSON(t *testing.T) {
+	type doc struct {
+		Price money.Amount `bson:"price"`
+	}
+	b, err := bson.Marshal(doc{Price: money.MustParseAmount("10.50")})
+	require.NoError(t, err)
+	assert.Equal(t, bson.TypeDecimal128, bson.Raw(b).Lookup("price").Type)
+
+	var decoded doc
+	require.NoError(t, bson.Unmarshal(b, &decoded))
+	assert.Equal(t, "10.50", decoded.Price.String())
+
+	// amounts stored as doubles before they were decimals
+	legacy, err := bson.Marshal(bson.M{"price": 0.1})
+	require.NoError(t, err)
+	require.NoError(t, bson.Unmarshal(legacy, &decoded))
+	assert.Equal(t, "0.1", decoded.Price.String())
+}
@@ -0,0 +1,67 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidCurrency = errors.New("invalid currency")
+
+// Currency is an ISO 4217 currency code such as USD.
+type Currency string
+
+// DefaultCurrency is the currency of orders that don't name one, and of the orders stored before orders had one.
+const DefaultCurrency Currency = "USD"
+
+// minorUnits lists the active ISO 4217 currencies by the number of digits of their minor unit,
+// currencies without a minor unit such as XAU are not accepted.
+var minorUnits = map[int32]string{
+	0: "BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX UYI VND VUV XAF XOF XPF",
+	2: "AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV BRL BSD BTN BWP BYN BZD CAD CDF " +
+		"CHE CHF CHW CNY COP COU CRC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD " +
+		"HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL MGA MKD MMK MNT " +
+		"MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR " +
+		"SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD TWD TZS UAH USD USN UYU " +
+		"UZS VED VES WST XCD XCG YER ZAR ZMW ZWG",
+	3: "BHD IQD JOD KWD LYD OMR TND",
+	4: "CLF UYW",
+}
+
+var currencies = func() map[Currency]int32 {
+	byCode := map[Currency]int32{}
+	for units, codes := range minorUnits {
+		for _, code := range strings.Fields(codes) {
+			byCode[Currency(code)] = units
+		}
+	}
+	return byCode
+}()
+
+// ParseCurrency returns the currency of an ISO 4217 code, codes are upper case.
+func ParseCurrency(code string) (Currency, error) {
+	if c := Currency(code); c.IsValid() {
+		return c, nil
+	}
+	return "", fmt.Errorf("%w %q, an ISO 4217 currency code is expected", ErrInvalidCurrency, code)
+}
+
+// IsValid reports whether c is an active ISO 4217 currency.
+func (c Currency) IsValid() bool {
+	_, ok := currencies[c]
+	return ok
+}
+
+// MinorUnits is the number of decimal places of amounts in the currency, 2 for USD and 0 for JPY.
+func (c Currency) MinorUnits() int32 {
+	return currencies[c]
+}
+
+// Round rounds a half to even to the minor unit of the currency.
+func (c Currency) Round(a Amount) Amount {
+	return a.Round(c.MinorUnits())
+}
+
+func (c Currency) String() string {
+	return string(c)
+}
@@ -0,0 +1,28 @@
+package money_test
+
+import (
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCurrency(t *testing.T) {
+	c, err := money.ParseCurrency("EUR")
+	require.NoError(t, err)
+	assert.Equal(t, money.Currency("EUR"), c)
+
+	for _, invalid := range []string{"", "usd", "EURO", "XAU", "ABC"} {
+		_, err := money.ParseCurrency(invalid)
+		assert.ErrorIs(t, err, money.ErrInvalidCurrency, invalid)
+	}
+}
+
+func TestCurrency_Round(t *testing.T) {
+	amount := money.MustParseAmount("1234.5675")
+	assert.Equal(t, "1234.57", money.Currency("USD").Round(amount).String())
+	assert.Equal(t, "1235", money.Currency("JPY").Round(amount).String())
+	assert.Equal(t, "1234.568", money.Currency("KWD").Round(amount).String())
+	assert.Equal(t, int32(2), money.DefaultCurrency.MinorUnits())
+}
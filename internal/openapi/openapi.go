@@ -0,0 +1,271 @@
+// Package openapi embeds the OpenAPI document of the service and validates requests and responses against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DocumentPath is the route the document is served on.
+const DocumentPath = "/openapi.json"
+
+var ErrInvalidDocument = errors.New("invalid openapi document")
+
+//go:embed openapi.json
+var document []byte
+
+// Document returns the raw OpenAPI document.
+func Document() []byte {
+	return document
+}
+
+// Spec is the part of an OpenAPI 3.1 document needed to validate requests and responses.
+type Spec struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+}
+
+// PathItem holds the operations of a path keyed by lower case method, parameters apply to every operation.
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Operations map[string]*Operation
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema the document uses: types, enums, objects, arrays, bounds and patterns.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 Types              `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinItems             *int               `json:"minItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+
+	pattern *regexp.Regexp
+}
+
+// Types is the type keyword of a schema, a single type or a list of types.
+type Types []string
+
+var methods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+// Load parses the embedded document and resolves the references to parameters and responses.
+func Load() (*Spec, error) {
+	return Parse(document)
+}
+
+// Parse parses an OpenAPI document and resolves the references to parameters and responses,
+// schema references are resolved while validating.
+func Parse(doc []byte) (*Spec, error) {
+	spec := &Spec{}
+	if err := json.Unmarshal(doc, spec); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.1") {
+		return nil, fmt.Errorf("%w: openapi version %q is not 3.1", ErrInvalidDocument, spec.OpenAPI)
+	}
+	for path, item := range spec.Paths {
+		for method, op := range item.Operations {
+			params := make([]*Parameter, 0, len(item.Parameters)+len(op.Parameters))
+			for _, param := range append(append([]*Parameter{}, item.Parameters...), op.Parameters...) {
+				resolved, err := spec.parameter(param)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s %s: %w", ErrInvalidDocument, method, path, err)
+				}
+				params = append(params, resolved)
+			}
+			op.Parameters = params
+			for status, resp := range op.Responses {
+				resolved, err := spec.response(resp)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s %s %s: %w", ErrInvalidDocument, method, path, status, err)
+				}
+				op.Responses[status] = resolved
+			}
+		}
+	}
+	return spec, nil
+}
+
+// Operation returns the operation of method on path, path uses either the OpenAPI form /orders/{id}
+// or the gin form /orders/:id.
+func (s *Spec) Operation(method, path string) (*Operation, bool) {
+	item, ok := s.Paths[SpecPath(path)]
+	if !ok {
+		return nil, false
+	}
+	op, ok := item.Operations[strings.ToLower(method)]
+	return op, ok
+}
+
+// Routes lists every operation of the document as "METHOD path".
+func (s *Spec) Routes() []string {
+	var routes []string
+	for path, item := range s.Paths {
+		for method := range item.Operations {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	return routes
+}
+
+// QueryParams returns the names of the query parameters of the operation.
+func (op *Operation) QueryParams() map[string]bool {
+	params := map[string]bool{}
+	for _, param := range op.Parameters {
+		if param.In == "query" {
+			params[param.Name] = true
+		}
+	}
+	return params
+}
+
+// SpecPath converts the gin path params of path, :id and *path, to OpenAPI path templates.
+func SpecPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *Spec) parameter(param *Parameter) (*Parameter, error) {
+	if param.Ref == "" {
+		return param, nil
+	}
+	resolved, ok := s.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %s", param.Ref)
+	}
+	return resolved, nil
+}
+
+func (s *Spec) response(resp *Response) (*Response, error) {
+	if resp.Ref == "" {
+		return resp, nil
+	}
+	resolved, ok := s.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+	if !ok {
+		return nil, fmt.Errorf("unknown response %s", resp.Ref)
+	}
+	return resolved, nil
+}
+
+// schema follows the reference of a schema to the component it points to.
+func (s *Spec) schema(schema *Schema) (*Schema, error) {
+	for schema.Ref != "" {
+		resolved, ok := s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown schema %s", ErrInvalidDocument, schema.Ref)
+		}
+		schema = resolved
+	}
+	return schema, nil
+}
+
+func (p *PathItem) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if raw, ok := fields["parameters"]; ok {
+		if err := json.Unmarshal(raw, &p.Parameters); err != nil {
+			return err
+		}
+	}
+	p.Operations = map[string]*Operation{}
+	for _, method := range methods {
+		raw, ok := fields[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		op := &Operation{}
+		if err := json.Unmarshal(raw, op); err != nil {
+			return fmt.Errorf("%s: %w", method, err)
+		}
+		p.Operations[strings.ToLower(method)] = op
+	}
+	return nil
+}
+
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	type plain Schema
+	if err := json.Unmarshal(b, (*plain)(s)); err != nil {
+		return err
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+	return nil
+}
+
+func (t *Types) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
@@ -0,0 +1,56 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+
+	op, ok := spec.Operation(http.MethodPut, "/ecommerce/v1/orders/:id")
+	require.True(t, ok)
+	assert.Equal(t, "replaceOrder", op.OperationID)
+	// path level params come first and references are resolved
+	require.Len(t, op.Parameters, 2)
+	assert.Equal(t, "id", op.Parameters[0].Name)
+	assert.Equal(t, "If-Match", op.Parameters[1].Name)
+	assert.NotNil(t, op.Responses["404"].Content["application/problem+json"])
+
+	_, ok = spec.Operation(http.MethodPost, "/livez")
+	assert.False(t, ok)
+}
+
+func TestDocument_IsValidJSON(t *testing.T) {
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(openapi.Document(), &doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not json":          `{`,
+		"version":           `{"openapi": "3.0.3", "paths": {}}`,
+		"unknown parameter": `{"openapi": "3.1.0", "paths": {"/a": {"get": {"parameters": [{"$ref": "#/components/parameters/X"}]}}}}`,
+		"unknown response":  `{"openapi": "3.1.0", "paths": {"/a": {"get": {"responses": {"200": {"$ref": "#/components/responses/X"}}}}}}`,
+		"bad pattern":       `{"openapi": "3.1.0", "components": {"schemas": {"A": {"pattern": "("}}}}`,
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := openapi.Parse([]byte(doc))
+			assert.ErrorIs(t, err, openapi.ErrInvalidDocument)
+		})
+	}
+}
+
+func TestSpecPath(t *testing.T) {
+	assert.Equal(t, "/orders/{id}/transitions", openapi.SpecPath("/orders/:id/transitions"))
+	assert.Equal(t, "/files/{path}", openapi.SpecPath("/files/*path"))
+	assert.Equal(t, "/orders/{id}", openapi.SpecPath("/orders/{id}"))
+}
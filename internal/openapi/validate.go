@@ -0,0 +1,312 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrUndocumentedOperation = errors.New("operation is not documented")
+	ErrUnsupportedMediaType  = errors.New("unsupported media type")
+)
+
+// ValidationError is a value of a request or response that does not match the document.
+type ValidationError struct {
+	In     string // body, query, path, header or status
+	Name   string // JSON pointer to the invalid value of a body, e.g. /products/0/price, name of a parameter or header
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.In == "body":
+		return strings.TrimSpace("body "+e.Name) + ": " + e.Reason
+	case e.Name == "":
+		return e.In + ": " + e.Reason
+	}
+	return e.In + " parameter " + e.Name + ": " + e.Reason
+}
+
+// ValidateRequest returns every mismatch between the request and the operation of method and route,
+// route is the matched gin path and pathParams its values. The request body is read and restored.
+func (s *Spec) ValidateRequest(req *http.Request, route string, pathParams map[string]string) []error {
+	op, ok := s.Operation(req.Method, route)
+	if !ok {
+		return []error{fmt.Errorf("%w: %s %s", ErrUndocumentedOperation, req.Method, route)}
+	}
+	var errs []error
+	query := req.URL.Query()
+	for name := range query {
+		if !op.QueryParams()[name] {
+			errs = append(errs, &ValidationError{In: "query", Name: name, Reason: "is not supported"})
+		}
+	}
+	for _, param := range op.Parameters {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value, present = pathParams[param.Name]
+		case "query":
+			present = query.Has(param.Name)
+			value = query.Get(param.Name)
+		case "header":
+			value = req.Header.Get(param.Name)
+			present = value != ""
+		default:
+			continue
+		}
+		if !present {
+			if param.Required {
+				errs = append(errs, &ValidationError{In: param.In, Name: param.Name, Reason: "is required"})
+			}
+			continue
+		}
+		errs = append(errs, s.validateParam(param, value)...)
+	}
+	if op.RequestBody != nil {
+		errs = append(errs, s.validateRequestBody(req, op.RequestBody)...)
+	}
+	return errs
+}
+
+// ValidateResponse returns every mismatch between a response and the operation of method and route.
+func (s *Spec) ValidateResponse(method, route string, statusCode int, header http.Header, body []byte) []error {
+	op, ok := s.Operation(method, route)
+	if !ok {
+		return []error{fmt.Errorf("%w: %s %s", ErrUndocumentedOperation, method, route)}
+	}
+	resp, ok := op.Responses[strconv.Itoa(statusCode)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []error{&ValidationError{In: "status", Reason: fmt.Sprintf("%d is not documented", statusCode)}}
+	}
+	if len(resp.Content) == 0 {
+		if len(body) > 0 && statusCode != http.StatusNoContent {
+			return []error{&ValidationError{In: "body", Reason: "should be empty"}}
+		}
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		return []error{&ValidationError{In: "header", Name: "Content-Type", Reason: fmt.Sprintf("%q is not documented", mediaType)}}
+	}
+	if content.Schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+	value, err := decodeJSON(body)
+	if err != nil {
+		return []error{&ValidationError{In: "body", Reason: err.Error()}}
+	}
+	return s.validateValue(content.Schema, value, "body", "")
+}
+
+// validateValue returns every mismatch between a decoded JSON value and schema, numbers are expected
+// as json.Number or float64. name is the JSON pointer to the value in a body or the name of a parameter.
+func (s *Spec) validateValue(schema *Schema, value any, in, name string) []error {
+	schema, err := s.schema(schema)
+	if err != nil {
+		return []error{err}
+	}
+	invalid := func(format string, args ...any) []error {
+		return []error{&ValidationError{In: in, Name: name, Reason: fmt.Sprintf(format, args...)}}
+	}
+	if len(schema.Type) > 0 && !slices.ContainsFunc(schema.Type, func(t string) bool { return hasType(value, t) }) {
+		return invalid("should be of type %s", strings.Join(schema.Type, " or "))
+	}
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(allowed any) bool { return equal(allowed, value) }) {
+		return invalid("should be one of %v", schema.Enum)
+	}
+	var errs []error
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			errs = append(errs, invalid("should have at least %d characters", *schema.MinLength)...)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			errs = append(errs, invalid("should have at most %d characters", *schema.MaxLength)...)
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(v) {
+			errs = append(errs, invalid("should match %s", schema.Pattern)...)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				errs = append(errs, invalid("should be an RFC 3339 date-time")...)
+			}
+		}
+	case json.Number, float64:
+		n, _ := number(v)
+		if schema.Minimum != nil && n < *schema.Minimum {
+			errs = append(errs, invalid("should be at least %v", *schema.Minimum)...)
+		}
+		if schema.ExclusiveMinimum != nil && n <= *schema.ExclusiveMinimum {
+			errs = append(errs, invalid("should be greater than %v", *schema.ExclusiveMinimum)...)
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			errs = append(errs, invalid("should be at most %v", *schema.Maximum)...)
+		}
+	case []any:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			errs = append(errs, invalid("should have at least %d items", *schema.MinItems)...)
+		}
+		if schema.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.validateValue(schema.Items, item, in, name+"/"+strconv.Itoa(i))...)
+			}
+		}
+	case map[string]any:
+		for _, property := range schema.Required {
+			if _, ok := v[property]; !ok {
+				errs = append(errs, &ValidationError{In: in, Name: name + "/" + pointerToken(property), Reason: "is required"})
+			}
+		}
+		for property, field := range v {
+			pointer := name + "/" + pointerToken(property)
+			propertySchema, ok := schema.Properties[property]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					errs = append(errs, &ValidationError{In: in, Name: pointer, Reason: "is not supported"})
+				}
+				continue
+			}
+			errs = append(errs, s.validateValue(propertySchema, field, in, pointer)...)
+		}
+	}
+	return errs
+}
+
+// validateParam converts the raw value of a parameter to the type of its schema before validating it.
+func (s *Spec) validateParam(param *Parameter, raw string) []error {
+	if param.Schema == nil {
+		return nil
+	}
+	schema, err := s.schema(param.Schema)
+	if err != nil {
+		return []error{err}
+	}
+	var value any = raw
+	switch {
+	case slices.Contains(schema.Type, "integer"), slices.Contains(schema.Type, "number"):
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return []error{&ValidationError{In: param.In, Name: param.Name, Reason: "should be a number"}}
+		}
+		value = json.Number(raw)
+	case slices.Contains(schema.Type, "boolean"):
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return []error{&ValidationError{In: param.In, Name: param.Name, Reason: "should be a boolean"}}
+		}
+		value = b
+	}
+	return s.validateValue(schema, value, param.In, param.Name)
+}
+
+func (s *Spec) validateRequestBody(req *http.Request, body *RequestBody) []error {
+	var raw []byte
+	if req.Body != nil {
+		var err error
+		raw, err = io.ReadAll(req.Body)
+		if err != nil {
+			return []error{&ValidationError{In: "body", Reason: err.Error()}}
+		}
+		req.Body = io.NopCloser(bytes.NewReader(raw))
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		if body.Required {
+			return []error{&ValidationError{In: "body", Reason: "is required"}}
+		}
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	content, ok := body.Content[mediaType]
+	if !ok {
+		return []error{fmt.Errorf("%w: %q", ErrUnsupportedMediaType, mediaType)}
+	}
+	if content.Schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+	value, err := decodeJSON(raw)
+	if err != nil {
+		return []error{&ValidationError{In: "body", Reason: err.Error()}}
+	}
+	return s.validateValue(content.Schema, value, "body", "")
+}
+
+func decodeJSON(raw []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("is not valid JSON: %w", err)
+	}
+	return value, nil
+}
+
+// pointerToken escapes a property name as a JSON pointer (RFC 6901) reference token.
+func pointerToken(property string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(property)
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func hasType(value any, typ string) bool {
+	switch typ {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := number(value)
+		return ok
+	case "integer":
+		n, ok := number(value)
+		return ok && n == float64(int64(n))
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
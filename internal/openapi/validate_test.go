@@ -0,0 +1,254 @@
+package openapi_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orderID = "65f1c3a2b4d5e6f708192a3b"
+
+func loadSpec(t *testing.T) *openapi.Spec {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	return spec
+}
+
+func TestValidateRequest(t *testing.T) {
+	spec := loadSpec(t)
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		route       string
+		contentType string
+		body        string
+		violations  []string
+	}{
+		{name: "list", method: http.MethodGet, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders?limit=10&includeTotal=true&sort=-createdAt,status&status=OrderPending&createdAt[gte]=2024-01-02T15:04:05Z"},
+		{name: "list bad params", method: http.MethodGet, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders?limit=ten&includeTotal=maybe&status=Lost&sort=name&createdAt[gt]=yesterday&foo=1",
+			violations: []string{"query parameter limit", "query parameter includeTotal", "query parameter status",
+				"query parameter sort", "query parameter createdAt[gt]", "query parameter foo"}},
+		{name: "list limit below minimum", method: http.MethodGet, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders?limit=0", violations: []string{"query parameter limit: should be at least 1"}},
+		{name: "bad order id", method: http.MethodGet, route: "/ecommerce/v1/orders/:id",
+			target: "/ecommerce/v1/orders/123", violations: []string{"path parameter id"}},
+		{name: "create", method: http.MethodPost, route: "/ecommerce/v1/orders", target: "/ecommerce/v1/orders",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"products": [{"name": "pen", "price": 1.5, "quantity": 2}]}`},
+		{name: "create with currency and amount strings", method: http.MethodPost, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders", contentType: "application/json",
+			body: `{"currency": "EUR", "products": [{"name": "pen", "price": "1.50", "quantity": 2, "currency": "EUR"}]}`},
+		{name: "create with shipping address", method: http.MethodPost, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders", contentType: "application/json",
+			body: `{"products": [{"name": "pen", "price": "1.50", "quantity": 2}], "shippingAddress": {"country": "US", "region": "CA"}}`},
+		{name: "create bad shipping address", method: http.MethodPost, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders", contentType: "application/json",
+			body:       `{"products": [{"name": "pen", "price": "1.50", "quantity": 2}], "shippingAddress": {"country": "usa"}}`,
+			violations: []string{"body /shippingAddress/country"}},
+		{name: "create with coupon", method: http.MethodPost, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders", contentType: "application/json",
+			body: `{"products": [{"name": "pen", "price": "1.50", "quantity": 2}], "couponCode": "SPRING10"}`},
+		{name: "create coupon", method: http.MethodPost, route: "/ecommerce/v1/coupons", target: "/ecommerce/v1/coupons",
+			contentType: "application/json",
+			body: `{"code": "spring10", "type": "percentage", "percent": "10", "validUntil": "2024-06-01T00:00:00Z",
+				"usageLimit": 100, "perUserLimit": 1}`},
+		{name: "create bad coupon", method: http.MethodPost, route: "/ecommerce/v1/coupons", target: "/ecommerce/v1/coupons",
+			contentType: "application/json", body: `{"code": "10% off", "type": "bogo", "usageLimit": -1}`,
+			violations: []string{"body /code", "body /type", "body /usageLimit"}},
+		{name: "bad coupon id", method: http.MethodPut, route: "/ecommerce/v1/coupons/:id",
+			target: "/ecommerce/v1/coupons/123", contentType: "application/json",
+			body:       `{"code": "SPRING10", "type": "fixed", "amount": "5", "currency": "USD"}`,
+			violations: []string{"path parameter id"}},
+		{name: "create for customer", method: http.MethodPost, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders", contentType: "application/json",
+			body: `{"products": [{"name": "pen", "price": "1.50", "quantity": 2}], "customerId": "` + orderID + `",
+				"shippingAddressId": "` + orderID + `", "billingAddress": {"name": "Jane Doe", "line1": "1 Main St",
+				"city": "Austin", "region": "TX", "postalCode": "78701", "country": "US"}}`},
+		{name: "create bad customer id", method: http.MethodPost, route: "/ecommerce/v1/orders",
+			target: "/ecommerce/v1/orders", contentType: "application/json",
+			body:       `{"products": [{"name": "pen", "price": "1.50", "quantity": 2}], "customerId": "123"}`,
+			violations: []string{"body /customerId"}},
+		{name: "create customer", method: http.MethodPost, route: "/ecommerce/v1/customers",
+			target: "/ecommerce/v1/customers", contentType: "application/json",
+			body: `{"name": "Jane Doe", "email": "jane@example.com", "phone": "+14155552671", "addresses": [
+				{"type": "shipping", "default": true, "name": "Jane Doe", "line1": "1 Main St", "city": "San Francisco",
+				"region": "CA", "postalCode": "94105", "country": "US"}]}`},
+		{name: "create bad customer", method: http.MethodPost, route: "/ecommerce/v1/customers",
+			target: "/ecommerce/v1/customers", contentType: "application/json",
+			body: `{"name": " ", "email": "jane@example.com", "phone": "0415", "addresses": [
+				{"type": "home", "name": "Jane Doe", "city": "Paris", "country": "FR"}]}`,
+			violations: []string{"body /name", "body /phone", "body /addresses/0/type", "body /addresses/0/line1"}},
+		{name: "customer orders", method: http.MethodGet, route: "/ecommerce/v1/customers/:id/orders",
+			target: "/ecommerce/v1/customers/" + orderID + "/orders?limit=10&status=OrderPending"},
+		{name: "bad customer id", method: http.MethodGet, route: "/ecommerce/v1/customers/:id",
+			target: "/ecommerce/v1/customers/123", violations: []string{"path parameter id"}},
+		{name: "totals report", method: http.MethodGet, route: "/ecommerce/v1/reports/order-totals",
+			target: "/ecommerce/v1/reports/order-totals?baseCurrency=EUR&currency[in]=USD,EUR&status=OrderPending"},
+		{name: "totals report bad base currency", method: http.MethodGet, route: "/ecommerce/v1/reports/order-totals",
+			target: "/ecommerce/v1/reports/order-totals?baseCurrency=euro", violations: []string{"query parameter baseCurrency"}},
+		{name: "create bad body", method: http.MethodPost, route: "/ecommerce/v1/orders", target: "/ecommerce/v1/orders",
+			contentType: "application/json",
+			body:        `{"products": [{"name": 3, "price": true, "quantity": 1.5}], "user": "me"}`,
+			violations: []string{"body /products/0/name", "body /products/0/price", "body /products/0/quantity",
+				"body /user: is not supported"}},
+		{name: "create invalid product", method: http.MethodPost, route: "/ecommerce/v1/orders", target: "/ecommerce/v1/orders",
+			contentType: "application/json",
+			body:        `{"products": [{"name": " ", "price": 0, "quantity": 0}]}`,
+			violations: []string{"body /products/0/name: should match", "body /products/0/price: should be greater than 0",
+				"body /products/0/quantity: should be at least 1"}},
+		{name: "create no products", method: http.MethodPost, route: "/ecommerce/v1/orders", target: "/ecommerce/v1/orders",
+			contentType: "application/json", body: `{"products": []}`,
+			violations: []string{"body /products: should have at least 1 items"}},
+		{name: "create missing body", method: http.MethodPost, route: "/ecommerce/v1/orders", target: "/ecommerce/v1/orders",
+			contentType: "application/json", violations: []string{"body: is required"}},
+		{name: "create invalid json", method: http.MethodPost, route: "/ecommerce/v1/orders", target: "/ecommerce/v1/orders",
+			contentType: "application/json", body: `{"products": [`, violations: []string{"body: is not valid JSON"}},
+		{name: "patch", method: http.MethodPatch, route: "/ecommerce/v1/orders/:id", target: "/ecommerce/v1/orders/" + orderID,
+			contentType: "application/merge-patch+json", body: `{"status": "OrderCancelled"}`},
+		{name: "patch empty products", method: http.MethodPatch, route: "/ecommerce/v1/orders/:id",
+			target: "/ecommerce/v1/orders/" + orderID, contentType: "application/merge-patch+json", body: `{"products": []}`,
+			violations: []string{"body /products: should have at least 1 items"}},
+		{name: "transition missing status", method: http.MethodPost, route: "/ecommerce/v1/orders/:id/transitions",
+			target: "/ecommerce/v1/orders/" + orderID + "/transitions", contentType: "application/json", body: `{"notes": "x"}`,
+			violations: []string{"body /status: is required"}},
+		{name: "undocumented media type", method: http.MethodPut, route: "/ecommerce/v1/orders/:id",
+			target: "/ecommerce/v1/orders/" + orderID, contentType: "text/plain", body: `status`,
+			violations: []string{"unsupported media type"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			pathParams := map[string]string{}
+			if strings.Contains(tt.route, ":id") {
+				pathParams["id"] = strings.Split(req.URL.Path, "/")[4]
+			}
+
+			errs := spec.ValidateRequest(req, tt.route, pathParams)
+
+			require.Len(t, errs, len(tt.violations), "%v", errs)
+			for _, violation := range tt.violations {
+				assert.True(t, containsViolation(errs, violation), "%q not in %v", violation, errs)
+			}
+		})
+	}
+}
+
+func TestValidateRequest_RestoresBody(t *testing.T) {
+	body := `{"status": "OrderProcessing"}`
+	req := httptest.NewRequest(http.MethodPost, "/ecommerce/v1/orders/"+orderID+"/transitions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	errs := loadSpec(t).ValidateRequest(req, "/ecommerce/v1/orders/:id/transitions", map[string]string{"id": orderID})
+
+	assert.Empty(t, errs)
+	read, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(read))
+}
+
+func TestValidateRequest_UndocumentedOperation(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/livez", nil)
+	errs := loadSpec(t).ValidateRequest(req, "/livez", nil)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], openapi.ErrUndocumentedOperation)
+}
+
+func TestValidateResponse(t *testing.T) {
+	spec := loadSpec(t)
+	jsonHeader := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+	order := `{"orderId": "` + orderID + `", "version": 1, "createdAt": "x", "updatedAt": "x", "user": "u",
+		"products": [{"name": "pen", "price": "1.00", "quantity": 1, "updateAt": "2024-01-02T15:04:05Z"}],
+		"currency": "USD", "totalAmount": "1.00", "status": "OrderPending", "updates": null}`
+	tests := []struct {
+		name       string
+		method     string
+		route      string
+		status     int
+		header     http.Header
+		body       string
+		violations []string
+	}{
+		{name: "order", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusOK,
+			header: jsonHeader, body: order},
+		{name: "page", method: http.MethodGet, route: "/ecommerce/v1/orders", status: http.StatusOK,
+			header: jsonHeader, body: `{"items": [` + order + `], "nextCursor": "abc"}`},
+		{name: "error", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusNotFound,
+			header: http.Header{"Content-Type": []string{"application/problem+json"}},
+			body:   `{"type": "urn:problem-type:c", "title": "t", "status": 404, "detail": "m", "debugId": "d", "errorCode": "c"}`},
+		{name: "deleted", method: http.MethodDelete, route: "/ecommerce/v1/orders/:id", status: http.StatusNoContent,
+			header: http.Header{}},
+		{name: "undocumented status", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusTeapot,
+			header: jsonHeader, body: `{}`, violations: []string{"status: 418 is not documented"}},
+		{name: "undocumented content type", method: http.MethodGet, route: "/livez", status: http.StatusOK,
+			header: http.Header{"Content-Type": []string{"text/plain"}}, body: "ok",
+			violations: []string{"Content-Type"}},
+		{name: "bad order", method: http.MethodPost, route: "/ecommerce/v1/orders", status: http.StatusCreated,
+			header: jsonHeader, body: `{"orderId": 1, "status": "Lost"}`,
+			violations: []string{"body /orderId", "body /status", "body /version: is required", "body /createdAt: is required",
+				"body /updatedAt: is required", "body /products: is required", "body /user: is required",
+				"body /currency: is required", "body /totalAmount: is required"}},
+		{name: "order with exchange rate", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusOK,
+			header: jsonHeader, body: strings.Replace(order, `"updates": null`, `"updates": null, "exchangeRate":
+				{"baseCurrency": "EUR", "rate": "0.92", "asOf": "2024-05-01T00:00:00Z", "baseTotalAmount": "0.92"}`, 1)},
+		{name: "order with pricing", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusOK,
+			header: jsonHeader, body: strings.Replace(order, `"updates": null`, `"updates": null,
+				"shippingAddress": {"country": "US", "region": "CA"}, "pricing": {"subtotal": "1.00", "lineDiscounts": "-0.10",
+				"orderDiscounts": "0.00", "shipping": "0.00", "tax": "0.07", "total": "0.97", "adjustments": [
+				{"rule": "sale", "kind": "lineDiscount", "line": 0, "description": "10% off 1 x pen", "amount": "-0.10"},
+				{"rule": "CA", "kind": "tax", "description": "7.25% of 0.90", "amount": "0.07"}]}`, 1)},
+		{name: "order with coupon", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusOK,
+			header: jsonHeader, body: strings.Replace(order, `"updates": null`, `"updates": null, "coupon": {
+				"couponId": "`+orderID+`", "code": "SPRING10", "redemptionId": "`+orderID+`", "type": "percentage",
+				"percent": "10", "releasedAt": "2024-05-01T00:00:00Z"}`, 1)},
+		{name: "coupons", method: http.MethodGet, route: "/ecommerce/v1/coupons", status: http.StatusOK,
+			header: jsonHeader, body: `[{"couponId": "` + orderID + `", "code": "FIVE", "description": "", "type": "fixed",
+				"amount": "5.00", "currency": "USD", "minSpend": "20.00", "usageLimit": 0, "perUserLimit": 1,
+				"usageCount": 3, "createdAt": "x", "updatedAt": "x"}]`},
+		{name: "order for customer", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusOK,
+			header: jsonHeader, body: strings.Replace(order, `"updates": null`, `"updates": null, "customerId": "`+orderID+`",
+				"shippingAddress": {"name": "Jane Doe", "line1": "1 Main St", "city": "San Francisco", "region": "CA",
+				"postalCode": "94105", "country": "US"}, "billingAddress": {"country": "US"}`, 1)},
+		{name: "customers", method: http.MethodGet, route: "/ecommerce/v1/customers", status: http.StatusOK,
+			header: jsonHeader, body: `[{"customerId": "` + orderID + `", "name": "Jane Doe", "email": "jane@example.com",
+				"addresses": [{"addressId": "` + orderID + `", "type": "billing", "default": false, "name": "Jane Doe",
+				"line1": "1 Main St", "city": "Berlin", "postalCode": "10115", "country": "DE"}],
+				"createdAt": "x", "updatedAt": "x"}]`},
+		{name: "totals report", method: http.MethodGet, route: "/ecommerce/v1/reports/order-totals", status: http.StatusOK,
+			header: jsonHeader, body: `{"baseCurrency": "USD", "orderCount": 1, "totalAmount": "1.00", "currencies": [
+				{"currency": "USD", "orderCount": 1, "totalAmount": "1.00", "baseTotalAmount": "1.00", "currentRateOrderCount": 0}]}`},
+		{name: "amount as number", method: http.MethodGet, route: "/ecommerce/v1/orders/:id", status: http.StatusOK,
+			header: jsonHeader, body: strings.Replace(order, `"totalAmount": "1.00"`, `"totalAmount": 1`, 1),
+			violations: []string{"body /totalAmount: should be of type string"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := spec.ValidateResponse(tt.method, tt.route, tt.status, tt.header, []byte(tt.body))
+
+			require.Len(t, errs, len(tt.violations), "%v", errs)
+			for _, violation := range tt.violations {
+				assert.True(t, containsViolation(errs, violation), "%q not in %v", violation, errs)
+			}
+		})
+	}
+}
+
+func containsViolation(errs []error, violation string) bool {
+	for _, err := range errs {
+		if strings.Contains(err.Error(), violation) {
+			return true
+		}
+	}
+	return false
+}
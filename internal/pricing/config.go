@@ -0,0 +1,137 @@
+package pricing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/derickit/go-rest-api/internal/money"
+)
+
+var ErrInvalidRules = errors.New("invalid pricing rules")
+
+var (
+	countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+	regionCode  = regexp.MustCompile(`^[A-Z0-9]{1,3}$`)
+)
+
+// Config holds the pricing rules of a JSON file, they run in the order of the fields: line discounts, order discounts,
+// shipping fees and taxes, the rules of a field in the order they are listed. Coupons apply after the order discounts.
+type Config struct {
+	LineDiscounts  []LineDiscount  `json:"lineDiscounts"`
+	OrderDiscounts []OrderDiscount `json:"orderDiscounts"`
+	Shipping       Shipping        `json:"shipping"`
+	Taxes          Taxes           `json:"taxes"`
+}
+
+// LoadConfig reads the pricing rules file.
+func LoadConfig(file string) (*Config, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRules, err)
+	}
+	return ParseConfig(raw)
+}
+
+// ParseConfig reads the pricing rules from JSON, every invalid rule is reported in the returned error.
+func ParseConfig(raw []byte) (*Config, error) {
+	var cfg Config
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRules, err)
+	}
+	if errs := cfg.validate(); len(errs) > 0 {
+		return nil, errors.Join(append([]error{ErrInvalidRules}, errs...)...)
+	}
+	return &cfg, nil
+}
+
+// Rules returns the rules of the config in the order they run.
+func (cfg *Config) Rules() []Rule {
+	var rules []Rule
+	for _, d := range cfg.LineDiscounts {
+		rules = append(rules, d)
+	}
+	for _, d := range cfg.OrderDiscounts {
+		rules = append(rules, d)
+	}
+	rules = append(rules, CouponDiscount{})
+	if len(cfg.Shipping) > 0 {
+		rules = append(rules, cfg.Shipping)
+	}
+	if len(cfg.Taxes) > 0 {
+		rules = append(rules, cfg.Taxes)
+	}
+	return rules
+}
+
+func (cfg *Config) validate() []error {
+	var errs []error
+	invalid := func(section string, i int, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s[%d]: "+format, append([]any{section, i}, args...)...))
+	}
+	for i, d := range cfg.LineDiscounts {
+		if d.Name == "" {
+			invalid("lineDiscounts", i, "name should be defined")
+		}
+		if !validPercent(d.Percent) {
+			invalid("lineDiscounts", i, "percent should be greater than 0 and at most 100")
+		}
+	}
+	for i, d := range cfg.OrderDiscounts {
+		if d.Name == "" {
+			invalid("orderDiscounts", i, "name should be defined")
+		}
+		switch {
+		case d.Percent.IsZero() == d.Amount.IsZero():
+			invalid("orderDiscounts", i, "either percent or amount should be defined")
+		case !d.Percent.IsZero() && !validPercent(d.Percent):
+			invalid("orderDiscounts", i, "percent should be greater than 0 and at most 100")
+		case d.Amount.Sign() < 0:
+			invalid("orderDiscounts", i, "amount should be positive")
+		}
+		if d.MinSubtotal.Sign() < 0 {
+			invalid("orderDiscounts", i, "minSubtotal should not be negative")
+		}
+		if (!d.Amount.IsZero() || !d.MinSubtotal.IsZero()) && !d.Currency.IsValid() {
+			invalid("orderDiscounts", i, "currency should be the ISO 4217 currency of amount and minSubtotal")
+		}
+	}
+	for i, fee := range cfg.Shipping {
+		if fee.Name == "" {
+			invalid("shipping", i, "name should be defined")
+		}
+		if !fee.Currency.IsValid() {
+			invalid("shipping", i, "%q is not an ISO 4217 currency code", fee.Currency)
+		}
+		if fee.Country != "" && !countryCode.MatchString(fee.Country) {
+			invalid("shipping", i, "%q is not an ISO 3166-1 alpha-2 country code", fee.Country)
+		}
+		if fee.Fee.Sign() < 0 || (fee.FreeFrom != nil && fee.FreeFrom.Sign() < 0) {
+			invalid("shipping", i, "fee and freeFrom should not be negative")
+		}
+	}
+	for i, j := range cfg.Taxes {
+		if j.Name == "" {
+			invalid("taxes", i, "name should be defined")
+		}
+		if !countryCode.MatchString(j.Country) {
+			invalid("taxes", i, "%q is not an ISO 3166-1 alpha-2 country code", j.Country)
+		}
+		if j.Region != "" && !regionCode.MatchString(j.Region) {
+			invalid("taxes", i, "%q is not an ISO 3166-2 subdivision code", j.Region)
+		}
+		if j.Percent.Sign() < 0 || j.Percent.Cmp(hundred) > 0 {
+			invalid("taxes", i, "percent should be between 0 and 100")
+		}
+	}
+	return errs
+}
+
+func validPercent(percent money.Amount) bool {
+	return percent.Sign() > 0 && percent.Cmp(hundred) <= 0
+}
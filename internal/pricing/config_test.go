@@ -0,0 +1,67 @@
+package pricing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rulesJSON = `{
+	"lineDiscounts": [{"name": "bulk pens", "percent": "10", "minQuantity": 10, "products": ["pen"]}],
+	"orderDiscounts": [{"name": "big orders", "percent": "5", "currency": "USD", "minSubtotal": "100"}],
+	"shipping": [{"name": "domestic", "currency": "USD", "country": "US", "fee": "4.99", "freeFrom": "50"}],
+	"taxes": [{"name": "New York", "country": "US", "region": "NY", "percent": "4", "taxShipping": true}]
+}`
+
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pricing.json")
+	require.NoError(t, os.WriteFile(file, []byte(rulesJSON), 0o600))
+	cfg, err := pricing.LoadConfig(file)
+	require.NoError(t, err)
+	require.Len(t, cfg.Rules(), 5, "the coupon discount is added")
+
+	breakdown, err := pricing.NewPipeline(cfg.Rules()...).Price(context.TODO(), &pricing.Quote{
+		Currency:        "USD",
+		Products:        products(),
+		ShippingAddress: &data.Address{Country: "US", Region: "NY"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "28.07", breakdown.Total.String(), "22.00 after the line discount, 4.99 shipping, 4% tax of 26.99")
+
+	_, err = pricing.LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, pricing.ErrInvalidRules)
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	testCases := []struct {
+		description string
+		raw         string
+		problems    []string
+	}{
+		{"not json", `{`, []string{"unexpected EOF"}},
+		{"unknown field", `{"discounts": []}`, []string{"unknown field"}},
+		{"line discount", `{"lineDiscounts": [{"percent": "120"}]}`,
+			[]string{"lineDiscounts[0]: name should be defined", "lineDiscounts[0]: percent should be greater than 0"}},
+		{"order discount", `{"orderDiscounts": [{"name": "d", "percent": "5", "amount": "5"}, {"name": "e", "amount": "5"}]}`,
+			[]string{"orderDiscounts[0]: either percent or amount", "orderDiscounts[1]: currency should be"}},
+		{"shipping", `{"shipping": [{"name": "s", "currency": "usd", "country": "USA", "fee": "-1"}]}`,
+			[]string{`"usd" is not an ISO 4217`, `"USA" is not an ISO 3166-1`, "fee and freeFrom should not be negative"}},
+		{"taxes", `{"taxes": [{"name": "t", "country": "us", "region": "new york", "percent": "101"}]}`,
+			[]string{`"us" is not an ISO 3166-1`, `"new york" is not an ISO 3166-2`, "percent should be between 0 and 100"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := pricing.ParseConfig([]byte(tc.raw))
+			require.ErrorIs(t, err, pricing.ErrInvalidRules)
+			for _, problem := range tc.problems {
+				assert.ErrorContains(t, err, problem)
+			}
+		})
+	}
+}
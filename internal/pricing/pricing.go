@@ -0,0 +1,106 @@
+// Package pricing prices orders with an ordered chain of rules, every change a rule makes to the price is recorded
+// so that the total of an order can be explained.
+package pricing
+
+import (
+	"context"
+	"slices"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/util"
+)
+
+// Rule adjusts the price of a quote, rules see the adjustments of the rules that ran before them.
+type Rule interface {
+	Apply(ctx context.Context, q *Quote) error
+}
+
+// RuleFunc adapts a function to a Rule.
+type RuleFunc func(ctx context.Context, q *Quote) error
+
+func (f RuleFunc) Apply(ctx context.Context, q *Quote) error {
+	return f(ctx, q)
+}
+
+// Quote is an order being priced.
+type Quote struct {
+	Currency        money.Currency
+	Products        []data.Product
+	ShippingAddress *data.Address
+	// Coupon is the coupon redeemed by the order, see CouponDiscount
+	Coupon *data.AppliedCoupon
+
+	adjustments []data.PriceAdjustment
+}
+
+// Subtotal is the price of the products before any adjustment.
+func (q *Quote) Subtotal() money.Amount {
+	return util.CalculateTotalAmount(q.Products, q.Currency)
+}
+
+// Total is the subtotal with the adjustments made so far.
+func (q *Quote) Total() money.Amount {
+	return q.Subtotal().Add(q.Sum())
+}
+
+// Sum adds up the adjustments of the kinds, of every kind when none is given.
+func (q *Quote) Sum(kinds ...data.AdjustmentKind) money.Amount {
+	sum := q.Currency.Round(money.Amount{})
+	for _, adj := range q.adjustments {
+		if len(kinds) == 0 || slices.Contains(kinds, adj.Kind) {
+			sum = sum.Add(adj.Amount)
+		}
+	}
+	return sum
+}
+
+// LineTotal is the price of the quantity of the product at index line with the line discounts made so far.
+func (q *Quote) LineTotal(line int) money.Amount {
+	product := q.Products[line]
+	total := q.Currency.Round(product.Price.MulInt(int64(product.Quantity)))
+	for _, adj := range q.adjustments {
+		if adj.Line != nil && *adj.Line == line {
+			total = total.Add(adj.Amount)
+		}
+	}
+	return total
+}
+
+// Adjust records an adjustment, its amount is rounded to the minor unit of the currency.
+func (q *Quote) Adjust(adj data.PriceAdjustment) {
+	adj.Amount = q.Currency.Round(adj.Amount)
+	q.adjustments = append(q.adjustments, adj)
+}
+
+// Pipeline runs its rules in order to price orders, a pipeline without rules prices orders at their subtotal.
+type Pipeline struct {
+	rules []Rule
+}
+
+func NewPipeline(rules ...Rule) *Pipeline {
+	return &Pipeline{rules: rules}
+}
+
+// Price runs the rules on q and returns the resulting breakdown, the adjustments of earlier calls are discarded.
+func (p *Pipeline) Price(ctx context.Context, q *Quote) (*data.PriceBreakdown, error) {
+	q.adjustments = nil
+	for _, rule := range p.rules {
+		if err := rule.Apply(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+	adjustments := q.adjustments
+	if adjustments == nil {
+		adjustments = []data.PriceAdjustment{}
+	}
+	return &data.PriceBreakdown{
+		Subtotal:       q.Subtotal(),
+		LineDiscounts:  q.Sum(data.LineDiscount),
+		OrderDiscounts: q.Sum(data.OrderDiscount),
+		Shipping:       q.Sum(data.ShippingFee),
+		Tax:            q.Sum(data.Tax),
+		Total:          q.Total(),
+		Adjustments:    adjustments,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package pricing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func products() []data.Product {
+	return []data.Product{
+		{Name: "pen", Price: money.MustParseAmount("1.50"), Quantity: 10},
+		{Name: "notebook", Price: money.MustParseAmount("4.25"), Quantity: 2},
+	}
+}
+
+func TestPipeline_Price(t *testing.T) {
+	pipeline := pricing.NewPipeline(
+		pricing.LineDiscount{Name: "bulk pens", Percent: money.MustParseAmount("10"), MinQuantity: 10},
+		pricing.OrderDiscount{Name: "welcome", Amount: money.MustParseAmount("2"), Currency: "USD"},
+		pricing.Shipping{{Name: "domestic", Currency: "USD", Country: "US", Fee: money.MustParseAmount("4.99")}},
+		pricing.Taxes{{Name: "California", Country: "US", Region: "CA", Percent: money.MustParseAmount("7.25")}},
+	)
+	breakdown, err := pipeline.Price(context.TODO(), &pricing.Quote{
+		Currency:        "USD",
+		Products:        products(),
+		ShippingAddress: &data.Address{Country: "US", Region: "CA"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "23.50", breakdown.Subtotal.String())
+	assert.Equal(t, "-1.50", breakdown.LineDiscounts.String())
+	assert.Equal(t, "-2.00", breakdown.OrderDiscounts.String())
+	assert.Equal(t, "4.99", breakdown.Shipping.String())
+	assert.Equal(t, "1.45", breakdown.Tax.String(), "7.25% of 20.00 after discounts")
+	assert.Equal(t, "26.44", breakdown.Total.String())
+
+	require.Len(t, breakdown.Adjustments, 4)
+	assert.Equal(t, "bulk pens", breakdown.Adjustments[0].Rule)
+	require.NotNil(t, breakdown.Adjustments[0].Line)
+	assert.Equal(t, 0, *breakdown.Adjustments[0].Line)
+	for i, kind := range []data.AdjustmentKind{data.LineDiscount, data.OrderDiscount, data.ShippingFee, data.Tax} {
+		assert.Equal(t, kind, breakdown.Adjustments[i].Kind, "rules should be recorded in the order they ran")
+	}
+}
+
+func TestPipeline_Price_NoRules(t *testing.T) {
+	breakdown, err := pricing.NewPipeline().Price(context.TODO(), &pricing.Quote{Currency: "USD", Products: products()})
+	require.NoError(t, err)
+	assert.Equal(t, "23.50", breakdown.Total.String())
+	assert.Equal(t, "0.00", breakdown.Tax.String())
+	assert.Empty(t, breakdown.Adjustments)
+}
+
+func TestPipeline_Price_RuleFails(t *testing.T) {
+	errRule := errors.New("rule failed")
+	pipeline := pricing.NewPipeline(pricing.RuleFunc(func(_ context.Context, _ *pricing.Quote) error {
+		return errRule
+	}))
+	_, err := pipeline.Price(context.TODO(), &pricing.Quote{Currency: "USD", Products: products()})
+	assert.ErrorIs(t, err, errRule)
+}
@@ -0,0 +1,198 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+)
+
+var hundred = money.NewAmount(100, 0)
+
+var ErrCouponNotApplicable = errors.New("coupon doesn't apply to the order")
+
+// LineDiscount takes Percent off the lines of the products named in Products, of every product when empty, ordered
+// in a quantity of at least MinQuantity. Discounts of several rules on a line compound.
+type LineDiscount struct {
+	Name        string       `json:"name"`
+	Percent     money.Amount `json:"percent"`
+	MinQuantity uint64       `json:"minQuantity"`
+	Products    []string     `json:"products"`
+}
+
+func (d LineDiscount) Apply(_ context.Context, q *Quote) error {
+	for i, product := range q.Products {
+		if product.Quantity < d.MinQuantity || (len(d.Products) > 0 && !slices.Contains(d.Products, product.Name)) {
+			continue
+		}
+		discount := percentOf(q.LineTotal(i), d.Percent, q.Currency)
+		if discount.IsZero() {
+			continue
+		}
+		line := i
+		q.Adjust(data.PriceAdjustment{
+			Rule:        d.Name,
+			Kind:        data.LineDiscount,
+			Line:        &line,
+			Description: fmt.Sprintf("%s%% off %d x %s", d.Percent, product.Quantity, product.Name),
+			Amount:      discount.Neg(),
+		})
+	}
+	return nil
+}
+
+// OrderDiscount takes Percent or Amount off orders of at least MinSubtotal after the discounts of earlier rules.
+// Amount and MinSubtotal are in Currency, discounts setting either only apply to orders in Currency, percent discounts
+// without them to orders in any currency unless Currency is set.
+type OrderDiscount struct {
+	Name        string         `json:"name"`
+	Percent     money.Amount   `json:"percent"`
+	Amount      money.Amount   `json:"amount"`
+	Currency    money.Currency `json:"currency"`
+	MinSubtotal money.Amount   `json:"minSubtotal"`
+}
+
+func (d OrderDiscount) Apply(_ context.Context, q *Quote) error {
+	inCurrency := d.Currency != "" || !d.Amount.IsZero() || !d.MinSubtotal.IsZero()
+	if inCurrency && d.Currency != q.Currency {
+		return nil
+	}
+	total := q.Total()
+	if total.Cmp(d.MinSubtotal) < 0 {
+		return nil
+	}
+	discount, description := d.Amount, fmt.Sprintf("%s %s off", d.Amount, d.Currency)
+	if d.Amount.IsZero() {
+		discount, description = percentOf(total, d.Percent, q.Currency), fmt.Sprintf("%s%% off %s", d.Percent, total)
+	}
+	if discount.Cmp(total) > 0 {
+		// orders are never discounted below zero
+		discount = total
+	}
+	if discount.Sign() <= 0 {
+		return nil
+	}
+	q.Adjust(data.PriceAdjustment{
+		Rule:        d.Name,
+		Kind:        data.OrderDiscount,
+		Description: description,
+		Amount:      discount.Neg(),
+	})
+	return nil
+}
+
+// CouponDiscount takes the discount of the coupon redeemed by an order off after the order discounts,
+// ErrCouponNotApplicable is returned when the order doesn't meet the terms of the coupon.
+type CouponDiscount struct{}
+
+func (CouponDiscount) Apply(ctx context.Context, q *Quote) error {
+	if q.Coupon == nil {
+		return nil
+	}
+	terms := q.Coupon.CouponTerms
+	if terms.Currency != "" && terms.Currency != q.Currency {
+		return fmt.Errorf("%w: coupon %s is only valid for orders in %s", ErrCouponNotApplicable, q.Coupon.Code,
+			terms.Currency)
+	}
+	discount := OrderDiscount{Name: "coupon " + q.Coupon.Code, Currency: terms.Currency}
+	if terms.MinSpend != nil && q.Total().Cmp(*terms.MinSpend) < 0 {
+		return fmt.Errorf("%w: coupon %s requires a spend of at least %s %s", ErrCouponNotApplicable,
+			q.Coupon.Code, terms.MinSpend, terms.Currency)
+	}
+	switch {
+	case terms.Type == data.PercentageDiscount && terms.Percent != nil:
+		discount.Percent = *terms.Percent
+	case terms.Type == data.FixedDiscount && terms.Amount != nil:
+		discount.Amount = *terms.Amount
+	default:
+		return fmt.Errorf("%w: coupon %s has no discount", ErrCouponNotApplicable, q.Coupon.Code)
+	}
+	return discount.Apply(ctx, q)
+}
+
+// ShippingFee is the fee of shipping orders in Currency to Country, to any country when it is empty. Orders of at
+// least FreeFrom after discounts ship for free.
+type ShippingFee struct {
+	Name     string         `json:"name"`
+	Currency money.Currency `json:"currency"`
+	Country  string         `json:"country"`
+	Fee      money.Amount   `json:"fee"`
+	FreeFrom *money.Amount  `json:"freeFrom"`
+}
+
+// Shipping charges the first fee matching the currency and the country of an order, orders no fee matches ship
+// for free.
+type Shipping []ShippingFee
+
+func (s Shipping) Apply(_ context.Context, q *Quote) error {
+	for _, fee := range s {
+		if fee.Currency != q.Currency || (fee.Country != "" && fee.Country != country(q.ShippingAddress)) {
+			continue
+		}
+		adj := data.PriceAdjustment{
+			Rule:        fee.Name,
+			Kind:        data.ShippingFee,
+			Description: fmt.Sprintf("shipping %s %s", fee.Fee, fee.Currency),
+			Amount:      fee.Fee,
+		}
+		if fee.FreeFrom != nil && q.Total().Cmp(*fee.FreeFrom) >= 0 {
+			adj.Description = fmt.Sprintf("free shipping from %s %s", fee.FreeFrom, fee.Currency)
+			adj.Amount = money.Amount{}
+		}
+		q.Adjust(adj)
+		return nil
+	}
+	return nil
+}
+
+// Jurisdiction taxes the orders shipped to Country, or only to Region of Country when it is set, at Percent of the
+// price of the products after discounts, and of the shipping fees when TaxShipping is set.
+type Jurisdiction struct {
+	Name        string       `json:"name"`
+	Country     string       `json:"country"`
+	Region      string       `json:"region"`
+	Percent     money.Amount `json:"percent"`
+	TaxShipping bool         `json:"taxShipping"`
+}
+
+// Taxes charges the tax of every jurisdiction an order ships to, e.g. a federal and a state tax. Orders without
+// shipping address aren't taxed.
+type Taxes []Jurisdiction
+
+func (t Taxes) Apply(_ context.Context, q *Quote) error {
+	if q.ShippingAddress == nil {
+		return nil
+	}
+	goods := q.Subtotal().Add(q.Sum(data.LineDiscount, data.OrderDiscount))
+	for _, j := range t {
+		if j.Country != q.ShippingAddress.Country || (j.Region != "" && j.Region != q.ShippingAddress.Region) {
+			continue
+		}
+		taxable := goods
+		if j.TaxShipping {
+			taxable = taxable.Add(q.Sum(data.ShippingFee))
+		}
+		q.Adjust(data.PriceAdjustment{
+			Rule:        j.Name,
+			Kind:        data.Tax,
+			Description: fmt.Sprintf("%s%% of %s", j.Percent, taxable),
+			Amount:      percentOf(taxable, j.Percent, q.Currency),
+		})
+	}
+	return nil
+}
+
+// percentOf returns percent % of a, rounded half to even to the minor unit of the currency.
+func percentOf(a, percent money.Amount, currency money.Currency) money.Amount {
+	return a.Mul(percent).QuoRound(hundred, currency.MinorUnits())
+}
+
+func country(address *data.Address) string {
+	if address == nil {
+		return ""
+	}
+	return address.Country
+}
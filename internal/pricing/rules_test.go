@@ -0,0 +1,201 @@
+package pricing_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func price(t *testing.T, q *pricing.Quote, rules ...pricing.Rule) *data.PriceBreakdown {
+	t.Helper()
+	breakdown, err := pricing.NewPipeline(rules...).Price(context.TODO(), q)
+	require.NoError(t, err)
+	return breakdown
+}
+
+func TestLineDiscount(t *testing.T) {
+	testCases := []struct {
+		description string
+		rules       []pricing.Rule
+		discounts   string
+	}{
+		{"every product", []pricing.Rule{pricing.LineDiscount{Name: "sale", Percent: money.MustParseAmount("10")}}, "-2.35"},
+		{"below min quantity", []pricing.Rule{
+			pricing.LineDiscount{Name: "bulk", Percent: money.MustParseAmount("10"), MinQuantity: 20}}, "0.00"},
+		{"named products", []pricing.Rule{
+			pricing.LineDiscount{Name: "notebooks", Percent: money.MustParseAmount("50"), Products: []string{"notebook"}}},
+			"-4.25"},
+		{"compound", []pricing.Rule{
+			pricing.LineDiscount{Name: "half", Percent: money.MustParseAmount("50"), Products: []string{"pen"}},
+			pricing.LineDiscount{Name: "all", Percent: money.MustParseAmount("100"), Products: []string{"pen"}}},
+			"-15.00"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			breakdown := price(t, &pricing.Quote{Currency: "USD", Products: products()}, tc.rules...)
+			assert.Equal(t, tc.discounts, breakdown.LineDiscounts.String())
+		})
+	}
+}
+
+func TestOrderDiscount(t *testing.T) {
+	testCases := []struct {
+		description string
+		discount    pricing.OrderDiscount
+		currency    money.Currency
+		discounts   string
+	}{
+		{"percent rounds half to even", pricing.OrderDiscount{Name: "d", Percent: money.MustParseAmount("15")}, "USD",
+			"-3.52"},
+		{"amount", pricing.OrderDiscount{Name: "d", Amount: money.MustParseAmount("5"), Currency: "USD"}, "USD", "-5.00"},
+		{"other currency", pricing.OrderDiscount{Name: "d", Amount: money.MustParseAmount("5"), Currency: "EUR"}, "USD",
+			"0.00"},
+		{"amount without currency", pricing.OrderDiscount{Name: "d", Amount: money.MustParseAmount("5")}, "USD", "0.00"},
+		{"min subtotal without currency", pricing.OrderDiscount{Name: "d", Percent: money.MustParseAmount("15"),
+			MinSubtotal: money.MustParseAmount("1")}, "USD", "0.00"},
+		{"percent in any currency", pricing.OrderDiscount{Name: "d", Percent: money.MustParseAmount("15")}, "EUR",
+			"-3.52"},
+		{"percent in other currency", pricing.OrderDiscount{Name: "d", Percent: money.MustParseAmount("15"),
+			Currency: "EUR"}, "USD", "0.00"},
+		{"below min subtotal", pricing.OrderDiscount{Name: "d", Percent: money.MustParseAmount("15"), Currency: "USD",
+			MinSubtotal: money.MustParseAmount("50")}, "USD", "0.00"},
+		{"not below zero", pricing.OrderDiscount{Name: "d", Amount: money.MustParseAmount("100"), Currency: "USD"}, "USD",
+			"-23.50"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			breakdown := price(t, &pricing.Quote{Currency: tc.currency, Products: products()}, tc.discount)
+			assert.Equal(t, tc.discounts, breakdown.OrderDiscounts.String())
+		})
+	}
+}
+
+func TestOrderDiscount_MixedCurrencies(t *testing.T) {
+	rules := []pricing.Rule{
+		pricing.OrderDiscount{Name: "usd", Amount: money.MustParseAmount("5"), Currency: "USD"},
+		pricing.OrderDiscount{Name: "eur", Amount: money.MustParseAmount("4"), Currency: "EUR"},
+		pricing.OrderDiscount{Name: "any", Amount: money.MustParseAmount("3")},
+	}
+	for _, currency := range []money.Currency{"USD", "EUR"} {
+		t.Run(string(currency), func(t *testing.T) {
+			breakdown := price(t, &pricing.Quote{Currency: currency, Products: products()}, rules...)
+			require.Len(t, breakdown.Adjustments, 1)
+			assert.Equal(t, strings.ToLower(string(currency)), breakdown.Adjustments[0].Rule)
+			assert.Contains(t, breakdown.Adjustments[0].Description, string(currency))
+		})
+	}
+}
+
+func TestShipping(t *testing.T) {
+	freeFrom := money.MustParseAmount("20")
+	shipping := pricing.Shipping{
+		{Name: "domestic", Currency: "USD", Country: "US", Fee: money.MustParseAmount("4.99"), FreeFrom: &freeFrom},
+		{Name: "international", Currency: "USD", Fee: money.MustParseAmount("14.99")},
+	}
+	testCases := []struct {
+		description string
+		address     *data.Address
+		discount    pricing.Rule
+		fee         string
+		rule        string
+	}{
+		{"free from", &data.Address{Country: "US"}, nil, "0.00", "domestic"},
+		{"below free from", &data.Address{Country: "US"},
+			pricing.OrderDiscount{Name: "d", Amount: money.MustParseAmount("5"), Currency: "USD"}, "4.99", "domestic"},
+		{"other country", &data.Address{Country: "DE"}, nil, "14.99", "international"},
+		{"no address", nil, nil, "14.99", "international"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var rules []pricing.Rule
+			if tc.discount != nil {
+				rules = append(rules, tc.discount)
+			}
+			breakdown := price(t, &pricing.Quote{Currency: "USD", Products: products(), ShippingAddress: tc.address},
+				append(rules, shipping)...)
+			assert.Equal(t, tc.fee, breakdown.Shipping.String())
+			assert.Equal(t, tc.rule, breakdown.Adjustments[len(breakdown.Adjustments)-1].Rule,
+				"the fee charged should be recorded, also when it is free")
+		})
+	}
+
+	breakdown := price(t, &pricing.Quote{Currency: "EUR", Products: products()}, shipping)
+	assert.Empty(t, breakdown.Adjustments, "no fee is in EUR")
+}
+
+func TestTaxes(t *testing.T) {
+	taxes := pricing.Taxes{
+		{Name: "GST", Country: "CA", Percent: money.MustParseAmount("5"), TaxShipping: true},
+		{Name: "PST", Country: "CA", Region: "BC", Percent: money.MustParseAmount("7")},
+	}
+	shipping := pricing.Shipping{{Name: "flat", Currency: "CAD", Fee: money.MustParseAmount("10")}}
+	testCases := []struct {
+		description string
+		address     *data.Address
+		tax         string
+	}{
+		{"country and region", &data.Address{Country: "CA", Region: "BC"}, "3.32"},
+		{"country", &data.Address{Country: "CA", Region: "ON"}, "1.68"},
+		{"other country", &data.Address{Country: "US", Region: "BC"}, "0.00"},
+		{"no address", nil, "0.00"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			breakdown := price(t, &pricing.Quote{Currency: "CAD", Products: products(), ShippingAddress: tc.address},
+				shipping, taxes)
+			assert.Equal(t, tc.tax, breakdown.Tax.String(), "GST of 33.50 with shipping, PST of 23.50")
+		})
+	}
+}
+
+func TestTaxes_RoundsToMinorUnit(t *testing.T) {
+	breakdown := price(t, &pricing.Quote{
+		Currency:        "JPY",
+		Products:        []data.Product{{Name: "tea", Price: money.MustParseAmount("1234"), Quantity: 1}},
+		ShippingAddress: &data.Address{Country: "JP"},
+	}, pricing.Taxes{{Name: "consumption tax", Country: "JP", Percent: money.MustParseAmount("10")}})
+	assert.Equal(t, "123", breakdown.Tax.String())
+	assert.Equal(t, "1357", breakdown.Total.String())
+}
+
+func TestCouponDiscount(t *testing.T) {
+	percent, amount := money.MustParseAmount("20"), money.MustParseAmount("30")
+	minSpend := money.MustParseAmount("50")
+	testCases := []struct {
+		description string
+		terms       data.CouponTerms
+		discounts   string
+		err         error
+	}{
+		{"percentage", data.CouponTerms{Type: data.PercentageDiscount, Percent: &percent}, "-4.70", nil},
+		{"fixed not below zero", data.CouponTerms{Type: data.FixedDiscount, Amount: &amount, Currency: "USD"}, "-23.50",
+			nil},
+		{"other currency", data.CouponTerms{Type: data.FixedDiscount, Amount: &amount, Currency: "EUR"}, "",
+			pricing.ErrCouponNotApplicable},
+		{"below min spend", data.CouponTerms{Type: data.PercentageDiscount, Percent: &percent, Currency: "USD",
+			MinSpend: &minSpend}, "", pricing.ErrCouponNotApplicable},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			q := &pricing.Quote{Currency: "USD", Products: products(),
+				Coupon: &data.AppliedCoupon{Code: "SPRING", CouponTerms: tc.terms}}
+			breakdown, err := pricing.NewPipeline(pricing.CouponDiscount{}).Price(context.TODO(), q)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.discounts, breakdown.OrderDiscounts.String())
+			assert.Equal(t, "coupon SPRING", breakdown.Adjustments[0].Rule)
+		})
+	}
+
+	breakdown := price(t, &pricing.Quote{Currency: "USD", Products: products()}, pricing.CouponDiscount{})
+	assert.Empty(t, breakdown.Adjustments, "orders without coupon are not discounted")
+}
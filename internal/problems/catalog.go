@@ -0,0 +1,151 @@
+// Package problems reports the errors of the handlers and the repos they call as RFC 7807 problems, it sits above
+// the packages whose errors it maps so that they can report errors of package errors themselves.
+package problems
+
+import (
+	stdErrors "errors"
+	"net/http"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/pricing"
+	"github.com/derickit/go-rest-api/internal/rates"
+)
+
+// entry is how an error is reported to clients.
+type entry struct {
+	err    error
+	status int
+	title  string
+	// codes is the error code per operation, the code of the empty Op is used for every other operation
+	codes map[errors.Op]string
+	// public errors describe the problem without leaking internals, their text becomes the detail
+	public bool
+}
+
+var catalog = []entry{
+	{err: db.ErrPOIDNotFound, status: http.StatusNotFound, title: "order not found", codes: map[errors.Op]string{
+		errors.OpGet: errors.OrderGetNotFound, errors.OpUpdate: errors.OrderUpdateNotFound,
+		errors.OpDelete: errors.OrderDeleteNotFound,
+	}},
+	{err: db.ErrInvalidPOIDUpdate, status: http.StatusBadRequest, title: "invalid order id", codes: map[errors.Op]string{
+		errors.OpGet: errors.OrderGetInvalidID, errors.OpUpdate: errors.OrderUpdateInvalidID,
+		errors.OpDelete: errors.OrderDeleteInvalidID,
+	}},
+	{err: errors.ErrPreconditionFailed, status: http.StatusPreconditionFailed,
+		title: "order has been modified, If-Match does not match the current version", codes: map[errors.Op]string{
+			errors.OpUpdate: errors.OrderUpdatePreconditionFail, errors.OpDelete: errors.OrderDeletePreconditionFail,
+		}},
+	{err: db.ErrVersionConflict, status: http.StatusConflict,
+		title: "order has been modified by another request, retry with the latest version", codes: map[errors.Op]string{
+			errors.OpUpdate: errors.OrderUpdateVersionConflict, errors.OpDelete: errors.OrderDeleteVersionConflict,
+		}},
+	{err: errors.ErrTransitionNotAllowed, status: http.StatusConflict, title: "order status transition is not allowed",
+		codes: map[errors.Op]string{"": errors.OrderTransitionNotAllowed}, public: true},
+	{err: errors.ErrProductsLocked, status: http.StatusConflict,
+		title: "order products can't change once it is delivered, completed or cancelled",
+		codes: map[errors.Op]string{"": errors.OrderUpdateProductsLocked}, public: true},
+	{err: errors.ErrInvalidInput, status: http.StatusBadRequest, title: "invalid request body",
+		codes: map[errors.Op]string{
+			errors.OpCreate: errors.OrderCreateInvalidInput, errors.OpUpdate: errors.OrderUpdateInvalidInput,
+			errors.OpCouponCreate: errors.CouponCreateInvalidInput, errors.OpCouponUpdate: errors.CouponUpdateInvalidInput,
+			errors.OpCustomerCreate: errors.CustomerCreateInvalidInput,
+			errors.OpCustomerUpdate: errors.CustomerUpdateInvalidInput,
+		}},
+	{err: db.ErrCouponNotFound, status: http.StatusNotFound, title: "coupon not found", codes: map[errors.Op]string{
+		errors.OpCouponGet: errors.CouponGetNotFound, errors.OpCouponUpdate: errors.CouponUpdateNotFound,
+		errors.OpCouponDelete: errors.CouponDeleteNotFound,
+	}},
+	{err: db.ErrInvalidCouponID, status: http.StatusBadRequest, title: "invalid coupon id", codes: map[errors.Op]string{
+		errors.OpCouponGet: errors.CouponGetInvalidID, errors.OpCouponUpdate: errors.CouponUpdateInvalidID,
+		errors.OpCouponDelete: errors.CouponDeleteInvalidID,
+	}},
+	{err: db.ErrCouponCodeExists, status: http.StatusConflict, title: "coupon code is already used",
+		codes: map[errors.Op]string{"": errors.CouponCodeExists}, public: true},
+	{err: pricing.ErrCouponNotApplicable, status: http.StatusUnprocessableEntity, title: "coupon doesn't apply",
+		codes: map[errors.Op]string{"": errors.CouponNotApplicable}, public: true},
+	{err: db.ErrCouponNotActive, status: http.StatusUnprocessableEntity, title: "coupon is not active",
+		codes: map[errors.Op]string{"": errors.CouponNotActive}, public: true},
+	{err: db.ErrCouponUsageLimit, status: http.StatusUnprocessableEntity, title: "coupon usage limit reached",
+		codes: map[errors.Op]string{"": errors.CouponUsageLimitReached}, public: true},
+	{err: db.ErrCouponUserLimit, status: http.StatusUnprocessableEntity, title: "coupon usage limit reached",
+		codes: map[errors.Op]string{"": errors.CouponUserLimitReached}, public: true},
+	{err: db.ErrCustomerNotFound, status: http.StatusNotFound, title: "customer not found", codes: map[errors.Op]string{
+		errors.OpCustomerGet: errors.CustomerGetNotFound, errors.OpCustomerUpdate: errors.CustomerUpdateNotFound,
+		errors.OpCustomerDelete: errors.CustomerDeleteNotFound, errors.OpCreate: errors.OrderCreateCustomerNotFound,
+	}},
+	{err: db.ErrInvalidCustomerID, status: http.StatusBadRequest, title: "invalid customer id",
+		codes: map[errors.Op]string{
+			errors.OpCustomerGet: errors.CustomerGetInvalidID, errors.OpCustomerUpdate: errors.CustomerUpdateInvalidID,
+			errors.OpCustomerDelete: errors.CustomerDeleteInvalidID,
+		}},
+	{err: db.ErrCustomerEmailExists, status: http.StatusConflict, title: "email is already used by another customer",
+		codes: map[errors.Op]string{"": errors.CustomerEmailExists}, public: true},
+	{err: rates.ErrRateNotFound, status: http.StatusUnprocessableEntity, title: "currency is not supported",
+		codes: map[errors.Op]string{"": errors.UnsupportedCurrency}, public: true},
+	{err: errors.ErrUnsupportedMediaType, status: http.StatusUnsupportedMediaType, title: "unsupported media type",
+		codes: map[errors.Op]string{"": errors.UnsupportedMediaType}, public: true},
+	{err: errors.ErrInvalidQueryParam, status: http.StatusBadRequest, title: "invalid query param",
+		codes: map[errors.Op]string{
+			"": errors.OrderGetInvalidParams, errors.OpCustomerGet: errors.CustomerGetInvalidParams,
+		}, public: true},
+	{err: db.ErrInvalidFilter, status: http.StatusBadRequest, title: "unsupported filter",
+		codes: map[errors.Op]string{"": errors.UnsupportedQueryParam}, public: true},
+	{err: db.ErrInvalidFilterOp, status: http.StatusBadRequest, title: "unsupported filter operator",
+		codes: map[errors.Op]string{"": errors.UnsupportedQueryOperator}, public: true},
+	{err: db.ErrInvalidFilterValue, status: http.StatusBadRequest, title: "invalid filter value",
+		codes: map[errors.Op]string{"": errors.OrderGetInvalidFilter}, public: true},
+	{err: db.ErrInvalidSort, status: http.StatusBadRequest, title: "unsupported sort",
+		codes: map[errors.Op]string{"": errors.OrderGetInvalidSort}, public: true},
+	{err: db.ErrCursorWithSort, status: http.StatusBadRequest, title: "invalid query param",
+		codes: map[errors.Op]string{"": errors.OrderGetInvalidParams}, public: true},
+}
+
+var serverErrorCodes = map[errors.Op]string{
+	errors.OpCreate: errors.OrderCreateServerError,
+	errors.OpGet:    errors.OrderGetServerError,
+	errors.OpUpdate: errors.OrderUpdateServerError,
+	errors.OpDelete: errors.OrderDeleteServerError,
+
+	errors.OpCouponCreate: errors.CouponCreateServerError,
+	errors.OpCouponGet:    errors.CouponGetServerError,
+	errors.OpCouponUpdate: errors.CouponUpdateServerError,
+	errors.OpCouponDelete: errors.CouponDeleteServerError,
+
+	errors.OpCustomerCreate: errors.CustomerCreateServerError,
+	errors.OpCustomerGet:    errors.CustomerGetServerError,
+	errors.OpCustomerUpdate: errors.CustomerUpdateServerError,
+	errors.OpCustomerDelete: errors.CustomerDeleteServerError,
+}
+
+// For returns how err, raised by op, is reported to clients. Errors missing from the catalog are reported as
+// unexpected server errors without any detail, validation errors list the problem of every invalid field.
+func For(op errors.Op, err error) *external.APIError {
+	for _, e := range catalog {
+		if !stdErrors.Is(err, e.err) {
+			continue
+		}
+		code, ok := e.codes[op]
+		if !ok {
+			code = e.codes[""]
+		}
+		apiErr := &external.APIError{
+			HTTPStatusCode: e.status,
+			Title:          e.title,
+			Message:        e.title,
+			ErrorCode:      code,
+			Errors:         errors.FieldErrors(err),
+		}
+		if e.public {
+			apiErr.Message = err.Error()
+		}
+		return apiErr
+	}
+	return &external.APIError{
+		HTTPStatusCode: http.StatusInternalServerError,
+		Title:          errors.UnexpectedErrorMessage,
+		Message:        errors.UnexpectedErrorMessage,
+		ErrorCode:      serverErrorCodes[op],
+	}
+}
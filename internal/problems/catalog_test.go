@@ -0,0 +1,117 @@
+package problems_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/db"
+	"github.com/derickit/go-rest-api/internal/errors"
+	"github.com/derickit/go-rest-api/internal/models/external"
+	"github.com/derickit/go-rest-api/internal/problems"
+	"github.com/derickit/go-rest-api/internal/rates"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		op         errors.Op
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{name: "not found", op: errors.OpGet, err: db.ErrPOIDNotFound,
+			wantStatus: http.StatusNotFound, wantCode: errors.OrderGetNotFound, wantDetail: "order not found"},
+		{name: "not found on delete", op: errors.OpDelete, err: fmt.Errorf("lookup: %w", db.ErrPOIDNotFound),
+			wantStatus: http.StatusNotFound, wantCode: errors.OrderDeleteNotFound, wantDetail: "order not found"},
+		{name: "invalid id", op: errors.OpUpdate, err: fmt.Errorf("%w %q", db.ErrInvalidPOIDUpdate, "1"),
+			wantStatus: http.StatusBadRequest, wantCode: errors.OrderUpdateInvalidID, wantDetail: "invalid order id"},
+		{name: "version conflict", op: errors.OpUpdate, err: db.ErrVersionConflict,
+			wantStatus: http.StatusConflict, wantCode: errors.OrderUpdateVersionConflict,
+			wantDetail: "order has been modified by another request, retry with the latest version"},
+		{name: "precondition wins over the conflict it wraps", op: errors.OpDelete,
+			err:        fmt.Errorf("%w: %w", errors.ErrPreconditionFailed, db.ErrVersionConflict),
+			wantStatus: http.StatusPreconditionFailed, wantCode: errors.OrderDeletePreconditionFail,
+			wantDetail: "order has been modified, If-Match does not match the current version"},
+		{name: "public detail", op: errors.OpGet, err: fmt.Errorf("%w createdAt[ne]", db.ErrInvalidFilterOp),
+			wantStatus: http.StatusBadRequest, wantCode: errors.UnsupportedQueryOperator,
+			wantDetail: "unsupported order filter operator createdAt[ne]"},
+		{name: "missing exchange rate", op: errors.OpCreate, err: fmt.Errorf("%w from CHF to USD", rates.ErrRateNotFound),
+			wantStatus: http.StatusUnprocessableEntity, wantCode: errors.UnsupportedCurrency,
+			wantDetail: "exchange rate not found from CHF to USD"},
+		{name: "products locked", op: errors.OpUpdate, err: fmt.Errorf("%w: order is OrderDelivered",
+			errors.ErrProductsLocked), wantStatus: http.StatusConflict, wantCode: errors.OrderUpdateProductsLocked,
+			wantDetail: "order products can't change: order is OrderDelivered"},
+		{name: "coupon not found", op: errors.OpCouponUpdate, err: db.ErrCouponNotFound,
+			wantStatus: http.StatusNotFound, wantCode: errors.CouponUpdateNotFound, wantDetail: "coupon not found"},
+		{name: "coupon limit on order create", op: errors.OpCreate, err: db.ErrCouponUserLimit,
+			wantStatus: http.StatusUnprocessableEntity, wantCode: errors.CouponUserLimitReached,
+			wantDetail: "coupon reached its usage limit for the user"},
+		{name: "unknown coupon error", op: errors.OpCouponGet, err: fmt.Errorf("mongo: connection reset"),
+			wantStatus: http.StatusInternalServerError, wantCode: errors.CouponGetServerError,
+			wantDetail: errors.UnexpectedErrorMessage},
+		{name: "unknown error", op: errors.OpCreate, err: fmt.Errorf("mongo: connection reset"),
+			wantStatus: http.StatusInternalServerError, wantCode: errors.OrderCreateServerError,
+			wantDetail: errors.UnexpectedErrorMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := problems.For(tt.op, tt.err)
+
+			assert.Equal(t, tt.wantStatus, apiErr.HTTPStatusCode)
+			assert.Equal(t, tt.wantCode, apiErr.ErrorCode)
+			assert.Equal(t, tt.wantDetail, apiErr.Message)
+			assert.NotEmpty(t, apiErr.Title)
+		})
+	}
+}
+
+func TestFor_FieldErrors(t *testing.T) {
+	type product struct {
+		Name  string  `json:"name" binding:"required"`
+		Price float64 `json:"price" binding:"required,gt=0"`
+	}
+	type order struct {
+		Products []product `json:"products" binding:"required,dive"`
+	}
+
+	t.Run("struct validation", func(t *testing.T) {
+		var o order
+		err := binding.JSON.BindBody([]byte(`{"products": [{"price": -1}]}`), &o)
+		require.Error(t, err)
+
+		apiErr := problems.For(errors.OpCreate, fmt.Errorf("%w: %w", errors.ErrInvalidInput, err))
+
+		assert.Equal(t, http.StatusBadRequest, apiErr.HTTPStatusCode)
+		assert.Equal(t, errors.OrderCreateInvalidInput, apiErr.ErrorCode)
+		require.Len(t, apiErr.Errors, 2)
+		assert.Equal(t, "is required", apiErr.Errors[0].Reason)
+		assert.Equal(t, "should be greater than 0", apiErr.Errors[1].Reason)
+	})
+
+	t.Run("json type", func(t *testing.T) {
+		var o order
+		err := json.NewDecoder(bytes.NewReader([]byte(`{"products": [{"name": 1}]}`))).Decode(&o)
+		require.Error(t, err)
+
+		apiErr := problems.For(errors.OpCreate, fmt.Errorf("%w: %w", errors.ErrInvalidInput, err))
+
+		assert.Equal(t, []external.FieldError{{Pointer: "/products/0/name", Reason: "should be of type string"}}, apiErr.Errors)
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		err := errors.InvalidFields{{Pointer: "/status", Reason: "is not an order status"}}
+
+		apiErr := problems.For(errors.OpUpdate, err)
+
+		assert.Equal(t, errors.OrderUpdateInvalidInput, apiErr.ErrorCode)
+		assert.Equal(t, []external.FieldError(err), apiErr.Errors)
+		assert.Equal(t, "invalid request body: /status: is not an order status", err.Error())
+	})
+}
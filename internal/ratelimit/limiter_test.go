@@ -0,0 +1,37 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.NewMemoryLimiter(&ratelimit.MemoryLimiterOpts{Clock: func() time.Time { return now }})
+	limit := ratelimit.PerMinute(3)
+
+	for i := 2; i >= 0; i-- {
+		result, err := limiter.Allow(context.TODO(), "user-1", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result, _ := limiter.Allow(context.TODO(), "user-1", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.ResetAfter)
+
+	other, _ := limiter.Allow(context.TODO(), "user-2", limit)
+	assert.True(t, other.Allowed, "buckets are kept per key")
+
+	now = now.Add(20 * time.Second)
+	result, _ = limiter.Allow(context.TODO(), "user-1", limit)
+	assert.True(t, result.Allowed, "a token is refilled after 20s")
+	assert.Equal(t, 0, result.Remaining)
+}
@@ -0,0 +1,96 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/money"
+)
+
+const DefPollInterval = time.Hour
+
+var ErrRatesNotLoaded = errors.New("exchange rates are not loaded")
+
+type FileOpts struct {
+	File         string        // JSON file holding a Table
+	PollInterval time.Duration // how often the file is read again, defaults to DefPollInterval
+}
+
+// FileProvider is an ExchangeRateProvider serving the Table of a JSON file, Watch reads the file again on a schedule
+// so that a job publishing new rates into the file is picked up without a restart. When the file can't be read or
+// holds invalid rates the previously loaded rates stay in use.
+type FileProvider struct {
+	opts   FileOpts
+	logger *logger.AppLogger
+
+	mu      sync.RWMutex
+	table   *Table
+	loadErr error
+}
+
+func NewFileProvider(opts FileOpts, lgr *logger.AppLogger) *FileProvider {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefPollInterval
+	}
+	return &FileProvider{opts: opts, logger: lgr, loadErr: ErrRatesNotLoaded}
+}
+
+// Load reads the rates file, on failure the rates loaded before are kept.
+func (p *FileProvider) Load() error {
+	table, err := p.read()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loadErr = err
+	if err != nil {
+		return err
+	}
+	p.table = table
+	return nil
+}
+
+func (p *FileProvider) read() (*Table, error) {
+	raw, err := os.ReadFile(p.opts.File)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRates, err)
+	}
+	return ParseTable(raw)
+}
+
+// Watch reloads the rates every PollInterval until ctx is done, the first rates are loaded with Load.
+func (p *FileProvider) Watch(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.Load(); err != nil {
+			p.logger.Error().Err(err).Str("file", p.opts.File).Msg("failed to reload exchange rates, keeping the current ones")
+		}
+	}
+}
+
+func (p *FileProvider) Rate(ctx context.Context, from, to money.Currency) (Rate, error) {
+	p.mu.RLock()
+	table := p.table
+	p.mu.RUnlock()
+	if table == nil {
+		// amounts are still converted to their own currency, the health check reports the missing rates
+		table = &Table{}
+	}
+	return table.Rate(ctx, from, to)
+}
+
+// Check is a health check failing until rates are loaded, and while the last reload fails.
+func (p *FileProvider) Check(_ context.Context) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.loadErr
+}
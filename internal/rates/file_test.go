@@ -0,0 +1,59 @@
+package rates_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/rates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lgr = logger.Setup(models.ServiceEnv{Name: "test"})
+
+func TestFileProvider_KeepsRatesWhenReloadFails(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rates.json")
+	provider := rates.NewFileProvider(rates.FileOpts{File: file}, lgr)
+	assert.ErrorIs(t, provider.Check(context.TODO()), rates.ErrRatesNotLoaded)
+	rate, err := provider.Rate(context.TODO(), "USD", "USD")
+	require.NoError(t, err, "amounts should convert to their own currency before rates are loaded")
+	assert.Equal(t, "1", rate.Value.String())
+	_, err = provider.Rate(context.TODO(), "USD", "EUR")
+	assert.ErrorIs(t, err, rates.ErrRateNotFound)
+
+	require.NoError(t, os.WriteFile(file, []byte(tableJSON), 0o600))
+	require.NoError(t, provider.Load())
+	assert.NoError(t, provider.Check(context.TODO()))
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"base": "USD", "rates": {"EUR": "0"}}`), 0o600))
+	assert.ErrorIs(t, provider.Load(), rates.ErrInvalidRates)
+	assert.ErrorIs(t, provider.Check(context.TODO()), rates.ErrInvalidRates)
+	rate, err = provider.Rate(context.TODO(), "USD", "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "0.92", rate.Value.String(), "the previous rates should be kept")
+}
+
+func TestFileProvider_Watch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(file, []byte(tableJSON), 0o600))
+	provider := rates.NewFileProvider(rates.FileOpts{File: file, PollInterval: 10 * time.Millisecond}, lgr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go provider.Watch(ctx)
+
+	require.Eventually(t, func() bool {
+		rate, err := provider.Rate(context.TODO(), "USD", "EUR")
+		return err == nil && rate.Value.String() == "0.92"
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"base": "USD", "rates": {"EUR": "0.95"}}`), 0o600))
+	assert.Eventually(t, func() bool {
+		rate, err := provider.Rate(context.TODO(), "USD", "EUR")
+		return err == nil && rate.Value.String() == "0.95"
+	}, time.Second, 5*time.Millisecond, "new rates should be picked up on the next refresh")
+}
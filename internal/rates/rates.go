@@ -0,0 +1,93 @@
+// Package rates converts amounts between currencies with the exchange rates of an ExchangeRateProvider.
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/money"
+)
+
+// Scale is the largest number of decimal places of the cross rates a Table computes.
+const Scale = 10
+
+var (
+	ErrRateNotFound = errors.New("exchange rate not found")
+	ErrInvalidRates = errors.New("invalid exchange rates")
+)
+
+// ExchangeRateProvider returns the current rate to convert amounts from one currency to another.
+type ExchangeRateProvider interface {
+	Rate(ctx context.Context, from, to money.Currency) (Rate, error)
+}
+
+// Rate converts amounts in From to To, an amount in From times Value is the amount in To.
+type Rate struct {
+	From  money.Currency
+	To    money.Currency
+	Value money.Amount
+	AsOf  time.Time // when the rate was published
+}
+
+// Convert returns the amount in To, rounded to its minor unit.
+func (r Rate) Convert(a money.Amount) money.Amount {
+	return r.To.Round(a.Mul(r.Value))
+}
+
+// Table is an ExchangeRateProvider of fixed rates, quoted as the units of each currency per unit of Base.
+// The rate between two other currencies is the cross rate through Base, every currency converts to itself at 1.
+type Table struct {
+	Base  money.Currency                  `json:"base"`
+	AsOf  time.Time                       `json:"asOf"`
+	Rates map[money.Currency]money.Amount `json:"rates"`
+}
+
+// ParseTable reads a table from JSON, e.g. {"base": "USD", "asOf": "2024-05-01T00:00:00Z", "rates": {"EUR": "0.92"}}.
+func ParseTable(raw []byte) (*Table, error) {
+	var t Table
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRates, err)
+	}
+	if !t.Base.IsValid() {
+		return nil, fmt.Errorf("%w: base %q is not an ISO 4217 currency code", ErrInvalidRates, t.Base)
+	}
+	for currency, rate := range t.Rates {
+		if !currency.IsValid() {
+			return nil, fmt.Errorf("%w: %q is not an ISO 4217 currency code", ErrInvalidRates, currency)
+		}
+		if rate.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: rate of %s should be positive", ErrInvalidRates, currency)
+		}
+	}
+	return &t, nil
+}
+
+func (t *Table) Rate(_ context.Context, from, to money.Currency) (Rate, error) {
+	rate := Rate{From: from, To: to, AsOf: t.AsOf}
+	fromRate, fromOK := t.quote(from)
+	toRate, toOK := t.quote(to)
+	switch {
+	case from == to:
+		rate.Value = money.NewAmount(1, 0)
+	case !fromOK || !toOK:
+		return Rate{}, fmt.Errorf("%w from %s to %s", ErrRateNotFound, from, to)
+	case from == t.Base:
+		rate.Value = toRate
+	default:
+		value := toRate.QuoRound(fromRate, Scale)
+		rate.Value = value.Round(value.DecimalPlaces())
+	}
+	return rate, nil
+}
+
+// quote returns the units of currency per unit of the base currency.
+func (t *Table) quote(currency money.Currency) (money.Amount, bool) {
+	if currency == t.Base {
+		return money.NewAmount(1, 0), true
+	}
+	rate, ok := t.Rates[currency]
+	return rate, ok
+}
@@ -0,0 +1,66 @@
+package rates_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/rates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tableJSON = `{"base": "USD", "asOf": "2024-05-01T00:00:00Z", "rates": {"EUR": "0.92", "JPY": 151.5, "GBP": "0.8"}}`
+
+func TestParseTable(t *testing.T) {
+	table, err := rates.ParseTable([]byte(tableJSON))
+	require.NoError(t, err)
+	assert.Equal(t, money.Currency("USD"), table.Base)
+	assert.Equal(t, "151.5", table.Rates["JPY"].String())
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"base": "usd", "rates": {}}`,
+		`{"base": "USD", "rates": {"EURO": "0.92"}}`,
+		`{"base": "USD", "rates": {"EUR": "0"}}`,
+		`{"base": "USD", "rates": {"EUR": "-1"}}`,
+	} {
+		_, err = rates.ParseTable([]byte(invalid))
+		assert.ErrorIs(t, err, rates.ErrInvalidRates, invalid)
+	}
+}
+
+func TestTable_Rate(t *testing.T) {
+	table, err := rates.ParseTable([]byte(tableJSON))
+	require.NoError(t, err)
+	tests := []struct {
+		from, to money.Currency
+		want     string
+	}{
+		{"USD", "EUR", "0.92"},
+		{"EUR", "USD", "1.0869565217"},
+		{"EUR", "GBP", "0.8695652174"},
+		{"EUR", "EUR", "1"},
+		{"CHF", "CHF", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from+tt.to), func(t *testing.T) {
+			rate, err := table.Rate(context.TODO(), tt.from, tt.to)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rate.Value.String())
+			assert.Equal(t, table.AsOf, rate.AsOf)
+		})
+	}
+
+	_, err = table.Rate(context.TODO(), "USD", "CHF")
+	assert.ErrorIs(t, err, rates.ErrRateNotFound)
+	_, err = table.Rate(context.TODO(), "CHF", "EUR")
+	assert.ErrorIs(t, err, rates.ErrRateNotFound)
+}
+
+func TestRate_Convert(t *testing.T) {
+	toEUR := rates.Rate{From: "USD", To: "EUR", Value: money.MustParseAmount("0.92")}
+	assert.Equal(t, "9.66", toEUR.Convert(money.MustParseAmount("10.50")).String())
+	toJPY := rates.Rate{From: "USD", To: "JPY", Value: money.MustParseAmount("151.5")}
+	assert.Equal(t, "1591", toJPY.Convert(money.MustParseAmount("10.50")).String())
+}
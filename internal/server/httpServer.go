@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/util"
+)
+
+const (
+	DefShutdownTimeout   = 30 * time.Second
+	DefReadHeaderTimeout = 10 * time.Second
+	// DefReadinessGracePeriod is the readiness grace period of the service configuration
+	DefReadinessGracePeriod = 5 * time.Second
+)
+
+var ErrShutdownTimeout = errors.New("in-flight requests were not drained before the shutdown deadline")
+
+type ServerOpts struct {
+	Addr string
+	// ShutdownTimeout is how long in-flight requests may take to finish once shutdown begins
+	ShutdownTimeout time.Duration
+	// ReadinessGracePeriod is how long requests are still accepted after readiness starts failing, it gives load
+	// balancers the time to notice and stop routing new requests before connections are refused. No delay when zero.
+	ReadinessGracePeriod time.Duration
+	// Lifecycle is flipped to shutting down first thing on Shutdown, readiness checks report it
+	Lifecycle *util.Lifecycle
+}
+
+func FillServerOpts(opts *ServerOpts) *ServerOpts {
+	if opts == nil {
+		opts = &ServerOpts{}
+	}
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = DefShutdownTimeout
+	}
+	if opts.Lifecycle == nil {
+		opts.Lifecycle = &util.Lifecycle{}
+	}
+	return opts
+}
+
+// Server is an http.Server that can be shut down gracefully.
+type Server struct {
+	httpServer *http.Server
+	opts       *ServerOpts
+	logger     *logger.AppLogger
+}
+
+func NewServer(handler http.Handler, opts *ServerOpts, lgr *logger.AppLogger) *Server {
+	opts = FillServerOpts(opts)
+	return &Server{
+		httpServer: &http.Server{
+			Addr:              opts.Addr,
+			Handler:           handler,
+			ReadHeaderTimeout: DefReadHeaderTimeout,
+		},
+		opts:   opts,
+		logger: lgr,
+	}
+}
+
+// Start listens on the configured address, see Serve.
+func (s *Server) Start() <-chan error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		errs := make(chan error, 1)
+		errs <- err
+		return errs
+	}
+	return s.Serve(listener)
+}
+
+// Serve serves requests from listener in the background. The returned channel delivers the error
+// the server stopped with, it is not written to when the server is shut down.
+func (s *Server) Serve(listener net.Listener) <-chan error {
+	errs := make(chan error, 1)
+	s.logger.Info().Str("addr", listener.Addr().String()).Msg("server listening")
+	go func() {
+		if err := s.httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+	return errs
+}
+
+// Shutdown marks the service as shutting down and keeps serving for ReadinessGracePeriod, then stops accepting
+// connections and waits for in-flight requests to finish within ShutdownTimeout. ErrShutdownTimeout is returned
+// when they did not. The grace period is cut short when ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.opts.Lifecycle.BeginShutdown()
+	if s.opts.ReadinessGracePeriod > 0 {
+		s.logger.Info().Dur("gracePeriod", s.opts.ReadinessGracePeriod).Msg("readiness failing, still serving requests")
+		timer := time.NewTimer(s.opts.ReadinessGracePeriod)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.opts.ShutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.logger.Error().Err(err).Dur("timeout", s.opts.ShutdownTimeout).Msg("failed to drain in-flight requests")
+		_ = s.httpServer.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrShutdownTimeout
+		}
+		return err
+	}
+	s.logger.Info().Msg("server drained and stopped")
+	return nil
+}
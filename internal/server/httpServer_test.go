@@ -0,0 +1,140 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/server"
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowHandler answers once release is closed and reports every request it receives on started.
+func slowHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		started <- struct{}{}
+		<-release
+		_, _ = io.WriteString(w, "done")
+	})
+}
+
+func TestServer_ShutdownDrainsInFlightRequests(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	lifecycle := &util.Lifecycle{}
+	srv := server.NewServer(slowHandler(started, release), &server.ServerOpts{
+		ShutdownTimeout: 5 * time.Second,
+		Lifecycle:       lifecycle,
+	}, lgr)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := srv.Serve(listener)
+	url := "http://" + listener.Addr().String()
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, rErr := http.Get(url)
+		if rErr != nil {
+			responses <- response{err: rErr}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		responses <- response{body: string(body)}
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(context.Background()) }()
+	require.Eventually(t, lifecycle.ShuttingDown, time.Second, 10*time.Millisecond)
+
+	select {
+	case <-shutdownErr:
+		t.Fatal("shutdown returned while a request was in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = http.Get(url)
+	assert.Error(t, err, "no new connections are accepted while draining")
+
+	close(release)
+	got := <-responses
+	require.NoError(t, got.err)
+	assert.Equal(t, "done", got.body)
+	assert.NoError(t, <-shutdownErr)
+	assert.Empty(t, serveErr)
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	srv := server.NewServer(slowHandler(started, release), &server.ServerOpts{ShutdownTimeout: 50 * time.Millisecond}, lgr)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Serve(listener)
+
+	go func() {
+		resp, rErr := http.Get("http://" + listener.Addr().String())
+		if rErr == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	assert.ErrorIs(t, srv.Shutdown(context.Background()), server.ErrShutdownTimeout)
+}
+
+func TestServer_ShutdownServesDuringReadinessGracePeriod(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	lifecycle := &util.Lifecycle{}
+	srv := server.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}), &server.ServerOpts{
+		ShutdownTimeout:      time.Second,
+		ReadinessGracePeriod: 300 * time.Millisecond,
+		Lifecycle:            lifecycle,
+	}, lgr)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Serve(listener)
+	url := "http://" + listener.Addr().String()
+
+	begun := time.Now()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(context.Background()) }()
+	require.Eventually(t, lifecycle.ShuttingDown, time.Second, time.Millisecond)
+
+	resp, err := http.Get(url)
+	require.NoError(t, err, "requests are served while load balancers notice the failing readiness")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.NoError(t, <-shutdownErr)
+	assert.GreaterOrEqual(t, time.Since(begun), 300*time.Millisecond)
+	_, err = http.Get(url)
+	assert.Error(t, err, "connections are refused after the grace period")
+}
+
+func TestServer_ShutdownGracePeriodEndsWithContext(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	srv := server.NewServer(http.NotFoundHandler(), &server.ServerOpts{ReadinessGracePeriod: time.Hour}, lgr)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Serve(listener)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begun := time.Now()
+	_ = srv.Shutdown(ctx)
+	assert.Less(t, time.Since(begun), time.Second)
+}
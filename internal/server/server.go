@@ -1,36 +1,61 @@
 package server
 
 import (
+	"context"
 	"io"
-	"sync"
 
 	"github.com/gin-contrib/pprof"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/derickit/go-rest-api/internal/auth"
 	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/health"
 	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/middleware"
 	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/money"
+	"github.com/derickit/go-rest-api/internal/openapi"
+	"github.com/derickit/go-rest-api/internal/pricing"
+	"github.com/derickit/go-rest-api/internal/ratelimit"
+	"github.com/derickit/go-rest-api/internal/rates"
 	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/gin-gonic/gin"
 )
 
-var startOnce sync.Once
+// StartService serves the API until one of the signals of sigHandler is received or the server fails, then shuts down
+// gracefully: readiness starts failing, requests are still served for svcEnv.ReadinessGracePeriod, then no new
+// connections are accepted, in-flight requests are drained within svcEnv.ShutdownTimeout and finally the OnSignal
+// functions of sigHandler run.
+func StartService(svcEnv models.ServiceEnv, dbMgr db.MongoManager, sigHandler util.SignalHandler, lgr *logger.AppLogger) error {
+	lifecycle := &util.Lifecycle{}
+	// stops the background work of the router, e.g. reloading the exchange rates
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	srv := NewServer(WebRouter(ctx, svcEnv, dbMgr, lifecycle, lgr), &ServerOpts{
+		Addr:                 ":" + svcEnv.Port,
+		ShutdownTimeout:      svcEnv.ShutdownTimeout,
+		ReadinessGracePeriod: svcEnv.ReadinessGracePeriod,
+		Lifecycle:            lifecycle,
+	}, lgr)
+	defer sigHandler.RunDeferred()
 
-func StartService(svcEnv models.ServiceEnv, dbMgr db.MongoManager, lgr *logger.AppLogger) {
-	startOnce.Do(func() {
-		r := WebRouter(svcEnv, dbMgr, lgr)
-		err := r.Run(":" + svcEnv.Port)
-		if err != nil {
-			panic(err)
-		}
-	})
+	serveErr := srv.Start()
+	select {
+	case err := <-serveErr:
+		lgr.Error().Err(err).Msg("server stopped unexpectedly")
+		return err
+	case sig := <-sigHandler.Signaled():
+		lgr.Info().Str("signal", sig.String()).Msg("shutting down")
+	}
+	return srv.Shutdown(context.Background())
 }
 
-func WebRouter(svcEnv models.ServiceEnv, dbMgr db.MongoManager, lgr *logger.AppLogger) *gin.Engine {
+// WebRouter registers the routes of the service, the background work of the router runs until ctx is done.
+func WebRouter(ctx context.Context, svcEnv models.ServiceEnv, dbMgr db.MongoManager, lifecycle *util.Lifecycle,
+	lgr *logger.AppLogger) *gin.Engine {
 	ginMode := gin.ReleaseMode
 	if util.IsDevMode(svcEnv.Name) {
 		ginMode = gin.DebugMode
@@ -40,38 +65,124 @@ func WebRouter(svcEnv models.ServiceEnv, dbMgr db.MongoManager, lgr *logger.AppL
 	gin.EnableJsonDecoderDisallowUnknownFields()
 	gin.DefaultWriter = io.Discard
 	router := gin.Default()
-	router.Use(gzip.Gzip(gzip.DefaultCompression))
+	// ClientIP reads X-Forwarded-For only from the configured proxies, anyone else could forge it
+	if err := router.SetTrustedProxies(svcEnv.TrustedProxies); err != nil {
+		lgr.Error().Err(err).Msg("trusted proxies are invalid, X-Forwarded-For is not trusted")
+		_ = router.SetTrustedProxies(nil)
+	}
+	// handlers pass the gin context to the repos, the fallback makes the span of the request visible through it
+	router.ContextWithFallback = true
+	router.Use(middleware.MetricsMiddleware())
+	router.Use(middleware.TracingMiddleware())
+	if svcEnv.GzipLevel != gzip.NoCompression {
+		router.Use(gzip.Gzip(svcEnv.GzipLevel))
+	}
 	router.Use(middleware.ReqIDMiddleware())
-	router.Use(middleware.ResponseHeadersMiddleware())
+	router.Use(middleware.ResponseHeadersMiddleware(svcEnv.SecurityHeaders))
 	router.Use(middleware.RequestLogMiddleware(lgr))
 	router.Use(gin.Recovery())
 
+	checks := health.NewRegistry(lgr)
+	checks.Register("mongo", db.PingCheck(dbMgr), &health.CheckOpts{Critical: true})
+	verifier := tokenVerifier(svcEnv, checks, lgr)
+	exchangeRates := exchangeRateProvider(ctx, svcEnv, checks, lgr)
+	pricingRules := pricingPipeline(svcEnv, checks, lgr)
 	internalAPIGrp := router.Group("/internal")
-	internalAPIGrp.Use(middleware.AuthMiddleware())
+	internalAPIGrp.Use(middleware.InternalAuthMiddleware(verifier, lgr))
+	internalAPIGrp.Use(middleware.AuthorizationMiddleware(lgr))
 	pprof.RouteRegister(internalAPIGrp, "pprof")
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
-	status := handlers.NewStatusController(dbMgr)
+	router.GET(openapi.DocumentPath, handlers.OpenAPIDocument)
+	if util.IsDevMode(svcEnv.Name) {
+		router.GET(handlers.DocsPath, handlers.SwaggerUI)
+	}
+	status := handlers.NewStatusController(checks, &handlers.StatusControllerOpts{
+		ServiceName: svcEnv.ServiceName,
+		Environment: svcEnv.Name,
+		Version:     svcEnv.Version,
+		Lifecycle:   lifecycle,
+	})
+	router.GET("/livez", status.Live)
+	router.GET("/readyz", status.Ready)
 	router.GET("/status", status.CheckStatus)
 
+	if svcEnv.CursorSigningKey == "" {
+		lgr.Warn().Msg("cursor signing key is not configured, pagination cursors will not survive a restart")
+	}
+
 	d := dbMgr.Database()
 	orders := db.NewOrderRepo(d, lgr)
+	idempotencyKeys := db.NewIdempotencyRepo(d, lgr)
+	coupons := db.NewCouponsRepo(d, lgr)
+	customers := db.NewCustomersRepo(d, lgr)
 
 	if util.IsDevMode(svcEnv.Name) {
-		seed := handlers.NewDataSeedHandler(orders)
+		seed := handlers.NewDataSeedHandler(orders, svcEnv.SeedRecordCount)
 		internalAPIGrp.POST("/seed-local-db", seed.SeedDB)
 	}
 
 	externalAPIGrp := router.Group("/ecommerce/v1")
-	externalAPIGrp.Use(middleware.AuthMiddleware())
+	// the limiter authenticates the caller itself, unauthenticated requests are limited before they are rejected
+	limiter := ratelimit.NewMemoryLimiter(nil)
+	externalAPIGrp.Use(middleware.RateLimitMiddleware(limiter, rateLimitOpts(svcEnv, verifier), lgr))
+	externalAPIGrp.Use(middleware.AuthMiddleware(verifier, lgr))
+	externalAPIGrp.Use(middleware.AuthorizationMiddleware(lgr))
 	externalAPIGrp.Use(middleware.QueryParamsCheckMiddleware(lgr))
+	if svcEnv.OpenAPIValidation {
+		if spec, err := openapi.Load(); err != nil {
+			lgr.Error().Err(err).Msg("openapi document could not be loaded, requests are not validated")
+		} else {
+			externalAPIGrp.Use(middleware.OpenAPIValidationMiddleware(spec, &middleware.OpenAPIValidationOpts{
+				ValidateResponses: util.IsDevMode(svcEnv.Name),
+			}, lgr))
+		}
+	}
 	{
+		// the orders handler also lists the orders of a customer
+		ordersHandler := handlers.NewOrdersHandler(orders, &handlers.OrdersHandlerOpts{
+			Cursors:      util.NewCursorCodec([]byte(svcEnv.CursorSigningKey)),
+			MaxPageSize:  svcEnv.MaxPageSize,
+			MaxLineItems: svcEnv.MaxLineItems,
+			MaxQuantity:  svcEnv.MaxProductQuantity,
+			BaseCurrency: money.Currency(svcEnv.BaseCurrency),
+			Rates:        exchangeRates,
+			Pricing:      pricingRules,
+			Coupons:      coupons,
+			Customers:    customers,
+		}, lgr)
 		ordersGroup := externalAPIGrp.Group("orders")
 		{
-			orders := handlers.NewOrdersHandler(orders, lgr)
-			ordersGroup.GET("", orders.GetAll)
-			ordersGroup.GET(":id", orders.GetByID)
-			ordersGroup.POST("", orders.Create)
-			ordersGroup.DELETE("/:id", orders.DeleteByID)
+			ordersGroup.GET("", ordersHandler.GetAll)
+			ordersGroup.GET(":id", ordersHandler.GetByID)
+			ordersGroup.POST("", middleware.IdempotencyMiddleware(idempotencyKeys, &middleware.IdempotencyOpts{
+				TTL: svcEnv.IdempotencyKeyTTL,
+			}, lgr), ordersHandler.Create)
+			ordersGroup.PUT("/:id", ordersHandler.Update)
+			ordersGroup.PATCH("/:id", ordersHandler.Patch)
+			ordersGroup.POST("/:id/transitions", ordersHandler.Transition)
+			ordersGroup.DELETE("/:id", ordersHandler.DeleteByID)
+
+			reportsGroup := externalAPIGrp.Group("reports")
+			reportsGroup.GET("order-totals", ordersHandler.Totals)
+		}
+		couponsGroup := externalAPIGrp.Group("coupons")
+		{
+			coupons := handlers.NewCouponsHandler(coupons, lgr)
+			couponsGroup.GET("", coupons.GetAll)
+			couponsGroup.GET(":id", coupons.GetByID)
+			couponsGroup.POST("", coupons.Create)
+			couponsGroup.PUT("/:id", coupons.Update)
+			couponsGroup.DELETE("/:id", coupons.DeleteByID)
+		}
+		customersGroup := externalAPIGrp.Group("customers")
+		{
+			customers := handlers.NewCustomersHandler(customers, lgr)
+			customersGroup.GET("", customers.GetAll)
+			customersGroup.GET(":id", customers.GetByID)
+			customersGroup.POST("", customers.Create)
+			customersGroup.PUT("/:id", customers.Update)
+			customersGroup.DELETE("/:id", customers.DeleteByID)
+			customersGroup.GET("/:id/orders", ordersHandler.GetByCustomer)
 		}
 	}
 
@@ -82,3 +193,76 @@ func WebRouter(svcEnv models.ServiceEnv, dbMgr db.MongoManager, lgr *logger.AppL
 	return router
 
 }
+
+// tokenVerifier returns the verifier of the access tokens and registers the health check of its keys.
+func tokenVerifier(svcEnv models.ServiceEnv, checks *health.Registry, lgr *logger.AppLogger) auth.TokenVerifier {
+	if svcEnv.DisableAuth {
+		lgr.Warn().Msg("!!! AUTHENTICATION IS DISABLED, every request is accepted without a token. " +
+			"This must never be used outside local development !!!")
+		return auth.DisabledVerifier{}
+	}
+	if svcEnv.JWKSSource == "" {
+		lgr.Error().Msg("jwks source is not configured, every authenticated request will be rejected")
+	}
+	keys := auth.NewJWKSProvider(auth.JWKSOpts{Source: svcEnv.JWKSSource}, lgr)
+	checks.Register("jwks", keys.Check, nil)
+	return auth.NewVerifier(keys, auth.VerifierOpts{
+		Issuer:   svcEnv.JWTIssuer,
+		Audience: svcEnv.JWTAudience,
+		Leeway:   auth.DefLeeway,
+	})
+}
+
+// exchangeRateProvider returns the provider of the exchange rates to the base currency, the rates file is reloaded
+// until ctx is done. Without rates file only orders in the base currency can be converted.
+func exchangeRateProvider(ctx context.Context, svcEnv models.ServiceEnv, checks *health.Registry,
+	lgr *logger.AppLogger) rates.ExchangeRateProvider {
+	base := money.Currency(svcEnv.BaseCurrency)
+	if base == "" {
+		base = money.DefaultCurrency
+	}
+	if svcEnv.ExchangeRatesFile == "" {
+		lgr.Warn().Str("baseCurrency", base.String()).
+			Msg("exchange rates file is not configured, only orders in the base currency are accepted")
+		return &rates.Table{Base: base}
+	}
+	provider := rates.NewFileProvider(rates.FileOpts{
+		File:         svcEnv.ExchangeRatesFile,
+		PollInterval: svcEnv.RatesPollInterval,
+	}, lgr)
+	if err := provider.Load(); err != nil {
+		lgr.Error().Err(err).Msg("exchange rates could not be loaded, orders in other currencies are rejected")
+	}
+	checks.Register("exchangeRates", provider.Check, nil)
+	go provider.Watch(ctx)
+	return provider
+}
+
+// pricingPipeline returns the pipeline of the rules of the pricing rules file, only coupon discounts apply without
+// file. When the file can't be loaded orders can't be priced, the service reports not ready until it is fixed and
+// restarted.
+func pricingPipeline(svcEnv models.ServiceEnv, checks *health.Registry, lgr *logger.AppLogger) *pricing.Pipeline {
+	if svcEnv.PricingRulesFile == "" {
+		lgr.Warn().Msg("pricing rules file is not configured, only coupon discounts apply to orders")
+		return pricing.NewPipeline(pricing.CouponDiscount{})
+	}
+	cfg, err := pricing.LoadConfig(svcEnv.PricingRulesFile)
+	if err != nil {
+		lgr.Error().Err(err).Str("file", svcEnv.PricingRulesFile).
+			Msg("pricing rules could not be loaded, orders are rejected")
+		checks.Register("pricingRules", func(_ context.Context) error { return err }, &health.CheckOpts{Critical: true})
+		return pricing.NewPipeline(pricing.RuleFunc(func(_ context.Context, _ *pricing.Quote) error { return err }))
+	}
+	return pricing.NewPipeline(cfg.Rules()...)
+}
+
+func rateLimitOpts(svcEnv models.ServiceEnv, verifier auth.TokenVerifier) *middleware.RateLimitOpts {
+	opts := &middleware.RateLimitOpts{Verifier: verifier}
+	if svcEnv.ReadRateLimit > 0 {
+		opts.Read = ratelimit.PerMinute(svcEnv.ReadRateLimit)
+	}
+	if svcEnv.WriteRateLimit > 0 {
+		opts.Write = ratelimit.PerMinute(svcEnv.WriteRateLimit)
+	}
+	return opts
+}
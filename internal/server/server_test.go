@@ -1,15 +1,21 @@
 package server_test
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/derickit/go-rest-api/internal/db/mocks"
 	"github.com/derickit/go-rest-api/internal/logger"
+	"github.com/derickit/go-rest-api/internal/middleware"
 	"github.com/derickit/go-rest-api/internal/models"
+	"github.com/derickit/go-rest-api/internal/openapi"
 	"github.com/derickit/go-rest-api/internal/server"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestListOfRoutes(t *testing.T) {
@@ -18,7 +24,7 @@ func TestListOfRoutes(t *testing.T) {
 		Port: "8080",
 	}
 	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
-	router := server.WebRouter(svcInfo, &mocks.MockMongoMgr{}, lgr)
+	router := server.WebRouter(context.Background(), svcInfo, &mocks.MockMongoMgr{}, nil, lgr)
 	list := router.Routes()
 	mode := gin.Mode()
 	assert.Equal(t, gin.ReleaseMode, mode)
@@ -28,6 +34,16 @@ func TestListOfRoutes(t *testing.T) {
 		Path:   "/status",
 	})
 
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/livez",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodGet,
+		Path:   "/readyz",
+	})
+
 	assertRoutePresent(t, list, gin.RouteInfo{
 		Method: http.MethodPost,
 		Path:   "/seedDB",
@@ -48,6 +64,21 @@ func TestListOfRoutes(t *testing.T) {
 		Path:   "/ecommerce/v1/orders",
 	})
 
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPut,
+		Path:   "/ecommerce/v1/orders/:id",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPatch,
+		Path:   "/ecommerce/v1/orders/:id",
+	})
+
+	assertRoutePresent(t, list, gin.RouteInfo{
+		Method: http.MethodPost,
+		Path:   "/ecommerce/v1/orders/:id/transitions",
+	})
+
 	assertRoutePresent(t, list, gin.RouteInfo{
 		Method: http.MethodDelete,
 		Path:   "/ecommerce/v1/orders/:id",
@@ -70,3 +101,68 @@ func assertRouteNotPresent(t *testing.T, gotRoutes gin.RoutesInfo, wantRoute gin
 		}
 	}
 }
+
+// TestWebRouter_MatchesOpenAPIDocument fails when a route is added to or removed from WebRouter without
+// updating the OpenAPI document, or the other way around.
+func TestWebRouter_MatchesOpenAPIDocument(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	// dev mode registers every route
+	router := server.WebRouter(context.Background(), models.ServiceEnv{Name: "local", Port: "8080"}, &mocks.MockMongoMgr{}, nil, lgr)
+
+	var routes []string
+	for _, route := range router.Routes() {
+		if strings.HasPrefix(route.Path, "/internal/pprof") {
+			continue
+		}
+		routes = append(routes, route.Method+" "+openapi.SpecPath(route.Path))
+	}
+	assert.ElementsMatch(t, spec.Routes(), routes)
+}
+
+// TestWebRouter_QueryParamsMatchOpenAPIDocument fails when the query params accepted by a route drift from the
+// params its operation documents.
+func TestWebRouter_QueryParamsMatchOpenAPIDocument(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	for route, allowed := range middleware.AllowedQueryParams {
+		method, path, _ := strings.Cut(route, "/")
+		op, ok := spec.Operation(method, "/"+path)
+		if !assert.True(t, ok, "operation of %s is not documented", route) {
+			continue
+		}
+		documented := op.QueryParams()
+		if allowed == nil {
+			allowed = map[string]bool{}
+		}
+		assert.Equal(t, allowed, documented, route)
+	}
+}
+
+func TestWebRouter_ClientIPFromTrustedProxiesOnly(t *testing.T) {
+	lgr := logger.Setup(models.ServiceEnv{Name: "test"})
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{name: "no trusted proxies", want: "10.0.0.1"},
+		{name: "trusted proxy", proxies: []string{"10.0.0.0/8"}, want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svcEnv := models.ServiceEnv{Name: "test", Port: "8080", TrustedProxies: tt.proxies}
+			router := server.WebRouter(context.Background(), svcEnv, &mocks.MockMongoMgr{}, nil, lgr)
+			router.GET("/client-ip", func(c *gin.Context) {
+				c.String(http.StatusOK, c.ClientIP())
+			})
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/client-ip", nil)
+			req.RemoteAddr = "10.0.0.1:4711"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, tt.want, resp.Body.String())
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+
+	// TracerName is the instrumentation scope of the spans of this service
+	TracerName = "github.com/derickit/go-rest-api"
+)
+
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+// Opts configures tracing, spans are only exported when an Exporter other than ExporterNone is set.
+type Opts struct {
+	Exporter    string  // one of ExporterNone, ExporterOTLP, ExporterStdout or ExporterFile
+	Endpoint    string  // OTLP/HTTP url for ExporterOTLP, e.g. http://localhost:4318, the OTEL_EXPORTER_OTLP_* env vars apply when empty; file path for ExporterFile
+	SampleRatio float64 // share of the traces started here that are sampled, traces of sampled parents always are
+	ServiceName string
+	Version     string
+	Environment string
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator. The returned function flushes
+// the pending spans and stops the exporter, it should run on shutdown.
+func Setup(ctx context.Context, opts Opts) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	exporter, closeOutput, err := newExporter(ctx, opts)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+		semconv.ServiceVersion(opts.Version),
+		semconv.DeploymentEnvironment(opts.Environment),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeOutput())
+	}, nil
+}
+
+func newExporter(ctx context.Context, opts Opts) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return nil, noClose, nil
+	case ExporterOTLP:
+		var otlpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err := otlptracehttp.New(ctx, otlpOpts...)
+		return exporter, noClose, err
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exporter, noClose, err
+	case ExporterFile:
+		f, err := os.OpenFile(opts.Endpoint, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, noClose, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		return exporter, f.Close, err
+	default:
+		return nil, noClose, fmt.Errorf("%w %q", ErrUnknownExporter, opts.Exporter)
+	}
+}
+
+// Tracer returns the tracer of this service from the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
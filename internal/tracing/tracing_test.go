@@ -0,0 +1,43 @@
+package tracing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetup_FileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Opts{
+		Exporter:    tracing.ExporterFile,
+		Endpoint:    file,
+		SampleRatio: 1,
+		ServiceName: "orders",
+		Version:     "1.2.3",
+		Environment: "test",
+	})
+	require.NoError(t, err)
+
+	_, span := tracing.Tracer().Start(context.Background(), "test span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"Name":"test span"`)
+	assert.Contains(t, string(content), `"Value":"orders"`)
+}
+
+func TestSetup_Exporters(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Opts{Exporter: tracing.ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(context.Background(), tracing.Opts{Exporter: "zipkin"})
+	assert.ErrorIs(t, err, tracing.ErrUnknownExporter)
+}
@@ -0,0 +1,78 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid or tampered pagination cursor")
+
+const (
+	cursorKeySize     = 32
+	cursorPayloadSize = 8 + 12 + 1
+)
+
+// Cursor is a position in a list sorted by creation time and id, used for keyset pagination.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+	Backward  bool // the cursor selects the page before the position instead of the page after it
+}
+
+// CursorCodec turns cursors into opaque tokens signed with HMAC-SHA256, so clients can't forge positions.
+type CursorCodec struct {
+	key []byte
+}
+
+// NewCursorCodec returns a codec signing with key, a random key is generated when key is empty
+// in which case cursors don't survive a restart of the service.
+func NewCursorCodec(key []byte) *CursorCodec {
+	if len(key) == 0 {
+		key = make([]byte, cursorKeySize)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+	return &CursorCodec{key: key}
+}
+
+func (cc *CursorCodec) Encode(cur Cursor) string {
+	payload := make([]byte, cursorPayloadSize)
+	// mongo keeps dates with millisecond precision
+	binary.BigEndian.PutUint64(payload, uint64(cur.CreatedAt.UnixMilli()))
+	copy(payload[8:20], cur.ID[:])
+	if cur.Backward {
+		payload[20] = 1
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, cc.sign(payload)...))
+}
+
+func (cc *CursorCodec) Decode(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != cursorPayloadSize+sha256.Size {
+		return nil, ErrInvalidCursor
+	}
+	payload, signature := raw[:cursorPayloadSize], raw[cursorPayloadSize:]
+	if !hmac.Equal(signature, cc.sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+	cur := &Cursor{
+		CreatedAt: time.UnixMilli(int64(binary.BigEndian.Uint64(payload))).UTC(),
+		Backward:  payload[20] == 1,
+	}
+	copy(cur.ID[:], payload[8:20])
+	return cur, nil
+}
+
+func (cc *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cc.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
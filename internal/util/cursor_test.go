@@ -0,0 +1,46 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorCodec_RoundTrip(t *testing.T) {
+	codec := util.NewCursorCodec([]byte("test-signing-key"))
+	want := util.Cursor{
+		CreatedAt: time.Date(2024, 5, 16, 9, 34, 0, 123000000, time.UTC),
+		ID:        primitive.NewObjectID(),
+		Backward:  true,
+	}
+	got, err := codec.Decode(codec.Encode(want))
+	require.NoError(t, err)
+	assert.Equal(t, want, *got)
+}
+
+func TestCursorCodec_Tampered(t *testing.T) {
+	codec := util.NewCursorCodec([]byte("test-signing-key"))
+	token := codec.Encode(util.Cursor{CreatedAt: time.Now(), ID: primitive.NewObjectID()})
+	modified := []byte(token)
+	modified[12] ^= 0x01
+
+	testCases := []struct {
+		description string
+		token       string
+	}{
+		{description: "not base64", token: "%%%"},
+		{description: "truncated", token: token[:10]},
+		{description: "modified payload", token: string(modified)},
+		{description: "signed with another key", token: util.NewCursorCodec(nil).Encode(util.Cursor{ID: primitive.NewObjectID()})},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := codec.Decode(tc.token)
+			assert.ErrorIs(t, err, util.ErrInvalidCursor)
+		})
+	}
+}
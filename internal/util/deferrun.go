@@ -8,21 +8,31 @@ import (
 )
 
 type SignalHandler interface {
+	// OnSignal registers a function to run on shutdown, functions run in LIFO order
 	OnSignal(deferFunc func())
+	// Signaled delivers the first signal received
+	Signaled() <-chan os.Signal
+	// RunDeferred runs the registered functions once, it is left to the caller to decide when,
+	// typically after in-flight requests were drained
+	RunDeferred()
 }
 
 func NewSignalHandler(signalsToListen ...os.Signal) SignalHandler {
 	if signalsToListen == nil {
 		signalsToListen = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGINT}
 	}
-	return &deferRun{
-		signals: signalsToListen,
+	dr := &deferRun{
+		signals:  signalsToListen,
+		signaled: make(chan os.Signal, 1),
 	}
+	signal.Notify(dr.signaled, dr.signals...)
+	return dr
 }
 
 // deferRun - Implements SignalHandler
 type deferRun struct {
 	signals       []os.Signal
+	signaled      chan os.Signal
 	deferredFuncs []func()
 	runOnce       sync.Once
 	mu            sync.Mutex
@@ -33,20 +43,20 @@ func (dr *deferRun) OnSignal(deferFunc func()) {
 	// Prepend as we have to iterate in LIFO order
 	dr.deferredFuncs = append([]func(){deferFunc}, dr.deferredFuncs...)
 	dr.mu.Unlock()
-	dr.runOnce.Do(func() {
-		dr.run()
-	})
 }
 
-func (dr *deferRun) run() {
-	signalsChan := make(chan os.Signal, 1)
-	signal.Notify(signalsChan, dr.signals...)
+func (dr *deferRun) Signaled() <-chan os.Signal {
+	return dr.signaled
+}
 
-	go func() {
-		<-signalsChan
-		for _, f := range dr.deferredFuncs {
+func (dr *deferRun) RunDeferred() {
+	dr.runOnce.Do(func() {
+		signal.Stop(dr.signaled)
+		dr.mu.Lock()
+		funcs := dr.deferredFuncs
+		dr.mu.Unlock()
+		for _, f := range funcs {
 			f()
 		}
-		os.Exit(0)
-	}()
+	})
 }
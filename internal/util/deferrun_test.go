@@ -0,0 +1,40 @@
+package util_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalHandler(t *testing.T) {
+	sh := util.NewSignalHandler(syscall.SIGUSR1)
+	var order []int
+	sh.OnSignal(func() { order = append(order, 1) })
+	sh.OnSignal(func() { order = append(order, 2) })
+
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	select {
+	case sig := <-sh.Signaled():
+		assert.Equal(t, syscall.SIGUSR1, sig)
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal was not delivered")
+	}
+	assert.Empty(t, order, "deferred functions only run when asked to")
+
+	sh.RunDeferred()
+	sh.RunDeferred()
+	assert.Equal(t, []int{2, 1}, order)
+}
+
+func TestLifecycle(t *testing.T) {
+	var nilLifecycle *util.Lifecycle
+	assert.False(t, nilLifecycle.ShuttingDown())
+
+	l := &util.Lifecycle{}
+	assert.False(t, l.ShuttingDown())
+	l.BeginShutdown()
+	assert.True(t, l.ShuttingDown())
+}
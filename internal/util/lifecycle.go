@@ -0,0 +1,18 @@
+package util
+
+import "sync/atomic"
+
+// Lifecycle tracks whether the service is shutting down, readiness checks fail from then on
+// so that load balancers stop sending new requests while in-flight ones are drained.
+type Lifecycle struct {
+	shuttingDown atomic.Bool
+}
+
+func (l *Lifecycle) BeginShutdown() {
+	l.shuttingDown.Store(true)
+}
+
+// ShuttingDown is safe to call on a nil Lifecycle, which never shuts down.
+func (l *Lifecycle) ShuttingDown() bool {
+	return l != nil && l.shuttingDown.Load()
+}
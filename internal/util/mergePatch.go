@@ -0,0 +1,52 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidMergePatch = errors.New("invalid json merge patch document")
+
+// MergePatch applies a JSON merge patch (RFC 7396) to the original document and returns the patched document.
+func MergePatch(original, patch []byte) ([]byte, error) {
+	target, err := decodeJSON(original)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodeJSON(patch)
+	if err != nil {
+		return nil, ErrInvalidMergePatch
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func decodeJSON(doc []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	// keep numbers as they were sent, so that prices are not rounded through float64
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergeValue(targetObj[k], v)
+	}
+	return targetObj
+}
@@ -0,0 +1,67 @@
+package util_test
+
+import (
+	"testing"
+
+	"github.com/derickit/go-rest-api/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	testCases := []struct {
+		description string
+		original    string
+		patch       string
+		expected    string
+	}{
+		{
+			description: "replace a member",
+			original:    `{"a":"b"}`,
+			patch:       `{"a":"c"}`,
+			expected:    `{"a":"c"}`,
+		},
+		{
+			description: "add a member",
+			original:    `{"a":"b"}`,
+			patch:       `{"b":"c"}`,
+			expected:    `{"a":"b","b":"c"}`,
+		},
+		{
+			description: "null removes a member",
+			original:    `{"a":"b","b":"c"}`,
+			patch:       `{"a":null}`,
+			expected:    `{"b":"c"}`,
+		},
+		{
+			description: "arrays are replaced as a whole",
+			original:    `{"a":[{"b":"c"}]}`,
+			patch:       `{"a":[1]}`,
+			expected:    `{"a":[1]}`,
+		},
+		{
+			description: "nested objects are merged",
+			original:    `{"a":{"b":"c","d":"e"}}`,
+			patch:       `{"a":{"d":null,"f":"g"}}`,
+			expected:    `{"a":{"b":"c","f":"g"}}`,
+		},
+		{
+			description: "numbers are kept as sent",
+			original:    `{"price":10.10}`,
+			patch:       `{"quantity":3}`,
+			expected:    `{"price":10.10,"quantity":3}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			got, err := util.MergePatch([]byte(tc.original), []byte(tc.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(got))
+		})
+	}
+}
+
+func TestMergePatch_InvalidPatch(t *testing.T) {
+	_, err := util.MergePatch([]byte(`{"a":"b"}`), []byte(`{invalid`))
+	assert.ErrorIs(t, err, util.ErrInvalidMergePatch)
+}
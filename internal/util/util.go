@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
 )
 
 func FormatTimeToISO(timeToFormat time.Time) string {
@@ -24,20 +25,23 @@ func IsDevMode(s string) bool {
 const defaultPrice = 100
 const MaxPrice = 1000
 
-func RandomPrice() float64 {
+// RandomPrice returns a price in cents of at least 0.01 and at most MaxPrice.
+func RandomPrice() money.Amount {
 	var price *big.Int
 	var err error
-	if price, err = rand.Int(rand.Reader, big.NewInt(MaxPrice)); err != nil {
-		price = big.NewInt(defaultPrice)
+	if price, err = rand.Int(rand.Reader, big.NewInt(MaxPrice*100)); err != nil {
+		return money.NewAmount(defaultPrice*100, 2)
 	}
-	pf, _ := price.Float64()
-	return pf
+	// rand.Int is in [0, n), the lowest price is a cent
+	return money.NewAmount(price.Int64()+1, 2)
 }
 
-func CalculateTotalAmount(products []data.Product) float64 {
-	var total float64
+// CalculateTotalAmount sums the price of the quantity of every product exactly, the total is rounded half to even
+// to the minor unit of the currency.
+func CalculateTotalAmount(products []data.Product, currency money.Currency) money.Amount {
+	var total money.Amount
 	for _, product := range products {
-		total += product.Price * (float64(product.Quantity))
+		total = total.Add(product.Price.MulInt(int64(product.Quantity)))
 	}
-	return total
+	return currency.Round(total)
 }
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/derickit/go-rest-api/internal/models/data"
+	"github.com/derickit/go-rest-api/internal/money"
 	"github.com/derickit/go-rest-api/internal/util"
 	"github.com/stretchr/testify/assert"
 )
@@ -47,3 +49,25 @@ func TestIsDevMode(t *testing.T) {
 		})
 	}
 }
+
+func TestRandomPrice(t *testing.T) {
+	maxPrice := money.NewAmount(util.MaxPrice, 0)
+	for range 1000 {
+		price := util.RandomPrice()
+		assert.Positive(t, price.Sign(), "price %s", price)
+		assert.LessOrEqual(t, price.Cmp(maxPrice), 0, "price %s", price)
+		assert.LessOrEqual(t, price.DecimalPlaces(), int32(2), "price %s", price)
+	}
+}
+
+func TestCalculateTotalAmount(t *testing.T) {
+	products := []data.Product{
+		{Price: money.MustParseAmount("0.1"), Quantity: 3},
+		{Price: money.MustParseAmount("19.99"), Quantity: 2},
+	}
+	assert.Equal(t, "40.28", util.CalculateTotalAmount(products, "USD").String())
+	assert.Equal(t, "40", util.CalculateTotalAmount(products, "JPY").String())
+	halves := []data.Product{{Price: money.MustParseAmount("1.25"), Quantity: 2}}
+	assert.Equal(t, "2", util.CalculateTotalAmount(halves, "JPY").String(), "2.5 is rounded half to even")
+	assert.Equal(t, "0.00", util.CalculateTotalAmount(nil, "USD").String())
+}
@@ -1,113 +1,128 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/derickit/go-rest-api/internal/db"
 	"github.com/derickit/go-rest-api/internal/logger"
 	"github.com/derickit/go-rest-api/internal/models"
 	"github.com/derickit/go-rest-api/internal/server"
+	"github.com/derickit/go-rest-api/internal/tracing"
 	"github.com/derickit/go-rest-api/internal/util"
 )
 
 const (
 	serviceName = "ecommerce-orders"
-	defaultPort = "8080"
+	// how long pending spans may take to be exported on shutdown
+	tracingFlushTimeout = 5 * time.Second
 )
 
-var version string
+// set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   string
+	commit    string
+	buildDate string
+)
 
 func main() {
-	fmt.Println("Hello, World!")
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
 
+// connectDB connects to the database configured by svcEnv.
+func connectDB(svcEnv models.ServiceEnv, lgr *logger.AppLogger) (*db.ConnectionManager, error) {
+	dbCredentials, err := db.MongoDBCredentialFromSideCar(svcEnv.MongoVaultSideCar)
+	if err != nil {
+		lgr.Error().Err(err).Msg("failed to fetch db credentials")
+		return nil, err
+	}
+	connOpts := &db.ConnectionOpts{
+		Database:          svcEnv.DBName,
+		PrintQueries:      svcEnv.PrintQueries,
+		ConnectionTimeout: svcEnv.DBConnectionTimeout,
+	}
+	dbConnMgr, err := db.NewMongoManager(dbCredentials, connOpts, lgr)
+	if err != nil {
+		lgr.Error().Err(err).Msg("unable to initialize db connection")
+		return nil, err
+	}
+	return dbConnMgr, nil
 }
 
-func run() error {
+func run(svcEnv models.ServiceEnv) error {
 	upTime := time.Now().UTC().Format(time.RFC3339)
 	sigHandler := util.NewSignalHandler()
 
-	svcEnv := MustEnvConfig()
-
+	svcEnv.ServiceName, svcEnv.Version = serviceName, buildVersion()
 	lgr := logger.Setup(svcEnv)
-	dbCredentials, err := db.MongoDBCredentialFromSideCar(svcEnv.MongoVaultSideCar)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Opts{
+		Exporter:    svcEnv.TraceExporter,
+		Endpoint:    svcEnv.TraceEndpoint,
+		SampleRatio: svcEnv.TraceSampleRatio,
+		ServiceName: svcEnv.ServiceName,
+		Version:     svcEnv.Version,
+		Environment: svcEnv.Name,
+	})
 	if err != nil {
-		lgr.Fatal().Err(err).Msg("failed to fetch db credentials")
+		lgr.Error().Err(err).Msg("unable to set up tracing")
 		return err
 	}
-	connOpts := &db.ConnectionOpts{
-		Database:     svcEnv.DBName,
-		PrintQueries: svcEnv.PrintQueries,
-	}
-
-	dbConnMgr, err := db.NewMongoManager(dbCredentials, connOpts, lgr)
+	sigHandler.OnSignal(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if tErr := shutdownTracing(ctx); tErr != nil {
+			lgr.Error().Err(tErr).Msg("unable to flush traces")
+		}
+	})
+	dbConnMgr, err := connectDB(svcEnv, lgr)
 	if err != nil {
-		lgr.Fatal().Err(err).Msg("unable to initialize db connection")
+		sigHandler.RunDeferred()
 		return err
 	}
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	if svcEnv.SideCarPollInterval > 0 {
+		go dbConnMgr.WatchSideCar(watchCtx, &db.ReloadOpts{
+			SideCarFile:  svcEnv.MongoVaultSideCar,
+			PollInterval: svcEnv.SideCarPollInterval,
+			DrainTimeout: svcEnv.ShutdownTimeout,
+		})
+	}
 	sigHandler.OnSignal(func() {
+		stopWatching()
 		dErr := dbConnMgr.Disconnect()
 		if dErr != nil {
 			lgr.Error().Err(dErr).Msg("unable to disconnect from db ,potential connection leak")
 			return
 		}
 	})
-
-	lgr.Info().Str("name", serviceName).Str("environment", svcEnv.Name).
-		Str("started", upTime).Str("version", version).Msg("service details starting the service")
-
-	server.StartService(svcEnv, dbConnMgr, lgr)
-	lgr.Fatal().Msg("service stopped")
-	return nil
-}
-
-func MustEnvConfig() models.ServiceEnv {
-	envName := os.Getenv("environment")
-	if envName == "" {
-		envName = "local"
-	}
-
-	port := os.Getenv("port")
-	if port == "" {
-		port = defaultPort
-	}
-
-	dbName := os.Getenv("dbName")
-	if dbName == "" {
-		panic("dbName  should be defined in env configuration ")
-
+	indexCtx, cancel := context.WithTimeout(context.Background(), svcEnv.DBConnectionTimeout)
+	defer cancel()
+	if err = db.NewOrderRepo(dbConnMgr.Database(), lgr).EnsureIndexes(indexCtx); err != nil {
+		lgr.Error().Err(err).Msg("unable to create db indexes")
+		sigHandler.RunDeferred()
+		return err
 	}
-
-	printDBQueries, err := strconv.ParseBool(os.Getenv("printDBQueries"))
-	if err != nil {
-		printDBQueries = false
+	if err = db.NewIdempotencyRepo(dbConnMgr.Database(), lgr).EnsureIndexes(indexCtx); err != nil {
+		lgr.Error().Err(err).Msg("unable to create db indexes")
+		sigHandler.RunDeferred()
+		return err
 	}
-
-	mongoSideCar := os.Getenv("mongoSideCar")
-	if mongoSideCar == "" {
-		panic("mongo sidecar file path should be defined in env configuration")
+	if err = db.NewCouponsRepo(dbConnMgr.Database(), lgr).EnsureIndexes(indexCtx); err != nil {
+		lgr.Error().Err(err).Msg("unable to create db indexes")
+		sigHandler.RunDeferred()
+		return err
 	}
-
-	disableAuth, authEnvErr := strconv.ParseBool(os.Getenv("disableAuth"))
-	if authEnvErr != nil {
-		disableAuth = false
+	if err = db.NewCustomersRepo(dbConnMgr.Database(), lgr).EnsureIndexes(indexCtx); err != nil {
+		lgr.Error().Err(err).Msg("unable to create db indexes")
+		sigHandler.RunDeferred()
+		return err
 	}
 
-	logLevel := os.Getenv("logLevel")
-	if logLevel == "" {
-		logLevel = "info"
-	}
+	lgr.Info().Str("name", serviceName).Str("environment", svcEnv.Name).
+		Str("started", upTime).Str("version", svcEnv.Version).Msg("service details starting the service")
 
-	envConfigurations := models.ServiceEnv{
-		Name:              envName,
-		Port:              port,
-		PrintQueries:      printDBQueries,
-		MongoVaultSideCar: mongoSideCar,
-		DisableAuth:       disableAuth,
-		DBName:            dbName,
-		LogLevel:          logLevel,
-	}
-	return envConfigurations
+	err = server.StartService(svcEnv, dbConnMgr, sigHandler, lgr)
+	lgr.Info().Err(err).Msg("service stopped")
+	return err
 }
@@ -1,78 +1,165 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/derickit/go-rest-api/internal/config"
+	"github.com/derickit/go-rest-api/internal/handlers"
+	"github.com/derickit/go-rest-api/internal/middleware"
 	"github.com/derickit/go-rest-api/internal/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestMustEnvConfig(t *testing.T) {
-	t.Run("MissingEnvVariables", func(t *testing.T) {
-		resetEnv(t)
-		assert.Panics(t, func() {
-			_ = MustEnvConfig()
+func loadConfig(t *testing.T, args ...string) (models.ServiceEnv, error) {
+	t.Helper()
+	fs, load := newFlagSet("test")
+	require.NoError(t, fs.Parse(args))
+	return load()
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
 
-		}, "MustEnvConfig did not panic with missing environment variables")
+func TestLoadConfig(t *testing.T) {
+	t.Run("MissingValuesAreReportedTogether", func(t *testing.T) {
+		resetEnv(t)
+		_, err := loadConfig(t)
+		require.ErrorIs(t, err, config.ErrInvalidConfig)
+		assert.Contains(t, err.Error(), "dbName")
+		assert.Contains(t, err.Error(), "mongoSideCar")
+		assert.Contains(t, err.Error(), "jwksSource")
 	})
 	t.Run("ValidEnvVariables", func(t *testing.T) {
 		resetEnv(t)
-		t.Setenv("environment", "test")
-		t.Setenv("port", "8080")
-		t.Setenv("dbName", "testDB")
-		t.Setenv("MongoVaultSideCar", "/path/to/mongo/sidecar")
-		t.Setenv("logLevel", "debug")
+		t.Setenv("ORDERS_ENVIRONMENT", "test")
+		t.Setenv("ORDERS_PORT", "8081")
+		t.Setenv("ORDERS_DB_NAME", "testDB")
+		t.Setenv("ORDERS_MONGO_SIDECAR", "/path/to/mongo/sidecar")
+		t.Setenv("ORDERS_LOG_LEVEL", "debug")
+		t.Setenv("ORDERS_DISABLE_AUTH", "true")
 
-		expectedConfig := models.ServiceEnv{
-			Name:              "test",
-			Port:              "8080",
-			PrintQueries:      false,
-			MongoVaultSideCar: "/path/to/mongo/sidecar",
-			DisableAuth:       false,
-			DBName:            "testDB",
-			LogLevel:          "debug",
-		}
-		actualConfig := MustEnvConfig()
-		assert.Equal(t, expectedConfig, actualConfig, "MustEnvConfig did not return the expected configuration")
+		expectedConfig := config.Defaults()
+		expectedConfig.Name = "test"
+		expectedConfig.Port = "8081"
+		expectedConfig.DBName = "testDB"
+		expectedConfig.MongoVaultSideCar = "/path/to/mongo/sidecar"
+		expectedConfig.LogLevel = "debug"
+		expectedConfig.DisableAuth = true
+		actualConfig, err := loadConfig(t)
+		require.NoError(t, err)
+		assert.Equal(t, expectedConfig, actualConfig)
 	})
 }
 
-func TestMustEnvConfig_Default(t *testing.T) {
-	t.Run("Default Env Values", func(t *testing.T) {
-		resetEnv(t)
+func TestLoadConfig_Default(t *testing.T) {
+	resetEnv(t)
+	actualConfig, err := loadConfig(t, "--db-name", "testDB", "--mongo-sidecar", "/path/to/mongo/sidecar", "--disable-auth")
+	require.NoError(t, err)
+	assert.Equal(t, "local", actualConfig.Name)
+	assert.Equal(t, "8080", actualConfig.Port)
+	assert.Equal(t, "info", actualConfig.LogLevel)
+	assert.Equal(t, 10*time.Second, actualConfig.DBConnectionTimeout)
+	assert.Equal(t, handlers.MaxPageSize, actualConfig.MaxPageSize)
+	assert.Equal(t, handlers.DefSeedRecordCount, actualConfig.SeedRecordCount)
+	assert.Equal(t, -1, actualConfig.GzipLevel)
+	assert.Equal(t, middleware.DefSecurityHeaders, actualConfig.SecurityHeaders)
+}
 
-		expectedConfig := models.ServiceEnv{
-			Name:              "test",
-			Port:              defaultPort,
-			PrintQueries:      false,
-			MongoVaultSideCar: "/path/to/mongo/sidecar",
-			DisableAuth:       false,
-			DBName:            "testDB",
-			LogLevel:          "info",
-		}
-		actualConfig := MustEnvConfig()
-		assert.Equal(t, expectedConfig, actualConfig, "MustEnvConfig did not return the expected configuration")
-	})
+func TestLoadConfig_Precedence(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+port: 9000
+dbName: fileDB
+mongoSideCar: /file/sidecar
+logLevel: warn
+maxPageSize: 50
+disableAuth: true
+securityHeaders:
+  X-Frame-Options: DENY
+`,
+		"config.toml": `
+port = "9000"
+dbName = "fileDB"
+mongoSideCar = "/file/sidecar"
+logLevel = "warn"
+maxPageSize = 50
+disableAuth = true
+
+[securityHeaders]
+X-Frame-Options = "DENY"
+`,
+		"config.json": `{
+  "port": 9000,
+  "dbName": "fileDB",
+  "mongoSideCar": "/file/sidecar",
+  "logLevel": "warn",
+  "maxPageSize": 50,
+  "disableAuth": true,
+  "securityHeaders": {"X-Frame-Options": "DENY"}
+}`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			resetEnv(t)
+			file := writeConfigFile(t, name, content)
+			t.Setenv("ORDERS_DB_NAME", "envDB")
+			t.Setenv("ORDERS_LOG_LEVEL", "debug")
+			t.Setenv("ORDERS_SECURITY_HEADERS", `{"Content-Security-Policy":""}`)
+
+			svcEnv, err := loadConfig(t, "--config", file, "--log-level", "error")
+			require.NoError(t, err)
+			assert.Equal(t, "9000", svcEnv.Port, "file overrides defaults")
+			assert.Equal(t, 50, svcEnv.MaxPageSize, "file overrides defaults")
+			assert.Equal(t, "/file/sidecar", svcEnv.MongoVaultSideCar)
+			assert.Equal(t, "envDB", svcEnv.DBName, "env overrides file")
+			assert.Equal(t, "error", svcEnv.LogLevel, "flags override env and file")
+			assert.Equal(t, "DENY", svcEnv.SecurityHeaders["X-Frame-Options"], "file headers are merged with the defaults")
+			assert.Equal(t, "", svcEnv.SecurityHeaders["Content-Security-Policy"], "env headers are merged with the file")
+			assert.Equal(t, middleware.DefSecurityHeaders["X-XSS-Protection"], svcEnv.SecurityHeaders["X-XSS-Protection"])
+		})
+	}
 }
 
-func TestMustEnvConfig_FailOnSideCar(t *testing.T) {
-	t.Run("Fail on MongoSide Car", func(t *testing.T) {
-		resetEnv(t)
-		t.Setenv("environment", "test")
-		t.Setenv("dbName", "testDB")
-		assert.Panics(t, func() {
-			_ = MustEnvConfig()
+func TestLoadConfig_FileFromEnv(t *testing.T) {
+	resetEnv(t)
+	t.Setenv(config.FileEnv, writeConfigFile(t, "config.yml", "dbName: fileDB\nmongoSideCar: /file/sidecar\njwksSource: /jwks.json\n"))
+	svcEnv, err := loadConfig(t)
+	require.NoError(t, err)
+	assert.Equal(t, "fileDB", svcEnv.DBName)
+	assert.Equal(t, "/jwks.json", svcEnv.JWKSSource)
+}
 
-		}, "MustEnvConfig did not panic with missing mongo sidecar")
-	})
+func TestLoadConfig_InvalidValues(t *testing.T) {
+	resetEnv(t)
+	file := writeConfigFile(t, "config.yaml", "dbName: fileDB\nmongoSideCar: /file/sidecar\ndisableAuth: true\nunknownKey: 1\n")
+	t.Setenv("ORDERS_PORT", "http")
+	t.Setenv("ORDERS_SHUTDOWN_TIMEOUT", "30")
+	_, err := loadConfig(t, "--config", file, "--gzip-level", "11", "--max-page-size", "0")
+	require.ErrorIs(t, err, config.ErrInvalidConfig)
+	for _, want := range []string{"unknownKey", "ORDERS_SHUTDOWN_TIMEOUT", "port", "gzipLevel", "maxPageSize"} {
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.Len(t, strings.Split(err.Error(), "\n"), 6, "every problem should be reported")
 }
 
+// resetEnv clears every variable read by config.Load for the duration of the test.
 func resetEnv(t *testing.T) {
-	t.Setenv("environment", "")
-	t.Setenv("port", "")
-	t.Setenv("logLevel", "")
-	t.Setenv("dbName", "")
-	t.Setenv("MongoVaultSideCar", "")
-	t.Setenv("printDBQueries", "")
-
+	t.Helper()
+	vars := []string{config.FileEnv}
+	for _, s := range config.Settings {
+		vars = append(vars, s.Env)
+	}
+	for _, v := range vars {
+		t.Setenv(v, "")
+		require.NoError(t, os.Unsetenv(v))
+	}
 }